@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/mjibson/go-dsp/fft"
+)
+
+// Lag returns the number of frames t is late against ref, at most
+// maxLag either way: the lag at which the cross-correlation of their
+// mono sums peaks. A negative lag means t is early.
+func (t *Tape) Lag(ref *Tape, maxLag int) int {
+	a, b := ref.monoSum().samples, t.monoSum().samples
+	size := 1
+	for size < len(a)+len(b) {
+		size *= 2
+	}
+	x := make([]float64, size)
+	y := make([]float64, size)
+	copy(x, a)
+	copy(y, b)
+	X := fft.FFTReal(x)
+	Y := fft.FFTReal(y)
+	for k := range X {
+		X[k] = complex(real(X[k]), -imag(X[k])) * Y[k]
+	}
+	// corr[k] is the sum of a[i]*b[i+k], negative k wrapping around
+	corr := fft.IFFT(X)
+	maxLag = min(maxLag, size/2-1)
+	best, bestScore := 0, math.Inf(-1)
+	for k := -maxLag; k <= maxLag; k++ {
+		score := real(corr[(k+size)%size])
+		if score > bestScore || (score == bestScore && abs(k) < abs(best)) {
+			best, bestScore = k, score
+		}
+	}
+	return best
+}
+
+// Advanced returns a copy of t moved earlier by n frames (later for
+// negative n), keeping its length. Unlike Shift, it does not rotate:
+// frames moved out of it are dropped, the gap is silent.
+func (t *Tape) Advanced(n int) *Tape {
+	nc := t.nchannels
+	out := makeTape(nc, t.nframes)
+	if n >= 0 {
+		if n < t.nframes {
+			copy(out.samples, t.samples[n*nc:])
+		}
+	} else if -n < t.nframes {
+		copy(out.samples[-n*nc:], t.samples)
+	}
+	return out
+}
+
+// alignMaxLag returns :align/max in frames.
+func alignMaxLag(vm *VM) (int, error) {
+	seconds, err := vm.GetFloat(":align/max")
+	if err != nil {
+		return 0, err
+	}
+	if seconds < 0 {
+		return 0, fmt.Errorf(":align/max must not be negative, got %v", seconds)
+	}
+	return int(seconds * float64(SampleRate())), nil
+}
+
+func init() {
+	RegisterGoMethod[*Tape]("align", func(vm *VM, t, ref *Tape) (*Tape, error) {
+		maxLag, err := alignMaxLag(vm)
+		if err != nil {
+			return nil, err
+		}
+		return t.Advanced(t.Lag(ref, maxLag)), nil
+	})
+	RegisterGoMethod[*Tape]("align/lag", func(vm *VM, t, ref *Tape) (int, error) {
+		maxLag, err := alignMaxLag(vm)
+		if err != nil {
+			return 0, err
+		}
+		return t.Lag(ref, maxLag), nil
+	})
+}
@@ -1,16 +1,17 @@
+//go:build cgo && !js
+
 package main
 
 import (
 	"bytes"
-	"embed"
 	"errors"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/go-gl/glfw/v3.3/glfw"
 )
 
-//go:embed assets/*
-var assets embed.FS
-
 // Event is the type of callback functions sent to the app's events channel
 type Event func()
 
@@ -21,28 +22,39 @@ const (
 	fontSizeStep    FontSizeInPoints = 1
 )
 
+// hotSwapFade is the length of the crossfade from a playing result to
+// the new one in hot-swap mode.
+const hotSwapFade = 100 * time.Millisecond
+
 type App struct {
 	vm                *VM
 	shouldExit        bool
-	font              *Font
+	fonts             []*Font // primary font first, then fallbacks
 	fontSize          FontSizeInPoints
 	tm                *TileMap
 	ts                *TileScreen
+	textMode          bool // rendering to a terminal instead of GL
 	bm                *BufferManager
 	screens           map[string]Screen
 	currentScreenName string
 	currentScreen     Screen
 	currentPrompt     *Prompt
-	oto               *OtoState
-	// rTape points to the currently rendered tape
-	rTape             *Tape
-	rTotalFrames      int
-	rDoneFrames       int
+	audio             *AudioState
+	journal           *Journal
+	viewStates        *ViewStateStore
+	slots             []*EvalSlot
+	replSlot          *EvalSlot
+	tutorialSlot      *EvalSlot
 	globalKeyMap      KeyMap
 	currentKeyHandler KeyHandler
 	chordHandler      KeyHandler
 	events            chan Event
 	lastError         error
+	hotSwap           bool // C-x h: crossfade playing results to the new ones of their buffers
+	mouse             mouseState
+	// prelude file watched in dev mode
+	preludeCheckTime time.Time
+	preludeModTime   time.Time
 }
 
 func (app *App) SetLastError(err error) {
@@ -54,16 +66,12 @@ func (app *App) ClearLastError() {
 }
 
 func (app *App) reloadFont() error {
-	face, err := app.font.GetFace(app.fontSize, contentScale)
-	if err != nil {
-		return err
+	if app.textMode {
+		// the terminal decides about fonts
+		return nil
 	}
 	sizeInTiles := Size{X: 16, Y: 32}
-	faceImage, err := app.font.GetFaceImage(face, sizeInTiles)
-	if err != nil {
-		return err
-	}
-	tm, err := CreateTileMap(faceImage, sizeInTiles)
+	tm, err := CreateTileMap(app.fonts, app.fontSize, contentScale, sizeInTiles)
 	if err != nil {
 		return err
 	}
@@ -135,11 +143,15 @@ func (app *App) Init() error {
 	if app.events == nil {
 		app.events = make(chan Event, 1024)
 	}
-	oto, err := NewOtoState(SampleRate())
-	if err != nil {
-		return err
+	// Init runs again when falling back from GL to the terminal, but
+	// the audio context can only be created once per process.
+	if app.audio == nil {
+		audio, err := sharedAudioState()
+		if err != nil {
+			return err
+		}
+		app.audio = audio
 	}
-	app.oto = oto
 	fontBytes, err := assets.ReadFile("assets/DroidSansMono.ttf")
 	if err != nil {
 		return err
@@ -148,7 +160,26 @@ func (app *App) Init() error {
 	if err != nil {
 		return err
 	}
-	app.font = font
+	app.fonts = append([]*Font{font}, LoadFallbackFonts(flags.FallbackFonts)...)
+	if flags.Journal != "" && app.journal == nil {
+		journal, err := OpenJournal(flags.Journal)
+		if err != nil {
+			logger.Warn("cannot open journal, evaluations will not be recorded", "path", flags.Journal, "error", err)
+		} else {
+			app.journal = journal
+		}
+	}
+	if flags.ViewState != "" && app.viewStates == nil {
+		viewStates, err := OpenViewStateStore(flags.ViewState)
+		if err != nil {
+			logger.Warn("cannot load view states", "path", flags.ViewState, "error", err)
+		} else {
+			app.viewStates = viewStates
+			for _, buf := range app.bm.buffers {
+				app.restoreViewState(buf)
+			}
+		}
+	}
 	app.fontSize = defaultFontSize
 	if err := app.reloadFont(); err != nil {
 		return err
@@ -159,22 +190,54 @@ func (app *App) Init() error {
 		return err
 	}
 
+	if flags.Keys != "" {
+		if err := LoadKeyConfig(flags.Keys); err != nil {
+			logger.Warn("cannot load key bindings, using the defaults", "error", err)
+		}
+	}
 	globalKeyMap := CreateKeyMap()
-	globalKeyMap.Bind("C-g", app.Reset)
-	globalKeyMap.Bind("Escape", app.Reset)
-	globalKeyMap.Bind("C-q", app.Quit)
-	globalKeyMap.Bind("C-S-=", app.IncreaseFontSize)
-	globalKeyMap.Bind("C--", app.DecreaseFontSize)
-	globalKeyMap.Bind("C-0", app.ResetFontSize)
-	globalKeyMap.Bind("F1", func() {
+	globalKeyMap.BindAction("global.reset", "C-g", app.Reset)
+	globalKeyMap.BindAction("global.reset", "Escape", app.Reset)
+	globalKeyMap.BindAction("global.quit", "C-q", app.Quit)
+	globalKeyMap.BindAction("global.font-bigger", "C-S-=", app.IncreaseFontSize)
+	globalKeyMap.BindAction("global.font-smaller", "C--", app.DecreaseFontSize)
+	globalKeyMap.BindAction("global.font-reset", "C-0", app.ResetFontSize)
+	globalKeyMap.BindAction("global.cancel-all", "M-g", app.CancelAll)
+	globalKeyMap.BindAction("global.pause", "F9", func() {
+		if slot := app.currentSlot(); slot != nil {
+			slot.TogglePause()
+		}
+	})
+	globalKeyMap.BindAction("global.stop-recording", "F10", func() {
+		StopRecording()
+	})
+	globalKeyMap.BindAction("global.help", "F1", func() {
 		app.SelectScreen("help")
 	})
-	globalKeyMap.Bind("F2", func() {
+	globalKeyMap.BindAction("global.edit", "F2", func() {
 		app.SelectScreen("edit")
 	})
-	globalKeyMap.Bind("F3", func() {
+	globalKeyMap.BindAction("global.files", "F3", func() {
 		app.SelectScreen("file")
 	})
+	globalKeyMap.BindAction("global.journal", "F4", func() {
+		app.SelectScreen("journal")
+	})
+	globalKeyMap.BindAction("global.scope", "F5", func() {
+		app.SelectScreen("scope")
+	})
+	globalKeyMap.BindAction("global.repl", "F6", func() {
+		app.SelectScreen("repl")
+	})
+	globalKeyMap.BindAction("global.inspect", "F7", func() {
+		app.SelectScreen("inspect")
+	})
+	globalKeyMap.BindAction("global.tutorial", "F8", func() {
+		app.SelectScreen("tutorial")
+	})
+	globalKeyMap.BindAction("global.gallery", "F11", func() {
+		app.SelectScreen("gallery")
+	})
 	app.globalKeyMap = globalKeyMap
 
 	helpScreen, err := CreateHelpScreen(app, string(helpBytes))
@@ -192,22 +255,65 @@ func (app *App) Init() error {
 		return err
 	}
 
-	app.screens = map[string]Screen{
-		"help": helpScreen,
-		"edit": editScreen,
-		"file": fileScreen,
+	journalScreen, err := CreateJournalScreen(app)
+	if err != nil {
+		return err
 	}
-	app.SelectScreen("edit")
 
-	app.vm.tapeProgressCallback = func(t *Tape, nftotal, nfdone int) {
-		app.postEvent(func() {
-			if app.vm.IsEvaluating() {
-				app.rTape = t
-				app.rTotalFrames = nftotal
-				app.rDoneFrames = nfdone
-			}
-		}, true)
+	scopeScreen, err := CreateScopeScreen(app)
+	if err != nil {
+		return err
+	}
+
+	if app.replSlot == nil {
+		replSlot, err := app.createEvalSlot("*repl*", nil)
+		if err != nil {
+			return err
+		}
+		app.replSlot = replSlot
+	}
+	replScreen, err := CreateReplScreen(app)
+	if err != nil {
+		return err
+	}
+
+	inspectScreen, err := CreateInspectScreen(app)
+	if err != nil {
+		return err
+	}
+
+	if app.tutorialSlot == nil {
+		tutorialSlot, err := app.createEvalSlot("*tutorial*", nil)
+		if err != nil {
+			return err
+		}
+		app.tutorialSlot = tutorialSlot
+	}
+	tutorialScreen, err := CreateTutorialScreen(app)
+	if err != nil {
+		return err
 	}
+
+	galleryScreen, err := CreateGalleryScreen(app)
+	if err != nil {
+		return err
+	}
+
+	app.screens = map[string]Screen{
+		"help":     helpScreen,
+		"edit":     editScreen,
+		"file":     fileScreen,
+		"journal":  journalScreen,
+		"scope":    scopeScreen,
+		"repl":     replScreen,
+		"inspect":  inspectScreen,
+		"tutorial": tutorialScreen,
+		"gallery":  galleryScreen,
+	}
+	for _, action := range unknownKeyActions() {
+		logger.Warn("key bindings: unknown action", "action", action)
+	}
+	app.SelectScreen("edit")
 	return nil
 }
 
@@ -318,6 +424,11 @@ func (app *App) OnKey(key glfw.Key, scancode int, action glfw.Action, modes glfw
 	if modes&glfw.ModControl != 0 {
 		keyName = "C-" + keyName
 	}
+	app.dispatchKey(keyName)
+}
+
+// dispatchKey handles a key press, keeping track of key chords.
+func (app *App) dispatchKey(keyName Key) {
 	nextHandler, handled := app.HandleKey(keyName)
 	if handled {
 		app.postEvent(func() {
@@ -387,11 +498,17 @@ func (app *App) Render() error {
 	app.currentScreen.Render(app, ts)
 	screenPane := ts.GetPane()
 	if err := app.lastError; err != nil {
+		// the message with the traceback below it, using at most half
+		// of the screen
+		lines := strings.Split(formatError(err), "\n")
+		lines = lines[:min(len(lines), max(screenPane.Height()/2, 1))]
 		if screenPane.Height() > 0 {
-			_, statusPane := screenPane.SplitY(-1)
+			_, statusPane := screenPane.SplitY(float64(-len(lines)))
 			statusPane.WithFgBg(ColorWhite, ColorRed, func() {
 				statusPane.Clear()
-				statusPane.DrawString(0, 0, err.Error())
+				for y, line := range lines {
+					statusPane.DrawString(0, y, line)
+				}
 			})
 		}
 	}
@@ -416,38 +533,208 @@ func (app *App) drainEvents() {
 
 func (app *App) Update() error {
 	app.drainEvents()
+	if flags.Dev {
+		app.watchPrelude()
+	}
+	if es, ok := app.screens["edit"].(*EditScreen); ok {
+		es.updateAutoEval()
+	}
 	return nil
 }
 
-func (app *App) evalBuffer(buffer *Buffer, evalSuccessCallback func()) {
+// reloadPrelude re-evaluates the prelude into the root env.
+func (app *App) reloadPrelude() {
+	if app.isEvaluating() {
+		app.SetLastError(errors.New("cannot reload the prelude during evaluation"))
+		return
+	}
+	if err := app.vm.LoadPrelude(); err != nil {
+		app.SetLastError(err)
+		return
+	}
+	if err := reapplyEnvOverrides(app.vm); err != nil {
+		app.SetLastError(err)
+		return
+	}
+	app.ClearLastError()
+	logger.Info("prelude reloaded")
+}
+
+// watchPrelude reloads the prelude when its file or one of its layers
+// has changed. It is called every frame, but looks at the files only
+// twice a second.
+func (app *App) watchPrelude() {
+	now := time.Now()
+	if now.Sub(app.preludeCheckTime) < 500*time.Millisecond {
+		return
+	}
+	app.preludeCheckTime = now
+	if flags.Prelude == "" {
+		if !fileExists(defaultPreludePath) {
+			return
+		}
+		flags.Prelude = defaultPreludePath
+	}
+	var modTime time.Time
+	for _, path := range preludeFiles() {
+		if info, err := os.Stat(path); err == nil && info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+	}
+	if modTime.Equal(app.preludeModTime) || app.isEvaluating() {
+		return
+	}
+	app.preludeModTime = modTime
+	app.reloadPrelude()
+}
+
+// evalBuffer evaluates buffer in its slot, cancelling the evaluation
+// running there. Evaluations in the slots of other buffers go on.
+func (app *App) evalBuffer(buffer *Buffer, evalSuccessCallback func(slot *EvalSlot)) {
 	if app.currentScreenName != "edit" {
 		return
 	}
-	app.Reset()
+	slot, err := app.ensureBufferSlot(buffer)
+	if err != nil {
+		app.SetLastError(err)
+		return
+	}
+	if app.hotSwap {
+		// playback goes on and switches over to the new result
+		slot.Cancel()
+		app.ClearLastError()
+	} else {
+		app.Reset()
+	}
+	app.startEval(slot, buffer, true, evalSuccessCallback)
+}
+
+// autoEvalBuffer evaluates buffer after it has been edited in auto-eval
+// mode. Unlike evalBuffer, it leaves playback, the mark and the point
+// alone.
+func (app *App) autoEvalBuffer(buffer *Buffer) {
+	slot, err := app.ensureBufferSlot(buffer)
+	if err != nil {
+		app.SetLastError(err)
+		return
+	}
+	slot.Cancel()
+	if bytes.Equal(buffer.Data, slot.lastScript) {
+		return
+	}
+	app.ClearLastError()
+	app.startEval(slot, buffer, false, nil)
+}
+
+// startEval starts the evaluation of buffer in slot. If showError is
+// true, the point is moved to where the evaluation failed.
+func (app *App) startEval(slot *EvalSlot, buffer *Buffer, showError bool, evalSuccessCallback func(slot *EvalSlot)) {
 	tapePath := "<temp-tape>"
 	if buffer.HasPath() {
 		tapePath = buffer.Path
 	}
+	script := buffer.Data
+	vm := slot.vm
+	prevResult, _ := vm.evalResult.(*Tape)
 	go func() {
-		if err := app.vm.ParseAndEval(bytes.NewReader(buffer.Data), tapePath); err != nil {
+		start := time.Now()
+		err := vm.ParseAndEval(bytes.NewReader(script), tapePath)
+		result := vm.evalResult
+		app.postEvent(func() {
+			app.recordEvaluation(buffer.Name, script, start, result, err)
+		}, false)
+		if err != nil {
 			if !errors.Is(err, ErrEvalCancelled) {
 				app.postEvent(func() {
 					app.SetLastError(err)
+					if es, ok := app.screens["edit"].(*EditScreen); ok && showError {
+						es.showEvalError(buffer, script, tapePath, err)
+					}
 				}, false)
 			}
 			return
 		}
 		app.postEvent(func() {
-			app.rTape = nil
-			app.rTotalFrames = 0
-			app.rDoneFrames = 0
-			if evalSuccessCallback != nil {
-				evalSuccessCallback()
+			slot.resetRenderProgress()
+			slot.lastScript = script
+			swapped := false
+			if app.hotSwap {
+				newResult, _ := result.(*Tape)
+				swapped = app.audio.HotSwap(prevResult, newResult, int(hotSwapFade.Seconds()*float64(SampleRate())), slot.vm.resultDownmix)
+			}
+			if evalSuccessCallback != nil && !swapped {
+				evalSuccessCallback(slot)
 			}
 		}, false)
 	}()
 }
 
+// Inspect shows v on the inspect screen.
+func (app *App) Inspect(v Val) {
+	if is, ok := app.screens["inspect"].(*InspectScreen); ok {
+		is.SetValue(v)
+		app.SelectScreen("inspect")
+	}
+}
+
+// playingMorph returns the morph position the last oscillator run over
+// wt was at in the frame being played.
+func (app *App) playingMorph(wt *Wavetable) (float64, bool) {
+	player := app.audio.CurrentTapePlayer()
+	if player == nil {
+		return 0, false
+	}
+	_, frame := player.currentTapeFrame()
+	return wt.morphAt(frame)
+}
+
+// recordEvaluation appends an entry to the session journal (if enabled).
+func (app *App) recordEvaluation(name string, script []byte, start time.Time, result Val, evalErr error) {
+	if app.journal == nil {
+		return
+	}
+	if err := app.journal.Record(name, script, start, result, evalErr); err != nil {
+		logger.Warn("cannot write journal entry", "error", err)
+		return
+	}
+	if js, ok := app.screens["journal"].(*JournalScreen); ok {
+		js.Reload()
+	}
+}
+
+// restoreViewState applies the view state saved for the file behind buf.
+func (app *App) restoreViewState(buf *Buffer) {
+	if app.viewStates == nil || !buf.HasPath() {
+		return
+	}
+	if state, ok := app.viewStates.Get(buf.Path); ok {
+		buf.SetViewState(state)
+	}
+}
+
+// rememberViewState records the view state of buf for the next session.
+func (app *App) rememberViewState(buf *Buffer) {
+	if app.viewStates == nil || !buf.HasPath() {
+		return
+	}
+	app.viewStates.Put(buf.Path, buf.ViewState())
+}
+
+func (app *App) saveViewStates() {
+	if app.viewStates == nil {
+		return
+	}
+	if es, ok := app.screens["edit"].(*EditScreen); ok {
+		es.syncEditorToBuffer()
+	}
+	for _, buf := range app.bm.buffers {
+		app.rememberViewState(buf)
+	}
+	if err := app.viewStates.Save(); err != nil {
+		logger.Warn("cannot save view states", "error", err)
+	}
+}
+
 func (app *App) OpenPrompt(prompt *Prompt) {
 	app.currentPrompt = prompt
 }
@@ -456,16 +743,15 @@ func (app *App) ClosePrompt() {
 	app.currentPrompt = nil
 }
 
+// Reset cancels the evaluation of the current slot (see currentSlot)
+// and resets transient state.
 func (app *App) Reset() {
-	if app.vm.IsEvaluating() {
-		app.vm.CancelEvaluation()
+	if slot := app.currentSlot(); slot != nil {
+		slot.Cancel()
 	}
-	app.rTape = nil
-	app.rTotalFrames = 0
-	app.rDoneFrames = 0
 	app.ClearLastError()
 	app.drainEvents()
-	app.oto.StopAllPlayers()
+	app.audio.StopAllPlayers()
 	for _, screen := range app.screens {
 		screen.Reset()
 	}
@@ -474,9 +760,13 @@ func (app *App) Reset() {
 
 func (app *App) Close() {
 	logger.Debug("Close")
+	app.saveViewStates()
+	app.CancelAll()
 	app.Reset()
 	app.ts.Close()
-	app.tm.Close()
+	if app.tm != nil {
+		app.tm.Close()
+	}
 	for _, screen := range app.screens {
 		screen.Close()
 	}
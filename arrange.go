@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// arrangeClip is a stream placed on a timeline.
+type arrangeClip struct {
+	start  int // in frames
+	stream Stream
+}
+
+// Arrange mixes clips into a single stream, each starting at its own
+// offset. The result has as many channels as the widest clip and ends
+// when all clips have ended; its length is known only if all clips are
+// finite.
+func Arrange(clips []arrangeClip) Stream {
+	nchannels := 1
+	nframes := 0
+	for _, c := range clips {
+		nchannels = max(nchannels, c.stream.nchannels)
+		if nframes >= 0 && c.stream.nframes > 0 {
+			nframes = max(nframes, c.start+c.stream.nframes)
+		} else {
+			nframes = -1
+		}
+	}
+	nframes = max(nframes, 0)
+	s := makeRewindableStream(nchannels, nframes, func() Stepper {
+		nexts := make([]Stepper, len(clips))
+		pending := len(clips)
+		playing := 0
+		frame := 0
+		out := make(Frame, nchannels)
+		return func() (Frame, bool) {
+			for i, c := range clips {
+				if c.start == frame {
+					nexts[i] = c.stream.WithNChannels(nchannels).clone().Next
+					pending--
+					playing++
+				}
+			}
+			if pending == 0 && playing == 0 {
+				return nil, false
+			}
+			clear(out)
+			for i, next := range nexts {
+				if next == nil {
+					continue
+				}
+				f, ok := next()
+				if !ok {
+					nexts[i] = nil
+					playing--
+					continue
+				}
+				for ch := range nchannels {
+					out[ch] += f[ch%len(f)]
+				}
+			}
+			if pending == 0 && playing == 0 {
+				return nil, false
+			}
+			frame++
+			return out, true
+		}
+	})
+	s.mix = &mixNode{op: AddOp(), any: true}
+	for _, c := range clips {
+		s.mix.parts = append(s.mix.parts, mixPart{c.start, c.stream})
+	}
+	return s
+}
+
+func init() {
+	RegisterWord("arrange", func(vm *VM) error {
+		items, err := Pop[Vec](vm)
+		if err != nil {
+			return err
+		}
+		tempo, pos, err := vm.tempo()
+		if err != nil {
+			return fmt.Errorf("arrange: %w", err)
+		}
+		clips := make([]arrangeClip, 0, len(items))
+		for i, item := range items {
+			pair, ok := item.(Vec)
+			if !ok || len(pair) != 2 {
+				return fmt.Errorf("arrange: item %d: expected [start clip] pair, got %T", i, item)
+			}
+			start, ok := pair[0].(Num)
+			if !ok || start < 0 {
+				return fmt.Errorf("arrange: item %d: start must be a non-negative number of beats", i)
+			}
+			s, err := streamFromVal(pair[1])
+			if err != nil {
+				return fmt.Errorf("arrange: item %d: %w", i, err)
+			}
+			clips = append(clips, arrangeClip{
+				start:  int(math.Round(tempo.Frames(pos, float64(start)))),
+				stream: s,
+			})
+		}
+		vm.Push(Arrange(clips))
+		return nil
+	})
+}
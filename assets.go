@@ -0,0 +1,11 @@
+package main
+
+import (
+	"embed"
+)
+
+//go:embed assets/*
+var assets embed.FS
+
+//go:embed examples/*.tape
+var exampleFiles embed.FS
@@ -0,0 +1,276 @@
+//go:build cgo && !js
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/ebitengine/oto/v3"
+)
+
+// audioPlayer plays the stereo float32 samples read from a TapeReader
+// on an audio backend.
+type audioPlayer interface {
+	Play()
+	Pause()
+	IsPlaying() bool
+	// BufferedSize returns the number of bytes read from the reader
+	// but not played yet.
+	BufferedSize() int
+	Close() error
+}
+
+// audioContext is an audio backend, selected with -audio.
+type audioContext interface {
+	NewPlayer(r io.Reader) audioPlayer
+}
+
+// audioInput is implemented by the audio backends which can record.
+type audioInput interface {
+	// Record captures nframes stereo frames from the input, or if
+	// nframes is 0, as many as it can until stop is closed. It also
+	// stops at the frames captured so far when stop is closed or when
+	// cancelled returns true.
+	Record(nframes int, stop <-chan struct{}, cancelled func() bool) (*Tape, error)
+}
+
+// otoContext plays through Oto, on the default device of the system.
+type otoContext struct {
+	*oto.Context
+}
+
+func newOtoContext(sampleRate int) (audioContext, error) {
+	otoContextOptions := &oto.NewContextOptions{
+		SampleRate:   sampleRate,
+		ChannelCount: 2,
+		Format:       oto.FormatFloat32LE,
+		BufferSize:   flags.AudioBuffer,
+	}
+	ctx, readyChan, err := oto.NewContext(otoContextOptions)
+	if err != nil {
+		return nil, err
+	}
+	<-readyChan
+	return otoContext{ctx}, nil
+}
+
+func (c otoContext) NewPlayer(r io.Reader) audioPlayer {
+	return c.Context.NewPlayer(r)
+}
+
+// newAudioContext opens the audio backend selected with -audio.
+func newAudioContext(sampleRate int) (audioContext, error) {
+	switch flags.Audio {
+	case "oto":
+		return newOtoContext(sampleRate)
+	case "jack":
+		return newJackContext(sampleRate)
+	}
+	return nil, fmt.Errorf("unknown audio backend: %q (use oto or jack)", flags.Audio)
+}
+
+type TapePlayer struct {
+	reader *TapeReader
+	player audioPlayer
+	owner  Screen
+	source *Tape // tape given to PlayTape, nil for other values
+}
+
+func (tp *TapePlayer) GetCurrentFrame() int {
+	bytesStillInAudioBuffer := tp.player.BufferedSize()
+	return tp.reader.GetCurrentFrame(bytesStillInAudioBuffer)
+}
+
+// currentTapeFrame returns the tape being played and the position of
+// the player in it.
+func (tp *TapePlayer) currentTapeFrame() (*Tape, int) {
+	return tp.reader.currentTape(), tp.GetCurrentFrame() - tp.reader.frameOffset
+}
+
+type AudioState struct {
+	mu          sync.Mutex
+	ctx         audioContext
+	tapePlayers []*TapePlayer
+}
+
+func NewAudioState(sampleRate int) (*AudioState, error) {
+	ctx, err := newAudioContext(sampleRate)
+	if err != nil {
+		return nil, err
+	}
+	return &AudioState{ctx: ctx}, nil
+}
+
+var (
+	sharedAudioMu sync.Mutex
+	sharedAudio   *AudioState
+)
+
+// sharedAudioState returns the audio state of the process, opening the
+// audio backend the first time: it can only be opened once.
+func sharedAudioState() (*AudioState, error) {
+	sharedAudioMu.Lock()
+	defer sharedAudioMu.Unlock()
+	if sharedAudio == nil {
+		audio, err := NewAudioState(SampleRate())
+		if err != nil {
+			return nil, err
+		}
+		sharedAudio = audio
+	}
+	return sharedAudio, nil
+}
+
+// recordInput records nframes frames (0: until stopped) from the input
+// of the audio backend.
+func recordInput(vm *VM, nframes int) (*Tape, error) {
+	audio, err := sharedAudioState()
+	if err != nil {
+		return nil, err
+	}
+	input, ok := audio.ctx.(audioInput)
+	if !ok {
+		return nil, fmt.Errorf("record: the %s audio backend cannot record, use -audio jack", flags.Audio)
+	}
+	stop := startRecording()
+	defer stopRecording()
+	return input.Record(nframes, stop, vm.Checkpoint)
+}
+
+func (os *AudioState) GetTapePlayers(owner Screen) []*TapePlayer {
+	os.mu.Lock()
+	result := make([]*TapePlayer, 0, len(os.tapePlayers))
+	for _, tp := range os.tapePlayers {
+		if tp.owner == owner {
+			result = append(result, tp)
+		}
+	}
+	os.mu.Unlock()
+	return result
+}
+
+// CurrentTapePlayer returns the most recently started player which is
+// still playing, whichever screen owns it, or nil.
+func (os *AudioState) CurrentTapePlayer() *TapePlayer {
+	os.mu.Lock()
+	defer os.mu.Unlock()
+	for i := len(os.tapePlayers) - 1; i >= 0; i-- {
+		if tp := os.tapePlayers[i]; tp.player.IsPlaying() {
+			return tp
+		}
+	}
+	return nil
+}
+
+// PlayTape plays x if it is a finite stream, its channels converted
+// with the matrices of downmix.
+func (os *AudioState) PlayTape(x any, downmix channelMatrices, owner Screen) error {
+	if streamable, ok := x.(Streamable); ok {
+		stream := streamable.Stream()
+		if stream.nframes > 0 {
+			tape := stream.Take(nil, stream.nframes)
+			reader, err := MakeTapeReader(tape, 2, downmix)
+			if err != nil {
+				return err
+			}
+			source, _ := x.(*Tape)
+			os.play(reader, owner, source)
+		}
+	}
+	return nil
+}
+
+// HotSwap crossfades the players which are playing from (as given to
+// PlayTape) to to over fadeFrames frames, continuing at the same
+// position. It returns false if none of them is playing.
+func (os *AudioState) HotSwap(from, to *Tape, fadeFrames int, downmix channelMatrices) bool {
+	if from == nil || to == nil || to.nframes == 0 {
+		return false
+	}
+	// play a copy, like PlayTape
+	tape := to.Stream().Take(nil, to.nframes)
+	os.mu.Lock()
+	defer os.mu.Unlock()
+	swapped := false
+	for _, tp := range os.tapePlayers {
+		if tp.source != from || !tp.player.IsPlaying() {
+			continue
+		}
+		if err := tp.reader.Swap(tape, fadeFrames, downmix); err != nil {
+			continue
+		}
+		tp.source = to
+		swapped = true
+	}
+	return swapped
+}
+
+// PlayTapeRegion plays frames [start,end) of tape, over and over
+// again if loop is set. Players report frames relative to the whole
+// tape.
+func (os *AudioState) PlayTapeRegion(tape *Tape, start, end int, loop bool, downmix channelMatrices, owner Screen) error {
+	if end <= start {
+		return nil
+	}
+	region, err := tape.Slice(start, end)
+	if err != nil {
+		return err
+	}
+	reader, err := MakeTapeReader(region, 2, downmix)
+	if err != nil {
+		return err
+	}
+	reader.frameOffset = start
+	reader.loop = loop
+	os.play(reader, owner, nil)
+	return nil
+}
+
+// play starts playing reader. source is the tape given to PlayTape, if
+// any (see HotSwap).
+func (os *AudioState) play(reader *TapeReader, owner Screen, source *Tape) {
+	player := os.ctx.NewPlayer(reader)
+	tapePlayer := &TapePlayer{
+		reader: reader,
+		player: player,
+		owner:  owner,
+		source: source,
+	}
+	os.mu.Lock()
+	os.tapePlayers = append(os.tapePlayers, tapePlayer)
+	os.mu.Unlock()
+	player.Play()
+}
+
+func (os *AudioState) StopAllPlayers() {
+	os.mu.Lock()
+	defer os.mu.Unlock()
+	for _, tp := range os.tapePlayers {
+		if tp.player.IsPlaying() {
+			tp.player.Pause()
+		}
+	}
+	os.tapePlayers = nil
+}
+
+// playTape plays t on the audio backend, its channels converted with
+// the matrices of downmix, and waits until it has finished.
+func playTape(t *Tape, downmix channelMatrices) error {
+	audioState, err := sharedAudioState()
+	if err != nil {
+		return err
+	}
+	reader, err := MakeTapeReader(t, 2, downmix)
+	if err != nil {
+		return err
+	}
+	player := audioState.ctx.NewPlayer(reader)
+	player.Play()
+	for player.IsPlaying() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	return player.Close()
+}
@@ -0,0 +1,82 @@
+package main
+
+// blockFrames is the largest number of frames a block stepper is asked
+// for at a time.
+const blockFrames = 64
+
+// BlockStepper fills buf, up to blockFrames interleaved frames, with the
+// next frames of a stream and returns how many it wrote: fewer than fit
+// in buf only when the stream has ended, and 0 ever after. The rest of
+// buf may have been written to all the same.
+type BlockStepper func(buf []Smp) int
+type BlockStepperFactory func() BlockStepper
+
+// makeBlockStream constructs a rewindable Stream computed a block of
+// frames at a time, which saves the call through the Stepper chain at
+// each frame. Consumers reading it with NextBlock get the blocks, the
+// others its frames one by one through Next.
+func makeBlockStream(nchannels, nframes int, factory BlockStepperFactory) Stream {
+	streamNodes.Add(1)
+	block := factory()
+	return Stream{
+		nchannels: nchannels,
+		nframes:   nframes,
+		newStepper: func() Stepper {
+			return frameStepper(nchannels, factory())
+		},
+		next:     frameStepper(nchannels, block),
+		newBlock: factory,
+		block:    block,
+	}
+}
+
+// makeBlockTransformStream is the block counterpart of
+// makeTransformStream.
+func makeBlockTransformStream(inputs []Stream, mk func([]Stream) BlockStepper) Stream {
+	return makeBlockTransformStreamN(inputs[0].nchannels, inputs, mk)
+}
+
+// makeBlockTransformStreamN is the block counterpart of
+// makeTransformStreamN.
+func makeBlockTransformStreamN(nchannels int, inputs []Stream, mk func([]Stream) BlockStepper) Stream {
+	return makeBlockStream(nchannels, transformFrames(inputs), func() BlockStepper {
+		clones := make([]Stream, len(inputs))
+		for i, s := range inputs {
+			clones[i] = s.clone()
+		}
+		return mk(clones)
+	})
+}
+
+// frameStepper returns the frames filled by block one by one. It asks
+// for a single frame each time, so that a stream read frame by frame
+// stays in step with the state it shares with others (the controls of
+// poly voices, ...): only consumers reading blocks get blocks.
+func frameStepper(nchannels int, block BlockStepper) Stepper {
+	frame := make(Frame, nchannels)
+	return func() (Frame, bool) {
+		if block(frame) == 0 {
+			return nil, false
+		}
+		return frame, true
+	}
+}
+
+// NextBlock fills buf, up to blockFrames frames, with the next frames
+// of s and returns how many it wrote, fewer only if s has ended. The
+// frames of streams not computed in blocks are copied one by one.
+func (s Stream) NextBlock(buf []Smp) int {
+	if s.block != nil {
+		return s.block(buf)
+	}
+	nch := s.nchannels
+	n := len(buf) / nch
+	for i := range n {
+		frame, ok := s.Next()
+		if !ok {
+			return i
+		}
+		copy(buf[i*nch:(i+1)*nch], frame)
+	}
+	return n
+}
@@ -1,3 +1,5 @@
+//go:build cgo && !js
+
 package main
 
 import (
@@ -17,6 +19,37 @@ type Buffer struct {
 	editorPoint EditorPoint
 	editorTop   int
 	editorLeft  int
+	editorMark  EditorPoint
+	markActive  bool
+	tapeZoom    int     // log2 of the tape view magnification
+	tapeCenter  float64 // center of the tape view as a fraction of its length
+	tapeSel     tapeSelection
+}
+
+// ViewState returns the view state of the buffer for persistence.
+func (b *Buffer) ViewState() BufferViewState {
+	return BufferViewState{
+		Line:       b.editorPoint.line,
+		Column:     b.editorPoint.column,
+		Top:        b.editorTop,
+		Left:       b.editorLeft,
+		MarkActive: b.markActive,
+		MarkLine:   b.editorMark.line,
+		MarkColumn: b.editorMark.column,
+		TapeZoom:   b.tapeZoom,
+		TapeCenter: b.tapeCenter,
+	}
+}
+
+// SetViewState restores a view state saved by ViewState.
+func (b *Buffer) SetViewState(state BufferViewState) {
+	b.editorPoint = EditorPoint{line: state.Line, column: state.Column}
+	b.editorTop = state.Top
+	b.editorLeft = state.Left
+	b.markActive = state.MarkActive
+	b.editorMark = EditorPoint{line: state.MarkLine, column: state.MarkColumn}
+	b.tapeZoom = min(max(state.TapeZoom, 0), maxTapeZoom)
+	b.tapeCenter = min(max(state.TapeCenter, 0), 1)
 }
 
 // SetData replaces the buffer contents and marks it dirty if changed.
@@ -1,3 +1,5 @@
+//go:build cgo && !js
+
 package main
 
 import "fmt"
@@ -45,16 +47,16 @@ func CreateBufferBrowser(bm *BufferManager, callbacks BufferBrowserCallbacks) *B
 
 func (bb *BufferBrowser) initKeymap() {
 	bb.keymap = CreateKeyMap()
-	bb.keymap.Bind("Up", func() { bb.MoveBy(-1) })
-	bb.keymap.Bind("Down", func() { bb.MoveBy(1) })
-	bb.keymap.Bind("Home", func() { bb.MoveTo(0) })
-	bb.keymap.Bind("End", func() { bb.MoveToEnd() })
-	bb.keymap.Bind("PageUp", func() { bb.MoveBy(-bb.PageSize()) })
-	bb.keymap.Bind("PageDown", func() { bb.MoveBy(bb.PageSize()) })
-	bb.keymap.Bind("Backspace", func() { bb.HandleBackspace() })
-	bb.keymap.Bind("Enter", func() { bb.handleEnter() })
-	bb.keymap.Bind("Escape", func() { bb.Exit() })
-	bb.keymap.Bind("C-g", func() { bb.Exit() })
+	bb.keymap.BindAction("buffers.up", "Up", func() { bb.MoveBy(-1) })
+	bb.keymap.BindAction("buffers.down", "Down", func() { bb.MoveBy(1) })
+	bb.keymap.BindAction("buffers.first", "Home", func() { bb.MoveTo(0) })
+	bb.keymap.BindAction("buffers.last", "End", func() { bb.MoveToEnd() })
+	bb.keymap.BindAction("buffers.page-up", "PageUp", func() { bb.MoveBy(-bb.PageSize()) })
+	bb.keymap.BindAction("buffers.page-down", "PageDown", func() { bb.MoveBy(bb.PageSize()) })
+	bb.keymap.BindAction("buffers.backspace", "Backspace", func() { bb.HandleBackspace() })
+	bb.keymap.BindAction("buffers.select", "Enter", func() { bb.handleEnter() })
+	bb.keymap.BindAction("buffers.exit", "Escape", func() { bb.Exit() })
+	bb.keymap.BindAction("buffers.exit", "C-g", func() { bb.Exit() })
 }
 
 func (bb *BufferBrowser) SearchText() string {
@@ -138,6 +140,17 @@ func (bb *BufferBrowser) handleEnter() {
 	}
 }
 
+// HandleMouse selects the clicked buffer and switches to it on double
+// click.
+func (bb *BufferBrowser) HandleMouse(ev MouseEvent) {
+	if ev.Action != MousePress || ev.Button != MouseLeft {
+		return
+	}
+	if bb.listDisplay.SelectAt(ev.Cell) && ev.Clicks == 2 {
+		bb.handleEnter()
+	}
+}
+
 func (bb *BufferBrowser) Render(tp TilePane) {
 	height := tp.Height()
 	if height <= 0 {
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// cacheTrimFrames is how many frames a stream cache computes between
+// two attempts to drop the frames all of its readers have read.
+const cacheTrimFrames = 16384
+
+// cacheReader is the position of a clone of a cached stream which has
+// started reading.
+type cacheReader struct {
+	pos int
+}
+
+// streamMemo holds the frames of a stream computed so far, dropping
+// the ones its readers have all read.
+type streamMemo struct {
+	mu       sync.Mutex
+	next     Stepper
+	nch      int
+	base     int   // frame index of samples[0]
+	samples  []Smp // interleaved
+	ended    bool
+	readers  map[*cacheReader]struct{}
+	computed int // frames computed since the last trim
+}
+
+// frame copies frame r.pos into out, computing the frames up to it. It
+// returns false if the stream ends before it, and ok false if the frame
+// has already been dropped.
+func (m *streamMemo) frame(r *cacheReader, out Frame) (valid, ok bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := r.pos - m.base
+	if i < 0 {
+		return false, false
+	}
+	for len(m.samples) <= i*m.nch {
+		if m.ended {
+			return false, true
+		}
+		f, ok := m.next()
+		if !ok {
+			m.ended = true
+			m.next = nil
+			return false, true
+		}
+		m.samples = append(m.samples, f...)
+		if m.computed++; m.computed == cacheTrimFrames {
+			m.computed = 0
+			m.trim()
+			i = r.pos - m.base
+		}
+	}
+	copy(out, m.samples[i*m.nch:])
+	return true, true
+}
+
+// trim drops the frames before the position of the slowest reader.
+func (m *streamMemo) trim() {
+	if len(m.readers) == 0 {
+		return
+	}
+	keep := m.base + len(m.samples)/m.nch
+	for r := range m.readers {
+		keep = min(keep, r.pos)
+	}
+	if n := keep - m.base; n > 0 {
+		m.samples = append(m.samples[:0], m.samples[n*m.nch:]...)
+		m.base = keep
+	}
+}
+
+func (m *streamMemo) addReader(r *cacheReader) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.readers[r] = struct{}{}
+}
+
+func (m *streamMemo) removeReader(r *cacheReader) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.readers, r)
+}
+
+// cacheClone is a clone of a cached stream.
+type cacheClone struct {
+	s       Stream
+	memo    *streamMemo
+	reader  *cacheReader // registered at the first frame
+	private Stepper      // set when it has fallen behind the memo
+	out     Frame
+}
+
+func (c *cacheClone) next() (Frame, bool) {
+	if c.private != nil {
+		return c.private()
+	}
+	if c.reader == nil {
+		// registering only now keeps clones which are never read from
+		// holding on to frames; when the clone goes away, so does its
+		// reader
+		c.reader = &cacheReader{}
+		c.memo.addReader(c.reader)
+		runtime.AddCleanup(c, c.memo.removeReader, c.reader)
+	}
+	valid, ok := c.memo.frame(c.reader, c.out)
+	if !ok {
+		// already dropped: catch up on a clone of our own
+		c.memo.removeReader(c.reader)
+		c.private = c.s.clone().Next
+		for range c.reader.pos {
+			if _, ok := c.private(); !ok {
+				return nil, false
+			}
+		}
+		return c.private()
+	}
+	if !valid {
+		c.memo.removeReader(c.reader)
+		return nil, false
+	}
+	c.reader.pos++
+	return c.out, true
+}
+
+// Cache returns a stream which plays s, computing each frame once for
+// all of its clones: the first clone to reach a frame computes it, the
+// others read it back. A clone which falls too far behind the others
+// (or starts after they have moved on) computes s on its own. When gen
+// changes, new clones start over with a fresh computation of s.
+func Cache(s Stream, gen *atomic.Uint64) Stream {
+	var mu sync.Mutex
+	var memo *streamMemo
+	var memoGen uint64
+	return makeRewindableStream(s.nchannels, s.nframes, func() Stepper {
+		mu.Lock()
+		defer mu.Unlock()
+		if g := gen.Load(); memo == nil || memoGen != g {
+			memo = &streamMemo{
+				next:    s.clone().Next,
+				nch:     s.nchannels,
+				readers: make(map[*cacheReader]struct{}),
+			}
+			memoGen = g
+		}
+		c := &cacheClone{s: s, memo: memo, out: make(Frame, s.nchannels)}
+		return c.next
+	})
+}
+
+func init() {
+	RegisterWord("cache", func(vm *VM) error {
+		s, err := streamFromVal(vm.Pop())
+		if err != nil {
+			return err
+		}
+		vm.Push(Cache(s, &vm.cacheGen))
+		return nil
+	})
+}
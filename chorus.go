@@ -0,0 +1,288 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// flangerMaxDepth is the longest sweep of the flanger delay, in seconds.
+const flangerMaxDepth = 0.02
+
+// Chorus runs the mono sum of input through voices delay lines around
+// delay seconds, each swept by depth seconds with a sine LFO at rate
+// Hz, the LFOs of the voices evenly apart in phase. The voices are
+// spread from left to right and blended with the dry signal by mix.
+func Chorus(input, rate, depth, mix Stream, delay float64, voices int) Stream {
+	return makeTransformStreamN(2, []Stream{input, rate, depth, mix}, func(inputs []Stream) Stepper {
+		inext := inputs[0].Mono().Next
+		rnext := inputs[1].Mono().Next
+		dnext := inputs[2].Mono().Next
+		mnext := inputs[3].Mono().Next
+		sr := float64(SampleRate())
+		buf := make([]float64, int(math.Ceil(2*delay*sr))+2)
+		writeIdx := 0
+		gains := make([][2]float64, voices)
+		for i := range voices {
+			p := 0.0
+			if voices > 1 {
+				p = -1 + 2*float64(i)/float64(voices-1)
+			}
+			l, r := equalPowerPan(p)
+			gains[i] = [2]float64{l, r}
+		}
+		norm := math.Sqrt(float64(voices))
+		phase := 0.0
+		out := make(Frame, 2)
+		return func() (Frame, bool) {
+			frame, ok := inext()
+			if !ok {
+				return nil, false
+			}
+			rframe, ok := rnext()
+			if !ok {
+				return nil, false
+			}
+			dframe, ok := dnext()
+			if !ok {
+				return nil, false
+			}
+			mframe, ok := mnext()
+			if !ok {
+				return nil, false
+			}
+			x := float64(frame[0])
+			d := min(max(float64(dframe[0]), 0), delay)
+			m := min(max(float64(mframe[0]), 0), 1)
+			buf[writeIdx] = x
+			var wet [2]float64
+			for i := range voices {
+				offset := float64(i) / float64(voices)
+				y := delayTap(buf, 1, 0, writeIdx, (delay+d*math.Sin(2*math.Pi*(phase+offset)))*sr)
+				wet[0] += gains[i][0] * y
+				wet[1] += gains[i][1] * y
+			}
+			for c := range out {
+				out[c] = Smp((1-m)*x + m*wet[c]/norm)
+			}
+			writeIdx = (writeIdx + 1) % len(buf)
+			phase = wrapPhase(phase + float64(rframe[0])/sr)
+			return out, true
+		}
+	})
+}
+
+// Flanger mixes each channel of input with itself delayed by delay
+// seconds plus up to depth seconds, swept by a sine LFO at rate Hz. The
+// delayed signal is fed back into the delay line by feedback and
+// blended with the dry signal by mix.
+func Flanger(input, rate, depth, feedback, mix Stream, delay float64) Stream {
+	nch := input.nchannels
+	return makeTransformStream([]Stream{input, rate, depth, feedback, mix}, func(inputs []Stream) Stepper {
+		inext := inputs[0].Next
+		rnext := inputs[1].Mono().Next
+		dnext := inputs[2].Mono().Next
+		fnext := inputs[3].Mono().Next
+		mnext := inputs[4].Mono().Next
+		sr := float64(SampleRate())
+		size := int(math.Ceil((delay+flangerMaxDepth)*sr)) + 2
+		bufs := make([][]float64, nch)
+		for c := range bufs {
+			bufs[c] = make([]float64, size)
+		}
+		writeIdx := 0
+		phase := 0.0
+		out := make(Frame, nch)
+		return func() (Frame, bool) {
+			frame, ok := inext()
+			if !ok {
+				return nil, false
+			}
+			rframe, ok := rnext()
+			if !ok {
+				return nil, false
+			}
+			dframe, ok := dnext()
+			if !ok {
+				return nil, false
+			}
+			fframe, ok := fnext()
+			if !ok {
+				return nil, false
+			}
+			mframe, ok := mnext()
+			if !ok {
+				return nil, false
+			}
+			d := min(max(float64(dframe[0]), 0), flangerMaxDepth)
+			fb := min(max(float64(fframe[0]), -0.99), 0.99)
+			m := min(max(float64(mframe[0]), 0), 1)
+			// the sweep goes from delay to delay+d and back
+			frames := max((delay+d*0.5*(1-math.Cos(2*math.Pi*phase)))*sr, 1)
+			for c := range nch {
+				x := float64(frame[c])
+				y := delayTap(bufs[c], 1, 0, writeIdx, frames)
+				bufs[c][writeIdx] = x + fb*y
+				out[c] = Smp((1-m)*x + m*y)
+			}
+			writeIdx = (writeIdx + 1) % size
+			phase = wrapPhase(phase + float64(rframe[0])/sr)
+			return out, true
+		}
+	})
+}
+
+// Phaser runs each channel of input through stages first-order allpass
+// filters whose cutoff is swept between lo and hi Hz, exponentially, by
+// a sine LFO at rate Hz. The output of the last stage is fed back into
+// the first by feedback and blended with the dry signal by mix, which
+// makes notches where the stages shift the phase by odd multiples of
+// half a cycle.
+func Phaser(input, rate, feedback, mix Stream, lo, hi float64, stages int) Stream {
+	nch := input.nchannels
+	return makeTransformStream([]Stream{input, rate, feedback, mix}, func(inputs []Stream) Stepper {
+		inext := inputs[0].Next
+		rnext := inputs[1].Mono().Next
+		fnext := inputs[2].Mono().Next
+		mnext := inputs[3].Mono().Next
+		sr := float64(SampleRate())
+		// the previous input and output of each stage of each channel
+		xPrev := make([]float64, nch*stages)
+		yPrev := make([]float64, nch*stages)
+		last := make([]float64, nch)
+		phase := 0.0
+		out := make(Frame, nch)
+		return func() (Frame, bool) {
+			frame, ok := inext()
+			if !ok {
+				return nil, false
+			}
+			rframe, ok := rnext()
+			if !ok {
+				return nil, false
+			}
+			fframe, ok := fnext()
+			if !ok {
+				return nil, false
+			}
+			mframe, ok := mnext()
+			if !ok {
+				return nil, false
+			}
+			fb := min(max(float64(fframe[0]), -0.99), 0.99)
+			m := min(max(float64(mframe[0]), 0), 1)
+			sweep := 0.5 * (1 - math.Cos(2*math.Pi*phase))
+			coef := ap1Coefficient(lo * math.Pow(hi/lo, sweep))
+			for c := range nch {
+				x := float64(frame[c])
+				y := x + fb*last[c]
+				for s := range stages {
+					i := c*stages + s
+					ap := coef*y + xPrev[i] - coef*yPrev[i]
+					xPrev[i], yPrev[i] = y, ap
+					y = ap
+				}
+				last[c] = y
+				out[c] = Smp((1-m)*x + m*y)
+			}
+			phase = wrapPhase(phase + float64(rframe[0])/sr)
+			return out, true
+		}
+	})
+}
+
+// positiveEnvFloat returns the value of the env key, which must be
+// positive.
+func positiveEnvFloat(vm *VM, word, key string) (float64, error) {
+	v, err := vm.GetFloat(key)
+	if err != nil {
+		return 0, err
+	}
+	if v <= 0 {
+		return 0, fmt.Errorf("%s: %s must be positive, got %v", word, key, v)
+	}
+	return v, nil
+}
+
+// envStreams returns the streams of the env keys.
+func envStreams(vm *VM, keys ...string) ([]Stream, error) {
+	streams := make([]Stream, len(keys))
+	for i, key := range keys {
+		s, err := vm.GetStream(key)
+		if err != nil {
+			return nil, err
+		}
+		streams[i] = s
+	}
+	return streams, nil
+}
+
+func init() {
+	RegisterWord("chorus", func(vm *VM) error {
+		input, err := streamFromVal(vm.Pop())
+		if err != nil {
+			return err
+		}
+		p, err := envStreams(vm, ":chorus/rate", ":chorus/depth", ":chorus/mix")
+		if err != nil {
+			return err
+		}
+		delay, err := positiveEnvFloat(vm, "chorus", ":chorus/delay")
+		if err != nil {
+			return err
+		}
+		voices, err := vm.GetInt(":chorus/voices")
+		if err != nil {
+			return err
+		}
+		if voices < 1 {
+			return fmt.Errorf("chorus: :chorus/voices must be at least 1, got %d", voices)
+		}
+		vm.Push(Chorus(input, p[0], p[1], p[2], delay, voices))
+		return nil
+	})
+
+	RegisterWord("flanger", func(vm *VM) error {
+		input, err := streamFromVal(vm.Pop())
+		if err != nil {
+			return err
+		}
+		p, err := envStreams(vm, ":flanger/rate", ":flanger/depth", ":flanger/feedback", ":flanger/mix")
+		if err != nil {
+			return err
+		}
+		delay, err := positiveEnvFloat(vm, "flanger", ":flanger/delay")
+		if err != nil {
+			return err
+		}
+		vm.Push(Flanger(input, p[0], p[1], p[2], p[3], delay))
+		return nil
+	})
+
+	RegisterWord("phaser", func(vm *VM) error {
+		input, err := streamFromVal(vm.Pop())
+		if err != nil {
+			return err
+		}
+		p, err := envStreams(vm, ":phaser/rate", ":phaser/feedback", ":phaser/mix")
+		if err != nil {
+			return err
+		}
+		lo, err := positiveEnvFloat(vm, "phaser", ":phaser/min")
+		if err != nil {
+			return err
+		}
+		hi, err := positiveEnvFloat(vm, "phaser", ":phaser/max")
+		if err != nil {
+			return err
+		}
+		stages, err := vm.GetInt(":phaser/stages")
+		if err != nil {
+			return err
+		}
+		if stages < 1 {
+			return fmt.Errorf("phaser: :phaser/stages must be at least 1, got %d", stages)
+		}
+		vm.Push(Phaser(input, p[0], p[1], p[2], lo, hi, stages))
+		return nil
+	})
+}
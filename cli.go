@@ -0,0 +1,353 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// command is a subcommand of the mixtape CLI.
+type command struct {
+	name    string
+	args    string // synopsis of the positional arguments
+	help    string
+	flags   *flag.FlagSet
+	needsVM bool // run gets a VM with the prelude loaded
+	run     func(vm *VM, args []string) error
+}
+
+var commands []*command
+
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+func newCommand(name, args, help string, needsVM bool, run func(vm *VM, args []string) error) *command {
+	cmd := &command{
+		name:    name,
+		args:    args,
+		help:    help,
+		flags:   flag.NewFlagSet(name, flag.ExitOnError),
+		needsVM: needsVM,
+		run:     run,
+	}
+	cmd.flags.Usage = func() {
+		out := cmd.flags.Output()
+		fmt.Fprintf(out, "usage: mixtape %s [flags] %s\n\n%s\n\nflags:\n", cmd.name, cmd.args, cmd.help)
+		cmd.flags.PrintDefaults()
+	}
+	addCommonFlags(cmd.flags)
+	commands = append(commands, cmd)
+	return cmd
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "usage: mixtape [flags] [file...]\n       mixtape <command> [flags] [args]\n\n")
+	fmt.Fprintf(out, "Without a command, mixtape evaluates the scripts given with -e/-f, or opens the files in the editor.\n\ncommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(out, "  %-11s %s\n", cmd.name, cmd.help)
+	}
+	fmt.Fprintf(out, "\nRun mixtape <command> -h for the flags of a command.\n\nflags:\n")
+	flag.PrintDefaults()
+}
+
+// evalInputs adds the files in args to the scripts to evaluate and
+// evaluates all of them, returning the final result.
+func evalInputs(vm *VM, args []string) (Val, error) {
+	for _, arg := range args {
+		flags.EvalTargets = append(flags.EvalTargets, EvalTarget{evalTargetFile, arg})
+	}
+	if len(flags.EvalTargets) == 0 {
+		return nil, errors.New("nothing to evaluate: give a file or use -e/-f")
+	}
+	err := withProfileIfNeeded(func() error {
+		return evalTargets(vm, false)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return vm.evalResult, nil
+}
+
+// resultTape converts the result of an evaluation to a tape.
+func resultTape(result Val) (*Tape, error) {
+	if tp, ok := result.(TapeProvider); ok {
+		return tp.Tape(), nil
+	}
+	if streamable, ok := result.(Streamable); ok {
+		if s := streamable.Stream(); s.nframes > 0 {
+			return s.Take(nil, s.nframes), nil
+		}
+	}
+	return nil, fmt.Errorf("result is not a finite stream or tape: %v", result)
+}
+
+func runRender(vm *VM, args []string, output string, watch bool) error {
+	if output == "" {
+		if len(args) == 0 {
+			return errors.New("render: -o is required when no file is given")
+		}
+		output = strings.TrimSuffix(args[len(args)-1], filepath.Ext(args[len(args)-1])) + ".wav"
+	}
+	if watch {
+		return watchRender(vm, args, output)
+	}
+	return renderFile(vm, args, output)
+}
+
+func renderFile(vm *VM, args []string, output string) error {
+	start := time.Now()
+	result, err := evalInputs(vm, args)
+	if err != nil {
+		return err
+	}
+	t, err := resultTape(result)
+	if err != nil {
+		return err
+	}
+	if err := t.WriteToFile(output); err != nil {
+		return err
+	}
+	fmt.Printf("%s: %d frames, %d channels, peak %s, rendered in %.2fs\n", output, t.nframes, t.nchannels, formatDBFS(t.Peak()), time.Since(start).Seconds())
+	return nil
+}
+
+// watchInterval is how often watchRender looks at the files.
+const watchInterval = 250 * time.Millisecond
+
+// watchRender renders the scripts to output, then renders them again
+// in a fresh VM whenever one of them or a file of the prelude changes,
+// until interrupted. Errors are reported without stopping the watch.
+func watchRender(vm *VM, args []string, output string) error {
+	if err := renderFile(vm, args, output); err != nil {
+		fmt.Fprintln(os.Stderr, formatError(err))
+	}
+	// evalInputs added the files given in args to the eval targets
+	var files []string
+	for _, target := range flags.EvalTargets {
+		if target.Kind == evalTargetFile {
+			files = append(files, target.Value)
+		}
+	}
+	files = append(files, preludeFiles()...)
+	if len(files) == 0 {
+		return errors.New("render: -watch needs files to watch")
+	}
+	modTimes := watchModTimes(files)
+	fmt.Printf("watching %s, press Ctrl-C to stop\n", strings.Join(files, ", "))
+	for {
+		time.Sleep(watchInterval)
+		current := watchModTimes(files)
+		if maps.Equal(current, modTimes) {
+			continue
+		}
+		modTimes = current
+		vm, err := newVM()
+		if err == nil {
+			err = renderFile(vm, nil, output)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, formatError(err))
+		}
+	}
+}
+
+// watchModTimes returns the modification times of the files which
+// exist.
+func watchModTimes(files []string) map[string]time.Time {
+	modTimes := make(map[string]time.Time, len(files))
+	for _, path := range files {
+		if info, err := os.Stat(path); err == nil {
+			modTimes[path] = info.ModTime()
+		}
+	}
+	return modTimes
+}
+
+func runPlay(vm *VM, args []string) error {
+	result, err := evalInputs(vm, args)
+	if err != nil {
+		return err
+	}
+	t, err := resultTape(result)
+	if err != nil {
+		return err
+	}
+	return playTape(t, vm.resultDownmix)
+}
+
+// formatTape normalizes the whitespace of a .tape script: leading tabs
+// become two spaces, trailing whitespace is removed, runs of blank lines
+// are collapsed into one and the file ends with a single newline.
+func formatTape(src []byte) []byte {
+	var out bytes.Buffer
+	blank := 0
+	for line := range strings.Lines(string(src)) {
+		line = strings.TrimRight(line, " \t\r\n")
+		indent := len(line) - len(strings.TrimLeft(line, "\t"))
+		line = strings.Repeat("  ", indent) + line[indent:]
+		if line == "" {
+			blank++
+			continue
+		}
+		if blank > 0 && out.Len() > 0 {
+			out.WriteByte('\n')
+		}
+		blank = 0
+		out.WriteString(line)
+		out.WriteByte('\n')
+	}
+	return out.Bytes()
+}
+
+func runFmt(args []string, write, list bool) error {
+	if len(args) == 0 {
+		src, err := readAllStdin()
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(formatTape(src))
+		return err
+	}
+	for _, path := range args {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		formatted := formatTape(src)
+		changed := !bytes.Equal(src, formatted)
+		switch {
+		case list:
+			if changed {
+				fmt.Println(path)
+			}
+		case write:
+			if changed {
+				if err := os.WriteFile(path, formatted, 0o644); err != nil {
+					return err
+				}
+			}
+		default:
+			os.Stdout.Write(formatted)
+		}
+	}
+	return nil
+}
+
+func readAllStdin() ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := buf.ReadFrom(os.Stdin)
+	return buf.Bytes(), err
+}
+
+// runTest evaluates each test script in a fresh VM. A test passes if
+// it evaluates without error and leaves the stack empty.
+func runTest(args []string) error {
+	if len(args) == 0 {
+		args = []string{"tests"}
+	}
+	var files []string
+	for _, arg := range args {
+		if info, err := os.Stat(arg); err == nil && info.IsDir() {
+			matches, err := filepath.Glob(filepath.Join(arg, "*.tape"))
+			if err != nil {
+				return err
+			}
+			files = append(files, matches...)
+		} else {
+			files = append(files, arg)
+		}
+	}
+	slices.Sort(files)
+	failed := 0
+	for _, file := range files {
+		vm, err := newVM()
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(file)
+		if err == nil {
+			err = vm.ParseAndEval(bytes.NewReader(data), file)
+		}
+		if err == nil && len(vm.valStack) != 0 {
+			err = fmt.Errorf("%s: stack not empty after test: %v", file, vm.valStack)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, formatError(err))
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d FAILED", failed)
+	}
+	fmt.Printf("%d OK\n", len(files))
+	return nil
+}
+
+func init() {
+	edit := newCommand("edit", "[file...]", "open the files in the editor (the default)", true, runGui)
+	addEditFlags(edit.flags)
+	addAudioFlags(edit.flags)
+
+	var renderOutput string
+	render := newCommand("render", "[file...]", "evaluate the scripts and write the resulting tape to a WAV or FLAC file", true, func(vm *VM, args []string) error {
+		return runRender(vm, args, renderOutput, flags.Watch)
+	})
+	addEvalFlags(render.flags)
+	render.flags.StringVar(&renderOutput, "o", "", "Output WAV or FLAC file, by extension (default: the last file with .wav extension)")
+	render.flags.BoolVar(&flags.Watch, "watch", false, "Render again whenever the scripts or the prelude change")
+
+	play := newCommand("play", "[file...]", "evaluate the scripts and play the resulting tape", true, runPlay)
+	addEvalFlags(play.flags)
+	addAudioFlags(play.flags)
+
+	var fmtWrite, fmtList bool
+	fmtCmd := newCommand("fmt", "[file...]", "normalize whitespace in .tape files (stdin to stdout without files)", false, func(vm *VM, args []string) error {
+		return runFmt(args, fmtWrite, fmtList)
+	})
+	fmtCmd.flags.BoolVar(&fmtWrite, "w", false, "Write the result to the files instead of stdout")
+	fmtCmd.flags.BoolVar(&fmtList, "l", false, "List the files whose formatting differs")
+
+	var newTemplate, newSample string
+	var newList bool
+	newCmd := newCommand("new", "file...", "create new .tape scripts from a template", false, func(vm *VM, args []string) error {
+		return runNew(args, newTemplate, newSample, newList)
+	})
+	newCmd.flags.StringVar(&newTemplate, "t", "song", "Template: "+strings.Join(templateNames(), ", "))
+	newCmd.flags.StringVar(&newSample, "sample", "", "Sample file loaded by the chain template (default: a stand-in sound)")
+	newCmd.flags.BoolVar(&newList, "l", false, "List the templates")
+
+	newCommand("test", "[file|dir...]", "run test scripts (default: tests/*.tape)", false, func(vm *VM, args []string) error {
+		return runTest(args)
+	})
+
+	newCommand("version", "", "print the version of mixtape", false, func(vm *VM, args []string) error {
+		fmt.Println("mixtape", Version)
+		return nil
+	})
+
+	newCommand("completion", "bash|zsh|fish", "print a shell completion script", false, func(vm *VM, args []string) error {
+		if len(args) != 1 {
+			return errors.New("usage: mixtape completion bash|zsh|fish")
+		}
+		script, err := completionScript(args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Print(script)
+		return nil
+	})
+}
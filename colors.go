@@ -16,6 +16,12 @@ var (
 	ColorHighlight    = color.RGBA{0x00, 0x00, 0xff, 0xff}
 	ColorMark         = color.RGBA{0x00, 0x00, 0x80, 0xff}
 	ColorCurrentToken = color.RGBA{0x20, 0x60, 0x20, 0xff}
+	ColorError        = color.RGBA{0xff, 0x66, 0x66, 0xff}
+	ColorMatch        = color.RGBA{0x60, 0x50, 0x00, 0xff}
+	ColorMismatch     = color.RGBA{0xa0, 0x00, 0x00, 0xff}
+	ColorAdded        = color.RGBA{0x20, 0x90, 0x20, 0xff}
+	ColorModified     = color.RGBA{0xa0, 0x80, 0x10, 0xff}
+	ColorPassed       = color.RGBA{0x66, 0xdd, 0x66, 0xff}
 )
 
 type Color = color.Color
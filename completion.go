@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// flagNames returns the names of the flags in fs, prefixed with a dash.
+func flagNames(fs *flag.FlagSet) []string {
+	var names []string
+	fs.VisitAll(func(f *flag.Flag) {
+		names = append(names, "-"+f.Name)
+	})
+	return names
+}
+
+func commandNames() []string {
+	names := make([]string, len(commands))
+	for i, cmd := range commands {
+		names[i] = cmd.name
+	}
+	return names
+}
+
+// completionScript generates a completion script for shell from the
+// command table and the flag sets of the commands.
+func completionScript(shell string) (string, error) {
+	var b strings.Builder
+	switch shell {
+	case "bash":
+		fmt.Fprintf(&b, "# bash completion for mixtape\n_mixtape() {\n")
+		fmt.Fprintf(&b, "  local cur=${COMP_WORDS[COMP_CWORD]} words\n")
+		fmt.Fprintf(&b, "  case ${COMP_WORDS[1]} in\n")
+		for _, cmd := range commands {
+			fmt.Fprintf(&b, "    %s) words=%q ;;\n", cmd.name, strings.Join(flagNames(cmd.flags), " "))
+		}
+		fmt.Fprintf(&b, "    *) words=%q ;;\n", strings.Join(append(commandNames(), flagNames(flag.CommandLine)...), " "))
+		fmt.Fprintf(&b, "  esac\n")
+		fmt.Fprintf(&b, "  if [[ $cur == -* || ($COMP_CWORD == 1 && $cur != */*) ]]; then\n")
+		fmt.Fprintf(&b, "    COMPREPLY=($(compgen -W \"$words\" -- \"$cur\"))\n")
+		fmt.Fprintf(&b, "  else\n    COMPREPLY=($(compgen -f -- \"$cur\"))\n  fi\n}\n")
+		fmt.Fprintf(&b, "complete -o filenames -F _mixtape mixtape\n")
+	case "zsh":
+		fmt.Fprintf(&b, "#compdef mixtape\n_mixtape() {\n")
+		fmt.Fprintf(&b, "  local -a candidates\n")
+		fmt.Fprintf(&b, "  case $words[2] in\n")
+		for _, cmd := range commands {
+			fmt.Fprintf(&b, "    %s) candidates=(%s) ;;\n", cmd.name, strings.Join(flagNames(cmd.flags), " "))
+		}
+		fmt.Fprintf(&b, "    *) candidates=(%s) ;;\n", strings.Join(append(commandNames(), flagNames(flag.CommandLine)...), " "))
+		fmt.Fprintf(&b, "  esac\n")
+		fmt.Fprintf(&b, "  if [[ $PREFIX == -* || $CURRENT == 2 ]]; then\n")
+		fmt.Fprintf(&b, "    compadd -a candidates\n  fi\n  _files\n}\n")
+		fmt.Fprintf(&b, "compdef _mixtape mixtape\n")
+	case "fish":
+		fmt.Fprintf(&b, "# fish completion for mixtape\n")
+		fmt.Fprintf(&b, "complete -c mixtape -n __fish_use_subcommand -f -a %q\n", strings.Join(commandNames(), " "))
+		for _, cmd := range commands {
+			fmt.Fprintf(&b, "complete -c mixtape -n __fish_use_subcommand -a %s -d %q\n", cmd.name, cmd.help)
+			cmd.flags.VisitAll(func(f *flag.Flag) {
+				fmt.Fprintf(&b, "complete -c mixtape -n '__fish_seen_subcommand_from %s' -o %s -d %q\n", cmd.name, f.Name, f.Usage)
+			})
+		}
+		flag.CommandLine.VisitAll(func(f *flag.Flag) {
+			fmt.Fprintf(&b, "complete -c mixtape -n __fish_use_subcommand -o %s -d %q\n", f.Name, f.Usage)
+		})
+	default:
+		return "", fmt.Errorf("unsupported shell: %s (expected bash, zsh or fish)", shell)
+	}
+	return b.String(), nil
+}
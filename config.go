@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// projectConfigName is the name of the project config, looked up next
+// to the scripts.
+const projectConfigName = ".mixtape.toml"
+
+// configEntry is the default value of an env var set in a config file.
+type configEntry struct {
+	key   string // without the leading colon
+	value string // TOML value
+	pos   string // file:line, for errors
+}
+
+// loadConfigFile reads the [env] table of the config file at path, if
+// it exists. The file uses a subset of TOML: each key of the table
+// names an env var, and its value is a number, a boolean or a string
+// holding a mixtape expression evaluated to get the value:
+//
+//	[env]
+//	bpm = 140
+//	"resample/converter" = ":resample/SRC_SINC_BEST_QUALITY"
+//	name = '"sketch"'
+func loadConfigFile(path string) ([]configEntry, error) {
+	p, err := expandPath(path)
+	if err != nil {
+		return nil, err
+	}
+	if !fileExists(p) {
+		return nil, nil
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := parseConfig(data, p)
+	if err != nil {
+		return nil, fmt.Errorf("%s:%w", p, err)
+	}
+	return entries, nil
+}
+
+func parseConfig(data []byte, path string) ([]configEntry, error) {
+	var entries []configEntry
+	table := ""
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for lineno := 1; sc.Scan(); lineno++ {
+		line := strings.TrimSpace(stripTomlComment(sc.Text()))
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("%d: unterminated table header", lineno)
+			}
+			table = strings.TrimSpace(line[1 : len(line)-1])
+			if table != "env" {
+				return nil, fmt.Errorf("%d: unknown table [%s]", lineno, table)
+			}
+			continue
+		}
+		if table == "" {
+			return nil, fmt.Errorf("%d: expected the [env] table", lineno)
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("%d: expected key = value", lineno)
+		}
+		key = strings.TrimPrefix(strings.Trim(strings.TrimSpace(key), `"`), ":")
+		if key == "" {
+			return nil, fmt.Errorf("%d: empty key", lineno)
+		}
+		entries = append(entries, configEntry{key, strings.TrimSpace(value), fmt.Sprintf("%s:%d", path, lineno)})
+	}
+	return entries, sc.Err()
+}
+
+// configValue evaluates the TOML value of e.
+func (vm *VM) configValue(e configEntry) (Val, error) {
+	switch v := e.value; {
+	case v == "true":
+		return True, nil
+	case v == "false":
+		return False, nil
+	case strings.HasPrefix(v, "'"):
+		if len(v) < 2 || !strings.HasSuffix(v, "'") {
+			return nil, fmt.Errorf("invalid string %s", v)
+		}
+		return vm.evalConfigExpr(v[1 : len(v)-1])
+	case strings.HasPrefix(v, `"`):
+		expr, err := strconv.Unquote(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid string %s", v)
+		}
+		return vm.evalConfigExpr(expr)
+	default:
+		n, err := strconv.ParseFloat(strings.ReplaceAll(v, "_", ""), 64)
+		if err != nil {
+			return nil, fmt.Errorf("expected a number, a boolean or a string, got %s", v)
+		}
+		return Num(n), nil
+	}
+}
+
+// evalConfigExpr evaluates expr in the root env. It must leave exactly
+// one value on the stack.
+func (vm *VM) evalConfigExpr(expr string) (Val, error) {
+	if err := vm.evalPrelude([]byte(expr), "<config>"); err != nil {
+		if inner := errors.Unwrap(err); inner != nil {
+			err = inner // without the "error while parsing" of evalPrelude
+		}
+		return nil, err
+	}
+	if len(vm.valStack) != 1 {
+		vm.valStack = vm.valStack[:0]
+		return nil, fmt.Errorf("expected an expression leaving one value")
+	}
+	return vm.Pop(), nil
+}
+
+// configFiles returns the config files, in the order they are applied:
+// the user config (-config) and the project config in the directory of
+// the first script given, or the working directory.
+func configFiles() []string {
+	var files []string
+	if flags.Config != "" {
+		files = append(files, flags.Config)
+	}
+	dir := "."
+	for _, target := range flags.EvalTargets {
+		if target.Kind == evalTargetFile {
+			dir = filepath.Dir(target.Value)
+			break
+		}
+	}
+	if dir == "." {
+		for _, arg := range flags.Scripts {
+			if strings.HasSuffix(arg, ".tape") {
+				dir = filepath.Dir(arg)
+				break
+			}
+		}
+	}
+	return append(files, filepath.Join(dir, projectConfigName))
+}
+
+// loadConfig reads the config files. The entries of later files come
+// later, so that they override the earlier ones.
+func loadConfig() ([]configEntry, error) {
+	var entries []configEntry
+	for _, path := range configFiles() {
+		e, err := loadConfigFile(path)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e...)
+	}
+	return entries, nil
+}
+
+// applyConfigTempo takes the tempo and the ticks per beat from the
+// number values of bpm and tpb in the config, unless they are given
+// with -bpm and -tpb, so that the defaults derived from them follow.
+func applyConfigTempo(entries []configEntry) {
+	for _, e := range entries {
+		n, err := strconv.ParseFloat(e.value, 64)
+		if err != nil {
+			continue
+		}
+		switch {
+		case e.key == "bpm" && !flags.Explicit["bpm"]:
+			flags.BPM = n
+		case e.key == "tpb" && !flags.Explicit["tpb"]:
+			flags.TPB = int(n)
+		}
+	}
+}
+
+// applyConfig sets the env vars of the config entries in the root env.
+// They are applied after the prelude, whose defaults they override,
+// and before the -D definitions, which override them in turn.
+func applyConfig(vm *VM, entries []configEntry) error {
+	for _, e := range entries {
+		if flags.Explicit[e.key] && (e.key == "bpm" || e.key == "tpb") {
+			continue
+		}
+		v, err := vm.configValue(e)
+		if err != nil {
+			return fmt.Errorf("%s: %s: %w", e.pos, e.key, err)
+		}
+		vm.SetVal(":"+e.key, v)
+	}
+	return nil
+}
+
+// reapplyEnvOverrides applies the config files and the -D definitions
+// again, after the prelude has been reloaded over them.
+func reapplyEnvOverrides(vm *VM) error {
+	entries, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	if err := applyConfig(vm, entries); err != nil {
+		return err
+	}
+	return applyDefines(vm)
+}
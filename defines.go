@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// DefineFlag collects -D key=value definitions.
+type DefineFlag struct {
+	Values *[]string
+}
+
+func (f DefineFlag) String() string {
+	if f.Values == nil {
+		return ""
+	}
+	return strings.Join(*f.Values, ",")
+}
+
+func (f DefineFlag) Set(val string) error {
+	key, _, ok := strings.Cut(val, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("expected key=value, got %q", val)
+	}
+	*f.Values = append(*f.Values, val)
+	return nil
+}
+
+// defineValue converts the value of a -D definition: number literals
+// (including ones with units like 2s or 4b, and note names) become
+// numbers, anything else is kept as a string.
+func (vm *VM) defineValue(text string) (Val, error) {
+	code, err := vm.Parse(strings.NewReader(text), "-D")
+	if err != nil || len(code) == 0 || len(code) > 2 {
+		return Str(text), nil
+	}
+	if _, ok := code[0].getVal().(Num); !ok {
+		return Str(text), nil
+	}
+	if len(code) == 2 {
+		// unit suffix: the second token converts the number
+		if _, ok := code[1].getVal().(Sym); !ok {
+			return Str(text), nil
+		}
+	}
+	for _, v := range code {
+		if err := vm.Eval(v); err != nil {
+			return nil, err
+		}
+	}
+	return vm.Pop(), nil
+}
+
+// applyDefines sets the env vars given with -D in the root env. They
+// are applied after the prelude so that they override its defaults.
+func applyDefines(vm *VM) error {
+	for _, def := range flags.Defines {
+		key, value, _ := strings.Cut(def, "=")
+		v, err := vm.defineValue(value)
+		if err != nil {
+			return fmt.Errorf("-D %s: %w", def, err)
+		}
+		vm.SetVal(":"+key, v)
+	}
+	return nil
+}
+
+func init() {
+	RegisterGoFunc("getenv", func(name string) Val {
+		if value, ok := os.LookupEnv(name); ok {
+			return Str(value)
+		}
+		return Nil
+	})
+}
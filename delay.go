@@ -1,5 +1,17 @@
 package main
 
+// delayTap returns channel ch of the frame delay frames behind frame
+// writeIdx in buf, a circular buffer of frames of nch channels,
+// interpolating linearly between frames.
+func delayTap(buf []Smp, nch, ch, writeIdx int, delay float64) Smp {
+	n := len(buf) / nch
+	di := int(delay)
+	frac := delay - float64(di)
+	r0 := ((writeIdx-di)%n + n) % n
+	r1 := (r0 - 1 + n) % n
+	return (1-frac)*buf[r0*nch+ch] + frac*buf[r1*nch+ch]
+}
+
 func (s Stream) Delay(nframes int) Stream {
 	if nframes <= 0 {
 		return s.clone()
@@ -6,26 +6,59 @@ import (
 )
 
 func Phasor(freq Stream, phase float64) Stream {
-	return makeRewindableStream(1, 0, func() Stepper {
-		fnext := freq.Mono().Next
+	return makeBlockStream(1, 0, func() BlockStepper {
+		freq := freq.Mono()
 		if phase < 0.0 || phase >= 1.0 {
 			phase = 0.0
 		}
 		p := Smp(phase)
 		sr := Smp(SampleRate())
+		fbuf := make([]Smp, blockFrames)
+		ended := false
+		return func(buf []Smp) int {
+			if ended {
+				return 0
+			}
+			n := freq.NextBlock(fbuf[:len(buf)])
+			for i, f := range fbuf[:n] {
+				periodSamples := sr / f
+				if periodSamples == 0 {
+					ended = true
+					return i
+				}
+				buf[i] = p
+				incr := 1.0 / periodSamples
+				p = math.Mod(p+incr, 1.0)
+			}
+			return n
+		}
+	})
+}
+
+// ChannelMix sums the channels of input into a mono stream, channel i
+// scaled by gains[i].
+func ChannelMix(input Stream, gains []Stream) Stream {
+	return makeTransformStreamN(1, append([]Stream{input}, gains...), func(inputs []Stream) Stepper {
+		next := inputs[0].Next
+		gnexts := make([]func() (Frame, bool), len(gains))
+		for i, g := range inputs[1:] {
+			gnexts[i] = g.Mono().Next
+		}
 		out := make(Frame, 1)
 		return func() (Frame, bool) {
-			f, ok := fnext()
+			frame, ok := next()
 			if !ok {
 				return nil, false
 			}
-			out[0] = p
-			periodSamples := sr / f[0]
-			if periodSamples == 0 {
-				return nil, false
+			var sum Smp
+			for ch, gnext := range gnexts {
+				g, ok := gnext()
+				if !ok {
+					return nil, false
+				}
+				sum += frame[ch] * g[0]
 			}
-			incr := 1.0 / periodSamples
-			p = math.Mod(p+incr, 1.0)
+			out[0] = sum
 			return out, true
 		}
 	})
@@ -243,6 +276,49 @@ func Mix(ss []Stream, ratio Stream) Stream {
 	})
 }
 
+// VectorMix crossfades between the four sources at the corners of a
+// square, A at x=0 y=0, B at x=1 y=0, C at x=0 y=1 and D at x=1 y=1,
+// with equal-power weights: the squares of the weights sum to 1.
+func VectorMix(sources [4]Stream, x, y Stream) Stream {
+	nchannels := sources[0].nchannels
+	inputs := append(sources[:], x.Mono(), y.Mono())
+	return makeTransformStream(inputs, func(inputs []Stream) Stepper {
+		nexts := make([]Stepper, len(inputs))
+		for i, s := range inputs {
+			nexts[i] = s.Next
+		}
+		var weights [4]Smp
+		out := make(Frame, nchannels)
+		return func() (Frame, bool) {
+			xframe, ok := nexts[4]()
+			if !ok {
+				return nil, false
+			}
+			yframe, ok := nexts[5]()
+			if !ok {
+				return nil, false
+			}
+			x := min(max(xframe[0], 0), 1)
+			y := min(max(yframe[0], 0), 1)
+			weights[0] = math.Sqrt((1 - x) * (1 - y))
+			weights[1] = math.Sqrt(x * (1 - y))
+			weights[2] = math.Sqrt((1 - x) * y)
+			weights[3] = math.Sqrt(x * y)
+			clear(out)
+			for i, w := range weights {
+				frame, ok := nexts[i]()
+				if !ok {
+					return nil, false
+				}
+				for ch := range nchannels {
+					out[ch] += frame[ch] * w
+				}
+			}
+			return out, true
+		}
+	})
+}
+
 func init() {
 	RegisterWord("~phasor", func(vm *VM) error {
 		freq, err := vm.GetStream(":freq")
@@ -396,4 +472,61 @@ func init() {
 		vm.Push(Mix(streams, ratio))
 		return nil
 	})
+
+	RegisterWord("vector-mix", func(vm *VM) error {
+		// [A B C D] x y -- output
+		y, err := streamFromVal(vm.Pop())
+		if err != nil {
+			return err
+		}
+		x, err := streamFromVal(vm.Pop())
+		if err != nil {
+			return err
+		}
+		inputs, err := Pop[Vec](vm)
+		if err != nil {
+			return err
+		}
+		if len(inputs) != 4 {
+			return vm.Errorf("vector-mix: expected 4 sources, got %d", len(inputs))
+		}
+		var sources [4]Stream
+		for i, v := range inputs {
+			s, err := streamFromVal(v)
+			if err != nil {
+				return err
+			}
+			if i > 0 && s.nchannels != sources[0].nchannels {
+				return vm.Errorf("vector-mix: all sources must have the same number of channels")
+			}
+			sources[i] = s
+		}
+		vm.Push(VectorMix(sources, x, y))
+		return nil
+	})
+
+	RegisterWord("chmix", func(vm *VM) error {
+		// input gains -- output
+		gainVals, err := Pop[Vec](vm)
+		if err != nil {
+			return err
+		}
+		input, err := streamFromVal(vm.Pop())
+		if err != nil {
+			return err
+		}
+		if len(gainVals) != input.nchannels {
+			return vm.Errorf("chmix: %d gains for %d channels", len(gainVals), input.nchannels)
+		}
+		gains := make([]Stream, len(gainVals))
+		for i, v := range gainVals {
+			s, err := streamFromVal(v)
+			if err != nil {
+				return err
+			}
+			gains[i] = s
+		}
+		vm.Push(ChannelMix(input, gains))
+		return nil
+	})
 }
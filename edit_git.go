@@ -0,0 +1,136 @@
+//go:build cgo && !js
+
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+// gitRefreshInterval is how often the edit screen checks the git
+// repository of the current buffer for changes made outside of it.
+const gitRefreshInterval = 2 * time.Second
+
+// editGit is what the edit screen knows about the git repository of the
+// file of the current buffer. It is only touched by the main loop; the
+// git commands run in the background and post their results.
+type editGit struct {
+	path    string    // file the state is for
+	status  gitStatus // branch and dirty flag of its repository
+	head    []string  // its lines in HEAD
+	tracked bool      // it is in HEAD
+	checked time.Time // when the last refresh started
+	running bool      // a refresh is going on
+	edits   int       // edit count of the editor when marks were computed
+	marks   map[int]Color
+}
+
+// refreshGit starts reading the git state of the file of buf in the
+// background if it is a different file or the state is getting old.
+func (es *EditScreen) refreshGit(buf *Buffer) {
+	g := &es.git
+	if buf == nil || !buf.HasPath() {
+		*g = editGit{}
+		return
+	}
+	path := buf.Path
+	if path == g.path && (g.running || time.Since(g.checked) < gitRefreshInterval) {
+		return
+	}
+	if path != g.path {
+		*g = editGit{path: path}
+	}
+	g.checked = time.Now()
+	g.running = true
+	go func() {
+		status := readGitStatus(path)
+		var head []string
+		tracked := false
+		if status.branch != "" {
+			head, tracked = gitHeadLines(path)
+		}
+		es.app.postEvent(func() {
+			if g.path != path {
+				return // the buffer changed meanwhile
+			}
+			g.running = false
+			g.status, g.head, g.tracked = status, head, tracked
+			g.marks = nil
+		}, false)
+	}()
+}
+
+// forgetGit makes the next refresh read the git state at once, after
+// the file has been written or committed.
+func (es *EditScreen) forgetGit() {
+	es.git.checked = time.Time{}
+}
+
+// gitLineMarks returns the colors of the lines of the editor added or
+// modified since HEAD, or nil if the file is not tracked.
+func (es *EditScreen) gitLineMarks() map[int]Color {
+	g := &es.git
+	if !g.tracked {
+		return nil
+	}
+	if g.marks == nil || g.edits != es.editor.Edits() {
+		g.edits = es.editor.Edits()
+		g.marks = make(map[int]Color)
+		for line, change := range diffLines(g.head, splitLines(string(es.editor.GetBytes()))) {
+			if change == lineAdded {
+				g.marks[line] = ColorAdded
+			} else {
+				g.marks[line] = ColorModified
+			}
+		}
+	}
+	return g.marks
+}
+
+// gitStatusText returns the branch and dirty flag for the status line,
+// or "" outside of a repository.
+func (es *EditScreen) gitStatusText() string {
+	st := es.git.status
+	if st.branch == "" {
+		return ""
+	}
+	text := " [git:" + st.branch
+	if st.dirty {
+		text += "*"
+	}
+	return text + "]"
+}
+
+// openCommitPrompt asks for a commit message, then saves the current
+// buffer and commits its file.
+func (es *EditScreen) openCommitPrompt() {
+	buf := es.GetCurrentBuffer()
+	if !buf.HasPath() {
+		es.app.SetLastError(errors.New("git commit: the buffer has no file"))
+		return
+	}
+	if es.git.status.branch == "" {
+		es.app.SetLastError(errors.New("git commit: the file is not in a git repository"))
+		return
+	}
+	prompt := CreateTextPrompt("Commit message: ", PromptCallbacks{
+		onConfirm: es.confirmCommitPrompt,
+		onCancel:  es.closePrompt,
+	})
+	es.openPrompt(prompt)
+}
+
+func (es *EditScreen) confirmCommitPrompt(message string) {
+	es.closePrompt()
+	es.SaveEditorContentToCurrentBuffer()
+	path := es.GetCurrentBuffer().Path
+	go func() {
+		err := gitCommitFile(path, message)
+		es.app.postEvent(func() {
+			if err != nil {
+				es.app.SetLastError(err)
+			}
+			es.forgetGit()
+		}, false)
+	}()
+}
@@ -1,11 +1,16 @@
+//go:build cgo && !js
+
 package main
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 )
 
 // EditScreen bundles the editor-related UI components.
@@ -13,21 +18,39 @@ type EditScreen struct {
 	app         *App
 	bm          *BufferManager
 	editor      *Editor
-	lastScript  []byte // last script successfully evaluated by VM
 	lastBuffer  *Buffer
 	tapeDisplay *TapeDisplay
 	keymap      KeyMap
 
+	tapeSpectral bool // M-s: show the spectrogram instead of the waveform
+	meter        LevelMeter
+
+	// panes of the last Render, for mouse hit-testing
+	editorPane    TilePane
+	tapePane      TilePane
+	mouseTarget   mouseTarget // pane of the last mouse press
+	tapeDragStart int         // frame where the tape selection drag started
+
 	fileBrowser     *FileBrowser // C-x f
 	showFileBrowser bool
 
 	bufferBrowser     *BufferBrowser // C-x b
 	showBufferBrowser bool
+
+	autoEval      bool      // C-x a: evaluate the buffer a moment after each edit
+	autoEvalEdits int       // edit count of the editor when last seen
+	autoEvalTime  time.Time // time of the last edit not evaluated yet, zero if none
+
+	git editGit // C-x g: the repository of the file of the current buffer
 }
 
+// autoEvalDelay is how long auto-eval mode waits after the last edit
+// before evaluating the buffer.
+const autoEvalDelay = 500 * time.Millisecond
+
 func CreateEditScreen(app *App) (*EditScreen, error) {
 	editor := CreateEditor()
-	tapeDisplay, err := CreateTapeDisplay()
+	tapeDisplay, err := app.createTapeDisplay()
 	if err != nil {
 		return nil, err
 	}
@@ -42,6 +65,7 @@ func CreateEditScreen(app *App) (*EditScreen, error) {
 	}
 
 	es.syncBufferToEditor()
+	editor.SetCompleter(es.completions)
 
 	fbFilter := func(fe FileEntry) bool {
 		// show directories
@@ -72,34 +96,32 @@ func CreateEditScreen(app *App) (*EditScreen, error) {
 	es.bufferBrowser = bb
 
 	// eval editor script
-	keymap.Bind("C-Enter", func() {
+	keymap.BindAction("edit.eval", "C-Enter", func() {
 		es.syncEditorToBuffer()
-		buf := es.GetCurrentBuffer()
-		lastScript := buf.Data
-		app.evalBuffer(buf, func() {
-			es.lastScript = lastScript
-		})
+		app.evalBuffer(es.GetCurrentBuffer(), nil)
 	})
 
 	// eval if changed, then play
-	keymap.Bind("C-p", func() {
+	keymap.BindAction("edit.eval-play", "C-p", func() {
 		es.syncEditorToBuffer()
 		buf := es.GetCurrentBuffer()
-		if bytes.Equal(buf.Data, es.lastScript) {
+		if slot := app.bufferSlot(buf); slot != nil && bytes.Equal(buf.Data, slot.lastScript) {
 			app.postEvent(func() {
-				app.oto.PlayTape(app.vm.evalResult, es)
+				if err := app.audio.PlayTape(slot.vm.evalResult, slot.vm.resultDownmix, es); err != nil {
+					app.SetLastError(err)
+				}
 			}, false)
 		} else {
-			lastScript := buf.Data
-			app.evalBuffer(buf, func() {
-				es.lastScript = lastScript
-				app.oto.PlayTape(app.vm.evalResult, es)
+			app.evalBuffer(buf, func(slot *EvalSlot) {
+				if err := app.audio.PlayTape(slot.vm.evalResult, slot.vm.resultDownmix, es); err != nil {
+					app.SetLastError(err)
+				}
 			})
 		}
 	})
 
 	// save
-	keymap.Bind("C-x s", func() {
+	keymap.BindAction("edit.save", "C-x s", func() {
 		buf := es.GetCurrentBuffer()
 		if !buf.HasPath() {
 			es.openSavePrompt()
@@ -109,37 +131,67 @@ func CreateEditScreen(app *App) (*EditScreen, error) {
 	})
 
 	// save as
-	keymap.Bind("C-x C-s", func() {
+	keymap.BindAction("edit.save-as", "C-x C-s", func() {
 		es.openSavePrompt()
 	})
 
+	// new buffer from a template
+	keymap.BindAction("edit.new-file", "C-x t", func() {
+		es.openTemplatePrompt()
+	})
+
 	// file browser
-	keymap.Bind("C-x f", func() {
+	keymap.BindAction("edit.open-file", "C-x f", func() {
 		es.enterFileOpenMode()
 	})
 
+	// reload prelude
+	keymap.BindAction("edit.reload-prelude", "C-x r", func() {
+		app.reloadPrelude()
+	})
+
 	// buffer browser
-	keymap.Bind("C-x b", func() {
+	keymap.BindAction("edit.switch-buffer", "C-x b", func() {
 		es.enterBufferSwitchMode()
 	})
 
 	// switch to last buffer
-	keymap.Bind("C-x o", func() {
+	keymap.BindAction("edit.other-buffer", "C-x o", func() {
 		es.switchToOtherBuffer()
 	})
 
 	// switch to next buffer
-	keymap.Bind("C-x n", func() {
+	keymap.BindAction("edit.next-buffer", "C-x n", func() {
 		es.switchToAdjacentBuffer(1)
 	})
 
 	// switch to previous buffer
-	keymap.Bind("C-x p", func() {
+	keymap.BindAction("edit.previous-buffer", "C-x p", func() {
 		es.switchToAdjacentBuffer(-1)
 	})
 
+	// auto-eval and hot-swap modes
+	keymap.BindAction("edit.auto-eval", "C-x a", func() {
+		es.autoEval = !es.autoEval
+		es.autoEvalTime = time.Time{}
+	})
+	keymap.BindAction("edit.hot-swap", "C-x h", func() { app.hotSwap = !app.hotSwap })
+
+	// stage and commit the file of the current buffer
+	keymap.BindAction("edit.git-commit", "C-x g", func() {
+		es.openCommitPrompt()
+	})
+
+	// inspect result
+	keymap.BindAction("edit.inspect", "C-x i", func() {
+		if slot := es.slot(); slot != nil && slot.vm.evalResult != nil {
+			prepareInspect(slot.vm.evalResult)
+			app.Inspect(slot.vm.evalResult)
+		}
+	})
+
 	// kill current buffer
-	keymap.Bind("C-x k", func() {
+	keymap.BindAction("edit.kill-buffer", "C-x k", func() {
 		if es.editor.Dirty() {
 			// ask before we kill it
 			es.openKillPrompt()
@@ -149,13 +201,211 @@ func CreateEditScreen(app *App) (*EditScreen, error) {
 	})
 
 	// undo
-	keymap.Bind("C-z", func() { es.editor.UndoLastAction() })
-	keymap.Bind("C-x u", func() { es.editor.UndoLastAction() })
-	keymap.Bind("C-S--", func() { es.editor.UndoLastAction() })
+	undo := func() { es.editor.UndoLastAction() }
+	keymap.BindAction("edit.undo", "C-z", undo)
+	keymap.BindAction("edit.undo", "C-x u", undo)
+	keymap.BindAction("edit.undo", "C-S--", undo)
+
+	// tape view zoom
+	keymap.BindAction("edit.zoom-in", "M-=", func() { es.zoomTapeView(1) })
+	keymap.BindAction("edit.zoom-out", "M--", func() { es.zoomTapeView(-1) })
+	keymap.BindAction("edit.zoom-reset", "M-0", func() { es.zoomTapeView(-maxTapeZoom) })
+	keymap.BindAction("edit.scroll-left", "M-Left", func() { es.scrollTapeView(-0.25) })
+	keymap.BindAction("edit.scroll-right", "M-Right", func() { es.scrollTapeView(0.25) })
+	keymap.BindAction("edit.spectrogram", "M-s", func() { es.tapeSpectral = !es.tapeSpectral })
+
+	// tape selection
+	keymap.BindAction("edit.selection-start", "M-i", func() { es.setTapeSelectionPoint(false) })
+	keymap.BindAction("edit.selection-end", "M-o", func() { es.setTapeSelectionPoint(true) })
+	keymap.BindAction("edit.selection-clear", "M-a", func() { es.clearTapeSelection() })
+	keymap.BindAction("edit.play-selection", "M-p", func() { es.playTapeSelection(false) })
+	keymap.BindAction("edit.loop-selection", "M-l", func() { es.playTapeSelection(true) })
 
 	return es, nil
 }
 
+// zoomTapeView changes the tape view magnification by 2^delta.
+func (es *EditScreen) zoomTapeView(delta int) {
+	buf := es.GetCurrentBuffer()
+	buf.tapeZoom = min(max(buf.tapeZoom+delta, 0), maxTapeZoom)
+	es.scrollTapeView(0)
+}
+
+// scrollTapeView moves the tape view by amount times its width,
+// keeping the view inside the tape.
+func (es *EditScreen) scrollTapeView(amount float64) {
+	buf := es.GetCurrentBuffer()
+	width := 1 / float64(int(1)<<buf.tapeZoom)
+	half := width / 2
+	buf.tapeCenter = min(max(buf.tapeCenter+amount*width, half), 1-half)
+}
+
+// completions returns the candidates for completing prefix in the
+// editor: the words and :keys of the root env, the methods, the words
+// and :keys defined by the last evaluation of the buffer and the :keys
+// used in it.
+func (es *EditScreen) completions(prefix string) []string {
+	names := slices.Concat(rootEnvKeys(), methodNames(), es.editor.bufferKeys())
+	if slot := es.slot(); slot != nil && slot.vm.resultEnv != nil {
+		names = append(names, envKeys(slot.vm.resultEnv)...)
+	}
+	return matchCompletions(names, prefix)
+}
+
+// slot returns the evaluation slot of the current buffer, or nil.
+func (es *EditScreen) slot() *EvalSlot {
+	return es.app.bufferSlot(es.GetCurrentBuffer())
+}
+
+// currentTape returns the tape shown in the tape view, or nil.
+func (es *EditScreen) currentTape() *Tape {
+	slot := es.slot()
+	if slot == nil {
+		return nil
+	}
+	t, _ := slot.vm.evalResult.(*Tape)
+	return t
+}
+
+// setTapeSelectionPoint sets the start (or the end, if out is set) of
+// the tape selection to the playhead, or if nothing is playing, to the
+// start (or end) of the tape view. The selected region becomes
+// available to scripts via the selection word.
+func (es *EditScreen) setTapeSelectionPoint(out bool) {
+	t := es.currentTape()
+	if t == nil {
+		return
+	}
+	buf := es.GetCurrentBuffer()
+	windowSize, windowOffset := tapeWindow(t.nframes, buf.tapeZoom, buf.tapeCenter)
+	frame := windowOffset
+	if out {
+		frame += windowSize
+	}
+	if players := es.app.audio.GetTapePlayers(es); len(players) > 0 {
+		frame = players[0].GetCurrentFrame()
+	}
+	frame = min(max(frame, 0), t.nframes)
+	sel := buf.tapeSel.clamp(t.nframes)
+	if !sel.active() {
+		sel = tapeSelection{0, t.nframes}
+	}
+	if out {
+		sel.end = frame
+	} else {
+		sel.start = frame
+	}
+	if sel.start > sel.end {
+		sel.start, sel.end = sel.end, sel.start
+	}
+	es.setTapeSelection(t, sel)
+}
+
+// setTapeSelection selects a region of t, making it available to
+// scripts via the selection word.
+func (es *EditScreen) setTapeSelection(t *Tape, sel tapeSelection) {
+	es.GetCurrentBuffer().tapeSel = sel
+	slot := es.slot()
+	if slot == nil {
+		return
+	}
+	if sel.active() {
+		slot.vm.SetSelection(t.slice(sel.start, sel.end))
+	} else {
+		slot.vm.SetSelection(nil)
+	}
+}
+
+func (es *EditScreen) clearTapeSelection() {
+	es.GetCurrentBuffer().tapeSel = tapeSelection{}
+	if slot := es.slot(); slot != nil {
+		slot.vm.SetSelection(nil)
+	}
+}
+
+// playTapeSelection plays the selected region of the tape (the whole
+// tape if there is no selection), looping it if loop is set.
+func (es *EditScreen) playTapeSelection(loop bool) {
+	t := es.currentTape()
+	if t == nil {
+		return
+	}
+	sel := es.GetCurrentBuffer().tapeSel.clamp(t.nframes)
+	if !sel.active() {
+		sel = tapeSelection{0, t.nframes}
+	}
+	es.app.audio.StopAllPlayers()
+	if err := es.app.audio.PlayTapeRegion(t, sel.start, sel.end, loop, es.slot().vm.resultDownmix, es); err != nil {
+		es.app.SetLastError(err)
+	}
+}
+
+type mouseTarget int
+
+const (
+	mouseTargetNone mouseTarget = iota
+	mouseTargetEditor
+	mouseTargetTape
+)
+
+func (es *EditScreen) HandleMouse(app *App, ev MouseEvent) {
+	if es.showFileBrowser {
+		es.fileBrowser.HandleMouse(ev)
+		return
+	}
+	if es.showBufferBrowser {
+		es.bufferBrowser.HandleMouse(ev)
+		return
+	}
+	if ev.Action == MousePress {
+		// a drag stays with the pane where it started
+		switch {
+		case es.editorPane.Contains(ev.Cell):
+			es.mouseTarget = mouseTargetEditor
+		case es.tapePane.Contains(ev.Cell) && es.currentTape() != nil:
+			es.mouseTarget = mouseTargetTape
+		default:
+			es.mouseTarget = mouseTargetNone
+		}
+	}
+	switch es.mouseTarget {
+	case mouseTargetEditor:
+		es.editor.HandleMouse(ev)
+	case mouseTargetTape:
+		es.dragTapeSelection(ev)
+	}
+	if ev.Action == MouseRelease {
+		es.mouseTarget = mouseTargetNone
+	}
+}
+
+// dragTapeSelection selects the region of the tape between the frames
+// under the mouse press and the current mouse position. A click
+// without dragging clears the selection.
+func (es *EditScreen) dragTapeSelection(ev MouseEvent) {
+	t := es.currentTape()
+	if t == nil || ev.Button != MouseLeft {
+		return
+	}
+	buf := es.GetCurrentBuffer()
+	windowSize, windowOffset := tapeWindow(t.nframes, buf.tapeZoom, buf.tapeCenter)
+	rect := es.tapePane.GetPixelRect()
+	frame := windowOffset
+	if rect.Dx() > 0 {
+		frame += int(float64(ev.Pixel.X-rect.Min.X) / float64(rect.Dx()) * float64(windowSize))
+	}
+	frame = min(max(frame, 0), t.nframes)
+	if ev.Action == MousePress {
+		es.tapeDragStart = frame
+		es.clearTapeSelection()
+		return
+	}
+	es.setTapeSelection(t, tapeSelection{
+		start: min(es.tapeDragStart, frame),
+		end:   max(es.tapeDragStart, frame),
+	})
+}
+
 func (es *EditScreen) GetCurrentBuffer() *Buffer {
 	return es.bm.GetCurrentBuffer()
 }
@@ -198,19 +448,78 @@ func (es *EditScreen) Render(app *App, ts *TileScreen) {
 	} else {
 		statusFile = currentBuffer.Name
 	}
+	if es.autoEval {
+		statusFile += " [auto-eval]"
+	}
+	if app.hotSwap {
+		statusFile += " [hot-swap]"
+	}
+	es.refreshGit(currentBuffer)
+	statusFile += es.gitStatusText()
 
 	var editorPane TilePane
 	var tapeDisplayPane TilePane
 	var statusPane TilePane
 
-	switch result := app.vm.evalResult.(type) {
+	var evalResult Val
+	var renderStats *RenderStats
+	var currentToken *Token
+	var progress string
+	slot := es.slot()
+	if slot != nil {
+		evalResult, renderStats = slot.vm.evalResult, slot.vm.renderStats
+		currentToken = slot.vm.CurrentToken()
+		progress = slot.renderProgress()
+	}
+	// renders of other buffers going on in the background
+	if background := app.backgroundProgress(slot); background != "" {
+		if progress != "" {
+			progress += " | "
+		}
+		progress += background
+	}
+
+	es.tapePane = TilePane{}
+	switch result := evalResult.(type) {
 	case *Tape:
-		editorPane, tapeDisplayPane = screenPane.SplitY(-8)
+		editorPane, tapeDisplayPane = screenPane.SplitY(-9)
+		var statsPane TilePane
+		tapeDisplayPane, statsPane = tapeDisplayPane.SplitY(-1)
+		if renderStats != nil {
+			statsPane.DrawString(0, 0, renderStats.String())
+		}
 		var playheadFrames []int
-		for _, tp := range app.oto.GetTapePlayers(es) {
+		players := app.audio.GetTapePlayers(es)
+		for _, tp := range players {
 			playheadFrames = append(playheadFrames, tp.GetCurrentFrame())
 		}
-		es.tapeDisplay.Render(result, tapeDisplayPane.GetPixelRect(), result.nframes, 0, playheadFrames)
+		// finished players stay in the list until the next playback
+		i := slices.IndexFunc(players, func(tp *TapePlayer) bool { return tp.player.IsPlaying() })
+		if i >= 0 {
+			t, frame := players[i].currentTapeFrame()
+			es.meter.Update(t, frame, GetTime())
+		} else {
+			es.meter.Update(nil, 0, GetTime())
+		}
+		if len(es.meter.Peak) == 0 {
+			es.meter.resize(result.nchannels)
+		}
+		var meterPane TilePane
+		tapeDisplayPane, meterPane = tapeDisplayPane.SplitX(-4)
+		renderLevelMeter(meterPane, es.tapeDisplay, &es.meter)
+		windowSize, windowOffset := tapeWindow(result.nframes, currentBuffer.tapeZoom, currentBuffer.tapeCenter)
+		es.tapePane = tapeDisplayPane
+		renderTapeView(tapeDisplayPane, es.tapeDisplay, result, windowSize, windowOffset, playheadFrames, es.tapeSpectral, currentBuffer.tapeSel.clamp(result.nframes))
+	case *Wavetable:
+		editorPane, tapeDisplayPane = screenPane.SplitY(-9)
+		var infoPane TilePane
+		tapeDisplayPane, infoPane = tapeDisplayPane.SplitY(-1)
+		infoPane.DrawString(0, 0, result.String())
+		morph, playing := app.playingMorph(result)
+		if !playing {
+			morph = -1
+		}
+		renderWavetableView(tapeDisplayPane, es.tapeDisplay, result.mips[0], morph)
 	default:
 		if result == nil {
 			editorPane = screenPane
@@ -231,7 +540,8 @@ func (es *EditScreen) Render(app *App, ts *TileScreen) {
 	}
 
 	editorBufferPane, editorStatusPane := editorPane.SplitY(-1)
-	currentToken := app.vm.CurrentToken()
+	es.editorPane = editorBufferPane
+	es.editor.SetLineMarks(es.gitLineMarks())
 	es.editor.Render(editorBufferPane, currentToken)
 	dirty := es.editor.Dirty() && currentBuffer.HasPath()
 	es.editor.RenderStatusLine(
@@ -239,8 +549,7 @@ func (es *EditScreen) Render(app *App, ts *TileScreen) {
 		statusFile,
 		dirty,
 		currentToken,
-		app.rTotalFrames,
-		app.rDoneFrames)
+		progress)
 }
 
 func (es *EditScreen) switchToAdjacentBuffer(delta int) {
@@ -285,12 +594,17 @@ func (es *EditScreen) switchToBuffer(buf *Buffer) {
 func (es *EditScreen) syncBufferToEditor() {
 	currentBuffer := es.GetCurrentBuffer()
 	es.editor.SetText(string(currentBuffer.Data))
-	es.editor.point = currentBuffer.editorPoint
-	es.editor.top = currentBuffer.editorTop
-	es.editor.left = currentBuffer.editorLeft
+	es.autoEvalTime = time.Time{}
+	es.editor.point = es.editor.clampPoint(currentBuffer.editorPoint)
+	es.editor.top = min(max(currentBuffer.editorTop, 0), len(es.editor.lines)-1)
+	es.editor.left = max(currentBuffer.editorLeft, 0)
 	es.editor.dirty = currentBuffer.Dirty
 	es.editor.undoStack = currentBuffer.undoStack
 	es.editor.Reset()
+	if currentBuffer.markActive {
+		es.editor.mark = es.editor.clampPoint(currentBuffer.editorMark)
+		es.editor.markActive = true
+	}
 }
 
 func (es *EditScreen) syncEditorToBuffer() {
@@ -299,10 +613,46 @@ func (es *EditScreen) syncEditorToBuffer() {
 	currentBuffer.editorPoint = es.editor.point
 	currentBuffer.editorTop = es.editor.top
 	currentBuffer.editorLeft = es.editor.left
+	currentBuffer.editorMark = es.editor.mark
+	currentBuffer.markActive = es.editor.markActive
 	currentBuffer.Dirty = es.editor.dirty
 	currentBuffer.undoStack = es.editor.undoStack
 }
 
+// updateAutoEval evaluates the current buffer in auto-eval mode once
+// autoEvalDelay has passed since the last edit. It is called every
+// frame.
+func (es *EditScreen) updateAutoEval() {
+	if edits := es.editor.Edits(); edits != es.autoEvalEdits {
+		es.autoEvalEdits = edits
+		es.autoEvalTime = time.Now()
+		return
+	}
+	if !es.autoEval || es.autoEvalTime.IsZero() || time.Since(es.autoEvalTime) < autoEvalDelay {
+		return
+	}
+	if es.app.currentScreenName != "edit" || es.app.currentPrompt != nil {
+		return
+	}
+	es.autoEvalTime = time.Time{}
+	es.syncEditorToBuffer()
+	es.app.autoEvalBuffer(es.GetCurrentBuffer())
+}
+
+// showEvalError moves the point to the token where the evaluation of
+// buffer (from path) failed, if the buffer is still shown and has not
+// been edited since.
+func (es *EditScreen) showEvalError(buffer *Buffer, script []byte, path string, err error) {
+	var e Err
+	if !errors.As(err, &e) || e.Pos.Line == 0 || e.Pos.Filename != path {
+		return
+	}
+	if es.GetCurrentBuffer() != buffer || !bytes.Equal(es.editor.GetBytes(), script) {
+		return
+	}
+	es.editor.ShowError(EditorPoint{line: e.Pos.Line - 1, column: e.Pos.Column - 1}, e.Len)
+}
+
 func (es *EditScreen) Keymap() KeyMap {
 	return es.keymap
 }
@@ -338,6 +688,7 @@ func (es *EditScreen) loadFileToBuffer(path string, buf *Buffer) {
 	}
 	if buf == nil {
 		buf = es.bm.CreateBuffer("", path, data)
+		es.app.restoreViewState(buf)
 	} else {
 		buf.SetData(data)
 	}
@@ -403,6 +754,35 @@ func (es *EditScreen) openSavePrompt() {
 	es.openPrompt(prompt)
 }
 
+// openTemplatePrompt asks for the name of a template and opens a new
+// buffer with it.
+func (es *EditScreen) openTemplatePrompt() {
+	prompt := CreateTextPrompt("New from template ("+strings.Join(templateNames(), ", ")+"): ", PromptCallbacks{
+		onConfirm: es.confirmTemplatePrompt,
+		onCancel:  es.closePrompt,
+	})
+	prompt.SetText(scriptTemplates[0].name)
+	es.openPrompt(prompt)
+}
+
+func (es *EditScreen) confirmTemplatePrompt(value string) {
+	es.closePrompt()
+	name := strings.TrimSpace(value)
+	if name == "" {
+		return
+	}
+	data, err := expandTemplate(name, templateVars{name: "untitled", bpm: flags.BPM})
+	if err != nil {
+		es.app.SetLastError(err)
+		return
+	}
+	es.syncEditorToBuffer()
+	es.lastBuffer = es.GetCurrentBuffer()
+	buf := es.bm.CreateBuffer(name+".tape", "", data)
+	buf.Dirty = true
+	es.syncBufferToEditor()
+}
+
 func (es *EditScreen) SaveEditorContentToCurrentBuffer() {
 	es.syncEditorToBuffer()
 	currentBuffer := es.GetCurrentBuffer()
@@ -410,6 +790,7 @@ func (es *EditScreen) SaveEditorContentToCurrentBuffer() {
 		es.app.SetLastError(err)
 	}
 	es.syncBufferToEditor()
+	es.forgetGit()
 }
 
 func (es *EditScreen) confirmSavePrompt(value string) {
@@ -441,6 +822,9 @@ func (es *EditScreen) killCurrentBuffer() {
 		nextBuffer = es.bm.getAdjacentBuffer(1)
 	}
 	target := es.GetCurrentBuffer()
+	es.syncEditorToBuffer()
+	es.app.rememberViewState(target)
+	es.app.closeBufferSlot(target)
 	es.bm.RemoveBuffer(target)
 	if es.lastBuffer == target {
 		es.lastBuffer = nil
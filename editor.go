@@ -1,3 +1,5 @@
+//go:build cgo && !js
+
 package main
 
 import (
@@ -8,7 +10,6 @@ import (
 	"slices"
 	"strings"
 	"unicode"
-	"unicode/utf8"
 )
 
 const MaxUndo = 64
@@ -45,11 +46,19 @@ type Editor struct {
 	top              int
 	left             int
 	height           int
+	lastPane         TilePane
+	dragAnchor       EditorPoint // where the last mouse press put the point
 	readOnly         bool
 	dirty            bool
 	keymap           KeyMap
 	actionDispatcher func(UndoableFunction)
 	undoStack        []Action
+	completer        Completer
+	completion       *completion   // open completion popup, or nil
+	errorPoint       EditorPoint   // start of the token where the last evaluation failed
+	errorLen         int           // length of that token, 0 if there is none to highlight
+	edits            int           // number of edits made (and undone) so far
+	lineMarks        map[int]Color // colors of the gutter by line; no gutter if nil
 }
 
 func (e *Editor) setYankedRunes(rs []rune) {
@@ -85,6 +94,8 @@ func (e *Editor) PopActionFromUndoStack() Action {
 }
 
 func (e *Editor) DispatchAction(f UndoableFunction) {
+	e.ClearError()
+	e.edits++
 	action := Action{doFunc: f}
 	action.undoFunc = f()
 	action.pointAfter = e.GetPoint()
@@ -95,6 +106,8 @@ func (e *Editor) UndoLastAction() {
 	if e.UndoStackIsEmpty() {
 		return
 	}
+	e.ClearError()
+	e.edits++
 	lastAction := e.PopActionFromUndoStack()
 	e.SetPoint(lastAction.pointAfter)
 	lastAction.undoFunc()
@@ -118,6 +131,8 @@ func (e *Editor) SetText(text string) {
 	}
 	lines = append(lines, EditorLine(""))
 	e.lines = lines
+	e.completion = nil
+	e.ClearError()
 }
 
 func (e *Editor) GetLine(index int) EditorLine {
@@ -179,8 +194,36 @@ func (e *Editor) AtEOF() bool {
 	return e.AtLastLine() && e.AtEOL()
 }
 
+// displayColumn returns the screen column of the rune at index column
+// in line, taking double-width runes into account.
+func displayColumn(line EditorLine, column int) int {
+	col := 0
+	for i := 0; i < column && i < len(line); i++ {
+		col += runeWidth(line[i])
+	}
+	if column > len(line) {
+		col += column - len(line)
+	}
+	return col
+}
+
+// runeIndexAtDisplayColumn is the inverse of displayColumn: it returns
+// the index of the rune covering screen column col (or the line length
+// if col is beyond the end of line).
+func runeIndexAtDisplayColumn(line EditorLine, col int) int {
+	x := 0
+	for i, r := range line {
+		x += runeWidth(r)
+		if x > col {
+			return i
+		}
+	}
+	return len(line)
+}
+
 func (e *Editor) AdvanceLine(amount int) {
 	p := &e.point
+	col := displayColumn(e.CurrentLine(), p.column)
 	p.line += amount
 	if p.line >= len(e.lines) {
 		p.line = len(e.lines) - 1
@@ -188,9 +231,7 @@ func (e *Editor) AdvanceLine(amount int) {
 	if p.line < 0 {
 		p.line = 0
 	}
-	if length := e.CurrentLineLength(); p.column > length {
-		p.column = length
-	}
+	p.column = runeIndexAtDisplayColumn(e.CurrentLine(), col)
 }
 
 func (e *Editor) AdvanceColumn(amount int) {
@@ -277,6 +318,29 @@ func (e *Editor) SetPoint(p EditorPoint) {
 	e.point = p
 }
 
+// ShowError moves the point to the token of length n at p where an
+// evaluation failed and highlights it until the next edit.
+func (e *Editor) ShowError(p EditorPoint, n int) {
+	if p.line < 0 || p.line >= len(e.lines) {
+		return
+	}
+	e.errorPoint = e.clampPoint(p)
+	e.errorLen = max(n, 1)
+	e.SetPoint(e.errorPoint)
+	e.ForgetMark()
+}
+
+func (e *Editor) ClearError() {
+	e.errorLen = 0
+}
+
+// clampPoint moves p to the nearest valid position in the text.
+func (e *Editor) clampPoint(p EditorPoint) EditorPoint {
+	p.line = min(max(p.line, 0), len(e.lines)-1)
+	p.column = min(max(p.column, 0), len(e.lines[p.line]))
+	return p
+}
+
 func (e *Editor) GetMark() EditorPoint {
 	return e.mark
 }
@@ -383,6 +447,7 @@ func (e *Editor) Paste() {
 
 func (e *Editor) Reset() {
 	e.ForgetMark()
+	e.completion = nil
 }
 
 func (e *Editor) InsertRune(r rune) {
@@ -450,8 +515,50 @@ func (e *Editor) SplitLine() {
 	e.dirty = true
 }
 
+// pointAtCell returns the text position displayed at screen cell c by
+// the last Render.
+func (e *Editor) pointAtCell(c Point) EditorPoint {
+	local := e.lastPane.Local(c)
+	line := min(max(e.top+local.Y, 0), len(e.lines)-1)
+	return e.clampPoint(EditorPoint{
+		line:   line,
+		column: runeIndexAtDisplayColumn(e.lines[line], e.left+max(local.X, 0)),
+	})
+}
+
+// HandleMouse moves the point to the clicked position. Dragging with
+// the left button selects the text between the press and the point.
+func (e *Editor) HandleMouse(ev MouseEvent) {
+	if ev.Button != MouseLeft {
+		return
+	}
+	p := e.pointAtCell(ev.Cell)
+	switch ev.Action {
+	case MousePress:
+		e.ForgetMark()
+		e.dragAnchor = p
+	case MouseDrag, MouseRelease:
+		if p != e.dragAnchor && !e.markActive {
+			e.mark = e.dragAnchor
+			e.markActive = true
+		}
+	}
+	e.point = p
+}
+
+// SetLineMarks sets the colors of the gutter left of the lines, by line
+// index. A nil map removes the gutter.
+func (e *Editor) SetLineMarks(marks map[int]Color) {
+	e.lineMarks = marks
+}
+
 func (e *Editor) Render(tp TilePane, currentToken *Token) {
 	p := e.point
+	var gutter TilePane
+	if e.lineMarks != nil {
+		gutter, tp = tp.SplitX(1)
+	}
+	e.lastPane = tp
 	e.height = tp.Height()
 	if p.line < e.top {
 		e.top = p.line
@@ -462,11 +569,18 @@ func (e *Editor) Render(tp TilePane, currentToken *Token) {
 	if e.top < 0 {
 		e.top = 0
 	}
-	if p.column < e.left {
-		e.left = p.column
+	// e.left is measured in screen columns
+	pointLine := e.CurrentLine()
+	pointCol := displayColumn(pointLine, p.column)
+	pointWidth := 1
+	if p.column < len(pointLine) {
+		pointWidth = runeWidth(pointLine[p.column])
 	}
-	if p.column >= e.left+tp.Width() {
-		e.left = p.column - tp.Width() + 1
+	if pointCol < e.left {
+		e.left = pointCol
+	}
+	if pointCol+pointWidth > e.left+tp.Width() {
+		e.left = pointCol + pointWidth - tp.Width()
 	}
 	if e.left < 0 {
 		e.left = 0
@@ -479,42 +593,82 @@ func (e *Editor) Render(tp TilePane, currentToken *Token) {
 		highlightStart = currentToken.pos.Column - 1
 		highlightEnd = highlightStart + currentToken.length
 	}
+	// the delimiter at (or right before) the point and its match
+	var delimPoints []EditorPoint
+	delimColor := ColorMatch
+	if d, ok := e.delimiterAtPoint(); ok {
+		if match, ok, found := e.matchingDelimiter(d); ok {
+			delimPoints = append(delimPoints, d)
+			if found {
+				delimPoints = append(delimPoints, match)
+			} else {
+				delimColor = ColorMismatch
+			}
+		}
+	}
+	for y := range gutter.Height() {
+		if c, ok := e.lineMarks[e.top+y]; ok {
+			gutter.WithBg(c, func() {
+				gutter.DrawRune(0, y, ' ')
+			})
+		}
+	}
 	for y := 0; y < tp.Height(); y++ {
 		lineIndex := e.top + y
 		if lineIndex >= len(e.lines) {
 			break
 		}
 		line := e.lines[lineIndex]
-		for x := 0; x < tp.Width(); x++ {
-			runeIndex := e.left + x
-			insideCurrent := currentToken != nil && lineIndex == highlightLine && runeIndex >= highlightStart && runeIndex < highlightEnd
+		col := 0
+		for runeIndex := 0; runeIndex <= len(line); runeIndex++ {
+			isPoint := lineIndex == p.line && runeIndex == p.column
+			if runeIndex == len(line) && !isPoint {
+				break
+			}
+			r := ' '
 			if runeIndex < len(line) {
-				r := line[runeIndex]
-				if insideCurrent {
-					tp.WithBg(ColorCurrentToken, func() {
-						tp.DrawRune(x, y, r)
-					})
-				} else if lineIndex == p.line && runeIndex == p.column {
-					tp.WithBg(ColorHighlight, func() {
-						tp.DrawRune(x, y, r)
-					})
-				} else if e.markActive && e.InsideRegion(lineIndex, runeIndex) {
-					tp.WithBg(ColorMark, func() {
-						tp.DrawRune(x, y, r)
-					})
-				} else {
+				r = line[runeIndex]
+			}
+			x := col - e.left
+			col += runeWidth(r)
+			if x >= tp.Width() {
+				break
+			}
+			if x < 0 {
+				// rune scrolled (partially) out of view
+				continue
+			}
+			insideCurrent := currentToken != nil && lineIndex == highlightLine && runeIndex >= highlightStart && runeIndex < highlightEnd
+			insideError := e.errorLen > 0 && lineIndex == e.errorPoint.line && runeIndex >= e.errorPoint.column && runeIndex < e.errorPoint.column+e.errorLen
+			if insideCurrent {
+				tp.WithBg(ColorCurrentToken, func() {
 					tp.DrawRune(x, y, r)
-				}
-			} else if lineIndex == p.line && runeIndex == p.column {
+				})
+			} else if isPoint {
 				tp.WithBg(ColorHighlight, func() {
-					tp.DrawRune(x, y, ' ')
+					tp.DrawRune(x, y, r)
 				})
+			} else if insideError {
+				tp.WithBg(ColorMismatch, func() {
+					tp.DrawRune(x, y, r)
+				})
+			} else if slices.Contains(delimPoints, EditorPoint{line: lineIndex, column: runeIndex}) {
+				tp.WithBg(delimColor, func() {
+					tp.DrawRune(x, y, r)
+				})
+			} else if e.markActive && e.InsideRegion(lineIndex, runeIndex) {
+				tp.WithBg(ColorMark, func() {
+					tp.DrawRune(x, y, r)
+				})
+			} else {
+				tp.DrawRune(x, y, r)
 			}
 		}
 	}
+	e.renderCompletion(tp)
 }
 
-func (e *Editor) RenderStatusLine(tp TilePane, bufferName string, dirty bool, currentToken *Token, nftotal, nfdone int) {
+func (e *Editor) RenderStatusLine(tp TilePane, bufferName string, dirty bool, currentToken *Token, progress string) {
 	label := bufferName
 	if dirty {
 		label += " *"
@@ -524,15 +678,15 @@ func (e *Editor) RenderStatusLine(tp TilePane, bufferName string, dirty bool, cu
 	if currentToken != nil {
 		rightText = currentToken.String()
 	}
-	if nftotal != 0 {
-		rightText += fmt.Sprintf(" %d%%", nfdone*100/nftotal)
+	if progress != "" {
+		rightText += " " + progress
 	}
 	paddedWidth := tp.Width() - 2
 	if paddedWidth <= 0 {
 		return
 	}
-	leftTextSize := utf8.RuneCountInString(leftText)
-	rightStart := max(paddedWidth-utf8.RuneCountInString(rightText), leftTextSize+1)
+	leftTextSize := stringWidth(leftText)
+	rightStart := max(paddedWidth-stringWidth(rightText), leftTextSize+1)
 	tp.WithFgBg(ColorWhite, ColorBlue, func() {
 		tp.Clear()
 		tp.DrawString(1, 0, leftText)
@@ -561,13 +715,24 @@ func (e *Editor) Close() error {
 	return nil
 }
 func (e *Editor) HandleKey(key Key) (KeyHandler, bool) {
-	return e.keymap.HandleKey(key)
+	if e.completion != nil && e.handleCompletionKey(key) {
+		return nil, true
+	}
+	next, handled := e.keymap.HandleKey(key)
+	e.updateCompletion()
+	return next, handled
 }
 
 func (e *Editor) Dirty() bool {
 	return e.dirty
 }
 
+// Edits returns the number of edits made so far, which changes with
+// every edit.
+func (e *Editor) Edits() int {
+	return e.edits
+}
+
 func (e *Editor) MarkClean() {
 	e.dirty = false
 }
@@ -575,45 +740,53 @@ func (e *Editor) MarkClean() {
 func (e *Editor) initKeymap() {
 	e.keymap = CreateKeyMap()
 
-	e.keymap.Bind("Left", func() { e.AdvanceColumn(-1) })
-	e.keymap.Bind("Right", func() { e.AdvanceColumn(1) })
-	e.keymap.Bind("Up", func() { e.AdvanceLine(-1) })
-	e.keymap.Bind("Down", func() { e.AdvanceLine(1) })
-	e.keymap.Bind("Home", e.MoveToBOL)
-	e.keymap.Bind("End", e.MoveToEOL)
-	e.keymap.Bind("C-Home", e.MoveToBOF)
-	e.keymap.Bind("C-End", e.MoveToEOF)
-	e.keymap.Bind("PageUp", func() {
+	e.keymap.BindAction("editor.left", "Left", func() { e.AdvanceColumn(-1) })
+	e.keymap.BindAction("editor.right", "Right", func() { e.AdvanceColumn(1) })
+	e.keymap.BindAction("editor.up", "Up", func() { e.AdvanceLine(-1) })
+	e.keymap.BindAction("editor.down", "Down", func() { e.AdvanceLine(1) })
+	e.keymap.BindAction("editor.line-start", "Home", e.MoveToBOL)
+	e.keymap.BindAction("editor.line-end", "End", e.MoveToEOL)
+	e.keymap.BindAction("editor.buffer-start", "C-Home", e.MoveToBOF)
+	e.keymap.BindAction("editor.buffer-end", "C-End", e.MoveToEOF)
+	e.keymap.BindAction("editor.page-up", "PageUp", func() {
 		for range e.height {
 			e.AdvanceLine(-1)
 		}
 	})
-	e.keymap.Bind("PageDown", func() {
+	e.keymap.BindAction("editor.page-down", "PageDown", func() {
 		for range e.height {
 			e.AdvanceLine(1)
 		}
 	})
 	// Word and mark operations
-	e.keymap.Bind("C-Left", e.WordLeft)
-	e.keymap.Bind("C-Right", e.WordRight)
-	e.keymap.Bind("M-b", e.WordLeft)
-	e.keymap.Bind("M-f", e.WordRight)
-	e.keymap.Bind("C-a", e.MoveToBOL)
-	e.keymap.Bind("C-e", e.MoveToEOL)
-	e.keymap.Bind("C-Space", e.SetMark)
-	e.keymap.Bind("M-w", e.YankRegion)
+	e.keymap.BindAction("editor.word-left", "C-Left", e.WordLeft)
+	e.keymap.BindAction("editor.word-right", "C-Right", e.WordRight)
+	e.keymap.BindAction("editor.word-left", "M-b", e.WordLeft)
+	e.keymap.BindAction("editor.word-right", "M-f", e.WordRight)
+	e.keymap.BindAction("editor.line-start", "C-a", e.MoveToBOL)
+	e.keymap.BindAction("editor.line-end", "C-e", e.MoveToEOL)
+	e.keymap.BindAction("editor.set-mark", "C-Space", e.SetMark)
+	e.keymap.BindAction("editor.copy", "M-w", e.YankRegion)
 
 	// Editing with undo support
-	e.keymap.Bind("Enter", func() {
+	e.keymap.BindAction("editor.newline", "Enter", func() {
 		e.DispatchAction(func() UndoFunc {
+			start := e.GetPoint()
 			e.SplitLine()
+			removed, inserted := e.IndentLine()
 			return func() {
-				e.AdvanceColumn(-1)
+				e.SetPoint(EditorPoint{line: start.line + 1})
+				for range inserted {
+					e.DeleteRune()
+				}
+				e.InsertRunes(removed)
+				e.SetPoint(start)
 				e.DeleteRune()
 			}
 		})
 	})
-	e.keymap.Bind("Delete", func() {
+	e.keymap.BindAction("editor.matching-delimiter", "M-m", e.JumpToMatchingDelimiter)
+	e.keymap.BindAction("editor.delete", "Delete", func() {
 		e.DispatchAction(func() UndoFunc {
 			deletedRune := e.DeleteRune()
 			return func() {
@@ -624,7 +797,7 @@ func (e *Editor) initKeymap() {
 			}
 		})
 	})
-	e.keymap.Bind("Backspace", func() {
+	e.keymap.BindAction("editor.backspace", "Backspace", func() {
 		if e.AtBOF() {
 			return
 		}
@@ -638,7 +811,12 @@ func (e *Editor) initKeymap() {
 			}
 		})
 	})
-	e.keymap.Bind("Tab", func() {
+	e.keymap.BindAction("editor.complete", "M-/", func() { e.Complete() })
+	e.keymap.BindAction("editor.indent-or-complete", "Tab", func() {
+		// complete the word before the point, indent if there is none
+		if e.canComplete() && e.Complete() {
+			return
+		}
 		e.DispatchAction(func() UndoFunc {
 			start := e.GetPoint()
 			e.InsertSpacesUntilNextTabStop()
@@ -657,7 +835,7 @@ func (e *Editor) initKeymap() {
 			}
 		})
 	})
-	e.keymap.Bind("C-k", func() {
+	e.keymap.BindAction("editor.kill-line", "C-k", func() {
 		e.DispatchAction(func() UndoFunc {
 			start := e.GetPoint()
 			var deletedRunes []rune
@@ -682,17 +860,7 @@ func (e *Editor) initKeymap() {
 			}
 		})
 	})
-	e.keymap.Bind("C-Backspace", func() {
-		e.DispatchAction(func() UndoFunc {
-			e.SetMark()
-			e.WordLeft()
-			deletedRunes := e.KillRegion()
-			return func() {
-				e.InsertRunes(deletedRunes)
-			}
-		})
-	})
-	e.keymap.Bind("C-u", func() {
+	e.keymap.BindAction("editor.kill-line-start", "C-u", func() {
 		e.DispatchAction(func() UndoFunc {
 			e.SetMark()
 			e.MoveToBOL()
@@ -702,7 +870,7 @@ func (e *Editor) initKeymap() {
 			}
 		})
 	})
-	e.keymap.Bind("C-w", func() {
+	e.keymap.BindAction("editor.cut", "C-w", func() {
 		e.DispatchAction(func() UndoFunc {
 			start := e.GetPoint()
 			p, _ := e.PointAndMarkInOrder()
@@ -714,7 +882,7 @@ func (e *Editor) initKeymap() {
 			}
 		})
 	})
-	e.keymap.Bind("C-y", func() {
+	e.keymap.BindAction("editor.paste", "C-y", func() {
 		e.DispatchAction(func() UndoFunc {
 			p0 := e.GetPoint()
 			e.Paste()
@@ -724,7 +892,7 @@ func (e *Editor) initKeymap() {
 			}
 		})
 	})
-	e.keymap.Bind("M-Backspace", func() {
+	killWordLeft := func() {
 		e.DispatchAction(func() UndoFunc {
 			e.SetMark()
 			e.WordLeft()
@@ -738,7 +906,9 @@ func (e *Editor) initKeymap() {
 				e.InsertRunes(deletedRunes)
 			}
 		})
-	})
+	}
+	e.keymap.BindAction("editor.kill-word-left", "C-Backspace", killWordLeft)
+	e.keymap.BindAction("editor.kill-word-left", "M-Backspace", killWordLeft)
 }
 
 func (e *Editor) OnChar(char rune) {
@@ -749,4 +919,5 @@ func (e *Editor) OnChar(char rune) {
 			e.DeleteRune()
 		}
 	})
+	e.updateCompletion()
 }
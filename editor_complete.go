@@ -0,0 +1,264 @@
+//go:build cgo && !js
+
+package main
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// maxCompletionRows is the number of candidates shown at once by the
+// completion popup.
+const maxCompletionRows = 8
+
+// Completer returns the candidates for completing prefix, best first.
+type Completer func(prefix string) []string
+
+type completion struct {
+	start      EditorPoint // where the completed word starts
+	candidates []string
+	index      int
+	top        int
+}
+
+func (c *completion) move(delta int) {
+	n := len(c.candidates)
+	c.index = ((c.index+delta)%n + n) % n
+	if c.index < c.top {
+		c.top = c.index
+	}
+	if c.index >= c.top+maxCompletionRows {
+		c.top = c.index - maxCompletionRows + 1
+	}
+}
+
+func isCompletionConstituent(r rune) bool {
+	return !unicode.IsSpace(r) && !isOpener(r) && !isCloser(r) && r != '"' && r != ';'
+}
+
+func (e *Editor) SetCompleter(completer Completer) {
+	e.completer = completer
+}
+
+// completionStart returns where the word before the point starts. The
+// > of the set shorthand is not part of the word.
+func (e *Editor) completionStart() EditorPoint {
+	line := e.CurrentLine()
+	start := min(e.point.column, len(line))
+	for start > 0 && isCompletionConstituent(line[start-1]) {
+		start--
+	}
+	if start < e.point.column && line[start] == '>' {
+		start++
+	}
+	return EditorPoint{line: e.point.line, column: start}
+}
+
+// canComplete reports whether the point is at the end of a word.
+func (e *Editor) canComplete() bool {
+	if e.completer == nil || e.readOnly {
+		return false
+	}
+	line := e.CurrentLine()
+	if e.point.column < len(line) && isCompletionConstituent(line[e.point.column]) {
+		return false
+	}
+	return e.completionStart().column < e.point.column
+}
+
+// Complete completes the word before the point: a single candidate is
+// inserted right away, more are offered in a popup. It returns false
+// if there is nothing to complete.
+func (e *Editor) Complete() bool {
+	e.completion = nil
+	if !e.canComplete() {
+		return false
+	}
+	start := e.completionStart()
+	candidates := e.completer(string(e.CurrentLine()[start.column:e.point.column]))
+	switch len(candidates) {
+	case 0:
+		return false
+	case 1:
+		e.insertCompletion(start, candidates[0])
+	default:
+		e.completion = &completion{start: start, candidates: candidates}
+	}
+	return true
+}
+
+// updateCompletion filters the candidates of the popup after the word
+// before the point has changed, closing it if none are left.
+func (e *Editor) updateCompletion() {
+	c := e.completion
+	if c == nil {
+		return
+	}
+	e.completion = nil
+	if e.point.line != c.start.line || e.point.column <= c.start.column || !e.canComplete() {
+		return
+	}
+	if candidates := e.completer(string(e.CurrentLine()[c.start.column:e.point.column])); len(candidates) > 0 {
+		e.completion = &completion{start: c.start, candidates: candidates}
+	}
+}
+
+// insertCompletion replaces the text between start and the point with
+// text.
+func (e *Editor) insertCompletion(start EditorPoint, text string) {
+	e.DispatchAction(func() UndoFunc {
+		end := e.GetPoint()
+		line := e.lines[start.line]
+		replaced := slices.Clone(line[start.column:end.column])
+		inserted := []rune(text)
+		e.lines[start.line] = slices.Replace(line, start.column, end.column, inserted...)
+		e.point.column = start.column + len(inserted)
+		e.dirty = true
+		return func() {
+			line := e.lines[start.line]
+			e.lines[start.line] = slices.Replace(line, start.column, start.column+len(inserted), replaced...)
+			e.SetPoint(end)
+		}
+	})
+}
+
+// handleCompletionKey handles the keys which act on the completion
+// popup. Other keys close it, except Backspace which filters it.
+func (e *Editor) handleCompletionKey(key Key) bool {
+	c := e.completion
+	switch key {
+	case "Down", "Tab", "C-n":
+		c.move(1)
+	case "Up", "S-Tab", "C-p":
+		c.move(-1)
+	case "Enter":
+		e.completion = nil
+		e.insertCompletion(c.start, c.candidates[c.index])
+	case "Escape", "C-g":
+		e.completion = nil
+	case "Backspace":
+		return false
+	default:
+		e.completion = nil
+		return false
+	}
+	return true
+}
+
+// renderCompletion draws the completion popup below the word being
+// completed, or above it if there is no room below.
+func (e *Editor) renderCompletion(tp TilePane) {
+	c := e.completion
+	if c == nil {
+		return
+	}
+	shown := c.candidates[c.top:min(c.top+maxCompletionRows, len(c.candidates))]
+	width := 0
+	for _, s := range shown {
+		width = max(width, stringWidth(s)+2)
+	}
+	width = min(width, tp.Width())
+	y := c.start.line - e.top + 1
+	if y+len(shown) > tp.Height() && y-1-len(shown) >= 0 {
+		y -= 1 + len(shown)
+	}
+	x := displayColumn(e.lines[c.start.line], c.start.column) - e.left - 1
+	x = max(min(x, tp.Width()-width), 0)
+	for i, s := range shown {
+		if y+i < 0 || y+i >= tp.Height() {
+			continue
+		}
+		row := truncateToWidth(" "+s, width)
+		row += strings.Repeat(" ", max(width-stringWidth(row), 0))
+		fg, bg := ColorText, ColorMark
+		if c.top+i == c.index {
+			fg, bg = ColorWhite, ColorBlue
+		}
+		tp.WithFgBg(fg, bg, func() {
+			tp.DrawString(x, y+i, row)
+		})
+	}
+}
+
+// envKeys returns the keys of env which can be typed as words.
+func envKeys(env Map) []string {
+	var keys []string
+	for k := range env {
+		switch k := k.(type) {
+		case Str:
+			keys = append(keys, string(k))
+		case Sym:
+			keys = append(keys, string(k))
+		}
+	}
+	return keys
+}
+
+// rootEnvKeys returns the words and :keys of the root env.
+func rootEnvKeys() []string {
+	rootEnvMu.RLock()
+	defer rootEnvMu.RUnlock()
+	return envKeys(rootEnv)
+}
+
+// methodNames returns the names of the methods registered with
+// RegisterMethod.
+func methodNames() []string {
+	var names []string
+	for _, methods := range []TypeMethodMap{typeMethods, interfaceMethods} {
+		for _, mm := range methods {
+			for name := range mm {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// bufferKeys returns the :keys used in the editor, except for the one
+// being typed at the point.
+func (e *Editor) bufferKeys() []string {
+	var keys []string
+	for lineIndex, line := range e.lines {
+		for i := 0; i < len(line); {
+			if !isCompletionConstituent(line[i]) {
+				i++
+				continue
+			}
+			start := i
+			for i < len(line) && isCompletionConstituent(line[i]) {
+				i++
+			}
+			if lineIndex == e.point.line && i == e.point.column {
+				continue
+			}
+			word := strings.TrimPrefix(string(line[start:i]), ">")
+			if len(word) > 1 && word[0] == ':' {
+				keys = append(keys, word)
+			}
+		}
+	}
+	return keys
+}
+
+// matchCompletions returns the names containing prefix (ignoring case)
+// like the search of ListDisplay, those starting with it first. The
+// prefix itself is not a candidate.
+func matchCompletions(names []string, prefix string) []string {
+	needle := strings.ToLower(prefix)
+	var starting, containing []string
+	for _, name := range names {
+		lower := strings.ToLower(name)
+		switch {
+		case name == prefix:
+		case strings.HasPrefix(lower, needle):
+			starting = append(starting, name)
+		case strings.Contains(lower, needle):
+			containing = append(containing, name)
+		}
+	}
+	slices.Sort(starting)
+	slices.Sort(containing)
+	return slices.Concat(slices.Compact(starting), slices.Compact(containing))
+}
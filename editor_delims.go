@@ -0,0 +1,180 @@
+//go:build cgo && !js
+
+package main
+
+import "slices"
+
+// IndentWidth is the number of spaces added per level of unclosed
+// delimiters by auto-indentation.
+const IndentWidth = 2
+
+func isOpener(r rune) bool {
+	return r == '(' || r == '[' || r == '{'
+}
+
+func isCloser(r rune) bool {
+	return r == ')' || r == ']' || r == '}'
+}
+
+func closerOf(opener rune) rune {
+	switch opener {
+	case '(':
+		return ')'
+	case '[':
+		return ']'
+	default:
+		return '}'
+	}
+}
+
+// scanDelimiters calls fn with the position of each delimiter before
+// end which is not inside a string or a comment.
+func scanDelimiters(lines []EditorLine, end EditorPoint, fn func(p EditorPoint, r rune)) {
+lines:
+	for lineIndex := 0; lineIndex <= end.line && lineIndex < len(lines); lineIndex++ {
+		line := lines[lineIndex]
+		inString, escaped := false, false
+		for i, r := range line {
+			if lineIndex == end.line && i >= end.column {
+				break
+			}
+			switch {
+			case inString:
+				switch {
+				case escaped:
+					escaped = false
+				case r == '\\':
+					escaped = true
+				case r == '"':
+					inString = false
+				}
+			case r == '"':
+				inString = true
+			case r == ';' && (i == 0 || isDelimiterOrSpace(line[i-1])):
+				// comment until the end of the line
+				continue lines
+			case isOpener(r) || isCloser(r):
+				fn(EditorPoint{line: lineIndex, column: i}, r)
+			}
+		}
+	}
+}
+
+func isDelimiterOrSpace(r rune) bool {
+	return r == ' ' || r == '\t' || isOpener(r) || isCloser(r)
+}
+
+type delimiter struct {
+	p EditorPoint
+	r rune
+}
+
+// openDelimiters returns the delimiters opened before end which are
+// still open there, innermost last.
+func (e *Editor) openDelimiters(end EditorPoint) []delimiter {
+	var stack []delimiter
+	scanDelimiters(e.lines, end, func(p EditorPoint, r rune) {
+		if isOpener(r) {
+			stack = append(stack, delimiter{p, r})
+		} else if len(stack) > 0 && closerOf(stack[len(stack)-1].r) == r {
+			stack = stack[:len(stack)-1]
+		}
+	})
+	return stack
+}
+
+// delimiterAtPoint returns the position of the delimiter the point is
+// on or, if it isn't on one, the closing delimiter right before it.
+func (e *Editor) delimiterAtPoint() (EditorPoint, bool) {
+	p := e.point
+	line := e.lines[p.line]
+	if p.column < len(line) && (isOpener(line[p.column]) || isCloser(line[p.column])) {
+		return p, true
+	}
+	if p.column > 0 && p.column <= len(line) && isCloser(line[p.column-1]) {
+		return EditorPoint{line: p.line, column: p.column - 1}, true
+	}
+	return EditorPoint{}, false
+}
+
+// matchingDelimiter returns the position of the delimiter matching the
+// one at p. ok is false if p is not a delimiter (or is in a string or
+// comment), found is false if it has no match.
+func (e *Editor) matchingDelimiter(p EditorPoint) (match EditorPoint, ok, found bool) {
+	var stack []delimiter
+	scanDelimiters(e.lines, EditorPoint{line: len(e.lines)}, func(q EditorPoint, r rune) {
+		if q == p {
+			ok = true
+		}
+		if isOpener(r) {
+			stack = append(stack, delimiter{q, r})
+			return
+		}
+		if len(stack) == 0 || closerOf(stack[len(stack)-1].r) != r {
+			// a stray or mismatched closer has no match
+			return
+		}
+		opener := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		switch p {
+		case q:
+			match, found = opener.p, true
+		case opener.p:
+			match, found = q, true
+		}
+	})
+	return match, ok, found
+}
+
+// JumpToMatchingDelimiter moves the point to the delimiter matching
+// the one at (or right before) the point.
+func (e *Editor) JumpToMatchingDelimiter() {
+	p, ok := e.delimiterAtPoint()
+	if !ok {
+		return
+	}
+	if match, _, found := e.matchingDelimiter(p); found {
+		e.point = match
+	}
+}
+
+// indentation returns the number of leading spaces and tabs of line.
+func indentation(line EditorLine) int {
+	n := 0
+	for n < len(line) && (line[n] == ' ' || line[n] == '\t') {
+		n++
+	}
+	return n
+}
+
+// IndentLine replaces the indentation of the current line with
+// IndentWidth spaces per level of delimiters left open on the lines
+// above it: one level more than the line of the innermost open
+// delimiter, or the same if the line starts with its closer. It
+// returns the removed indentation and the number of spaces inserted.
+func (e *Editor) IndentLine() (removed []rune, inserted int) {
+	if e.readOnly {
+		return nil, 0
+	}
+	lineIndex := e.point.line
+	line := e.lines[lineIndex]
+	want := 0
+	if open := e.openDelimiters(EditorPoint{line: lineIndex}); len(open) > 0 {
+		innermost := open[len(open)-1]
+		want = displayColumn(e.lines[innermost.p.line], indentation(e.lines[innermost.p.line]))
+		rest := line[indentation(line):]
+		if len(rest) == 0 || rest[0] != closerOf(innermost.r) {
+			want += IndentWidth
+		}
+	}
+	n := indentation(line)
+	removed = slices.Clone(line[:n])
+	indent := make(EditorLine, want)
+	for i := range indent {
+		indent[i] = ' '
+	}
+	e.lines[lineIndex] = slices.Concat(indent, line[n:])
+	e.point.column = max(e.point.column-n, 0) + want
+	e.dirty = true
+	return removed, want
+}
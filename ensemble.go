@@ -0,0 +1,101 @@
+package main
+
+import (
+	"math"
+)
+
+// The ensemble of a string machine: three delay lines around
+// ensembleDelay, each modulated by a slow and a fast LFO, the LFOs of
+// the lines a third of a cycle apart.
+const (
+	ensembleLines     = 3
+	ensembleDelay     = 0.008  // seconds
+	ensembleSlowRate  = 0.63   // Hz
+	ensembleSlowDepth = 0.0020 // seconds
+	ensembleFastRate  = 6.1    // Hz
+	ensembleFastDepth = 0.0003 // seconds
+	ensembleCutoff    = 8000.0 // Hz, the rolloff of the BBDs
+)
+
+// ensemblePans are the positions of the delay lines in the stereo field.
+var ensemblePans = [ensembleLines]float64{-1, 0, 1}
+
+// Ensemble runs the mono sum of input through the delay lines of a
+// string machine ensemble and returns their stereo mix blended with the
+// dry signal by mix. depth scales the modulation of the delays.
+func Ensemble(input, depth, mix Stream) Stream {
+	return makeTransformStreamN(2, []Stream{input, depth, mix}, func(inputs []Stream) Stepper {
+		inext := inputs[0].Mono().Next
+		dnext := inputs[1].Mono().Next
+		mnext := inputs[2].Mono().Next
+		sr := float64(SampleRate())
+		maxDepth := 2.0
+		bufSize := int(math.Ceil((ensembleDelay+maxDepth*(ensembleSlowDepth+ensembleFastDepth))*sr)) + 2
+		buf := make([]float64, bufSize)
+		writeIdx := 0
+		var gains [ensembleLines][2]float64
+		for i, p := range ensemblePans {
+			l, r := equalPowerPan(p)
+			gains[i] = [2]float64{l, r}
+		}
+		lp := make([]float64, ensembleLines)
+		lpCoef := 1 - math.Exp(-2*math.Pi*ensembleCutoff/sr)
+		slowPhase, fastPhase := 0.0, 0.0
+		out := make(Frame, 2)
+		return func() (Frame, bool) {
+			frame, ok := inext()
+			if !ok {
+				return nil, false
+			}
+			dframe, ok := dnext()
+			if !ok {
+				return nil, false
+			}
+			mframe, ok := mnext()
+			if !ok {
+				return nil, false
+			}
+			x := float64(frame[0])
+			d := min(max(float64(dframe[0]), 0), maxDepth)
+			m := min(max(float64(mframe[0]), 0), 1)
+			buf[writeIdx] = x
+			var wet [2]float64
+			for i := range ensembleLines {
+				offset := float64(i) / ensembleLines
+				mod := ensembleSlowDepth*math.Sin(2*math.Pi*(slowPhase+offset)) +
+					ensembleFastDepth*math.Sin(2*math.Pi*(fastPhase+offset))
+				delay := (ensembleDelay + d*mod) * sr
+				y := delayTap(buf, 1, 0, writeIdx, delay)
+				lp[i] += lpCoef * (y - lp[i])
+				wet[0] += gains[i][0] * lp[i]
+				wet[1] += gains[i][1] * lp[i]
+			}
+			for c := range out {
+				out[c] = Smp((1-m)*x + m*wet[c]/math.Sqrt(ensembleLines))
+			}
+			writeIdx = (writeIdx + 1) % bufSize
+			slowPhase = wrapPhase(slowPhase + ensembleSlowRate/sr)
+			fastPhase = wrapPhase(fastPhase + ensembleFastRate/sr)
+			return out, true
+		}
+	})
+}
+
+func init() {
+	RegisterWord("ensemble", func(vm *VM) error {
+		input, err := streamFromVal(vm.Pop())
+		if err != nil {
+			return err
+		}
+		depth, err := vm.GetStream(":ensemble/depth")
+		if err != nil {
+			return err
+		}
+		mix, err := vm.GetStream(":ensemble/mix")
+		if err != nil {
+			return err
+		}
+		vm.Push(Ensemble(input, depth, mix))
+		return nil
+	})
+}
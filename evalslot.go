@@ -0,0 +1,194 @@
+//go:build cgo && !js
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// EvalSlot is a place where evaluations run: a VM of its own with the
+// progress of its current render. Each buffer (and the REPL) evaluates
+// in its own slot, so a long render of one buffer can go on in the
+// background while another one is edited, evaluated and auditioned.
+// Top-level definitions go to the env of the slot, layered over the
+// root env shared by all slots.
+type EvalSlot struct {
+	name       string
+	buffer     *Buffer // nil for the REPL
+	vm         *VM
+	env        Map
+	lastScript []byte // last script successfully evaluated in the slot
+	// rTape points to the currently rendered tape
+	rTape        *Tape
+	rTotalFrames int
+	rDoneFrames  int
+	rStartTime   time.Time // when rendering rTape started
+	rPauseTime   time.Time // when the render was paused
+}
+
+func (app *App) createEvalSlot(name string, buffer *Buffer) (*EvalSlot, error) {
+	vm, err := CreateVM()
+	if err != nil {
+		return nil, err
+	}
+	vm.sandbox = app.vm.sandbox
+	slot := &EvalSlot{
+		name:   name,
+		buffer: buffer,
+		vm:     vm,
+		env:    make(Map),
+	}
+	vm.SetBaseEnvs(slot.env)
+	vm.tapeProgressCallback = func(t *Tape, nftotal, nfdone int) {
+		now := time.Now()
+		app.postEvent(func() {
+			if vm.IsEvaluating() {
+				if slot.rTape != t {
+					slot.rStartTime = now
+				}
+				slot.rTape = t
+				slot.rTotalFrames = nftotal
+				slot.rDoneFrames = nfdone
+			}
+		}, true)
+	}
+	vm.inspectCallback = func(v Val) {
+		app.postEvent(func() {
+			app.Inspect(v)
+		}, false)
+	}
+	app.slots = append(app.slots, slot)
+	return slot, nil
+}
+
+// bufferSlot returns the slot of buffer, or nil if it has not been
+// evaluated yet.
+func (app *App) bufferSlot(buffer *Buffer) *EvalSlot {
+	for _, slot := range app.slots {
+		if slot.buffer == buffer {
+			return slot
+		}
+	}
+	return nil
+}
+
+// ensureBufferSlot returns the slot of buffer, creating it if needed.
+func (app *App) ensureBufferSlot(buffer *Buffer) (*EvalSlot, error) {
+	if slot := app.bufferSlot(buffer); slot != nil {
+		return slot, nil
+	}
+	return app.createEvalSlot(buffer.Name, buffer)
+}
+
+// closeBufferSlot cancels the evaluation of a killed buffer and forgets
+// its slot.
+func (app *App) closeBufferSlot(buffer *Buffer) {
+	for i, slot := range app.slots {
+		if slot.buffer == buffer {
+			slot.Cancel()
+			app.slots = append(app.slots[:i], app.slots[i+1:]...)
+			return
+		}
+	}
+}
+
+// currentSlot returns the slot the current screen works with: the
+// slot of the REPL on the REPL screen, the one of the tutorial on the
+// tutorial screen, the slot of the current buffer everywhere else. It
+// returns nil if that buffer has no slot yet.
+func (app *App) currentSlot() *EvalSlot {
+	switch app.currentScreenName {
+	case "repl":
+		return app.replSlot
+	case "tutorial":
+		return app.tutorialSlot
+	}
+	if buffer := app.bm.GetCurrentBuffer(); buffer != nil {
+		return app.bufferSlot(buffer)
+	}
+	return nil
+}
+
+// isEvaluating reports whether an evaluation is running in any slot.
+func (app *App) isEvaluating() bool {
+	for _, slot := range app.slots {
+		if slot.vm.IsEvaluating() {
+			return true
+		}
+	}
+	return false
+}
+
+// CancelAll cancels the evaluations running in all slots.
+func (app *App) CancelAll() {
+	for _, slot := range app.slots {
+		slot.Cancel()
+	}
+}
+
+// backgroundProgress describes the progress of the evaluations running
+// in the slots other than current, or returns "" if there are none.
+func (app *App) backgroundProgress(current *EvalSlot) string {
+	var parts []string
+	for _, slot := range app.slots {
+		if slot == current || !slot.vm.IsEvaluating() {
+			continue
+		}
+		progress := slot.renderProgress()
+		if progress == "" {
+			progress = "evaluating"
+		}
+		parts = append(parts, slot.name+": "+progress)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Cancel cancels the evaluation running in the slot.
+func (slot *EvalSlot) Cancel() {
+	if slot.vm.IsEvaluating() {
+		slot.vm.CancelEvaluation()
+	}
+	slot.resetRenderProgress()
+}
+
+// TogglePause pauses the evaluation running in the slot or resumes a
+// paused one. The time spent paused does not count towards the time
+// left.
+func (slot *EvalSlot) TogglePause() {
+	switch {
+	case slot.vm.IsPaused():
+		slot.vm.ResumeEvaluation()
+		slot.rStartTime = slot.rStartTime.Add(time.Since(slot.rPauseTime))
+	case slot.vm.IsEvaluating():
+		slot.vm.PauseEvaluation()
+		slot.rPauseTime = time.Now()
+	}
+}
+
+func (slot *EvalSlot) resetRenderProgress() {
+	slot.rTape = nil
+	slot.rTotalFrames = 0
+	slot.rDoneFrames = 0
+}
+
+// renderProgress describes the progress of the tape being rendered,
+// with an estimate of the time left, or returns "" if nothing is being
+// rendered.
+func (slot *EvalSlot) renderProgress() string {
+	if slot.rTotalFrames == 0 {
+		if slot.vm.IsPaused() {
+			return "paused"
+		}
+		return ""
+	}
+	progress := fmt.Sprintf("%d%%", slot.rDoneFrames*100/slot.rTotalFrames)
+	if slot.vm.IsPaused() {
+		return progress + ", paused"
+	}
+	if eta, ok := estimateTimeLeft(time.Since(slot.rStartTime), slot.rDoneFrames, slot.rTotalFrames); ok {
+		progress += ", " + formatTimeLeft(eta) + " left"
+	}
+	return progress
+}
@@ -1,3 +1,5 @@
+//go:build cgo && !js
+
 package main
 
 import (
@@ -19,7 +21,7 @@ type FileScreen struct {
 
 func CreateFileScreen(app *App) (*FileScreen, error) {
 	keymap := CreateKeyMap()
-	tapeDisplay, err := CreateTapeDisplay()
+	tapeDisplay, err := app.createTapeDisplay()
 	if err != nil {
 		return nil, err
 	}
@@ -33,8 +35,8 @@ func CreateFileScreen(app *App) (*FileScreen, error) {
 		tapeDisplay: tapeDisplay,
 		app:         app,
 	}
-	keymap.Bind("M-w", func() { fs.copyPath() })
-	keymap.Bind("C-p", func() { fs.playSelected(app) })
+	keymap.BindAction("files.copy-path", "M-w", func() { fs.copyPath() })
+	keymap.BindAction("files.play", "C-p", func() { fs.playSelected(app) })
 	return fs, nil
 }
 
@@ -79,10 +81,10 @@ func (fs *FileScreen) Render(app *App, ts *TileScreen) {
 		var tapePane TilePane
 		browserPane, tapePane = pane.SplitY(-8)
 		playheadFrames := []int{}
-		for _, tp := range app.oto.GetTapePlayers(fs) {
+		for _, tp := range app.audio.GetTapePlayers(fs) {
 			playheadFrames = append(playheadFrames, tp.GetCurrentFrame())
 		}
-		fs.tapeDisplay.Render(fs.lastTape, tapePane.GetPixelRect(), fs.lastTape.nframes, 0, playheadFrames)
+		renderTapeView(tapePane, fs.tapeDisplay, fs.lastTape, fs.lastTape.nframes, 0, playheadFrames, false, tapeSelection{})
 	}
 
 	fs.fileBrowser.Render(browserPane)
@@ -99,7 +101,9 @@ func (fs *FileScreen) playSelected(app *App) {
 	}
 	path := canonicalPath(entry.path)
 	if path == fs.lastPlayedPath && fs.lastTape != nil {
-		app.oto.PlayTape(fs.lastTape, fs)
+		if err := app.audio.PlayTape(fs.lastTape, nil, fs); err != nil {
+			fs.app.SetLastError(err)
+		}
 		return
 	}
 	tape, err := loadSample(path)
@@ -109,5 +113,7 @@ func (fs *FileScreen) playSelected(app *App) {
 	}
 	fs.lastPlayedPath = path
 	fs.lastTape = tape
-	app.oto.PlayTape(tape, fs)
+	if err := app.audio.PlayTape(tape, nil, fs); err != nil {
+		fs.app.SetLastError(err)
+	}
 }
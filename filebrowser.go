@@ -1,3 +1,5 @@
+//go:build cgo && !js
+
 package main
 
 import (
@@ -51,16 +53,16 @@ type FileBrowser struct {
 
 func (fb *FileBrowser) initKeymap() {
 	fb.keymap = CreateKeyMap()
-	fb.keymap.Bind("Up", func() { fb.MoveBy(-1) })
-	fb.keymap.Bind("Down", func() { fb.MoveBy(1) })
-	fb.keymap.Bind("Home", func() { fb.MoveTo(0) })
-	fb.keymap.Bind("End", func() { fb.MoveToEnd() })
-	fb.keymap.Bind("PageUp", func() { fb.MoveBy(-fb.PageSize()) })
-	fb.keymap.Bind("PageDown", func() { fb.MoveBy(fb.PageSize()) })
-	fb.keymap.Bind("Enter", func() { fb.handleEnter() })
-	fb.keymap.Bind("Backspace", func() { _, _ = fb.HandleBackspace() })
-	fb.keymap.Bind("Escape", func() { fb.Exit() })
-	fb.keymap.Bind("C-g", func() { fb.Exit() })
+	fb.keymap.BindAction("files.up", "Up", func() { fb.MoveBy(-1) })
+	fb.keymap.BindAction("files.down", "Down", func() { fb.MoveBy(1) })
+	fb.keymap.BindAction("files.first", "Home", func() { fb.MoveTo(0) })
+	fb.keymap.BindAction("files.last", "End", func() { fb.MoveToEnd() })
+	fb.keymap.BindAction("files.page-up", "PageUp", func() { fb.MoveBy(-fb.PageSize()) })
+	fb.keymap.BindAction("files.page-down", "PageDown", func() { fb.MoveBy(fb.PageSize()) })
+	fb.keymap.BindAction("files.select", "Enter", func() { fb.handleEnter() })
+	fb.keymap.BindAction("files.backspace", "Backspace", func() { _, _ = fb.HandleBackspace() })
+	fb.keymap.BindAction("files.exit", "Escape", func() { fb.Exit() })
+	fb.keymap.BindAction("files.exit", "C-g", func() { fb.Exit() })
 }
 
 func (fb *FileBrowser) Keymap() KeyMap {
@@ -273,6 +275,16 @@ func (fb *FileBrowser) enterSelection(selected *FileEntry) (bool, error) {
 	return false, nil
 }
 
+// HandleMouse selects the clicked entry and enters it on double click.
+func (fb *FileBrowser) HandleMouse(ev MouseEvent) {
+	if ev.Action != MousePress || ev.Button != MouseLeft {
+		return
+	}
+	if fb.listDisplay.SelectAt(ev.Cell) && ev.Clicks == 2 {
+		fb.handleEnter()
+	}
+}
+
 func (fb *FileBrowser) Render(tp TilePane) {
 	height := tp.Height()
 	if height <= 0 {
@@ -284,7 +296,7 @@ func (fb *FileBrowser) Render(tp TilePane) {
 	header.DrawString(0, 0, fb.Directory())
 	if fb.SearchText() != "" {
 		header.WithFgBg(ColorWhite, ColorGreen, func() {
-			header.DrawString(len(fb.Directory())+1, 0, fmt.Sprintf("[%s]", fb.SearchText()))
+			header.DrawString(stringWidth(fb.Directory())+1, 0, fmt.Sprintf("[%s]", fb.SearchText()))
 		})
 	}
 
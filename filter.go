@@ -58,27 +58,25 @@ func OnePole(s Stream, a float64) Stream {
 		a = 1
 	}
 	nchannels := s.nchannels
-	return makeTransformStream([]Stream{s}, func(inputs []Stream) Stepper {
+	return makeBlockTransformStream([]Stream{s}, func(inputs []Stream) BlockStepper {
 		prev := make(Frame, nchannels)
-		out := make(Frame, nchannels)
-		next := inputs[0].Next
+		in := inputs[0]
 		initialized := false
-		return func() (Frame, bool) {
-			frame, ok := next()
-			if !ok {
-				return nil, false
-			}
-			if !initialized {
-				copy(prev, frame)
-				copy(out, prev)
-				initialized = true
-			} else {
+		return func(buf []Smp) int {
+			n := in.NextBlock(buf)
+			for i := range n {
+				frame := buf[i*nchannels : (i+1)*nchannels]
+				if !initialized {
+					copy(prev, frame)
+					initialized = true
+					continue
+				}
 				for c := range nchannels {
 					prev[c] = Smp(a)*prev[c] + Smp(1-a)*frame[c]
-					out[c] = prev[c]
+					frame[c] = prev[c]
 				}
 			}
-			return out, true
+			return n
 		}
 	})
 }
@@ -107,33 +105,33 @@ func cutoffToAlpha(cutoff float64) float64 {
 // LP1 applies a first-order lowpass with cutoff in Hz.
 func LP1(input, cutoff Stream) Stream {
 	nchannels := input.nchannels
-	return makeTransformStream([]Stream{input, cutoff}, func(inputs []Stream) Stepper {
-		inNext := inputs[0].Next
-		cNext := inputs[1].Mono().Next
+	return makeBlockTransformStream([]Stream{input, cutoff}, func(inputs []Stream) BlockStepper {
+		in := inputs[0]
+		cutoff := inputs[1].Mono()
+		cbuf := make([]Smp, blockFrames)
 		prev := make(Frame, nchannels)
-		out := make(Frame, nchannels)
 		initialized := false
-		return func() (Frame, bool) {
-			inFrame, ok := inNext()
-			if !ok {
-				return nil, false
-			}
-			cFrame, ok := cNext()
-			if !ok {
-				return nil, false
-			}
-			alpha := cutoffToAlpha(float64(cFrame[0]))
-			if !initialized {
-				copy(prev, inFrame)
-				copy(out, inFrame)
-				initialized = true
-				return out, true
-			}
-			for ch := range nchannels {
-				prev[ch] = Smp(alpha)*prev[ch] + Smp(1-alpha)*inFrame[ch]
-				out[ch] = prev[ch]
+		lastCutoff, alpha := Smp(-1), 0.0
+		return func(buf []Smp) int {
+			n := in.NextBlock(buf)
+			n = cutoff.NextBlock(cbuf[:n])
+			for i, c := range cbuf[:n] {
+				if c != lastCutoff {
+					// cutoffs are mostly constant or slow
+					lastCutoff, alpha = c, cutoffToAlpha(float64(c))
+				}
+				frame := buf[i*nchannels : (i+1)*nchannels]
+				if !initialized {
+					copy(prev, frame)
+					initialized = true
+					continue
+				}
+				for ch := range nchannels {
+					prev[ch] = Smp(alpha)*prev[ch] + Smp(1-alpha)*frame[ch]
+					frame[ch] = prev[ch]
+				}
 			}
-			return out, true
+			return n
 		}
 	})
 }
@@ -141,35 +139,35 @@ func LP1(input, cutoff Stream) Stream {
 // HP1 applies a first-order highpass with cutoff in Hz.
 func HP1(input, cutoff Stream) Stream {
 	nchannels := input.nchannels
-	return makeTransformStream([]Stream{input, cutoff}, func(inputs []Stream) Stepper {
-		inNext := inputs[0].Next
-		cNext := inputs[1].Mono().Next
+	return makeBlockTransformStream([]Stream{input, cutoff}, func(inputs []Stream) BlockStepper {
+		in := inputs[0]
+		cutoff := inputs[1].Mono()
+		cbuf := make([]Smp, blockFrames)
 		lp := make(Frame, nchannels)
-		out := make(Frame, nchannels)
 		initialized := false
-		return func() (Frame, bool) {
-			inFrame, ok := inNext()
-			if !ok {
-				return nil, false
-			}
-			cFrame, ok := cNext()
-			if !ok {
-				return nil, false
-			}
-			alpha := cutoffToAlpha(float64(cFrame[0]))
-			if !initialized {
-				copy(lp, inFrame)
+		lastCutoff, alpha := Smp(-1), 0.0
+		return func(buf []Smp) int {
+			n := in.NextBlock(buf)
+			n = cutoff.NextBlock(cbuf[:n])
+			for i, c := range cbuf[:n] {
+				if c != lastCutoff {
+					// cutoffs are mostly constant or slow
+					lastCutoff, alpha = c, cutoffToAlpha(float64(c))
+				}
+				frame := buf[i*nchannels : (i+1)*nchannels]
+				if !initialized {
+					copy(lp, frame)
+					initialized = true
+				} else {
+					for ch := range nchannels {
+						lp[ch] = Smp(alpha)*lp[ch] + Smp(1-alpha)*frame[ch]
+					}
+				}
 				for ch := range nchannels {
-					out[ch] = inFrame[ch] - lp[ch]
+					frame[ch] -= lp[ch]
 				}
-				initialized = true
-				return out, true
 			}
-			for ch := range nchannels {
-				lp[ch] = Smp(alpha)*lp[ch] + Smp(1-alpha)*inFrame[ch]
-				out[ch] = inFrame[ch] - lp[ch]
-			}
-			return out, true
+			return n
 		}
 	})
 }
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+)
+
+// maxDesignOrder limits the order of the designed filters: the
+// coefficients of a single direct form filter of higher order lose too
+// much precision.
+const maxDesignOrder = 16
+
+// zpk is a filter given by its zeros, poles and gain.
+type zpk struct {
+	z, p []complex128
+	k    float64
+}
+
+// butterPrototype returns the analog Butterworth lowpass of order n
+// with a cutoff of 1 rad/s.
+func butterPrototype(n int) zpk {
+	p := make([]complex128, n)
+	for i := range p {
+		p[i] = cmplx.Exp(complex(0, math.Pi*float64(2*i+n+1)/float64(2*n)))
+	}
+	return zpk{p: p, k: 1}
+}
+
+// cheby1Prototype returns the analog Chebyshev type I lowpass of order
+// n with ripple dB of ripple in the passband, which ends at 1 rad/s.
+func cheby1Prototype(n int, ripple float64) zpk {
+	eps := math.Sqrt(math.Pow(10, ripple/10) - 1)
+	mu := math.Asinh(1/eps) / float64(n)
+	p := make([]complex128, n)
+	for i := range p {
+		theta := math.Pi * float64(2*i+1) / float64(2*n)
+		p[i] = complex(-math.Sinh(mu)*math.Sin(theta), math.Cosh(mu)*math.Cos(theta))
+	}
+	k := real(prodNeg(p))
+	if n%2 == 0 {
+		k /= math.Sqrt(1 + eps*eps)
+	}
+	return zpk{p: p, k: k}
+}
+
+// ellipPrototype returns the analog elliptic lowpass of order n with
+// ripple dB of ripple in the passband, which ends at 1 rad/s, and an
+// attenuation of atten dB in the stopband. It follows S. J. Orfanidis,
+// Lecture Notes on Elliptic Filter Design (2006), with arguments of the
+// elliptic functions in units of the quarter period.
+func ellipPrototype(n int, ripple, atten float64) zpk {
+	ep := math.Sqrt(math.Pow(10, ripple/10) - 1)
+	es := math.Sqrt(math.Pow(10, atten/10) - 1)
+	k1 := ep / es
+	k := ellipDegree(n, k1)
+	l := n / 2
+	var z, p []complex128
+	v0 := -1i * ellipAsn(complex(0, 1/ep), k1) / complex(float64(n), 0)
+	for i := 1; i <= l; i++ {
+		u := complex(float64(2*i-1)/float64(n), 0)
+		zeta := ellipCd(u, k)
+		zero := 1i / (complex(k, 0) * zeta)
+		pole := 1i * ellipCd(u-1i*v0, k)
+		z = append(z, zero, cmplx.Conj(zero))
+		p = append(p, pole, cmplx.Conj(pole))
+	}
+	if n%2 == 1 {
+		p = append(p, complex(real(1i*ellipSn(1i*v0, k)), 0))
+	}
+	h0 := 1.0
+	if n%2 == 0 {
+		h0 = 1 / math.Sqrt(1+ep*ep)
+	}
+	return zpk{z: z, p: p, k: h0 * real(prodNeg(p)/prodNeg(z))}
+}
+
+// landen returns the descending Landen sequence of the modulus k.
+func landen(k float64) []float64 {
+	var v []float64
+	for range 10 {
+		k = math.Pow(k/(1+math.Sqrt(1-k*k)), 2)
+		v = append(v, k)
+		if k < 1e-16 {
+			break
+		}
+	}
+	return v
+}
+
+// ellipCd returns the Jacobi elliptic function cd(uK, k).
+func ellipCd(u complex128, k float64) complex128 {
+	return ellipAscend(cmplx.Cos(u*math.Pi/2), k)
+}
+
+// ellipSn returns the Jacobi elliptic function sn(uK, k).
+func ellipSn(u complex128, k float64) complex128 {
+	return ellipAscend(cmplx.Sin(u*math.Pi/2), k)
+}
+
+func ellipAscend(w complex128, k float64) complex128 {
+	v := landen(k)
+	for i := len(v) - 1; i >= 0; i-- {
+		vi := complex(v[i], 0)
+		w = (1 + vi) * w / (1 + vi*w*w)
+	}
+	return w
+}
+
+// ellipAsn returns u such that sn(uK, k) = w.
+func ellipAsn(w complex128, k float64) complex128 {
+	v := landen(k)
+	prev := k
+	for _, vi := range v {
+		w = w / (1 + cmplx.Sqrt(1-w*w*complex(prev*prev, 0))) * complex(2/(1+vi), 0)
+		prev = vi
+	}
+	return 1 - cmplx.Acos(w)*2/math.Pi
+}
+
+// ellipDegree solves the degree equation of an elliptic filter of order
+// n for the selectivity modulus k from the discrimination modulus k1.
+func ellipDegree(n int, k1 float64) float64 {
+	k1p := math.Sqrt(1 - k1*k1)
+	prod := 1.0
+	for i := 1; i <= n/2; i++ {
+		prod *= real(ellipSn(complex(float64(2*i-1)/float64(n), 0), k1p))
+	}
+	kp := math.Pow(k1p, float64(n)) * math.Pow(prod, 4)
+	return math.Sqrt(1 - kp*kp)
+}
+
+// prodNeg returns the product of the negated values of xs.
+func prodNeg(xs []complex128) complex128 {
+	prod := complex(1, 0)
+	for _, x := range xs {
+		prod *= -x
+	}
+	return prod
+}
+
+// lowpassToLowpass moves the cutoff of the analog lowpass f from 1 to
+// wo rad/s.
+func (f zpk) lowpassToLowpass(wo float64) zpk {
+	z := make([]complex128, len(f.z))
+	p := make([]complex128, len(f.p))
+	for i, x := range f.z {
+		z[i] = x * complex(wo, 0)
+	}
+	for i, x := range f.p {
+		p[i] = x * complex(wo, 0)
+	}
+	return zpk{z: z, p: p, k: f.k * math.Pow(wo, float64(len(p)-len(z)))}
+}
+
+// lowpassToHighpass turns the analog lowpass f with a cutoff of 1 rad/s
+// into a highpass with a cutoff of wo rad/s.
+func (f zpk) lowpassToHighpass(wo float64) zpk {
+	z := make([]complex128, 0, len(f.p))
+	p := make([]complex128, len(f.p))
+	for _, x := range f.z {
+		z = append(z, complex(wo, 0)/x)
+	}
+	for i, x := range f.p {
+		p[i] = complex(wo, 0) / x
+	}
+	for len(z) < len(p) {
+		z = append(z, 0)
+	}
+	return zpk{z: z, p: p, k: f.k * real(prodNeg(f.z)/prodNeg(f.p))}
+}
+
+// bilinear maps the analog filter f to a digital one at the sample
+// rate sr, zeros at infinity going to Nyquist.
+func (f zpk) bilinear(sr float64) zpk {
+	fs2 := complex(2*sr, 0)
+	z := make([]complex128, 0, len(f.p))
+	p := make([]complex128, len(f.p))
+	num, den := complex(1, 0), complex(1, 0)
+	for _, x := range f.z {
+		z = append(z, (fs2+x)/(fs2-x))
+		num *= fs2 - x
+	}
+	for i, x := range f.p {
+		p[i] = (fs2 + x) / (fs2 - x)
+		den *= fs2 - x
+	}
+	for len(z) < len(p) {
+		z = append(z, -1)
+	}
+	return zpk{z: z, p: p, k: f.k * real(num/den)}
+}
+
+// poly returns the real coefficients of the polynomial with roots,
+// highest power first.
+func poly(roots []complex128) []float64 {
+	c := []complex128{1}
+	for _, r := range roots {
+		next := make([]complex128, len(c)+1)
+		for i, x := range c {
+			next[i] += x
+			next[i+1] -= x * r
+		}
+		c = next
+	}
+	result := make([]float64, len(c))
+	for i, x := range c {
+		result[i] = real(x)
+	}
+	return result
+}
+
+// designIIR turns the analog lowpass prototype into the coefficients
+// of a digital lowpass or highpass (btype) with a cutoff of cutoff Hz.
+func designIIR(proto zpk, cutoff float64, btype string) (b, a Vec, err error) {
+	sr := float64(SampleRate())
+	if cutoff <= 0 || cutoff >= sr/2 {
+		return nil, nil, fmt.Errorf("cutoff must be between 0 and %v Hz, got %v", sr/2, cutoff)
+	}
+	// prewarp, so that the digital filter has its cutoff at cutoff
+	wo := 2 * sr * math.Tan(math.Pi*cutoff/sr)
+	var f zpk
+	switch btype {
+	case "lowpass":
+		f = proto.lowpassToLowpass(wo)
+	case "highpass":
+		f = proto.lowpassToHighpass(wo)
+	default:
+		return nil, nil, fmt.Errorf(`type must be "lowpass" or "highpass", got %q`, btype)
+	}
+	f = f.bilinear(sr)
+	for _, c := range poly(f.z) {
+		b = append(b, Num(f.k*c))
+	}
+	for _, c := range poly(f.p) {
+		a = append(a, Num(c))
+	}
+	return b, a, nil
+}
+
+func checkDesignOrder(order int) error {
+	if order < 1 || order > maxDesignOrder {
+		return fmt.Errorf("order must be in 1..%d, got %d", maxDesignOrder, order)
+	}
+	return nil
+}
+
+func init() {
+	RegisterGoFunc("iir/butter", func(order int, cutoff float64, btype string) (Vec, Vec, error) {
+		if err := checkDesignOrder(order); err != nil {
+			return nil, nil, err
+		}
+		return designIIR(butterPrototype(order), cutoff, btype)
+	})
+
+	RegisterGoFunc("iir/cheby1", func(order int, cutoff, ripple float64, btype string) (Vec, Vec, error) {
+		if err := checkDesignOrder(order); err != nil {
+			return nil, nil, err
+		}
+		if ripple <= 0 {
+			return nil, nil, fmt.Errorf("ripple must be positive, got %v", ripple)
+		}
+		return designIIR(cheby1Prototype(order, ripple), cutoff, btype)
+	})
+
+	RegisterGoFunc("iir/ellip", func(order int, cutoff, ripple, atten float64, btype string) (Vec, Vec, error) {
+		if err := checkDesignOrder(order); err != nil {
+			return nil, nil, err
+		}
+		if ripple <= 0 || atten <= ripple {
+			return nil, nil, fmt.Errorf("expected 0 < ripple < attenuation, got %v and %v", ripple, atten)
+		}
+		return designIIR(ellipPrototype(order, ripple, atten), cutoff, btype)
+	})
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"bufio"
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// flacBlockSize is the number of frames in each FLAC frame.
+const flacBlockSize = 4096
+
+// flacMaxPartitionOrder limits the search for the best partitioning of
+// the residual of a subframe.
+const flacMaxPartitionOrder = 6
+
+// WriteToFile writes t to path as a FLAC file if path has a .flac
+// extension, as a WAV file otherwise.
+func (t *Tape) WriteToFile(path string) error {
+	if strings.ToLower(filepath.Ext(path)) == ".flac" {
+		return t.WriteToFlac(path)
+	}
+	return t.WriteToWav(path)
+}
+
+// WriteToFlac writes t to path as a 16-bit FLAC file, losslessly
+// compressed with the fixed predictors of the format. Like the WAV
+// writer, it records the version of mixtape in the file (as the vendor
+// string of the Vorbis comment).
+func (t *Tape) WriteToFlac(path string) error {
+	if t.nchannels < 1 || t.nchannels > 8 {
+		return fmt.Errorf("flac: cannot write %d channels", t.nchannels)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	if err := writeFlac(w, t.flacSamples(), t.nchannels, SampleRate()); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// flacSamples returns the samples of t as clipped 16-bit integers,
+// one slice per channel.
+func (t *Tape) flacSamples() [][]int32 {
+	channels := make([][]int32, t.nchannels)
+	for ch := range channels {
+		channels[ch] = make([]int32, t.nframes)
+	}
+	for i, smp := range t.samples[:t.nframes*t.nchannels] {
+		channels[i%t.nchannels][i/t.nchannels] = int32(min(max(math.Round(smp*32767), -32768), 32767))
+	}
+	return channels
+}
+
+func writeFlac(w *bufio.Writer, channels [][]int32, nchannels, sampleRate int) error {
+	nframes := len(channels[0])
+	w.WriteString("fLaC")
+
+	// STREAMINFO
+	var info flacBitWriter
+	info.write(flacBlockSize, 16) // minimum block size
+	info.write(flacBlockSize, 16) // maximum block size
+	info.write(0, 24)             // minimum frame size: unknown
+	info.write(0, 24)             // maximum frame size: unknown
+	info.write(uint64(sampleRate), 20)
+	info.write(uint64(nchannels-1), 3)
+	info.write(16-1, 5)
+	info.write(uint64(nframes), 36)
+	sum := flacMD5(channels)
+	info.bytes = append(info.bytes, sum[:]...)
+	writeFlacMetadataBlock(w, 0, false, info.bytes)
+
+	// VORBIS_COMMENT with the vendor string only
+	vendor := "mixtape " + Version
+	comment := binary.LittleEndian.AppendUint32(nil, uint32(len(vendor)))
+	comment = append(comment, vendor...)
+	comment = binary.LittleEndian.AppendUint32(comment, 0)
+	writeFlacMetadataBlock(w, 4, true, comment)
+
+	for n, start := 0, 0; start < nframes; n, start = n+1, start+flacBlockSize {
+		end := min(start+flacBlockSize, nframes)
+		block := make([][]int32, nchannels)
+		for ch := range block {
+			block[ch] = channels[ch][start:end]
+		}
+		if _, err := w.Write(encodeFlacFrame(n, block)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeFlacMetadataBlock(w *bufio.Writer, blockType byte, last bool, data []byte) {
+	if last {
+		blockType |= 0x80
+	}
+	w.WriteByte(blockType)
+	w.Write([]byte{byte(len(data) >> 16), byte(len(data) >> 8), byte(len(data))})
+	w.Write(data)
+}
+
+// flacMD5 returns the MD5 sum of the interleaved little-endian samples,
+// which decoders use to verify the decoded audio.
+func flacMD5(channels [][]int32) [md5.Size]byte {
+	h := md5.New()
+	buf := make([]byte, 0, 2*len(channels)*flacBlockSize)
+	for i := range channels[0] {
+		for _, samples := range channels {
+			buf = binary.LittleEndian.AppendUint16(buf, uint16(int16(samples[i])))
+		}
+		if len(buf) == cap(buf) {
+			h.Write(buf)
+			buf = buf[:0]
+		}
+	}
+	h.Write(buf)
+	var sum [md5.Size]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
+
+// encodeFlacFrame encodes frame n holding the samples of block, one
+// slice per channel, coded independently.
+func encodeFlacFrame(n int, block [][]int32) []byte {
+	var bw flacBitWriter
+	bw.write(0x3ffe, 14) // sync code
+	bw.write(0, 1)       // reserved
+	bw.write(0, 1)       // fixed block size
+	bw.write(0x7, 4)     // block size - 1 follows as 16 bits
+	bw.write(0, 4)       // sample rate from STREAMINFO
+	bw.write(uint64(len(block)-1), 4)
+	bw.write(0x4, 3) // 16 bits per sample
+	bw.write(0, 1)   // reserved
+	bw.bytes = appendFlacUTF8(bw.bytes, uint32(n))
+	bw.write(uint64(len(block[0])-1), 16)
+	bw.bytes = append(bw.bytes, flacCRC8(bw.bytes))
+	for _, samples := range block {
+		encodeFlacSubframe(&bw, samples)
+	}
+	bw.align()
+	crc := flacCRC16(bw.bytes)
+	return append(bw.bytes, byte(crc>>8), byte(crc))
+}
+
+// encodeFlacSubframe writes the subframe of one channel: constant if
+// all samples are equal, otherwise the fixed predictor of the order
+// leaving the smallest residual, or verbatim if nothing compresses.
+func encodeFlacSubframe(bw *flacBitWriter, samples []int32) {
+	constant := true
+	for _, s := range samples {
+		if s != samples[0] {
+			constant = false
+			break
+		}
+	}
+	if constant {
+		bw.write(0, 8)
+		bw.writeSigned(int64(samples[0]), 16)
+		return
+	}
+	bestOrder := -1
+	bestBits := 16 * len(samples)
+	var bestResidual []int64
+	var bestPartitions []flacPartition
+	for order := range min(5, len(samples)) {
+		residual := flacFixedResidual(samples, order)
+		partitions, nbits := flacPartitionResidual(residual, len(samples), order)
+		nbits += 16 * order
+		if nbits < bestBits {
+			bestOrder, bestBits = order, nbits
+			bestResidual, bestPartitions = residual, partitions
+		}
+	}
+	if bestOrder < 0 {
+		bw.write(0x01<<1, 8) // verbatim
+		for _, s := range samples {
+			bw.writeSigned(int64(s), 16)
+		}
+		return
+	}
+	bw.write(uint64(0x08|bestOrder)<<1, 8) // fixed predictor
+	for _, s := range samples[:bestOrder] {
+		bw.writeSigned(int64(s), 16)
+	}
+	bw.write(0, 2) // Rice coding with 4-bit parameters
+	bw.write(uint64(bits.Len(uint(len(bestPartitions)))-1), 4)
+	i := 0
+	for _, p := range bestPartitions {
+		bw.write(uint64(p.param), 4)
+		for _, r := range bestResidual[i : i+p.n] {
+			bw.writeRice(zigzag(r), p.param)
+		}
+		i += p.n
+	}
+}
+
+// flacFixedResidual returns the residual of the fixed predictor of the
+// given order over samples, which starts after the first order samples.
+func flacFixedResidual(samples []int32, order int) []int64 {
+	residual := make([]int64, len(samples)-order)
+	for i := order; i < len(samples); i++ {
+		s := func(k int) int64 { return int64(samples[i-k]) }
+		var r int64
+		switch order {
+		case 0:
+			r = s(0)
+		case 1:
+			r = s(0) - s(1)
+		case 2:
+			r = s(0) - 2*s(1) + s(2)
+		case 3:
+			r = s(0) - 3*s(1) + 3*s(2) - s(3)
+		case 4:
+			r = s(0) - 4*s(1) + 6*s(2) - 4*s(3) + s(4)
+		}
+		residual[i-order] = r
+	}
+	return residual
+}
+
+// flacPartition is a run of residual coded with one Rice parameter.
+type flacPartition struct {
+	n     int // number of residual samples
+	param int
+}
+
+// flacPartitionResidual picks the partition order and the Rice
+// parameter of each partition coding the residual of a predictor of the
+// given order over blockSize samples in the fewest bits.
+func flacPartitionResidual(residual []int64, blockSize, order int) ([]flacPartition, int) {
+	var best []flacPartition
+	bestBits := math.MaxInt
+	for porder := 0; porder <= flacMaxPartitionOrder; porder++ {
+		nparts := 1 << porder
+		if blockSize%nparts != 0 || blockSize/nparts <= order {
+			break
+		}
+		partitions := make([]flacPartition, nparts)
+		nbits := 6
+		i := 0
+		for p := range partitions {
+			n := blockSize / nparts
+			if p == 0 {
+				n -= order
+			}
+			param, pbits := flacRiceParam(residual[i : i+n])
+			partitions[p] = flacPartition{n: n, param: param}
+			nbits += 4 + pbits
+			i += n
+		}
+		if nbits < bestBits {
+			best, bestBits = partitions, nbits
+		}
+	}
+	return best, bestBits
+}
+
+// flacRiceParam returns the Rice parameter coding residual in the
+// fewest bits, and the number of bits.
+func flacRiceParam(residual []int64) (int, int) {
+	bestParam, bestBits := 0, math.MaxInt
+	for param := range 15 {
+		nbits := 0
+		for _, r := range residual {
+			nbits += int(zigzag(r)>>param) + 1 + param
+		}
+		if nbits < bestBits {
+			bestParam, bestBits = param, nbits
+		}
+	}
+	return bestParam, bestBits
+}
+
+func zigzag(r int64) uint64 {
+	return uint64(r<<1) ^ uint64(r>>63)
+}
+
+// appendFlacUTF8 appends n in the extended UTF-8 coding FLAC uses for
+// frame numbers.
+func appendFlacUTF8(b []byte, n uint32) []byte {
+	if n < 0x80 {
+		return append(b, byte(n))
+	}
+	nbytes := 2
+	for n >= 1<<(5*nbytes+1) {
+		nbytes++
+	}
+	lead := byte(0xff << (8 - nbytes))
+	b = append(b, lead|byte(n>>(6*(nbytes-1))))
+	for i := nbytes - 2; i >= 0; i-- {
+		b = append(b, 0x80|byte(n>>(6*i))&0x3f)
+	}
+	return b
+}
+
+func flacCRC8(data []byte) byte {
+	var crc byte
+	for _, b := range data {
+		crc ^= b
+		for range 8 {
+			if crc&0x80 != 0 {
+				crc = crc<<1 ^ 0x07
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+func flacCRC16(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for range 8 {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x8005
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// flacBitWriter packs values MSB first.
+type flacBitWriter struct {
+	bytes []byte
+	nbits int // bits used in the last byte, 0 if it is full
+}
+
+func (bw *flacBitWriter) write(v uint64, n int) {
+	for n > 0 {
+		if bw.nbits == 0 {
+			bw.bytes = append(bw.bytes, 0)
+		}
+		free := 8 - bw.nbits
+		k := min(free, n)
+		chunk := byte(v>>(n-k)) & byte(1<<k-1)
+		bw.bytes[len(bw.bytes)-1] |= chunk << (free - k)
+		bw.nbits = (bw.nbits + k) % 8
+		n -= k
+	}
+}
+
+func (bw *flacBitWriter) writeSigned(v int64, n int) {
+	bw.write(uint64(v)&(1<<n-1), n)
+}
+
+// writeRice writes u as its quotient by 2^param in unary followed by
+// the param low bits.
+func (bw *flacBitWriter) writeRice(u uint64, param int) {
+	for q := u >> param; q > 0; {
+		k := min(q, 32)
+		bw.write(0, int(k))
+		q -= k
+	}
+	bw.write(1, 1)
+	bw.write(u, param)
+}
+
+func (bw *flacBitWriter) align() {
+	bw.nbits = 0
+}
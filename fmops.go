@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// maxFMOperators is the largest number of operators of an FM voice.
+const maxFMOperators = 8
+
+// fmOperator is a sine operator of an FM voice. Its output is
+// level*env*sin(2π(phase+mod)), its phase advancing at ratio times the
+// frequency of the voice.
+type fmOperator struct {
+	ratio, level, env Stream
+}
+
+// fmAlgorithm routes the operators of an FM voice: mod[i][j] is the
+// amount by which operator j modulates the phase of operator i (in
+// cycles at full output), mod[i][i] its feedback, and out[i] the gain
+// of operator i in the output of the voice.
+type fmAlgorithm struct {
+	mod   [][]float64
+	out   []float64
+	order []int // operators in the order they are computed each frame
+}
+
+// fmOperatorFromVal parses an operator given as [ ratio level env ],
+// where env may be left out.
+func fmOperatorFromVal(v Val) (fmOperator, error) {
+	vec, ok := v.(Vec)
+	if !ok || len(vec) < 2 || len(vec) > 3 {
+		return fmOperator{}, fmt.Errorf("expected [ ratio level env ], got %v", v)
+	}
+	parts := []Stream{Num(1).Stream(), Num(1).Stream(), Num(1).Stream()}
+	for i, x := range vec {
+		s, err := streamFromVal(x)
+		if err != nil {
+			return fmOperator{}, err
+		}
+		parts[i] = s
+	}
+	return fmOperator{ratio: parts[0], level: parts[1], env: parts[2]}, nil
+}
+
+// numsFromVal returns the numbers of a Vec of n numbers.
+func numsFromVal(v Val, n int) ([]float64, error) {
+	vec, ok := v.(Vec)
+	if !ok || len(vec) != n {
+		return nil, fmt.Errorf("expected a vector of %d numbers, got %v", n, v)
+	}
+	nums := make([]float64, n)
+	for i, x := range vec {
+		num, ok := x.(Num)
+		if !ok {
+			return nil, fmt.Errorf("expected a vector of %d numbers, got %v", n, v)
+		}
+		nums[i] = float64(num)
+	}
+	return nums, nil
+}
+
+func newFMAlgorithm(mod [][]float64, out []float64) *fmAlgorithm {
+	alg := &fmAlgorithm{mod: mod, out: out}
+	// depth-first, so that modulators are computed before the
+	// operators they modulate; in a cycle, one of them has to use the
+	// output of its modulator from the previous frame
+	visited := make([]bool, len(mod))
+	var visit func(i int)
+	visit = func(i int) {
+		visited[i] = true
+		for j, amount := range mod[i] {
+			if amount != 0 && !visited[j] {
+				visit(j)
+			}
+		}
+		alg.order = append(alg.order, i)
+	}
+	for i := range mod {
+		if !visited[i] {
+			visit(i)
+		}
+	}
+	return alg
+}
+
+// FMVoice plays the operators at freq, routed by alg. The voice lasts
+// as long as the longest of its finite parameters. An envelope which
+// has ended stays at 0, other parameters at their last value.
+func FMVoice(freq Stream, ops []fmOperator, alg *fmAlgorithm) Stream {
+	inputs := []Stream{freq}
+	for _, op := range ops {
+		inputs = append(inputs, op.ratio, op.level, op.env)
+	}
+	nframes := 0
+	for _, s := range inputs {
+		nframes = max(nframes, s.nframes)
+	}
+	return makeRewindableStream(1, nframes, func() Stepper {
+		nexts := make([]func() (Frame, bool), len(inputs))
+		for i, s := range inputs {
+			nexts[i] = s.clone().Mono().Next
+		}
+		n := len(ops)
+		values := make([]Smp, len(inputs))
+		phases := make([]float64, n)
+		// outputs of the operators, of this frame for the operators
+		// already computed, of the previous frame for the others
+		outputs := make([]float64, n)
+		older := make([]float64, n) // outputs of the frame before that
+		sr := float64(SampleRate())
+		out := make(Frame, 1)
+		remaining := nframes
+		return func() (Frame, bool) {
+			if nframes > 0 {
+				if remaining == 0 {
+					return nil, false
+				}
+				remaining--
+			}
+			for i, next := range nexts {
+				if next == nil {
+					continue
+				}
+				frame, ok := next()
+				if !ok {
+					nexts[i] = nil
+					if i > 0 && i%3 == 0 {
+						values[i] = 0 // env
+					}
+					continue
+				}
+				values[i] = frame[0]
+			}
+			freq := values[0]
+			var sum float64
+			for _, i := range alg.order {
+				mod := 0.0
+				for j, amount := range alg.mod[i] {
+					switch {
+					case amount == 0:
+					case j == i:
+						// the mean of the last two outputs keeps high
+						// feedback from oscillating at Nyquist
+						mod += amount * (outputs[i] + older[i]) / 2
+					default:
+						mod += amount * outputs[j]
+					}
+				}
+				ratio, level, env := values[1+3*i], values[2+3*i], values[3+3*i]
+				y := level * env * math.Sin(2*math.Pi*(phases[i]+mod))
+				older[i], outputs[i] = outputs[i], y
+				sum += alg.out[i] * y
+				phases[i] = wrapPhase(phases[i] + freq*ratio/sr)
+			}
+			out[0] = Smp(sum)
+			return out, true
+		}
+	})
+}
+
+func init() {
+	RegisterWord("~fm/ops", func(vm *VM) error {
+		outVal := vm.Pop()
+		modVal := vm.Pop()
+		opsVal := vm.Pop()
+		opVec, ok := opsVal.(Vec)
+		if !ok || len(opVec) < 1 || len(opVec) > maxFMOperators {
+			return fmt.Errorf("~fm/ops: expected a vector of 1 to %d operators, got %v", maxFMOperators, opsVal)
+		}
+		n := len(opVec)
+		ops := make([]fmOperator, n)
+		for i, v := range opVec {
+			op, err := fmOperatorFromVal(v)
+			if err != nil {
+				return fmt.Errorf("~fm/ops: operator %d: %w", i, err)
+			}
+			ops[i] = op
+		}
+		modVec, ok := modVal.(Vec)
+		if !ok || len(modVec) != n {
+			return fmt.Errorf("~fm/ops: expected a %dx%d modulation matrix, got %v", n, n, modVal)
+		}
+		mod := make([][]float64, n)
+		for i, row := range modVec {
+			nums, err := numsFromVal(row, n)
+			if err != nil {
+				return fmt.Errorf("~fm/ops: modulation matrix row %d: %w", i, err)
+			}
+			mod[i] = nums
+		}
+		out, err := numsFromVal(outVal, n)
+		if err != nil {
+			return fmt.Errorf("~fm/ops: output gains: %w", err)
+		}
+		freq, err := vm.GetStream(":freq")
+		if err != nil {
+			return err
+		}
+		vm.Push(FMVoice(freq, ops, newFMAlgorithm(mod, out)))
+		return nil
+	})
+}
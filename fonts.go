@@ -1,3 +1,5 @@
+//go:build cgo && !js
+
 package main
 
 import (
@@ -8,6 +10,7 @@ import (
 	"golang.org/x/image/draw"
 	"golang.org/x/image/font"
 	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
 	"golang.org/x/image/math/fixed"
 )
 
@@ -45,22 +48,27 @@ func (f *Font) GetFace(size FontSizeInPoints, scale float32) (font.Face, error)
 	return face, nil
 }
 
-func (f *Font) GetFaceImage(face font.Face, sizeInTiles Size) (image.Image, error) {
-	cols, rows := sizeInTiles.X, sizeInTiles.Y
-	if cols <= 0 || rows <= 0 {
-		return nil, fmt.Errorf("sizeInTiles must be positive, got %v", sizeInTiles)
-	}
+// HasGlyph reports whether the font provides a glyph for r.
+func (f *Font) HasGlyph(r rune) bool {
+	var buf sfnt.Buffer
+	x, err := f.font.GlyphIndex(&buf, r)
+	return err == nil && x != 0
+}
+
+// GetCellSize returns the size of a single-width character cell: the
+// widest advance among the first nGlyphs runes by the line height.
+func (f *Font) GetCellSize(face font.Face, nGlyphs int) (Size, error) {
 	metrics := face.Metrics()
-	ascent := metrics.Ascent.Ceil()
-	descent := metrics.Descent.Ceil()
 	tileHeight := metrics.Height.Ceil()
 	if tileHeight == 0 {
-		tileHeight = ascent + descent
+		tileHeight = metrics.Ascent.Ceil() + metrics.Descent.Ceil()
 	}
-	nGlyphs := cols * rows
 	maxWidth := 0
 	for i := range nGlyphs {
 		r := rune(i)
+		if runeWidth(r) != 1 {
+			continue
+		}
 		if adv, ok := face.GlyphAdvance(r); ok {
 			if w := adv.Ceil(); w > maxWidth {
 				maxWidth = w
@@ -70,46 +78,53 @@ func (f *Font) GetFaceImage(face font.Face, sizeInTiles Size) (image.Image, erro
 	if maxWidth <= 0 {
 		adv, ok := face.GlyphAdvance('m')
 		if !ok {
-			return nil, fmt.Errorf("Font face does not provide a glyph for rune 'm'")
+			return Size{}, fmt.Errorf("Font face does not provide a glyph for rune 'm'")
 		}
 		maxWidth = adv.Ceil()
 	}
+	return Size{X: maxWidth, Y: tileHeight}, nil
+}
 
-	atlas := image.NewAlpha(image.Rect(0, 0, maxWidth*cols, tileHeight*rows))
-	for i := range nGlyphs {
-		r := rune(i)
-		col := i % cols
-		row := i / cols
-		dot := fixed.Point26_6{
-			X: fixed.I(col * maxWidth),
-			Y: fixed.I(row*tileHeight + ascent),
-		}
-		dstRect, mask, maskPt, _, ok := face.Glyph(dot, r)
-		if !ok || mask == nil {
-			continue
-		}
-
-		// Clip to the tile's cell. Some glyphs/fonts can extend outside the expected
-		// cell bounds (e.g. negative bearings), which would otherwise scribble into
-		// neighboring glyph cells in the atlas.
-		cellRect := image.Rect(col*maxWidth, row*tileHeight, (col+1)*maxWidth, (row+1)*tileHeight)
-		clipped := dstRect.Intersect(cellRect)
-		if clipped.Empty() {
-			continue
-		}
-		dx := clipped.Min.X - dstRect.Min.X
-		dy := clipped.Min.Y - dstRect.Min.Y
-		maskPt = image.Point{X: maskPt.X + dx, Y: maskPt.Y + dy}
+// DrawGlyph renders r into dst with its origin at the left edge of
+// cells and its baseline ascent pixels below the top. The glyph is
+// clipped to cells.
+func DrawGlyph(face font.Face, dst *image.Alpha, cells image.Rectangle, ascent int, r rune) {
+	dot := fixed.Point26_6{
+		X: fixed.I(cells.Min.X),
+		Y: fixed.I(cells.Min.Y + ascent),
+	}
+	dstRect, mask, maskPt, _, ok := face.Glyph(dot, r)
+	if !ok || mask == nil {
+		return
+	}
 
-		draw.Draw(atlas, clipped, mask, maskPt, draw.Src)
+	// Some glyphs/fonts can extend outside the expected cell bounds (e.g.
+	// negative bearings or fallback fonts with different metrics), which
+	// would otherwise scribble into neighboring glyph cells in the atlas.
+	clipped := dstRect.Intersect(cells)
+	if clipped.Empty() {
+		return
 	}
-	return atlas, nil
+	dx := clipped.Min.X - dstRect.Min.X
+	dy := clipped.Min.Y - dstRect.Min.Y
+	maskPt = image.Point{X: maskPt.X + dx, Y: maskPt.Y + dy}
+
+	draw.Draw(dst, clipped, mask, maskPt, draw.Src)
 }
 
+// LoadFontFromBytes parses a TrueType/OpenType font. For font
+// collections (.ttc/.otc) the first font is used.
 func LoadFontFromBytes(bytes []byte) (*Font, error) {
 	f, err := opentype.Parse(bytes)
 	if err != nil {
-		return nil, err
+		c, cerr := opentype.ParseCollection(bytes)
+		if cerr != nil {
+			return nil, err
+		}
+		f, err = c.Font(0)
+		if err != nil {
+			return nil, err
+		}
 	}
 	return &Font{
 		font:  f,
@@ -124,3 +139,57 @@ func LoadFontFromFile(name string) (*Font, error) {
 	}
 	return LoadFontFromBytes(bytes)
 }
+
+// defaultFallbackFonts lists system fonts which are tried (in order)
+// for runes the embedded font does not cover. Missing files are
+// silently skipped.
+var defaultFallbackFonts = []string{
+	"/usr/share/fonts/truetype/dejavu/DejaVuSansMono.ttf",
+	"/usr/share/fonts/TTF/DejaVuSansMono.ttf",
+	"/usr/share/fonts/truetype/dejavu/DejaVuSans.ttf",
+	"/usr/share/fonts/TTF/DejaVuSans.ttf",
+	"/usr/share/fonts/truetype/noto/NotoSansSymbols2-Regular.ttf",
+	"/usr/share/fonts/noto/NotoSansSymbols2-Regular.ttf",
+	"/usr/share/fonts/truetype/noto/NotoMusic-Regular.ttf",
+	"/usr/share/fonts/noto/NotoMusic-Regular.ttf",
+	"/usr/share/fonts/opentype/noto/NotoSansCJK-Regular.ttc",
+	"/usr/share/fonts/noto-cjk/NotoSansCJK-Regular.ttc",
+	"/usr/share/fonts/truetype/droid/DroidSansFallbackFull.ttf",
+	"/usr/share/fonts/truetype/ancient-scripts/Symbola_hint.ttf",
+	"/System/Library/Fonts/Menlo.ttc",
+	"/System/Library/Fonts/Apple Symbols.ttf",
+	"/System/Library/Fonts/PingFang.ttc",
+	"C:\\Windows\\Fonts\\consola.ttf",
+	"C:\\Windows\\Fonts\\seguisym.ttf",
+	"C:\\Windows\\Fonts\\msgothic.ttc",
+}
+
+// LoadFallbackFonts loads the fonts at the given paths followed by
+// the available defaultFallbackFonts. Fonts which cannot be loaded are
+// skipped with a warning.
+func LoadFallbackFonts(paths []string) []*Font {
+	var fonts []*Font
+	load := func(path string) {
+		f, err := LoadFontFromFile(path)
+		if err != nil {
+			logger.Warn("cannot load fallback font", "path", path, "error", err)
+			return
+		}
+		logger.Debug("loaded fallback font", "path", path)
+		fonts = append(fonts, f)
+	}
+	for _, path := range paths {
+		p, err := expandPath(path)
+		if err != nil {
+			logger.Warn("invalid fallback font path", "path", path, "error", err)
+			continue
+		}
+		load(p)
+	}
+	for _, path := range defaultFallbackFonts {
+		if fileExists(path) {
+			load(path)
+		}
+	}
+	return fonts
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"io/fs"
+	"strings"
+)
+
+// example is a script of the gallery, embedded from examples/.
+type example struct {
+	name  string // file name
+	title string // its first comment line
+	src   string
+}
+
+// loadExamples returns the examples in the order of their names.
+func loadExamples() ([]example, error) {
+	paths, err := fs.Glob(exampleFiles, "examples/*.tape")
+	if err != nil {
+		return nil, err
+	}
+	examples := make([]example, 0, len(paths))
+	for _, path := range paths {
+		src, err := exampleFiles.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		name := strings.TrimPrefix(path, "examples/")
+		examples = append(examples, example{name: name, title: exampleTitle(string(src)), src: string(src)})
+	}
+	return examples, nil
+}
+
+// exampleTitle returns the first line of src without its comment
+// marker, or "" if it is not a comment.
+func exampleTitle(src string) string {
+	line, _, _ := strings.Cut(src, "\n")
+	if !strings.HasPrefix(line, ";") {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimLeft(line, ";"))
+}
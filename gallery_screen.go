@@ -0,0 +1,142 @@
+//go:build cgo && !js
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// GalleryListEntry adapts example to the ListEntry interface.
+type GalleryListEntry struct {
+	index int
+	ex    example
+}
+
+func (ge GalleryListEntry) GetUniqueId() any {
+	return ge.index
+}
+
+func (ge GalleryListEntry) Format() string {
+	return fmt.Sprintf("%-16s %s", ge.ex.name, ge.ex.title)
+}
+
+// GalleryScreen lists the example scripts built into mixtape with the
+// source of the selected one, and opens it in a new buffer of the
+// editor, evaluated.
+type GalleryScreen struct {
+	app         *App
+	listDisplay *ListDisplay
+	keymap      KeyMap
+}
+
+func CreateGalleryScreen(app *App) (*GalleryScreen, error) {
+	examples, err := loadExamples()
+	if err != nil {
+		return nil, err
+	}
+	gs := &GalleryScreen{
+		app:         app,
+		listDisplay: CreateListDisplay(),
+		keymap:      CreateKeyMap(),
+	}
+	entries := make([]ListEntry, len(examples))
+	for i, ex := range examples {
+		entries[i] = GalleryListEntry{index: i, ex: ex}
+	}
+	gs.listDisplay.SetEntries(entries)
+	gs.keymap.BindAction("gallery.up", "Up", func() { gs.listDisplay.MoveBy(-1) })
+	gs.keymap.BindAction("gallery.down", "Down", func() { gs.listDisplay.MoveBy(1) })
+	gs.keymap.BindAction("gallery.first", "Home", func() { gs.listDisplay.MoveTo(0) })
+	gs.keymap.BindAction("gallery.last", "End", func() { gs.listDisplay.MoveTo(len(gs.listDisplay.GetFilteredEntries()) - 1) })
+	gs.keymap.BindAction("gallery.page-up", "PageUp", func() { gs.listDisplay.MoveBy(-gs.listDisplay.PageSize()) })
+	gs.keymap.BindAction("gallery.page-down", "PageDown", func() { gs.listDisplay.MoveBy(gs.listDisplay.PageSize()) })
+	gs.keymap.BindAction("gallery.backspace", "Backspace", func() { gs.listDisplay.RemoveLastSearchChar() })
+	gs.keymap.BindAction("gallery.open", "Enter", func() { gs.openSelected(false) })
+	gs.keymap.BindAction("gallery.play", "C-p", func() { gs.openSelected(true) })
+	return gs, nil
+}
+
+func (gs *GalleryScreen) currentFilteredEntry() *GalleryListEntry {
+	filtered := gs.listDisplay.GetFilteredEntries()
+	if len(filtered) == 0 {
+		return nil
+	}
+	ge := filtered[gs.listDisplay.GetFilteredSelectionIndex()].(GalleryListEntry)
+	return &ge
+}
+
+// openSelected loads the selected example into a new buffer of the
+// editor and evaluates it, then plays the result if play is set.
+func (gs *GalleryScreen) openSelected(play bool) {
+	ge := gs.currentFilteredEntry()
+	if ge == nil {
+		return
+	}
+	app := gs.app
+	es := app.screens["edit"].(*EditScreen)
+	prev := es.GetCurrentBuffer()
+	buf := es.bm.CreateBuffer(ge.ex.name, "", []byte(ge.ex.src))
+	es.bm.SetCurrentBuffer(prev)
+	es.switchToBuffer(buf)
+	app.SelectScreen("edit")
+	var onSuccess func(slot *EvalSlot)
+	if play {
+		onSuccess = func(slot *EvalSlot) {
+			if err := app.audio.PlayTape(slot.vm.evalResult, slot.vm.resultDownmix, es); err != nil {
+				app.SetLastError(err)
+			}
+		}
+	}
+	app.evalBuffer(buf, onSuccess)
+}
+
+func (gs *GalleryScreen) HandleKey(key Key) (KeyHandler, bool) {
+	return gs.keymap.HandleKey(key)
+}
+
+func (gs *GalleryScreen) OnChar(app *App, char rune) {
+	gs.listDisplay.AppendSearchChar(char)
+}
+
+// HandleMouse selects the clicked entry and opens it on double click.
+func (gs *GalleryScreen) HandleMouse(app *App, ev MouseEvent) {
+	if ev.Action != MousePress || ev.Button != MouseLeft {
+		return
+	}
+	if gs.listDisplay.SelectAt(ev.Cell) && ev.Clicks == 2 {
+		gs.openSelected(false)
+	}
+}
+
+func (gs *GalleryScreen) Render(app *App, ts *TileScreen) {
+	pane := ts.GetPane()
+	height := pane.Height()
+	if height <= 0 {
+		return
+	}
+	header := pane.SubPane(0, 0, pane.Width(), 1)
+	title := "Gallery (Enter: open and evaluate, C-p: open and play)"
+	header.DrawString(0, 0, title)
+	if text := gs.listDisplay.SearchText(); text != "" {
+		header.WithFgBg(ColorWhite, ColorGreen, func() {
+			header.DrawString(len(title)+1, 0, fmt.Sprintf("[%s]", text))
+		})
+	}
+	listPane, sourcePane := pane.SubPane(0, 1, pane.Width(), height-1).SplitX(0.5)
+	gs.listDisplay.Render(listPane)
+	if ge := gs.currentFilteredEntry(); ge != nil {
+		for y, line := range strings.Split(ge.ex.src, "\n") {
+			if y >= sourcePane.Height() {
+				break
+			}
+			sourcePane.DrawString(1, y, line)
+		}
+	}
+}
+
+func (gs *GalleryScreen) Reset() {
+	gs.listDisplay.Reset()
+}
+
+func (gs *GalleryScreen) Close() {}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// gitStatus is the state of the git repository holding a file.
+type gitStatus struct {
+	branch string // "" if the file is not in a repository
+	dirty  bool   // the worktree has uncommitted changes to tracked files
+}
+
+// git runs git with args in dir and returns its standard output.
+func git(dir string, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	c := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	c.Stdout = &stdout
+	c.Stderr = &stderr
+	if err := c.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return nil, fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return stdout.Bytes(), nil
+}
+
+// readGitStatus returns the state of the repository holding the file
+// at path.
+func readGitStatus(path string) gitStatus {
+	out, err := git(filepath.Dir(path), "status", "--porcelain=v2", "--branch", "--untracked-files=no")
+	if err != nil {
+		return gitStatus{}
+	}
+	var st gitStatus
+	var oid string
+	for line := range strings.Lines(string(out)) {
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "# branch.head "):
+			st.branch = strings.TrimPrefix(line, "# branch.head ")
+		case strings.HasPrefix(line, "# branch.oid "):
+			oid = strings.TrimPrefix(line, "# branch.oid ")
+		case !strings.HasPrefix(line, "#"):
+			st.dirty = true
+		}
+	}
+	if st.branch == "(detached)" && len(oid) >= 7 {
+		st.branch = oid[:7]
+	}
+	return st
+}
+
+// gitHeadLines returns the lines of the file at path as committed in
+// HEAD, and false if it is not in HEAD.
+func gitHeadLines(path string) ([]string, bool) {
+	out, err := git(filepath.Dir(path), "show", "HEAD:./"+filepath.Base(path))
+	if err != nil {
+		return nil, false
+	}
+	return splitLines(string(out)), true
+}
+
+// gitCommitFile stages the file at path and commits it, and only it,
+// with message.
+func gitCommitFile(path, message string) error {
+	if strings.TrimSpace(message) == "" {
+		return errors.New("git commit: empty commit message")
+	}
+	dir, name := filepath.Split(path)
+	if _, err := git(dir, "add", "--", name); err != nil {
+		return err
+	}
+	_, err := git(dir, "commit", "-m", message, "--", name)
+	return err
+}
+
+// splitLines splits text into lines without their line ends.
+func splitLines(text string) []string {
+	text = strings.TrimSuffix(text, "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+// lineChange tells how a line differs from the committed version.
+type lineChange int
+
+const (
+	lineAdded lineChange = iota + 1
+	lineModified
+)
+
+// maxDiffCells bounds the size of the table diffLines fills; beyond it,
+// all the lines between the common start and end count as modified.
+const maxDiffCells = 1 << 22
+
+// diffLines returns the lines of cur, by index, which are not in old:
+// added where no line of old was removed in their place, modified
+// otherwise.
+func diffLines(old, cur []string) map[int]lineChange {
+	changes := make(map[int]lineChange)
+	// the common start and end
+	start := 0
+	for start < len(old) && start < len(cur) && old[start] == cur[start] {
+		start++
+	}
+	oldEnd, curEnd := len(old), len(cur)
+	for oldEnd > start && curEnd > start && old[oldEnd-1] == cur[curEnd-1] {
+		oldEnd--
+		curEnd--
+	}
+	o, c := old[start:oldEnd], cur[start:curEnd]
+	if len(c) == 0 {
+		return changes
+	}
+	if len(o) == 0 || (len(o)+1)*(len(c)+1) > maxDiffCells {
+		change := lineModified
+		if len(o) == 0 {
+			change = lineAdded
+		}
+		for i := range c {
+			changes[start+i] = change
+		}
+		return changes
+	}
+	// lcs[i][j] is the length of the longest common subsequence of
+	// o[i:] and c[j:]
+	w := len(c) + 1
+	lcs := make([]int, (len(o)+1)*w)
+	for i := len(o) - 1; i >= 0; i-- {
+		for j := len(c) - 1; j >= 0; j-- {
+			if o[i] == c[j] {
+				lcs[i*w+j] = lcs[(i+1)*w+j+1] + 1
+			} else {
+				lcs[i*w+j] = max(lcs[(i+1)*w+j], lcs[i*w+j+1])
+			}
+		}
+	}
+	// walk the runs of lines between the common ones
+	var inserted []int
+	removed := false
+	flush := func() {
+		change := lineAdded
+		if removed {
+			change = lineModified
+		}
+		for _, j := range inserted {
+			changes[start+j] = change
+		}
+		inserted, removed = inserted[:0], false
+	}
+	i, j := 0, 0
+	for i < len(o) || j < len(c) {
+		switch {
+		case i < len(o) && j < len(c) && o[i] == c[j]:
+			flush()
+			i++
+			j++
+		case j < len(c) && (i == len(o) || lcs[i*w+j+1] >= lcs[(i+1)*w+j]):
+			inserted = append(inserted, j)
+			j++
+		default:
+			removed = true
+			i++
+		}
+	}
+	flush()
+	return changes
+}
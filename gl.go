@@ -1,10 +1,17 @@
+//go:build cgo && !js
+
 package main
 
 import (
+	"errors"
 	"fmt"
 	gl "github.com/go-gl/gl/v3.1/gles2"
 )
 
+// ErrGLUnavailable wraps failures which indicate that the GL driver
+// cannot be used (no context, broken shader compiler).
+var ErrGLUnavailable = errors.New("OpenGL unavailable")
+
 type Texture struct {
 	tex uint32
 }
@@ -56,7 +63,7 @@ func CreateShader(shaderType uint32, source string) (Shader, error) {
 	var status int32
 	gl.GetShaderiv(shader, gl.COMPILE_STATUS, &status)
 	if status == gl.FALSE {
-		return Shader{}, fmt.Errorf("shader compilation failed: %s", GetShaderInfoLog(shader))
+		return Shader{}, fmt.Errorf("%w: shader compilation failed: %s", ErrGLUnavailable, GetShaderInfoLog(shader))
 	}
 	return Shader{shader}, nil
 }
@@ -100,7 +107,7 @@ func CreateProgram(vertexShader string, fragmentShader string) (Program, error)
 	var status int32
 	gl.GetProgramiv(program, gl.LINK_STATUS, &status)
 	if status == gl.FALSE {
-		return Program{}, fmt.Errorf("program link failed: %s", GetProgramInfoLog(program))
+		return Program{}, fmt.Errorf("%w: program link failed: %s", ErrGLUnavailable, GetProgramInfoLog(program))
 	}
 	return Program{program, vs, fs}, nil
 }
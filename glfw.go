@@ -1,3 +1,5 @@
+//go:build cgo && !js
+
 package main
 
 import (
@@ -26,6 +28,8 @@ type GlfwApp interface {
 	IsRunning() bool
 	OnKey(key glfw.Key, scancode int, action glfw.Action, modes glfw.ModifierKey)
 	OnChar(char rune)
+	OnCursorPos(x, y float64)
+	OnMouseButton(button glfw.MouseButton, action glfw.Action, mods glfw.ModifierKey)
 	OnFramebufferSize(width, height int)
 	BgColor() (r, g, b, a float32)
 	Render() error
@@ -36,17 +40,17 @@ type GlfwApp interface {
 func WithGL(windowTitle string, app GlfwApp) error {
 	err := glfw.Init()
 	if err != nil {
-		return err
+		return fmt.Errorf("%w: %w", ErrGLUnavailable, err)
 	}
 	defer glfw.Terminate()
 
 	monitor := glfw.GetPrimaryMonitor()
 	if monitor == nil {
-		return fmt.Errorf("no monitors found")
+		return fmt.Errorf("%w: no monitors found", ErrGLUnavailable)
 	}
 	mode := monitor.GetVideoMode()
 	if mode == nil {
-		return fmt.Errorf("video mode cannot be determined")
+		return fmt.Errorf("%w: video mode cannot be determined", ErrGLUnavailable)
 	}
 	glfw.WindowHint(glfw.RedBits, mode.RedBits)
 	glfw.WindowHint(glfw.GreenBits, mode.GreenBits)
@@ -58,9 +62,16 @@ func WithGL(windowTitle string, app GlfwApp) error {
 	glfw.WindowHint(glfw.DoubleBuffer, glfw.True)
 	glfw.WindowHint(glfw.ClientAPI, glfw.OpenGLESAPI)
 	glfw.WindowHint(glfw.ContextVersionMajor, 2)
+	// multisampling smooths the waveform lines
+	glfw.WindowHint(glfw.Samples, flags.MSAA)
 	window, err := glfw.CreateWindow(mode.Width, mode.Height, windowTitle, monitor, nil)
+	if err != nil && flags.MSAA > 0 {
+		logger.Warn("cannot create multisampled window, retrying without MSAA", "samples", flags.MSAA, "error", err)
+		glfw.WindowHint(glfw.Samples, 0)
+		window, err = glfw.CreateWindow(mode.Width, mode.Height, windowTitle, monitor, nil)
+	}
 	if err != nil {
-		return err
+		return fmt.Errorf("%w: %w", ErrGLUnavailable, err)
 	}
 	defer window.Destroy()
 	framebufferSizeCallback := func(w *glfw.Window, width, height int) {
@@ -76,9 +87,22 @@ func WithGL(windowTitle string, app GlfwApp) error {
 	window.SetCharCallback(func(w *glfw.Window, char rune) {
 		app.OnChar(char)
 	})
+	window.SetCursorPosCallback(func(w *glfw.Window, x, y float64) {
+		// cursor positions are in screen coordinates, which differ
+		// from framebuffer pixels on HiDPI displays
+		width, height := w.GetSize()
+		if width > 0 && height > 0 {
+			x *= float64(fbSize.X) / float64(width)
+			y *= float64(fbSize.Y) / float64(height)
+		}
+		app.OnCursorPos(x, y)
+	})
+	window.SetMouseButtonCallback(func(w *glfw.Window, button glfw.MouseButton, action glfw.Action, mods glfw.ModifierKey) {
+		app.OnMouseButton(button, action, mods)
+	})
 	window.MakeContextCurrent()
 	if err := gl.Init(); err != nil {
-		return err
+		return fmt.Errorf("%w: %w", ErrGLUnavailable, err)
 	}
 	width, height := glfw.GetCurrentContext().GetFramebufferSize()
 	framebufferSizeCallback(nil, width, height)
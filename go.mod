@@ -13,13 +13,13 @@ require (
 	github.com/go-gl/mathgl v1.2.0
 	github.com/hajimehoshi/go-mp3 v0.3.4
 	github.com/mitchellh/go-homedir v1.1.0
+	github.com/mjibson/go-dsp v0.0.0-20180508042940-11479a337f12
 	golang.org/x/image v0.33.0
+	golang.org/x/text v0.31.0
 )
 
 require (
 	github.com/ebitengine/purego v0.9.1 // indirect
 	github.com/go-audio/riff v1.0.0 // indirect
-	github.com/mjibson/go-dsp v0.0.0-20180508042940-11479a337f12 // indirect
 	golang.org/x/sys v0.38.0 // indirect
-	golang.org/x/text v0.31.0 // indirect
 )
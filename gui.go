@@ -0,0 +1,35 @@
+//go:build cgo && !js
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// runGui opens the files in args in the editor.
+func runGui(vm *VM, args []string) error {
+	bm := CreateBufferManager()
+	for _, arg := range args {
+		data, err := os.ReadFile(arg)
+		if err != nil {
+			return err
+		}
+		path := arg
+		bm.CreateBuffer("", path, data)
+	}
+	if bm.Empty() {
+		bm.CreateBuffer("", "", nil)
+	}
+
+	app := CreateApp(vm, bm)
+	if flags.Safe {
+		return WithTerminal(app)
+	}
+	err := WithGL("mixtape", app)
+	if errors.Is(err, ErrGLUnavailable) {
+		logger.Warn("falling back to the terminal frontend", "error", err)
+		return WithTerminal(app)
+	}
+	return err
+}
@@ -0,0 +1,13 @@
+//go:build !cgo && !js
+
+package main
+
+import (
+	"errors"
+)
+
+// runGui reports that the editor is not available: its OpenGL
+// frontend needs cgo. Scripts can still be run with -e and -f.
+func runGui(vm *VM, args []string) error {
+	return errors.New("this mixtape was built without cgo and has no editor: use -e or -f to evaluate scripts")
+}
@@ -1,3 +1,5 @@
+//go:build cgo && !js
+
 package main
 
 // HelpScreen shows the embedded help text in a read-only editor.
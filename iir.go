@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+)
+
+// IIRFilter applies the filter with the numerator coefficients b and
+// the denominator coefficients a to each channel of s:
+//
+//	a[0]*y[n] = b[0]*x[n] + b[1]*x[n-1] + ... - a[1]*y[n-1] - ...
+//
+// as computed by scipy.signal.lfilter, in transposed direct form II.
+// An FIR filter has a = [1].
+func IIRFilter(s Stream, b, a []float64) Stream {
+	order := max(len(a), len(b))
+	nb := make([]float64, order)
+	na := make([]float64, order)
+	for i, c := range b {
+		nb[i] = c / a[0]
+	}
+	for i, c := range a {
+		na[i] = c / a[0]
+	}
+	nchannels := s.nchannels
+	return makeBlockTransformStream([]Stream{s}, func(inputs []Stream) BlockStepper {
+		in := inputs[0]
+		// z[c] holds the order-1 delayed partial sums of channel c
+		z := make([][]float64, nchannels)
+		for c := range z {
+			z[c] = make([]float64, order)
+		}
+		return func(buf []Smp) int {
+			n := in.NextBlock(buf)
+			for i := range n {
+				frame := buf[i*nchannels : (i+1)*nchannels]
+				for c, x := range frame {
+					zc := z[c]
+					y := nb[0]*x + zc[0]
+					for k := 1; k < order; k++ {
+						zc[k-1] = nb[k]*x - na[k]*y + zc[k]
+					}
+					frame[c] = y
+				}
+			}
+			return n
+		}
+	})
+}
+
+// filterCoeffs pops a vector of filter coefficients.
+func filterCoeffs(vm *VM, name string) ([]float64, error) {
+	v, err := Pop[Vec](vm)
+	if err != nil {
+		return nil, err
+	}
+	if len(v) == 0 {
+		return nil, fmt.Errorf("%s: no coefficients", name)
+	}
+	coeffs, err := numsFromVal(v, len(v))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return coeffs, nil
+}
+
+func init() {
+	RegisterWord("iir", func(vm *VM) error {
+		a, err := filterCoeffs(vm, "iir")
+		if err != nil {
+			return err
+		}
+		if a[0] == 0 {
+			return fmt.Errorf("iir: a[0] must not be 0")
+		}
+		b, err := filterCoeffs(vm, "iir")
+		if err != nil {
+			return err
+		}
+		input, err := streamFromVal(vm.Pop())
+		if err != nil {
+			return err
+		}
+		vm.Push(IIRFilter(input, b, a))
+		return nil
+	})
+
+	RegisterWord("fir", func(vm *VM) error {
+		b, err := filterCoeffs(vm, "fir")
+		if err != nil {
+			return err
+		}
+		input, err := streamFromVal(vm.Pop())
+		if err != nil {
+			return err
+		}
+		vm.Push(IIRFilter(input, b, []float64{1}))
+		return nil
+	})
+}
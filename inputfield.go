@@ -1,3 +1,5 @@
+//go:build cgo && !js
+
 package main
 
 import (
@@ -31,32 +33,32 @@ func (f *InputField) SetCallbacks(callbacks InputFieldCallbacks) {
 func (f *InputField) initKeymap() {
 	f.keymap = CreateKeyMap()
 
-	f.keymap.Bind("Left", func() { f.AdvanceColumn(-1) })
-	f.keymap.Bind("Right", func() { f.AdvanceColumn(1) })
-	f.keymap.Bind("Home", f.MoveToBOL)
-	f.keymap.Bind("End", f.MoveToEOL)
-
-	f.keymap.Bind("C-Left", f.WordLeft)
-	f.keymap.Bind("C-Right", f.WordRight)
-	f.keymap.Bind("M-b", f.WordLeft)
-	f.keymap.Bind("M-f", f.WordRight)
-	f.keymap.Bind("C-a", f.MoveToBOL)
-	f.keymap.Bind("C-e", f.MoveToEOL)
-
-	f.keymap.Bind("Backspace", func() { f.Backspace() })
-	f.keymap.Bind("Delete", func() { f.DeleteRune() })
-	f.keymap.Bind("C-k", func() { f.KillToEnd() })
-	f.keymap.Bind("Enter", func() {
+	f.keymap.BindAction("input.left", "Left", func() { f.AdvanceColumn(-1) })
+	f.keymap.BindAction("input.right", "Right", func() { f.AdvanceColumn(1) })
+	f.keymap.BindAction("input.line-start", "Home", f.MoveToBOL)
+	f.keymap.BindAction("input.line-end", "End", f.MoveToEOL)
+
+	f.keymap.BindAction("input.word-left", "C-Left", f.WordLeft)
+	f.keymap.BindAction("input.word-right", "C-Right", f.WordRight)
+	f.keymap.BindAction("input.word-left", "M-b", f.WordLeft)
+	f.keymap.BindAction("input.word-right", "M-f", f.WordRight)
+	f.keymap.BindAction("input.line-start", "C-a", f.MoveToBOL)
+	f.keymap.BindAction("input.line-end", "C-e", f.MoveToEOL)
+
+	f.keymap.BindAction("input.backspace", "Backspace", func() { f.Backspace() })
+	f.keymap.BindAction("input.delete", "Delete", func() { f.DeleteRune() })
+	f.keymap.BindAction("input.kill-line", "C-k", func() { f.KillToEnd() })
+	f.keymap.BindAction("input.confirm", "Enter", func() {
 		if f.callbacks.onConfirm != nil {
 			f.callbacks.onConfirm()
 		}
 	})
-	f.keymap.Bind("Escape", func() {
+	f.keymap.BindAction("input.cancel", "Escape", func() {
 		if f.callbacks.onCancel != nil {
 			f.callbacks.onCancel()
 		}
 	})
-	f.keymap.Bind("C-g", func() {
+	f.keymap.BindAction("input.cancel", "C-g", func() {
 		if f.callbacks.onCancel != nil {
 			f.callbacks.onCancel()
 		}
@@ -199,19 +201,23 @@ func (f *InputField) Reset() {
 	f.left = 0
 }
 
+// ensureCursorVisible adjusts f.left (a screen column) so that the
+// cursor fits into width cells.
 func (f *InputField) ensureCursorVisible(width int) {
-	if f.point < f.left {
-		f.left = f.point
+	pointCol := displayColumn(f.runes, f.point)
+	pointWidth := 1
+	if f.point < len(f.runes) {
+		pointWidth = runeWidth(f.runes[f.point])
+	}
+	if pointCol < f.left {
+		f.left = pointCol
 	}
-	if f.point >= f.left+width {
-		f.left = f.point - width + 1
+	if pointCol+pointWidth > f.left+width {
+		f.left = pointCol + pointWidth - width
 	}
 	if f.left < 0 {
 		f.left = 0
 	}
-	if f.left > f.point {
-		f.left = f.point
-	}
 }
 
 func (f *InputField) Render(tp TilePane) {
@@ -223,12 +229,20 @@ func (f *InputField) Render(tp TilePane) {
 
 	f.ensureCursorVisible(width)
 
-	for x := range width {
-		idx := f.left + x
+	col := 0
+	for idx := 0; ; idx++ {
 		r := ' '
 		if idx < len(f.runes) {
 			r = f.runes[idx]
 		}
+		x := col - f.left
+		col += runeWidth(r)
+		if x >= width {
+			break
+		}
+		if x < 0 {
+			continue
+		}
 		if idx == f.point {
 			tp.WithBg(ColorHighlight, func() {
 				tp.DrawRune(x, 0, r)
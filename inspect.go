@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// channelStats holds the level of one channel of a tape.
+type channelStats struct {
+	peak float64
+	rms  float64
+	dc   float64 // mean sample value
+}
+
+func (t *Tape) channelStats() []channelStats {
+	nc := t.nchannels
+	stats := make([]channelStats, nc)
+	if t.nframes == 0 {
+		return stats
+	}
+	for i, smp := range t.samples[:t.nframes*nc] {
+		s := &stats[i%nc]
+		s.peak = max(s.peak, math.Abs(smp))
+		s.rms += smp * smp
+		s.dc += smp
+	}
+	for i := range stats {
+		stats[i].rms = math.Sqrt(stats[i].rms / float64(t.nframes))
+		stats[i].dc /= float64(t.nframes)
+	}
+	return stats
+}
+
+func formatFrames(nframes int) string {
+	if nframes <= 0 {
+		return "infinite"
+	}
+	return fmt.Sprintf("%d frames (%.3fs)", nframes, float64(nframes)/float64(SampleRate()))
+}
+
+// inspectLines describes v in more detail than its String(): the level
+// of each channel of a tape, the waves and mip levels of a wavetable,
+// the length of a stream.
+func inspectLines(v Val) []string {
+	switch v := v.(type) {
+	case *Tape:
+		lines := []string{
+			fmt.Sprintf("Tape: %d channels, %s at %d Hz", v.nchannels, formatFrames(v.nframes), SampleRate()),
+		}
+		for ch, s := range v.channelStats() {
+			lines = append(lines, fmt.Sprintf("channel %d: peak %s, RMS %s, DC %+.4f", ch, formatDBFS(s.peak), formatDBFS(s.rms), s.dc))
+		}
+		return lines
+	case *Wavetable:
+		lines := []string{fmt.Sprintf("%v, %v", v, v.strategy)}
+		for level, waves := range v.mips {
+			if len(waves) == 0 {
+				continue
+			}
+			peak := 0.0
+			for _, wave := range waves {
+				peak = max(peak, wave.Peak())
+			}
+			lines = append(lines, fmt.Sprintf("level %d: %d waves of %d samples, peak %s, %d harmonics, from %.0f Hz", level, len(waves), waves[0].nframes, formatDBFS(peak), harmonicBandwidth(waveHarmonics(waves[0])), levelFreq(level, v.mips[0][0].nframes)))
+		}
+		return lines
+	case Stream:
+		return []string{
+			fmt.Sprintf("Stream: %d channels, %s", v.nchannels, formatFrames(v.nframes)),
+		}
+	}
+	return []string{fmt.Sprintf("%T: %v", v, v)}
+}
+
+// prepareInspect builds the parts of v which are computed lazily, so
+// that the inspector can show them without modifying v while it is
+// being used by an evaluation.
+func prepareInspect(v Val) {
+	if wt, ok := v.(*Wavetable); ok {
+		wt.ensureLevel(wt.strategy.maxLevel)
+	}
+}
+
+func init() {
+	RegisterWord("inspect", func(vm *VM) error {
+		v := vm.Top()
+		prepareInspect(v)
+		if vm.inspectCallback != nil {
+			vm.inspectCallback(v)
+		} else {
+			for _, line := range inspectLines(v) {
+				logger.Info(line)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,204 @@
+//go:build cgo && !js
+
+package main
+
+import (
+	"fmt"
+)
+
+// InspectScreen shows a value in detail: the levels and a zoomable
+// waveform of tapes, the waves of each mip level of wavetables (as a
+// 3D stack, one by one or as spectra), the length of streams.
+type InspectScreen struct {
+	keymap      KeyMap
+	tapeDisplay *TapeDisplay
+	value       Val
+	lines       []string   // inspectLines of value, computed once
+	zoom        int        // tapes: magnification of the waveform (a power of two)
+	center      float64    // tapes: center of the view as a fraction of the tape length
+	wave        int        // wavetables: index of the wave shown
+	level       int        // wavetables: mip level shown
+	mode        wtViewMode // wavetables: Tab: 3D stack, single wave or spectrum
+	spectrum    []float64  // harmonics of the shown wave, computed on demand
+	refSpectrum []float64  // harmonics of the shown wave at mip level 0
+	spectrumKey [2]int     // level and wave of spectrum, -1 if not computed
+}
+
+// wtViewMode selects how the inspector shows the waves of a wavetable.
+type wtViewMode int
+
+const (
+	wtView3D wtViewMode = iota
+	wtViewSingle
+	wtViewSpectrum
+	numWtViewModes
+)
+
+func CreateInspectScreen(app *App) (*InspectScreen, error) {
+	tapeDisplay, err := app.createTapeDisplay()
+	if err != nil {
+		return nil, err
+	}
+	is := &InspectScreen{
+		keymap:      CreateKeyMap(),
+		tapeDisplay: tapeDisplay,
+		center:      0.5,
+		spectrumKey: [2]int{-1, -1},
+	}
+	is.keymap.BindAction("inspect.zoom-in", "M-=", func() { is.zoomBy(1) })
+	is.keymap.BindAction("inspect.zoom-out", "M--", func() { is.zoomBy(-1) })
+	is.keymap.BindAction("inspect.zoom-reset", "M-0", func() { is.zoomBy(-maxTapeZoom) })
+	is.keymap.BindAction("inspect.left", "Left", func() { is.move(-1) })
+	is.keymap.BindAction("inspect.right", "Right", func() { is.move(1) })
+	is.keymap.BindAction("inspect.previous-level", "Up", func() { is.changeLevel(-1) })
+	is.keymap.BindAction("inspect.next-level", "Down", func() { is.changeLevel(1) })
+	is.keymap.BindAction("inspect.view", "Tab", func() { is.mode = (is.mode + 1) % numWtViewModes })
+	is.keymap.BindAction("inspect.play", "C-p", func() {
+		if t := is.playedTape(); t != nil {
+			if err := app.audio.PlayTape(t, nil, is); err != nil {
+				app.SetLastError(err)
+			}
+		}
+	})
+	return is, nil
+}
+
+// SetValue makes v the inspected value, resetting the view.
+func (is *InspectScreen) SetValue(v Val) {
+	is.value = v
+	is.lines = inspectLines(v)
+	is.spectrumKey = [2]int{-1, -1}
+	is.zoom = 0
+	is.center = 0.5
+	is.wave = 0
+	is.level = 0
+}
+
+func (is *InspectScreen) zoomBy(delta int) {
+	is.zoom = min(max(is.zoom+delta, 0), maxTapeZoom)
+	is.scroll(0)
+}
+
+// scroll moves the waveform of a tape by amount times its width.
+func (is *InspectScreen) scroll(amount float64) {
+	width := 1 / float64(int(1)<<is.zoom)
+	half := width / 2
+	is.center = min(max(is.center+amount*width, half), 1-half)
+}
+
+// move scrolls the waveform of a tape, or pages through the waves of a
+// wavetable.
+func (is *InspectScreen) move(delta int) {
+	switch v := is.value.(type) {
+	case *Tape:
+		is.scroll(float64(delta) * 0.25)
+	case *Wavetable:
+		if n := len(v.mips[is.level]); n > 0 {
+			is.wave = (is.wave + delta + n) % n
+		}
+	}
+}
+
+// changeLevel pages through the mip levels of a wavetable.
+func (is *InspectScreen) changeLevel(delta int) {
+	if wt, ok := is.value.(*Wavetable); ok {
+		is.level = min(max(is.level+delta, 0), len(wt.mips)-1)
+		is.wave = min(is.wave, len(wt.mips[is.level])-1)
+	}
+}
+
+// shownTape returns the tape whose waveform is shown, or nil.
+func (is *InspectScreen) shownTape() *Tape {
+	switch v := is.value.(type) {
+	case *Tape:
+		return v
+	case *Wavetable:
+		if is.level < len(v.mips) && is.wave < len(v.mips[is.level]) {
+			return v.mips[is.level][is.wave]
+		}
+	}
+	return nil
+}
+
+// playedTape returns the tape played by C-p: the shown waveform of a
+// tape, or one second of the shown wave of a wavetable at the lowest
+// note which plays its mip level, so that each level is heard where
+// the oscillator uses it.
+func (is *InspectScreen) playedTape() *Tape {
+	t := is.shownTape()
+	wt, ok := is.value.(*Wavetable)
+	if t == nil || !ok {
+		return t
+	}
+	freq := max(levelFreq(is.level, wt.mips[0][0].nframes), 55)
+	return auditionWave(t, freq, SampleRate())
+}
+
+// shownSpectrum returns the harmonics of the shown wave of a wavetable
+// at the shown level and at level 0.
+func (is *InspectScreen) shownSpectrum(wt *Wavetable) (harmonics, ref []float64) {
+	key := [2]int{is.level, is.wave}
+	if is.spectrumKey != key {
+		is.spectrum = waveHarmonics(wt.mips[is.level][is.wave])
+		is.refSpectrum = waveHarmonics(wt.mips[0][min(is.wave, len(wt.mips[0])-1)])
+		is.spectrumKey = key
+	}
+	return is.spectrum, is.refSpectrum
+}
+
+func (is *InspectScreen) Keymap() KeyMap {
+	return is.keymap
+}
+
+func (is *InspectScreen) HandleKey(key Key) (KeyHandler, bool) {
+	return is.keymap.HandleKey(key)
+}
+
+func (is *InspectScreen) Render(app *App, ts *TileScreen) {
+	screenPane := ts.GetPane()
+	if is.value == nil {
+		screenPane.DrawString(0, 0, "nothing to inspect: evaluate a buffer or use the inspect word")
+		return
+	}
+	lines := is.lines
+	var help string
+	switch is.value.(type) {
+	case *Tape:
+		help = "M-= / M--: zoom, Left / Right: scroll, C-p: play"
+	case *Wavetable:
+		help = fmt.Sprintf("wave %d, level %d -- Left / Right: wave, Up / Down: mip level, Tab: 3D / single wave / spectrum, C-p: play", is.wave, is.level)
+	}
+	infoPane, viewPane := screenPane.SplitY(float64(len(lines) + 1))
+	for y, line := range lines {
+		infoPane.DrawString(0, y, line)
+	}
+	infoPane.DrawString(0, len(lines), help)
+	if wt, ok := is.value.(*Wavetable); ok && is.mode == wtViewSpectrum && is.shownTape() != nil {
+		harmonics, ref := is.shownSpectrum(wt)
+		drawSpectrumText(viewPane, harmonics, ref)
+		return
+	}
+	if wt, ok := is.value.(*Wavetable); ok && is.mode == wtView3D {
+		waves := wt.mips[is.level]
+		morph, playing := app.playingMorph(wt)
+		if !playing {
+			morph = waveDepth(is.wave, len(waves))
+		}
+		renderWavetableView(viewPane, is.tapeDisplay, waves, morph)
+		return
+	}
+	t := is.shownTape()
+	if t == nil || t.nframes == 0 {
+		return
+	}
+	var playheadFrames []int
+	for _, tp := range app.audio.GetTapePlayers(is) {
+		playheadFrames = append(playheadFrames, tp.GetCurrentFrame())
+	}
+	windowSize, windowOffset := tapeWindow(t.nframes, is.zoom, is.center)
+	renderTapeView(viewPane, is.tapeDisplay, t, windowSize, windowOffset, playheadFrames, false, tapeSelection{})
+}
+
+func (is *InspectScreen) Reset() {}
+
+func (is *InspectScreen) Close() {}
@@ -0,0 +1,28 @@
+//go:build cgo && !js && jack
+
+#include <jack/jack.h>
+#include "_cgo_export.h"
+
+// cgo cannot call variadic functions, pass function pointers or use
+// string macros, so these wrappers do it for jack.go.
+
+static int mixtape_jack_process(jack_nframes_t nframes, void *arg) {
+	return jackProcess(nframes, (uintptr_t)arg);
+}
+
+static void mixtape_jack_shutdown(void *arg) {
+	jackShutdown((uintptr_t)arg);
+}
+
+jack_client_t *mixtape_jack_open(const char *name, jack_status_t *status) {
+	return jack_client_open(name, JackNoStartServer, status);
+}
+
+int mixtape_jack_set_callbacks(jack_client_t *client, uintptr_t handle) {
+	jack_on_shutdown(client, mixtape_jack_shutdown, (void *)handle);
+	return jack_set_process_callback(client, mixtape_jack_process, (void *)handle);
+}
+
+jack_port_t *mixtape_jack_register_port(jack_client_t *client, const char *name, unsigned long flags) {
+	return jack_port_register(client, name, JACK_DEFAULT_AUDIO_TYPE, flags, 0);
+}
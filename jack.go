@@ -0,0 +1,344 @@
+//go:build cgo && !js && jack
+
+package main
+
+/*
+#cgo pkg-config: jack
+#include <stdint.h>
+#include <stdlib.h>
+#include <jack/jack.h>
+
+jack_client_t *mixtape_jack_open(const char *name, jack_status_t *status);
+int mixtape_jack_set_callbacks(jack_client_t *client, uintptr_t handle);
+jack_port_t *mixtape_jack_register_port(jack_client_t *client, const char *name, unsigned long flags);
+*/
+import "C"
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"runtime/cgo"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// jackPortNames are the names of the output ports of the client.
+var jackPortNames = [2]string{"out_L", "out_R"}
+
+// jackInputPortNames are the names of the input ports of the client.
+var jackInputPortNames = [2]string{"in_L", "in_R"}
+
+// jackContext plays through a JACK client (or the JACK API of
+// PipeWire), mixing the playing players into its two output ports in
+// the process callback of the server, and records from its two input
+// ports.
+type jackContext struct {
+	client *C.jack_client_t
+	ports  [2]*C.jack_port_t
+	inputs [2]*C.jack_port_t
+	handle cgo.Handle
+
+	mu        sync.Mutex
+	players   []*jackPlayer // playing ones only
+	buf       []byte
+	recording *jackRecording
+}
+
+// jackRecording collects the frames of the input ports.
+type jackRecording struct {
+	samples []Smp // interleaved stereo
+	nframes int   // frames to record, 0 for no limit
+	done    chan struct{}
+}
+
+func newJackContext(sampleRate int) (audioContext, error) {
+	name := C.CString(flags.JackName)
+	defer C.free(unsafe.Pointer(name))
+	var status C.jack_status_t
+	client := C.mixtape_jack_open(name, &status)
+	if client == nil {
+		return nil, fmt.Errorf("jack: cannot open client %q (status 0x%x), is the server running?", flags.JackName, int(status))
+	}
+	ctx := &jackContext{client: client}
+	if err := ctx.start(sampleRate); err != nil {
+		C.jack_client_close(client)
+		if ctx.handle != 0 {
+			ctx.handle.Delete()
+		}
+		return nil, err
+	}
+	return ctx, nil
+}
+
+func (ctx *jackContext) start(sampleRate int) error {
+	if sr := int(C.jack_get_sample_rate(ctx.client)); sr != sampleRate {
+		return fmt.Errorf("jack: the server runs at %d Hz, start mixtape with -sr %d", sr, sr)
+	}
+	if flags.AudioBuffer > 0 {
+		// JACK wants a power of two
+		frames := max(int(flags.AudioBuffer.Seconds()*float64(sampleRate)), 16)
+		frames = 1 << bits.Len(uint(frames-1))
+		if C.jack_set_buffer_size(ctx.client, C.jack_nframes_t(frames)) != 0 {
+			logger.Warn("jack: cannot set the buffer size", "frames", frames)
+		}
+	}
+	for i := range 2 {
+		var err error
+		if ctx.ports[i], err = ctx.registerPort(jackPortNames[i], C.JackPortIsOutput); err != nil {
+			return err
+		}
+		if ctx.inputs[i], err = ctx.registerPort(jackInputPortNames[i], C.JackPortIsInput); err != nil {
+			return err
+		}
+	}
+	ctx.handle = cgo.NewHandle(ctx)
+	if C.mixtape_jack_set_callbacks(ctx.client, C.uintptr_t(ctx.handle)) != 0 {
+		return fmt.Errorf("jack: cannot set the process callback")
+	}
+	if C.jack_activate(ctx.client) != 0 {
+		return fmt.Errorf("jack: cannot activate client")
+	}
+	if flags.JackConnect {
+		ctx.connectToSystem()
+	}
+	period := int(C.jack_get_buffer_size(ctx.client))
+	logger.Info("jack client active",
+		"name", C.GoString(C.jack_get_client_name(ctx.client)),
+		"period", period,
+		"latency", fmt.Sprintf("%.1fms", float64(ctx.latency())*1000/float64(sampleRate)))
+	return nil
+}
+
+func (ctx *jackContext) registerPort(portName string, portFlags C.ulong) (*C.jack_port_t, error) {
+	name := C.CString(portName)
+	defer C.free(unsafe.Pointer(name))
+	port := C.mixtape_jack_register_port(ctx.client, name, portFlags)
+	if port == nil {
+		return nil, fmt.Errorf("jack: cannot register port %s", portName)
+	}
+	return port, nil
+}
+
+// connectToSystem connects the output ports to the first two physical
+// playback ports and the input ports to the first two physical capture
+// ports, or both of them to the only one.
+func (ctx *jackContext) connectToSystem() {
+	playback := ctx.physicalPorts(C.JackPortIsInput)
+	defer C.jack_free(unsafe.Pointer(playback))
+	capture := ctx.physicalPorts(C.JackPortIsOutput)
+	defer C.jack_free(unsafe.Pointer(capture))
+	for i := range 2 {
+		if dst := nthPort(playback, i); dst != nil {
+			if C.jack_connect(ctx.client, C.jack_port_name(ctx.ports[i]), dst) != 0 {
+				logger.Warn("jack: cannot connect port", "port", jackPortNames[i], "to", C.GoString(dst))
+			}
+		}
+		if src := nthPort(capture, i); src != nil {
+			if C.jack_connect(ctx.client, src, C.jack_port_name(ctx.inputs[i])) != 0 {
+				logger.Warn("jack: cannot connect port", "port", jackInputPortNames[i], "from", C.GoString(src))
+			}
+		}
+	}
+	if nthPort(playback, 0) == nil {
+		logger.Warn("jack: no playback ports to connect to")
+	}
+}
+
+// physicalPorts returns the NULL-terminated list of the physical ports
+// with direction, to be freed with jack_free. It may be nil.
+func (ctx *jackContext) physicalPorts(direction C.ulong) **C.char {
+	return C.jack_get_ports(ctx.client, nil, nil, C.JackPortIsPhysical|direction)
+}
+
+// nthPort returns port i of a list returned by physicalPorts, or the
+// last one if there are fewer, or nil if the list is empty.
+func nthPort(ports **C.char, i int) *C.char {
+	if ports == nil {
+		return nil
+	}
+	var last *C.char
+	for _, p := range unsafe.Slice(ports, i+1) {
+		if p == nil {
+			break
+		}
+		last = p
+	}
+	return last
+}
+
+// latency returns the number of frames between reading a frame from a
+// player and hearing it.
+func (ctx *jackContext) latency() int {
+	var r C.jack_latency_range_t
+	C.jack_port_get_latency_range(ctx.ports[0], C.JackPlaybackLatency, &r)
+	return int(C.jack_get_buffer_size(ctx.client)) + int(r.max)
+}
+
+func (ctx *jackContext) NewPlayer(r io.Reader) audioPlayer {
+	return &jackPlayer{ctx: ctx, r: r}
+}
+
+//export jackProcess
+func jackProcess(nframes C.jack_nframes_t, handle C.uintptr_t) C.int {
+	cgo.Handle(handle).Value().(*jackContext).process(int(nframes))
+	return 0
+}
+
+//export jackShutdown
+func jackShutdown(handle C.uintptr_t) {
+	ctx := cgo.Handle(handle).Value().(*jackContext)
+	ctx.mu.Lock()
+	for _, p := range ctx.players {
+		p.playing.Store(false)
+	}
+	ctx.players = nil
+	if rec := ctx.recording; rec != nil {
+		ctx.recording = nil
+		close(rec.done)
+	}
+	ctx.mu.Unlock()
+	logger.Error("jack: the server has shut down, audio stopped")
+}
+
+// process mixes the playing players into the output ports and captures
+// the input ports if recording. It runs on the real-time thread of the
+// server.
+func (ctx *jackContext) process(nframes int) {
+	var out [2][]float32
+	for i, port := range ctx.ports {
+		out[i] = unsafe.Slice((*float32)(C.jack_port_get_buffer(port, C.jack_nframes_t(nframes))), nframes)
+		clear(out[i])
+	}
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	if rec := ctx.recording; rec != nil {
+		ctx.capture(rec, nframes)
+	}
+	if len(ctx.buf) < 8*nframes {
+		ctx.buf = make([]byte, 8*nframes)
+	}
+	buf := ctx.buf[:8*nframes]
+	playing := ctx.players[:0]
+	for _, p := range ctx.players {
+		n, err := io.ReadFull(p.r, buf)
+		for i := range n / 8 {
+			out[0][i] += math.Float32frombits(binary.LittleEndian.Uint32(buf[8*i:]))
+			out[1][i] += math.Float32frombits(binary.LittleEndian.Uint32(buf[8*i+4:]))
+		}
+		if err != nil {
+			p.playing.Store(false)
+			continue
+		}
+		playing = append(playing, p)
+	}
+	clear(ctx.players[len(playing):])
+	ctx.players = playing
+}
+
+// capture appends the frames of the input ports to rec.
+func (ctx *jackContext) capture(rec *jackRecording, nframes int) {
+	if rec.nframes > 0 {
+		nframes = min(nframes, rec.nframes-len(rec.samples)/2)
+	}
+	var in [2][]float32
+	for i, port := range ctx.inputs {
+		in[i] = unsafe.Slice((*float32)(C.jack_port_get_buffer(port, C.jack_nframes_t(nframes))), nframes)
+	}
+	for i := range nframes {
+		rec.samples = append(rec.samples, Smp(in[0][i]), Smp(in[1][i]))
+	}
+	if rec.nframes > 0 && len(rec.samples) == 2*rec.nframes {
+		ctx.recording = nil
+		close(rec.done)
+	}
+}
+
+// Record records from the input ports. See audioInput.
+func (ctx *jackContext) Record(nframes int, stop <-chan struct{}, cancelled func() bool) (*Tape, error) {
+	rec := &jackRecording{nframes: nframes, done: make(chan struct{})}
+	if nframes > 0 {
+		// avoid allocating in the process callback
+		rec.samples = make([]Smp, 0, 2*nframes)
+	}
+	ctx.mu.Lock()
+	if ctx.recording != nil {
+		ctx.mu.Unlock()
+		return nil, fmt.Errorf("record: already recording")
+	}
+	ctx.recording = rec
+	ctx.mu.Unlock()
+	logger.Info("recording", "frames", nframes)
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+wait:
+	for {
+		select {
+		case <-rec.done:
+			break wait
+		case <-stop:
+			break wait
+		case <-ticker.C:
+			if cancelled() {
+				break wait
+			}
+		}
+	}
+	ctx.mu.Lock()
+	if ctx.recording == rec {
+		ctx.recording = nil
+	}
+	ctx.mu.Unlock()
+	t := makeTape(2, len(rec.samples)/2)
+	copy(t.samples, rec.samples)
+	logger.Info("recorded", "frames", t.nframes)
+	return t, nil
+}
+
+// jackPlayer reads stereo float32 samples from r while it is playing.
+type jackPlayer struct {
+	ctx     *jackContext
+	r       io.Reader
+	playing atomic.Bool
+}
+
+func (p *jackPlayer) Play() {
+	p.ctx.mu.Lock()
+	defer p.ctx.mu.Unlock()
+	if !p.playing.Swap(true) {
+		p.ctx.players = append(p.ctx.players, p)
+	}
+}
+
+func (p *jackPlayer) Pause() {
+	p.ctx.mu.Lock()
+	defer p.ctx.mu.Unlock()
+	if p.playing.Swap(false) {
+		for i, q := range p.ctx.players {
+			if q == p {
+				p.ctx.players = append(p.ctx.players[:i], p.ctx.players[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+func (p *jackPlayer) IsPlaying() bool {
+	return p.playing.Load()
+}
+
+func (p *jackPlayer) BufferedSize() int {
+	if !p.IsPlaying() {
+		return 0
+	}
+	return 8 * p.ctx.latency()
+}
+
+func (p *jackPlayer) Close() error {
+	p.Pause()
+	return nil
+}
@@ -0,0 +1,9 @@
+//go:build cgo && !js && !jack
+
+package main
+
+import "errors"
+
+func newJackContext(sampleRate int) (audioContext, error) {
+	return nil, errors.New("jack: this build has no JACK support (build with -tags jack)")
+}
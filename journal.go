@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const maxJournalResultLength = 80
+
+// JournalEntry records a single evaluation.
+//
+// Script holds the evaluated source, but only for the first entry
+// with a given hash: later entries refer back to it via Hash.
+type JournalEntry struct {
+	Time     time.Time     `json:"time"`
+	Name     string        `json:"name"`
+	Hash     string        `json:"hash"`
+	Duration time.Duration `json:"duration"`
+	Result   string        `json:"result,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	Script   string        `json:"script,omitempty"`
+}
+
+// Journal is an append-only log of evaluations stored as JSON lines.
+type Journal struct {
+	path    string
+	entries []JournalEntry
+	scripts map[string]string // hash -> script
+}
+
+func scriptHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// OpenJournal loads the journal at path (if it exists) and prepares
+// it for appending. Missing parent directories are created.
+func OpenJournal(path string) (*Journal, error) {
+	p, err := expandPath(path)
+	if err != nil {
+		return nil, err
+	}
+	j := &Journal{
+		path:    p,
+		scripts: make(map[string]string),
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			return nil, err
+		}
+		return j, nil
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 64*1024*1024)
+	for scanner.Scan() {
+		var e JournalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			logger.Warn("skipping invalid journal entry", "path", p, "error", err)
+			continue
+		}
+		j.add(e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+func (j *Journal) add(e JournalEntry) {
+	if e.Script != "" {
+		if _, ok := j.scripts[e.Hash]; !ok {
+			j.scripts[e.Hash] = e.Script
+		}
+	}
+	j.entries = append(j.entries, e)
+}
+
+// Record appends an entry describing the evaluation of script.
+func (j *Journal) Record(name string, script []byte, start time.Time, result Val, evalErr error) error {
+	e := JournalEntry{
+		Time:     start,
+		Name:     name,
+		Hash:     scriptHash(script),
+		Duration: time.Since(start),
+	}
+	if evalErr != nil {
+		e.Error = evalErr.Error()
+	} else if result != nil {
+		e.Result = result.String()
+		if runes := []rune(e.Result); len(runes) > maxJournalResultLength {
+			e.Result = string(runes[:maxJournalResultLength]) + "..."
+		}
+	}
+	if _, ok := j.scripts[e.Hash]; !ok {
+		e.Script = string(script)
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(j.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	j.add(e)
+	return nil
+}
+
+// Entries returns all recorded entries, oldest first.
+func (j *Journal) Entries() []JournalEntry {
+	return j.entries
+}
+
+// Script returns the source recorded for the given hash.
+func (j *Journal) Script(hash string) (string, bool) {
+	script, ok := j.scripts[hash]
+	return script, ok
+}
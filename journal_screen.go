@@ -0,0 +1,148 @@
+//go:build cgo && !js
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// JournalListEntry adapts JournalEntry to the ListEntry interface.
+type JournalListEntry struct {
+	index int
+	entry JournalEntry
+}
+
+func (je JournalListEntry) GetUniqueId() any {
+	return je.index
+}
+
+func (je JournalListEntry) Format() string {
+	e := je.entry
+	summary := e.Result
+	if e.Error != "" {
+		summary = "ERROR: " + e.Error
+	}
+	summary = strings.ReplaceAll(summary, "\n", " ")
+	return fmt.Sprintf("%s %-20s %s %8s  %s",
+		e.Time.Format("2006-01-02 15:04:05"),
+		e.Name,
+		e.Hash[:min(8, len(e.Hash))],
+		e.Duration.Round(time.Millisecond),
+		summary)
+}
+
+// JournalScreen lists past evaluations (newest first) and restores
+// the script of the selected one into a new buffer.
+type JournalScreen struct {
+	app         *App
+	listDisplay *ListDisplay
+	keymap      KeyMap
+}
+
+func CreateJournalScreen(app *App) (*JournalScreen, error) {
+	js := &JournalScreen{
+		app:         app,
+		listDisplay: CreateListDisplay(),
+		keymap:      CreateKeyMap(),
+	}
+	js.keymap.BindAction("journal.up", "Up", func() { js.listDisplay.MoveBy(-1) })
+	js.keymap.BindAction("journal.down", "Down", func() { js.listDisplay.MoveBy(1) })
+	js.keymap.BindAction("journal.first", "Home", func() { js.listDisplay.MoveTo(0) })
+	js.keymap.BindAction("journal.last", "End", func() { js.listDisplay.MoveTo(len(js.listDisplay.GetFilteredEntries()) - 1) })
+	js.keymap.BindAction("journal.page-up", "PageUp", func() { js.listDisplay.MoveBy(-js.listDisplay.PageSize()) })
+	js.keymap.BindAction("journal.page-down", "PageDown", func() { js.listDisplay.MoveBy(js.listDisplay.PageSize()) })
+	js.keymap.BindAction("journal.backspace", "Backspace", func() { js.listDisplay.RemoveLastSearchChar() })
+	js.keymap.BindAction("journal.restore", "Enter", func() { js.restoreSelected() })
+	js.Reload()
+	return js, nil
+}
+
+func (js *JournalScreen) Reload() {
+	journal := js.app.journal
+	if journal == nil {
+		js.listDisplay.SetEntries(nil)
+		return
+	}
+	recorded := journal.Entries()
+	entries := make([]ListEntry, len(recorded))
+	for i, e := range recorded {
+		entries[len(recorded)-1-i] = JournalListEntry{index: i, entry: e}
+	}
+	js.listDisplay.SetEntries(entries)
+}
+
+func (js *JournalScreen) currentFilteredEntry() *JournalListEntry {
+	filtered := js.listDisplay.GetFilteredEntries()
+	if len(filtered) == 0 {
+		return nil
+	}
+	je := filtered[js.listDisplay.GetFilteredSelectionIndex()].(JournalListEntry)
+	return &je
+}
+
+func (js *JournalScreen) restoreSelected() {
+	je := js.currentFilteredEntry()
+	if je == nil {
+		return
+	}
+	script, ok := js.app.journal.Script(je.entry.Hash)
+	if !ok {
+		js.app.SetLastError(fmt.Errorf("journal: no script recorded for %s", je.entry.Hash))
+		return
+	}
+	name := fmt.Sprintf("%s@%s", je.entry.Name, je.entry.Hash[:min(8, len(je.entry.Hash))])
+	es := js.app.screens["edit"].(*EditScreen)
+	prev := es.GetCurrentBuffer()
+	buf := es.bm.CreateBuffer(name, "", []byte(script))
+	es.bm.SetCurrentBuffer(prev)
+	es.switchToBuffer(buf)
+	js.app.SelectScreen("edit")
+}
+
+func (js *JournalScreen) HandleKey(key Key) (KeyHandler, bool) {
+	return js.keymap.HandleKey(key)
+}
+
+func (js *JournalScreen) OnChar(app *App, char rune) {
+	js.listDisplay.AppendSearchChar(char)
+}
+
+// HandleMouse selects the clicked entry and restores it on double click.
+func (js *JournalScreen) HandleMouse(app *App, ev MouseEvent) {
+	if ev.Action != MousePress || ev.Button != MouseLeft {
+		return
+	}
+	if js.listDisplay.SelectAt(ev.Cell) && ev.Clicks == 2 {
+		js.restoreSelected()
+	}
+}
+
+func (js *JournalScreen) Render(app *App, ts *TileScreen) {
+	pane := ts.GetPane()
+	height := pane.Height()
+	if height <= 0 {
+		return
+	}
+	header := pane.SubPane(0, 0, pane.Width(), 1)
+	title := "Journal"
+	if app.journal == nil {
+		title = "Journal (disabled)"
+	}
+	header.DrawString(0, 0, title)
+	if text := js.listDisplay.SearchText(); text != "" {
+		header.WithFgBg(ColorWhite, ColorGreen, func() {
+			header.DrawString(len(title)+1, 0, fmt.Sprintf("[%s]", text))
+		})
+	}
+	listPane := pane.SubPane(0, 1, pane.Width(), height-1)
+	js.listDisplay.Render(listPane)
+}
+
+func (js *JournalScreen) Reset() {
+	js.listDisplay.Reset()
+	js.Reload()
+}
+
+func (js *JournalScreen) Close() {}
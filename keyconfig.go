@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// keyConfig holds the keys of the actions rebound by the user, by
+// action name (see LoadKeyConfig). An action with an empty list of
+// keys is unbound.
+var keyConfig map[string][]string
+
+// keyActions holds the default keys of every action bound by
+// BindAction so far, by action name.
+var keyActions = make(map[string][]string)
+
+// BindAction binds handler to key as the default key of the named
+// action, unless the key config rebinds the action, in which case
+// handler is bound to the keys given there instead.
+//
+// Action names consist of the name of a keymap and the name of the
+// action within it, e.g. "editor.word-left". Bind an action to several
+// keys by calling BindAction once for each key.
+func (km KeyMap) BindAction(action string, key string, handler any) {
+	if !slices.Contains(keyActions[action], key) {
+		keyActions[action] = append(keyActions[action], key)
+	}
+	keys, rebound := keyConfig[action]
+	if !rebound {
+		keys = []string{key}
+	}
+	for _, k := range keys {
+		km.Bind(k, handler)
+	}
+}
+
+// LoadKeyConfig loads key binding overrides from the file at path, if
+// it exists. The file uses a subset of TOML: each table is a keymap,
+// each key in it names an action and its value is a key sequence or
+// an array of key sequences:
+//
+//	[editor]
+//	word-left = ["M-b", "C-Left"]
+//	kill-line = "C-d"
+//	paste = []
+func LoadKeyConfig(path string) error {
+	p, err := expandPath(path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	config, err := parseKeyConfig(data)
+	if err != nil {
+		return fmt.Errorf("%s:%w", p, err)
+	}
+	keyConfig = config
+	return nil
+}
+
+func parseKeyConfig(data []byte) (map[string][]string, error) {
+	config := make(map[string][]string)
+	table := ""
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for lineno := 1; sc.Scan(); lineno++ {
+		line := strings.TrimSpace(stripTomlComment(sc.Text()))
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("%d: unterminated table header", lineno)
+			}
+			table = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		name, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("%d: expected action = keys", lineno)
+		}
+		name = strings.Trim(strings.TrimSpace(name), `"`)
+		if table != "" {
+			name = table + "." + name
+		}
+		keys, err := parseKeyList(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("%d: %w", lineno, err)
+		}
+		config[name] = keys
+	}
+	return config, sc.Err()
+}
+
+// stripTomlComment removes a # comment outside of strings from line.
+func stripTomlComment(line string) string {
+	inString := false
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			if inString {
+				i++
+			}
+		case '"':
+			inString = !inString
+		case '#':
+			if !inString {
+				return line[:i]
+			}
+		}
+	}
+	return line
+}
+
+// parseKeyList parses a string or an array of strings.
+func parseKeyList(value string) ([]string, error) {
+	if !strings.HasPrefix(value, "[") {
+		key, err := strconv.Unquote(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %s", value)
+		}
+		return []string{key}, nil
+	}
+	if !strings.HasSuffix(value, "]") {
+		return nil, fmt.Errorf("arrays of keys must end on the same line")
+	}
+	keys := []string{}
+	rest := strings.TrimSpace(value[1 : len(value)-1])
+	for rest != "" {
+		quoted, err := strconv.QuotedPrefix(rest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key in %s", value)
+		}
+		key, _ := strconv.Unquote(quoted)
+		keys = append(keys, key)
+		rest = strings.TrimSpace(rest[len(quoted):])
+		rest = strings.TrimSpace(strings.TrimPrefix(rest, ","))
+	}
+	return keys, nil
+}
+
+// unknownKeyActions returns the actions of the key config which are not
+// bound by any keymap, most likely misspelled. Keymaps built on demand
+// (prompts, the buffer switcher) are only checked once they exist.
+func unknownKeyActions() []string {
+	tables := make(map[string]bool)
+	for action := range keyActions {
+		table, _, _ := strings.Cut(action, ".")
+		tables[table] = true
+	}
+	var unknown []string
+	for action := range keyConfig {
+		table, _, _ := strings.Cut(action, ".")
+		if _, ok := keyActions[action]; !ok && tables[table] {
+			unknown = append(unknown, action)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
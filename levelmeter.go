@@ -0,0 +1,92 @@
+package main
+
+import "math"
+
+const (
+	meterWindowSeconds   = 0.05  // length of the measured window
+	meterFloorDB         = -60.0 // level at the bottom of the meter
+	meterFallDBPerSecond = 20.0
+	meterHoldSeconds     = 1.5 // how long the peak hold marker stays up
+	meterClipSeconds     = 2.0 // how long the clip indicator stays lit
+)
+
+// LevelMeter tracks the peak and RMS level of each channel of a
+// playing tape. Levels are linear amplitudes. Rising levels are shown
+// immediately, falling ones decay at meterFallDBPerSecond so that
+// short peaks stay visible.
+type LevelMeter struct {
+	Peak []float64
+	RMS  []float64
+	Hold []float64 // highest recent peak
+	Clip []bool    // a sample exceeded 1 in the last meterClipSeconds
+
+	holdTime []float64
+	clipTime []float64
+	lastTime float64
+}
+
+func (m *LevelMeter) resize(nchannels int) {
+	if len(m.Peak) == nchannels {
+		return
+	}
+	m.Peak = make([]float64, nchannels)
+	m.RMS = make([]float64, nchannels)
+	m.Hold = make([]float64, nchannels)
+	m.Clip = make([]bool, nchannels)
+	m.holdTime = make([]float64, nchannels)
+	m.clipTime = make([]float64, nchannels)
+	for ch := range m.clipTime {
+		m.clipTime[ch] = math.Inf(-1)
+	}
+}
+
+// Update measures the meterWindowSeconds of t before frame. now is
+// the current time in seconds. With a nil tape (nothing playing) the
+// levels fall back to silence.
+func (m *LevelMeter) Update(t *Tape, frame int, now float64) {
+	if t != nil {
+		m.resize(t.nchannels)
+	}
+	dt := 0.0
+	if m.lastTime > 0 {
+		dt = max(now-m.lastTime, 0)
+	}
+	m.lastTime = now
+	fall := math.Pow(10, -meterFallDBPerSecond*dt/20)
+	window := max(int(meterWindowSeconds*float64(SampleRate())), 1)
+	for ch := range m.Peak {
+		peak, sumSquares, n := 0.0, 0.0, 0
+		if t != nil {
+			for i := max(frame-window, 0); i < min(frame, t.nframes); i++ {
+				smp := float64(t.samples[i*t.nchannels+ch])
+				peak = max(peak, math.Abs(smp))
+				sumSquares += smp * smp
+				n++
+			}
+		}
+		rms := 0.0
+		if n > 0 {
+			rms = math.Sqrt(sumSquares / float64(n))
+		}
+		m.Peak[ch] = max(peak, m.Peak[ch]*fall)
+		m.RMS[ch] = max(rms, m.RMS[ch]*fall)
+		if peak >= m.Hold[ch] || now-m.holdTime[ch] > meterHoldSeconds {
+			m.Hold[ch] = peak
+			m.holdTime[ch] = now
+		}
+		if peak > 1 {
+			m.clipTime[ch] = now
+		}
+		m.Clip[ch] = now-m.clipTime[ch] < meterClipSeconds
+	}
+}
+
+// meterFraction maps a level to the filled fraction of a meter bar,
+// on a dB scale from meterFloorDB to 0 dBFS.
+func meterFraction(level float64) float64 {
+	if level <= 0 {
+		return 0
+	}
+	db := 20 * math.Log10(level)
+	return min(max((db-meterFloorDB)/-meterFloorDB, 0), 1)
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"slices"
+
+	"github.com/mjibson/go-dsp/fft"
+)
+
+// linphaseMinSize and linphaseMaxSize bound :linphase/size.
+const (
+	linphaseMinSize = 64
+	linphaseMaxSize = 65536
+)
+
+// linphaseFloorDB is the gain of the stopbands of the presets.
+const linphaseFloorDB = -200.0
+
+// breakpoint is a point of a magnitude response: gain dB at freq Hz.
+type breakpoint struct {
+	freq, gain float64
+}
+
+// gainAt returns the gain in dB of the response through the breakpoints
+// bps at freq: interpolated linearly in dB over log frequency between
+// them, constant beyond the first and the last. Breakpoints at the same
+// frequency make a step there.
+func gainAt(bps []breakpoint, freq float64) float64 {
+	if freq <= bps[0].freq {
+		return bps[0].gain
+	}
+	for i := 1; i < len(bps); i++ {
+		a, b := bps[i-1], bps[i]
+		if freq > b.freq {
+			continue
+		}
+		if a.freq == b.freq {
+			return b.gain
+		}
+		var t float64
+		if a.freq > 0 {
+			t = math.Log(freq/a.freq) / math.Log(b.freq/a.freq)
+		} else {
+			t = freq / b.freq
+		}
+		return a.gain + t*(b.gain-a.gain)
+	}
+	return bps[len(bps)-1].gain
+}
+
+// linphaseKernel returns the FFT of size 2*size of the linear-phase FIR
+// filter of size taps approximating the magnitude response through bps,
+// designed by frequency sampling with a Hann window. It delays by size/2
+// frames.
+func linphaseKernel(bps []breakpoint, size int) []complex128 {
+	sr := float64(SampleRate())
+	H := make([]complex128, size)
+	for k := 0; k <= size/2; k++ {
+		g := math.Pow(10, gainAt(bps, float64(k)*sr/float64(size))/20)
+		H[k] = complex(g, 0)
+		if k > 0 && k < size/2 {
+			H[size-k] = H[k]
+		}
+	}
+	// the zero-phase impulse response, centered and windowed
+	h0 := fft.IFFT(H)
+	h := make([]float64, 2*size)
+	for n := range size {
+		w := 0.5 - 0.5*math.Cos(2*math.Pi*float64(n)/float64(size))
+		h[n] = real(h0[(n+size/2)%size]) * w
+	}
+	return fft.FFTReal(h)
+}
+
+// LinearPhaseFilter filters each channel of s through the linear-phase
+// FIR filter of size taps (a power of two) with the magnitude response
+// through bps, by FFT overlap-add convolution in blocks of size frames.
+// The output is aligned with the input: the latency of the filter, size/2
+// frames, is made up for by reading ahead, and the tail is cut where the
+// input ends.
+func LinearPhaseFilter(s Stream, bps []breakpoint, size int) Stream {
+	kernel := linphaseKernel(bps, size)
+	nchannels := s.nchannels
+	latency := size / 2
+	return makeTransformStream([]Stream{s}, func(inputs []Stream) Stepper {
+		next := inputs[0].Next
+		block := make([][]float64, nchannels)
+		tail := make([][]float64, nchannels)
+		for c := range nchannels {
+			block[c] = make([]float64, 2*size)
+			tail[c] = make([]float64, size)
+		}
+		// queue holds the filtered frames waiting to be output
+		queue := make([]Smp, size*nchannels)
+		qpos, qlen := 0, 0
+		nin, nout, skip := 0, 0, latency
+		ended := false
+		// fill reads the next block of input, zeros after its end, and
+		// queues the filtered frames
+		fill := func() {
+			for i := range size {
+				frame, ok := Frame(nil), false
+				if !ended {
+					frame, ok = next()
+					if ok {
+						nin++
+					} else {
+						ended = true
+					}
+				}
+				for c := range nchannels {
+					if ok {
+						block[c][i] = frame[c]
+					} else {
+						block[c][i] = 0
+					}
+				}
+			}
+			for c := range nchannels {
+				X := fft.FFTReal(block[c])
+				for k := range X {
+					X[k] *= kernel[k]
+				}
+				y := fft.IFFT(X)
+				for i := range size {
+					queue[i*nchannels+c] = real(y[i]) + tail[c][i]
+					tail[c][i] = real(y[size+i])
+				}
+			}
+			qpos, qlen = min(skip, size), size
+			skip -= qpos
+		}
+		out := make(Frame, nchannels)
+		return func() (Frame, bool) {
+			for qpos == qlen {
+				if ended && nout >= nin {
+					return nil, false
+				}
+				fill()
+			}
+			if ended && nout >= nin {
+				return nil, false
+			}
+			copy(out, queue[qpos*nchannels:(qpos+1)*nchannels])
+			qpos++
+			nout++
+			return out, true
+		}
+	})
+}
+
+// breakpointsFromVal returns the magnitude response given by a vector
+// of [freq dB] pairs, sorted by frequency.
+func breakpointsFromVal(v Vec) ([]breakpoint, error) {
+	if len(v) == 0 {
+		return nil, fmt.Errorf("no breakpoints")
+	}
+	bps := make([]breakpoint, len(v))
+	for i, item := range v {
+		nums, err := numsFromVal(item, 2)
+		if err != nil {
+			return nil, fmt.Errorf("expected a [freq dB] pair, got %v", item)
+		}
+		if nums[0] < 0 || math.IsNaN(nums[1]) {
+			return nil, fmt.Errorf("invalid breakpoint: %v", item)
+		}
+		bps[i] = breakpoint{nums[0], nums[1]}
+	}
+	slices.SortStableFunc(bps, func(a, b breakpoint) int { return cmp.Compare(a.freq, b.freq) })
+	return bps, nil
+}
+
+// linphaseSize returns :linphase/size, checked.
+func linphaseSize(vm *VM, name string) (int, error) {
+	size, err := vm.GetInt(":linphase/size")
+	if err != nil {
+		return 0, err
+	}
+	if size < linphaseMinSize || size > linphaseMaxSize || size&(size-1) != 0 {
+		return 0, fmt.Errorf("%s: :linphase/size must be a power of two in %d..%d, got %d", name, linphaseMinSize, linphaseMaxSize, size)
+	}
+	return size, nil
+}
+
+// registerLinphasePreset registers a linphase word which pops its
+// nargs numeric arguments and turns them into breakpoints with mk.
+func registerLinphasePreset(name string, nargs int, mk func(args []float64) []breakpoint) {
+	RegisterWord(name, func(vm *VM) error {
+		args := make([]float64, nargs)
+		for i := nargs - 1; i >= 0; i-- {
+			n, err := Pop[Num](vm)
+			if err != nil {
+				return err
+			}
+			args[i] = float64(n)
+		}
+		if args[0] <= 0 || args[0] >= float64(SampleRate())/2 {
+			return fmt.Errorf("%s: frequency must be between 0 and %v Hz, got %v", name, SampleRate()/2, args[0])
+		}
+		input, err := streamFromVal(vm.Pop())
+		if err != nil {
+			return err
+		}
+		size, err := linphaseSize(vm, name)
+		if err != nil {
+			return err
+		}
+		vm.Push(LinearPhaseFilter(input, mk(args), size))
+		return nil
+	})
+}
+
+func init() {
+	RegisterWord("linphase", func(vm *VM) error {
+		v, err := Pop[Vec](vm)
+		if err != nil {
+			return err
+		}
+		bps, err := breakpointsFromVal(v)
+		if err != nil {
+			return fmt.Errorf("linphase: %w", err)
+		}
+		input, err := streamFromVal(vm.Pop())
+		if err != nil {
+			return err
+		}
+		size, err := linphaseSize(vm, "linphase")
+		if err != nil {
+			return err
+		}
+		vm.Push(LinearPhaseFilter(input, bps, size))
+		return nil
+	})
+
+	registerLinphasePreset("linphase/lp", 1, func(args []float64) []breakpoint {
+		return []breakpoint{{args[0], 0}, {args[0], linphaseFloorDB}}
+	})
+	registerLinphasePreset("linphase/hp", 1, func(args []float64) []breakpoint {
+		return []breakpoint{{args[0], linphaseFloorDB}, {args[0], 0}}
+	})
+	// the shelves move over two octaves centered on freq
+	registerLinphasePreset("linphase/lowshelf", 2, func(args []float64) []breakpoint {
+		return []breakpoint{{args[0] / 2, args[1]}, {args[0] * 2, 0}}
+	})
+	registerLinphasePreset("linphase/highshelf", 2, func(args []float64) []breakpoint {
+		return []breakpoint{{args[0] / 2, 0}, {args[0] * 2, args[1]}}
+	})
+}
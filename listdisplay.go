@@ -1,3 +1,5 @@
+//go:build cgo && !js
+
 package main
 
 import (
@@ -16,6 +18,7 @@ type ListDisplay struct {
 	index      int
 	top        int
 	lastHeight int
+	lastPane   TilePane
 	searchText string
 }
 
@@ -221,7 +224,22 @@ func (ld *ListDisplay) SelectedEntry() ListEntry {
 	return ld.entries[ld.index]
 }
 
+// SelectAt selects the entry displayed at screen cell p by the last
+// Render. It returns false if there is no entry at p.
+func (ld *ListDisplay) SelectAt(p Point) bool {
+	if !ld.lastPane.Contains(p) {
+		return false
+	}
+	idx := ld.top + ld.lastPane.Local(p).Y
+	if idx >= len(ld.GetFilteredEntries()) {
+		return false
+	}
+	ld.SelectFiltered(idx)
+	return true
+}
+
 func (ld *ListDisplay) Render(tp TilePane) {
+	ld.lastPane = tp
 	ld.lastHeight = tp.Height()
 	if ld.lastHeight <= 0 {
 		return
@@ -239,16 +257,23 @@ func (ld *ListDisplay) Render(tp TilePane) {
 	row := 0
 	for i := ld.top; i < len(filtered) && row < ld.lastHeight; i, row = i+1, row+1 {
 		entry := filtered[i]
-		line := entry.Format()
-		runes := []rune(line)
-		if len(runes) > availableWidth {
-			runes = runes[:availableWidth]
-			line = string(runes)
-		}
+		line := truncateToWidth(entry.Format(), availableWidth)
 		ld.drawRow(tp, row, line, selectedEntry, entry)
 	}
 }
 
+// truncateToWidth cuts s so that it fits into width screen cells.
+func truncateToWidth(s string, width int) string {
+	w := 0
+	for i, r := range s {
+		w += runeWidth(r)
+		if w > width {
+			return s[:i]
+		}
+	}
+	return s
+}
+
 func (ld *ListDisplay) drawRow(tp TilePane, row int, line string, selectedEntry ListEntry, entry ListEntry) {
 	isSelected := ld.isSelected(entry, selectedEntry)
 	if isSelected {
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// Loop plays t repeatedly as an infinite stream, advancing the read
+// position by rate frames per output frame.
+//
+// With xfade > 0 the loop period shrinks to nframes-xfade: the last
+// xfade frames of the tape are crossfaded (equal power) into the first
+// xfade frames at each loop point. The very first pass starts
+// unfaded.
+func (t *Tape) Loop(rate Stream, xfade int) Stream {
+	nc := t.nchannels
+	nf := t.nframes
+	if nf == 0 {
+		return makeEmptyStream(nc)
+	}
+	xfade = min(max(xfade, 0), nf/2)
+	period := float64(nf - xfade)
+	return makeTransformStreamN(nc, []Stream{rate}, func(inputs []Stream) Stepper {
+		rnext := inputs[0].Mono().Next
+		out := make(Frame, nc)
+		head := make(Frame, nc)
+		tail := make(Frame, nc)
+		pos := 0.0
+		firstPass := true
+		return func() (Frame, bool) {
+			r, ok := rnext()
+			if !ok {
+				return nil, false
+			}
+			if firstPass || pos >= float64(xfade) {
+				t.GetInterpolatedFrameAtIndex(pos, out)
+			} else {
+				x := pos / float64(xfade)
+				gin := math.Sin(x * math.Pi / 2)
+				gout := math.Cos(x * math.Pi / 2)
+				t.GetInterpolatedFrameAtIndex(pos, head)
+				t.GetInterpolatedFrameAtIndex(pos+period, tail)
+				for ch := range nc {
+					out[ch] = head[ch]*gin + tail[ch]*gout
+				}
+			}
+			pos += r[0]
+			if pos >= period || pos < 0 {
+				pos = math.Mod(pos, period)
+				if pos < 0 {
+					pos += period
+				}
+				firstPass = false
+			}
+			return out, true
+		}
+	})
+}
+
+func init() {
+	RegisterWord("~loop", func(vm *VM) error {
+		rate, err := streamFromVal(vm.Pop())
+		if err != nil {
+			return err
+		}
+		t, err := Pop[*Tape](vm)
+		if err != nil {
+			return err
+		}
+		xfade := 0
+		if v := vm.GetVal(":loop/xfade"); v != nil {
+			if n, ok := v.(Num); ok {
+				xfade = int(n)
+			} else {
+				return fmt.Errorf("~loop: :loop/xfade must be number (frames)")
+			}
+		}
+		vm.Push(t.Loop(rate, xfade))
+		return nil
+	})
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"math"
 	"math/rand"
+	"slices"
 )
 
 var rng *rand.Rand
@@ -156,18 +157,79 @@ func MaxOp() SmpBinOp {
 	return func(x, y Smp) Smp { return max(x, y) }
 }
 
-func ClampOp(min, max Smp) SmpUnOp {
+// ClampRangeOp limits x to [lo,hi].
+func ClampRangeOp() SmpRangeOp {
+	return func(x, lo, hi Smp) Smp {
+		return min(max(x, lo), hi)
+	}
+}
+
+// WrapOp brings x into [lo,hi) by adding or subtracting multiples of
+// the width of the range, like a phase.
+func WrapOp() SmpRangeOp {
+	return func(x, lo, hi Smp) Smp {
+		r := hi - lo
+		if r <= 0 {
+			return lo
+		}
+		return x - r*math.Floor((x-lo)/r)
+	}
+}
+
+// FoldOp brings x into [lo,hi] by reflecting it at the ends of the
+// range as often as needed, like a wavefolder.
+func FoldOp() SmpRangeOp {
+	return func(x, lo, hi Smp) Smp {
+		r := hi - lo
+		if r <= 0 {
+			return lo
+		}
+		t := (x - lo) - 2*r*math.Floor((x-lo)/(2*r))
+		if t > r {
+			t = 2*r - t
+		}
+		return lo + t
+	}
+}
+
+// QuantizeOp rounds x to the nearest multiple of step, leaving it as
+// it is if step is not positive.
+func QuantizeOp() SmpBinOp {
+	return func(x, step Smp) Smp {
+		if step <= 0 {
+			return x
+		}
+		return math.Round(x/step) * step
+	}
+}
+
+// QuantizeToOp snaps x to the nearest of values, sorted in increasing
+// order, the lower one on a tie.
+func QuantizeToOp(values []Smp) SmpUnOp {
 	return func(x Smp) Smp {
-		if x > max {
-			return max
+		i, _ := slices.BinarySearch(values, x)
+		if i == len(values) {
+			return values[i-1]
 		}
-		if x < min {
-			return min
+		if i > 0 && x-values[i-1] <= values[i]-x {
+			return values[i-1]
 		}
-		return x
+		return values[i]
 	}
 }
 
+// NoteFreq returns the frequency of the MIDI note note, A4 (note 69)
+// being a4 Hz.
+func NoteFreq(note, a4 float64) float64 {
+	return a4 * math.Pow(2, (note-69)/12)
+}
+
+// FreqNote returns the MIDI note of the frequency freq, A4 (note 69)
+// being a4 Hz. Notes between semitones have a fractional part.
+func FreqNote(freq, a4 float64) float64 {
+	return 69 + 12*math.Log2(freq/a4)
+}
+
 func init() {
 
 	RegisterWord("e", func(vm *VM) error {
@@ -317,18 +379,36 @@ func init() {
 	})
 
 	RegisterWord("clamp", func(vm *VM) error {
-		maxNum, err := Pop[Num](vm)
-		if err != nil {
-			return err
+		return applySmpRangeOp(vm, "clamp", ClampRangeOp())
+	})
+
+	RegisterWord("wrap", func(vm *VM) error {
+		return applySmpRangeOp(vm, "wrap", WrapOp())
+	})
+
+	RegisterWord("fold", func(vm *VM) error {
+		return applySmpRangeOp(vm, "fold", FoldOp())
+	})
+
+	RegisterWord("quantize", func(vm *VM) error {
+		v, ok := vm.Top().(Vec)
+		if !ok {
+			return applySmpBinOp(vm, QuantizeOp())
 		}
-		minNum, err := Pop[Num](vm)
-		if err != nil {
-			return err
+		vm.Pop()
+		if len(v) == 0 {
+			return vm.Errorf("quantize: no values")
 		}
-		if minNum > maxNum {
-			return vm.Errorf("clamp: min (%v) > max (%v)", minNum, maxNum)
+		values := make([]Smp, len(v))
+		for i, item := range v {
+			n, ok := item.(Num)
+			if !ok {
+				return vm.Errorf("quantize: expected numbers, got %v", item)
+			}
+			values[i] = Smp(n)
 		}
-		return applySmpUnOp(vm, ClampOp(Smp(minNum), Smp(maxNum)))
+		slices.Sort(values)
+		return applySmpUnOp(vm, QuantizeToOp(values))
 	})
 
 	RegisterWord("rand", func(vm *VM) error {
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"unsafe"
+)
+
+// releaseThreshold is the size in bytes by which the samples reachable
+// from a VM must shrink for the freed memory to be given back to the OS
+// right away, instead of whenever the runtime gets around to it.
+const releaseThreshold = 64 << 20
+
+// MemStats counts the values reachable from the stacks and envs of a
+// VM and the memory used by the process.
+type MemStats struct {
+	Tapes       int
+	Streams     int
+	Vecs        int
+	Maps        int
+	SampleBytes int64  // samples of the reachable tapes, shared samples counted once
+	HeapInUse   uint64 // bytes of live and not yet collected objects
+	HeapHeld    uint64 // bytes of heap memory obtained from the OS and not released
+}
+
+type vecKey struct {
+	first *Val
+	n     int
+}
+
+type memWalker struct {
+	stats   *MemStats
+	seen    map[any]bool // tapes, vecs and maps already counted, which also breaks cycles
+	samples map[*Smp]int // sample arrays by the address of their last element, their largest seen size
+}
+
+func (w *memWalker) walk(v Val) {
+	if v == nil {
+		return
+	}
+	switch v := v.getVal().(type) {
+	case *Tape:
+		if w.seen[v] {
+			return
+		}
+		w.seen[v] = true
+		w.stats.Tapes++
+		if c := cap(v.samples); c > 0 {
+			last := &v.samples[:c][c-1]
+			w.samples[last] = max(w.samples[last], c)
+		}
+	case Stream:
+		w.stats.Streams++
+	case Vec:
+		if len(v) == 0 {
+			w.stats.Vecs++
+			return
+		}
+		key := vecKey{&v[0], len(v)}
+		if w.seen[key] {
+			return
+		}
+		w.seen[key] = true
+		w.stats.Vecs++
+		for _, item := range v {
+			w.walk(item)
+		}
+	case Map:
+		key := reflect.ValueOf(v).Pointer()
+		if w.seen[key] {
+			return
+		}
+		w.seen[key] = true
+		w.stats.Maps++
+		for k, item := range v {
+			w.walk(k)
+			w.walk(item)
+		}
+	}
+}
+
+// MemStats walks the values reachable from the stacks and envs of the
+// VM, its last result and the selection.
+func (vm *VM) MemStats() *MemStats {
+	stats := vm.reachable()
+	// collect first, so that the heap counts only what is still in use
+	runtime.GC()
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	stats.HeapInUse = ms.HeapInuse
+	stats.HeapHeld = ms.HeapSys - ms.HeapReleased
+	return stats
+}
+
+// reachable is MemStats without the heap.
+func (vm *VM) reachable() *MemStats {
+	stats := &MemStats{}
+	w := &memWalker{
+		stats:   stats,
+		seen:    make(map[any]bool),
+		samples: make(map[*Smp]int),
+	}
+	rootEnvMu.RLock()
+	w.walk(rootEnv)
+	rootEnvMu.RUnlock()
+	for _, env := range vm.envStack[1:] {
+		w.walk(env)
+	}
+	for _, v := range vm.valStack {
+		w.walk(v)
+	}
+	w.walk(vm.evalResult)
+	if vm.resultEnv != nil {
+		w.walk(vm.resultEnv)
+	}
+	if t := vm.Selection(); t != nil {
+		w.walk(t)
+	}
+	for _, n := range w.samples {
+		stats.SampleBytes += int64(n) * int64(unsafe.Sizeof(Smp(0)))
+	}
+	return stats
+}
+
+func (stats *MemStats) String() string {
+	parts := []string{
+		fmt.Sprintf("%d tapes (%.1f MB of samples)", stats.Tapes, float64(stats.SampleBytes)/(1<<20)),
+		fmt.Sprintf("%d streams", stats.Streams),
+		fmt.Sprintf("%d vecs", stats.Vecs),
+		fmt.Sprintf("%d maps", stats.Maps),
+		fmt.Sprintf("heap %.1f MB in use", float64(stats.HeapInUse)/(1<<20)),
+		fmt.Sprintf("%.1f MB held", float64(stats.HeapHeld)/(1<<20)),
+	}
+	return strings.Join(parts, ", ")
+}
+
+// releaseUnreachable gives the freed memory back to the OS if the
+// samples reachable from the VM shrank by releaseThreshold bytes since
+// the last call, because a large tape was dropped from the stack, an
+// env, a vec or a map.
+func (vm *VM) releaseUnreachable() {
+	n := vm.reachable().SampleBytes
+	if vm.reachableSampleBytes-n >= releaseThreshold {
+		go releaseMemory()
+	}
+	vm.reachableSampleBytes = n
+}
+
+// releaseMemory gives the memory of unreachable values back to the OS.
+// The runtime does that on its own, but only gradually: after dropping
+// a large tape, a long live-coding session would keep holding on to
+// its memory for minutes.
+func releaseMemory() {
+	debug.FreeOSMemory()
+}
+
+func init() {
+	RegisterWord("mem", func(vm *VM) error {
+		vm.Push(Str(vm.MemStats().String()))
+		return nil
+	})
+	RegisterGoFunc("mem/tapes", func(vm *VM) int {
+		return vm.reachable().Tapes
+	})
+	RegisterGoFunc("mem/bytes", func(vm *VM) int {
+		return int(vm.reachable().SampleBytes)
+	})
+}
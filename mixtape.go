@@ -2,12 +2,14 @@ package main
 
 import (
 	"bytes"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"os"
 	"runtime/pprof"
 	"strings"
+	"time"
 )
 
 type EvalTargetKind int
@@ -23,12 +25,33 @@ type EvalTarget struct {
 }
 
 var flags struct {
-	LogLevel    string
-	SampleRate  int
-	BPM         float64 // beats per minute
-	TPB         int     // ticks per beat
-	EvalTargets []EvalTarget
-	Prof        string
+	LogLevel      string
+	SampleRate    int
+	BPM           float64 // beats per minute
+	TPB           int     // ticks per beat
+	EvalTargets   []EvalTarget
+	Prof          string
+	Journal       string
+	ViewState     string
+	Keys          string
+	Output        string // -o: render to this file instead of printing
+	Watch         bool   // render again when the inputs change
+	FallbackFonts []string
+	MSAA          int
+	Safe          bool
+	Prelude       string
+	PreludeLayers []string
+	Dev           bool
+	Sandbox       bool
+	Audio         string          // audio backend: oto or jack
+	AudioBuffer   time.Duration   // latency of the audio backend, 0 for its default
+	JackName      string          // name of the JACK client
+	JackConnect   bool            // connect the JACK ports to the system outputs
+	Defines       []string        // -D key=value
+	Threads       int             // goroutines rendering the parts of mixes
+	Config        string          // user config file
+	Scripts       []string        // the files given as arguments
+	Explicit      map[string]bool // the flags given on the command line
 }
 
 func SampleRate() int {
@@ -53,9 +76,21 @@ func (f *EvalTargetFlag) Set(val string) error {
 	return nil
 }
 
-func runGui(vm *VM, bm *BufferManager) error {
-	app := CreateApp(vm, bm)
-	return WithGL("mixtape", app)
+// StringListFlag collects the values of a repeatable flag.
+type StringListFlag struct {
+	Values *[]string
+}
+
+func (f StringListFlag) String() string {
+	if f.Values == nil {
+		return ""
+	}
+	return strings.Join(*f.Values, ",")
+}
+
+func (f StringListFlag) Set(val string) error {
+	*f.Values = append(*f.Values, val)
+	return nil
 }
 
 func withProfileIfNeeded(fn func() error) error {
@@ -93,43 +128,51 @@ func evalAndReport(vm *VM, r io.Reader, name string) error {
 	return err
 }
 
-func runWithArgs(vm *VM, args []string) error {
-	if len(flags.EvalTargets) > 0 {
-		return withProfileIfNeeded(func() error {
-			for _, target := range flags.EvalTargets {
-				switch target.Kind {
-				case evalTargetScript:
-					if err := evalAndReport(vm, strings.NewReader(target.Value), "<script>"); err != nil {
-						return err
-					}
-				case evalTargetFile:
-					data, err := os.ReadFile(target.Value)
-					if err != nil {
-						return err
-					}
-					if err := evalAndReport(vm, bytes.NewReader(data), target.Value); err != nil {
-						return err
-					}
-				}
+// evalTargets evaluates the scripts and files given with -e and -f
+// in order. If report is set, the result of each is printed.
+func evalTargets(vm *VM, report bool) error {
+	for _, target := range flags.EvalTargets {
+		var r io.Reader
+		name := "<script>"
+		switch target.Kind {
+		case evalTargetScript:
+			r = strings.NewReader(target.Value)
+		case evalTargetFile:
+			data, err := os.ReadFile(target.Value)
+			if err != nil {
+				return err
 			}
-			return nil
-		})
-	}
-
-	bm := CreateBufferManager()
-	for _, arg := range args {
-		data, err := os.ReadFile(arg)
-		if err != nil {
+			r = bytes.NewReader(data)
+			name = target.Value
+		}
+		if report {
+			if err := evalAndReport(vm, r, name); err != nil {
+				return err
+			}
+		} else if err := vm.ParseAndEval(r, name); err != nil {
 			return err
 		}
-		path := arg
-		bm.CreateBuffer("", path, data)
+		if stats := vm.renderStats; stats != nil && stats.Frames > 0 {
+			logger.Info("rendered", "stats", stats)
+		}
+	}
+	return nil
+}
+
+func runWithArgs(vm *VM, args []string) error {
+	if flags.Output != "" {
+		return runRender(vm, args, flags.Output, flags.Watch)
 	}
-	if bm.Empty() {
-		bm.CreateBuffer("", "", nil)
+	if flags.Watch {
+		return errors.New("-watch needs -o")
+	}
+	if len(flags.EvalTargets) > 0 {
+		return withProfileIfNeeded(func() error {
+			return evalTargets(vm, true)
+		})
 	}
 
-	return runGui(vm, bm)
+	return runGui(vm, args)
 }
 
 func setDefaults(vm *VM) {
@@ -141,40 +184,115 @@ func setDefaults(vm *VM) {
 	vm.SetVal(":nf", int(framesPerBeat))
 }
 
-func main() {
-	var vm *VM
-	var err error
-	flag.StringVar(&flags.LogLevel, "loglevel", "info", "Log level")
-	flag.IntVar(&flags.SampleRate, "sr", 48000, "Sample rate")
-	flag.Float64Var(&flags.BPM, "bpm", 120, "Beats per minute")
-	flag.IntVar(&flags.TPB, "tpb", 96, "Ticks per beat")
-	flag.Var(&EvalTargetFlag{Kind: evalTargetFile}, "f", "File to evaluate")
-	flag.Var(&EvalTargetFlag{Kind: evalTargetScript}, "e", "Script to evaluate")
-	flag.StringVar(&flags.Prof, "prof", "", "Profile output file prefix (writes <prefix>.cpu and <prefix>.mem)")
-	flag.Parse()
-	if err := InitLogger(flags.LogLevel); err != nil {
-		fmt.Fprintf(os.Stderr, "%s\n", err)
-		os.Exit(1)
+// newVM creates a VM with the defaults set and the prelude loaded.
+func newVM() (*VM, error) {
+	vm, err := CreateVM()
+	if err != nil {
+		return nil, fmt.Errorf("vm initialization error: %w", err)
 	}
-	vm, err = CreateVM()
+	entries, err := loadConfig()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "vm initialization error: %s", err)
-		os.Exit(1)
+		return nil, err
 	}
+	applyConfigTempo(entries)
 	setDefaults(vm)
-	prelude, err := assets.ReadFile("assets/prelude.tape")
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "cannot load prelude from embed.FS: %s", err)
-		os.Exit(1)
+	vm.sandbox = flags.Sandbox
+	if err := vm.LoadPrelude(); err != nil {
+		return nil, err
 	}
-	err = vm.ParseAndEval(bytes.NewReader(prelude), "<prelude>")
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "error while parsing the prelude: %s", err)
+	if err := applyConfig(vm, entries); err != nil {
+		return nil, err
+	}
+	if err := applyDefines(vm); err != nil {
+		return nil, err
+	}
+	return vm, nil
+}
+
+// addCommonFlags adds the flags understood by all subcommands to fs.
+func addCommonFlags(fs *flag.FlagSet) {
+	fs.StringVar(&flags.LogLevel, "loglevel", "info", "Log level")
+	fs.IntVar(&flags.SampleRate, "sr", 48000, "Sample rate")
+	fs.Float64Var(&flags.BPM, "bpm", 120, "Beats per minute")
+	fs.IntVar(&flags.TPB, "tpb", 96, "Ticks per beat")
+	fs.StringVar(&flags.Prof, "prof", "", "Profile output file prefix (writes <prefix>.cpu and <prefix>.mem)")
+	fs.StringVar(&flags.Prelude, "prelude", "", "Load the prelude from this file instead of the built-in one")
+	fs.Var(StringListFlag{&flags.PreludeLayers}, "prelude-layer", "File to evaluate after the prelude, ~/.mixtape/prelude.tape and ./prelude.tape (repeatable)")
+	fs.Var(DefineFlag{&flags.Defines}, "D", "Set the env var :key to value in the root env, e.g. -D len=2s (repeatable)")
+	fs.IntVar(&flags.Threads, "threads", 1, "Number of goroutines rendering the parts of sums and arrangements in parallel (overridden by :threads)")
+	fs.StringVar(&flags.Config, "config", "~/.mixtape/config.toml", "Config file setting the defaults of env vars (empty to disable), applied before ./.mixtape.toml next to the scripts")
+	fs.BoolVar(&flags.Sandbox, "sandbox", false, "Evaluate scripts without allowing them to write files, run programs or access the network")
+}
+
+// addEvalFlags adds the flags selecting scripts to evaluate to fs.
+func addEvalFlags(fs *flag.FlagSet) {
+	fs.Var(&EvalTargetFlag{Kind: evalTargetFile}, "f", "File to evaluate")
+	fs.Var(&EvalTargetFlag{Kind: evalTargetScript}, "e", "Script to evaluate")
+}
+
+// addAudioFlags adds the flags selecting the audio backend to fs.
+func addAudioFlags(fs *flag.FlagSet) {
+	fs.StringVar(&flags.Audio, "audio", "oto", "Audio backend: oto (the default device of the system) or jack")
+	fs.DurationVar(&flags.AudioBuffer, "audio-buffer", 0, "Audio buffer length, e.g. 10ms (0 for the default of the backend; with jack, sets the buffer size of the server)")
+	fs.StringVar(&flags.JackName, "jack-name", "mixtape", "Client name with -audio jack")
+	fs.BoolVar(&flags.JackConnect, "jack-connect", true, "Connect the ports to the system playback and capture ports with -audio jack")
+}
+
+// addEditFlags adds the flags of the editor to fs.
+func addEditFlags(fs *flag.FlagSet) {
+	fs.StringVar(&flags.Journal, "journal", "~/.mixtape/journal.jsonl", "Evaluation journal file (empty to disable)")
+	fs.StringVar(&flags.ViewState, "viewstate", "~/.mixtape/viewstate.json", "File remembering cursor, selection and tape zoom per file (empty to disable)")
+	fs.StringVar(&flags.Keys, "keys", "~/.mixtape/keys.toml", "Key binding overrides (empty to disable)")
+	fs.Var(StringListFlag{&flags.FallbackFonts}, "fallback-font", "Font file to try for glyphs missing from the built-in font (repeatable)")
+	fs.BoolVar(&flags.Safe, "safe", false, "Run the editor in the terminal without OpenGL")
+	fs.IntVar(&flags.MSAA, "msaa", 4, "Number of multisampling (anti-aliasing) samples, 0 to disable")
+	fs.BoolVar(&flags.Dev, "dev", false, "Reload the prelude whenever its file changes (default file: assets/prelude.tape)")
+}
+
+func main() {
+	addCommonFlags(flag.CommandLine)
+	addEvalFlags(flag.CommandLine)
+	addEditFlags(flag.CommandLine)
+	addAudioFlags(flag.CommandLine)
+	flag.StringVar(&flags.Output, "o", "", "Render the result of the scripts (-e/-f and the files given) to this WAV or FLAC file instead of opening the editor")
+	flag.BoolVar(&flags.Watch, "watch", false, "With -o, render again whenever the scripts or the prelude change")
+	flag.Usage = usage
+	flag.Parse()
+	args := flag.Args()
+	var cmd *command
+	if len(args) > 0 {
+		cmd = findCommand(args[0])
+	}
+	flags.Explicit = make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { flags.Explicit[f.Name] = true })
+	if cmd != nil {
+		cmd.flags.Parse(args[1:])
+		args = cmd.flags.Args()
+		cmd.flags.Visit(func(f *flag.Flag) { flags.Explicit[f.Name] = true })
+	}
+	flags.Scripts = args
+	if err := InitLogger(flags.LogLevel); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
 		os.Exit(1)
 	}
-	err = runWithArgs(vm, flag.Args())
+	var err error
+	if cmd != nil && !cmd.needsVM {
+		err = cmd.run(nil, args)
+	} else {
+		var vm *VM
+		vm, err = newVM()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", formatError(err))
+			os.Exit(1)
+		}
+		if cmd != nil {
+			err = cmd.run(vm, args)
+		} else {
+			err = runWithArgs(vm, args)
+		}
+	}
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s\n", err)
+		fmt.Fprintf(os.Stderr, "%s\n", formatError(err))
 		os.Exit(1)
 	}
 }
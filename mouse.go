@@ -0,0 +1,108 @@
+//go:build cgo && !js
+
+package main
+
+import (
+	"github.com/go-gl/glfw/v3.3/glfw"
+)
+
+type MouseAction int
+
+const (
+	MousePress MouseAction = iota
+	MouseDrag              // movement with a button held down
+	MouseRelease
+)
+
+type MouseButton int
+
+const (
+	MouseLeft MouseButton = iota
+	MouseRight
+	MouseMiddle
+)
+
+// doubleClickSeconds is the maximum time between the presses of a
+// double click.
+const doubleClickSeconds = 0.4
+
+// MouseEvent describes a button press, a drag or a button release.
+type MouseEvent struct {
+	Action MouseAction
+	Button MouseButton
+	Cell   Point // position in screen cells
+	Pixel  Point // position in framebuffer pixels
+	Clicks int   // 2 for the second press of a double click, 1 otherwise
+}
+
+// MouseScreen is implemented by screens that handle the mouse.
+type MouseScreen interface {
+	HandleMouse(app *App, ev MouseEvent)
+}
+
+type mouseState struct {
+	pixel         Point
+	pressed       bool
+	button        MouseButton
+	lastPressTime float64
+	lastPressCell Point
+}
+
+// OnCursorPos is called with the position of the mouse in
+// framebuffer pixels whenever it moves.
+func (app *App) OnCursorPos(x, y float64) {
+	app.mouse.pixel = Point{X: int(x), Y: int(y)}
+	if app.mouse.pressed {
+		app.dispatchMouse(MouseDrag, app.mouse.button)
+	}
+}
+
+func (app *App) OnMouseButton(button glfw.MouseButton, action glfw.Action, mods glfw.ModifierKey) {
+	var mb MouseButton
+	switch button {
+	case glfw.MouseButtonLeft:
+		mb = MouseLeft
+	case glfw.MouseButtonRight:
+		mb = MouseRight
+	case glfw.MouseButtonMiddle:
+		mb = MouseMiddle
+	default:
+		return
+	}
+	switch action {
+	case glfw.Press:
+		app.mouse.pressed = true
+		app.mouse.button = mb
+		app.dispatchMouse(MousePress, mb)
+	case glfw.Release:
+		app.mouse.pressed = false
+		app.dispatchMouse(MouseRelease, mb)
+	}
+}
+
+func (app *App) dispatchMouse(action MouseAction, button MouseButton) {
+	if app.ts == nil || app.currentPrompt != nil {
+		return
+	}
+	ev := MouseEvent{
+		Action: action,
+		Button: button,
+		Cell:   app.ts.CellAt(app.mouse.pixel),
+		Pixel:  app.mouse.pixel,
+		Clicks: 1,
+	}
+	if action == MousePress {
+		app.ClearLastError()
+		now := GetTime()
+		if now-app.mouse.lastPressTime < doubleClickSeconds && ev.Cell == app.mouse.lastPressCell {
+			ev.Clicks = 2
+			// a third press starts a new double click
+			now = 0
+		}
+		app.mouse.lastPressTime = now
+		app.mouse.lastPressCell = ev.Cell
+	}
+	if ms, ok := app.currentScreen.(MouseScreen); ok {
+		ms.HandleMouse(app, ev)
+	}
+}
@@ -0,0 +1,24 @@
+//go:build !cgo || js
+
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+var startTime = time.Now()
+
+// GetTime returns the number of seconds since the program started
+// (glfw.GetTime in builds with the OpenGL frontend).
+func GetTime() float64 {
+	return time.Since(startTime).Seconds()
+}
+
+func playTape(t *Tape, downmix channelMatrices) error {
+	return errors.New("play: audio output is not available in this build")
+}
+
+func recordInput(vm *VM, nframes int) (*Tape, error) {
+	return nil, errors.New("record: audio input is not available in this build")
+}
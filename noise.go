@@ -138,3 +138,177 @@ func init() {
 		return nil
 	})
 }
+
+// seedFromEnv returns :seed, 0 if it is not set.
+func seedFromEnv(vm *VM, word string) (int64, error) {
+	sval := vm.GetVal(":seed")
+	if sval == nil {
+		return 0, nil
+	}
+	snum, ok := sval.(Num)
+	if !ok {
+		return 0, fmt.Errorf("%s: :seed must be number", word)
+	}
+	return int64(snum), nil
+}
+
+// ShNoise returns a mono stream of random values in [-1,1] from r, a
+// new one rate times a second. With slew (in seconds) above 0, it glides
+// towards each new value instead of jumping to it.
+func ShNoise(r Rng, rate Stream, slew float64) Stream {
+	return makeBlockTransformStreamN(1, []Stream{rate}, func(inputs []Stream) BlockStepper {
+		rate := inputs[0].Mono()
+		rbuf := make([]Smp, blockFrames)
+		r := r
+		sr := float64(SampleRate())
+		coef := 1.0
+		if slew > 0 {
+			coef = 1 - math.Exp(-1/(slew*sr))
+		}
+		var target, x float64
+		phase := sr // the phase in cycles times sr, drawing at the first frame
+		first := true
+		return func(buf []Smp) int {
+			n := rate.NextBlock(rbuf[:len(buf)])
+			for i, f := range rbuf[:n] {
+				if phase >= sr {
+					phase = math.Mod(phase, sr)
+					var u float64
+					r, u = r.Next()
+					target = 2*u - 1
+					if first {
+						x, first = target, false
+					}
+				}
+				x += coef * (target - x)
+				buf[i] = Smp(x)
+				phase += float64(f)
+			}
+			return n
+		}
+	})
+}
+
+// Drunk returns a mono random walk in [-1,1] from r, starting at 0: rate
+// times a second, it moves by a random amount up to step either way,
+// bouncing back from the bounds.
+func Drunk(r Rng, rate, step Stream) Stream {
+	return makeBlockTransformStreamN(1, []Stream{rate, step}, func(inputs []Stream) BlockStepper {
+		rate := inputs[0].Mono()
+		step := inputs[1].Mono()
+		rbuf := make([]Smp, blockFrames)
+		sbuf := make([]Smp, blockFrames)
+		r := r
+		sr := float64(SampleRate())
+		x := 0.0
+		phase := 0.0 // the phase in cycles times sr
+		return func(buf []Smp) int {
+			n := rate.NextBlock(rbuf[:len(buf)])
+			n = step.NextBlock(sbuf[:n])
+			for i, f := range rbuf[:n] {
+				if phase >= sr {
+					phase = math.Mod(phase, sr)
+					var u float64
+					r, u = r.Next()
+					x += float64(sbuf[i]) * (2*u - 1)
+					for x > 1 || x < -1 {
+						if x > 1 {
+							x = 2 - x
+						} else {
+							x = -2 - x
+						}
+					}
+				}
+				buf[i] = Smp(x)
+				phase += float64(f)
+			}
+			return n
+		}
+	})
+}
+
+// perlinGradient returns the gradient of 1D Perlin noise seeded with
+// seed at lattice point i, in [-1,1].
+func perlinGradient(seed int64, i int64) float64 {
+	_, u := NewRng(seed ^ i*0x5851f42d4c957f2d).Next()
+	return 2*u - 1
+}
+
+// Perlin returns mono 1D Perlin (gradient) noise in [-1,1] seeded with
+// seed, passing through rate lattice points a second: a smooth random
+// curve which changes direction about rate times a second.
+func Perlin(seed int64, rate Stream) Stream {
+	return makeBlockTransformStreamN(1, []Stream{rate}, func(inputs []Stream) BlockStepper {
+		rate := inputs[0].Mono()
+		rbuf := make([]Smp, blockFrames)
+		sr := float64(SampleRate())
+		var cell int64 // lattice point left of pos
+		pos := 0.0     // position from cell in lattice units
+		g0, g1 := perlinGradient(seed, 0), perlinGradient(seed, 1)
+		return func(buf []Smp) int {
+			n := rate.NextBlock(rbuf[:len(buf)])
+			for i, f := range rbuf[:n] {
+				for pos >= 1 {
+					pos--
+					cell++
+					g0, g1 = g1, perlinGradient(seed, cell+1)
+				}
+				fade := pos * pos * pos * (pos*(pos*6-15) + 10)
+				a, b := g0*pos, g1*(pos-1)
+				// 1D gradient noise stays within [-0.5,0.5]
+				buf[i] = Smp(2 * (a + fade*(b-a)))
+				pos += float64(f) / sr
+			}
+			return n
+		}
+	})
+}
+
+func init() {
+	RegisterWord("~shnoise", func(vm *VM) error {
+		rate, err := streamFromVal(vm.Pop())
+		if err != nil {
+			return err
+		}
+		seed, err := seedFromEnv(vm, "~shnoise")
+		if err != nil {
+			return err
+		}
+		slew, err := vm.GetFloat(":shnoise/slew")
+		if err != nil {
+			return err
+		}
+		vm.Push(ShNoise(NewRng(seed), rate, slew))
+		return nil
+	})
+
+	RegisterWord("~drunk", func(vm *VM) error {
+		step, err := streamFromVal(vm.Pop())
+		if err != nil {
+			return err
+		}
+		rate, err := streamFromVal(vm.Pop())
+		if err != nil {
+			return err
+		}
+		seed, err := seedFromEnv(vm, "~drunk")
+		if err != nil {
+			return err
+		}
+		vm.Push(Drunk(NewRng(seed), rate, step))
+		return nil
+	})
+
+	RegisterWord("~perlin", func(vm *VM) error {
+		rate, err := streamFromVal(vm.Pop())
+		if err != nil {
+			return err
+		}
+		seed, err := seedFromEnv(vm, "~perlin")
+		if err != nil {
+			return err
+		}
+		vm.Push(Perlin(seed, rate))
+		return nil
+	})
+}
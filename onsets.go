@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/mjibson/go-dsp/fft"
+)
+
+const (
+	onsetWindowSize = 1024
+	onsetHopSize    = 256
+)
+
+// spectralFlux computes the half-wave rectified spectral flux of the
+// mono sum of t, one value per hop, normalized to [0,1].
+func (t *Tape) spectralFlux() []float64 {
+	nhops := (t.nframes + onsetHopSize - 1) / onsetHopSize
+	flux := make([]float64, nhops)
+	window := make([]float64, onsetWindowSize)
+	for i := range window {
+		window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(onsetWindowSize))
+	}
+	nbins := onsetWindowSize/2 + 1
+	prevMags := make([]float64, nbins)
+	buf := make([]float64, onsetWindowSize)
+	maxFlux := 0.0
+	for h := range nhops {
+		start := h*onsetHopSize - onsetWindowSize/2
+		for i := range onsetWindowSize {
+			frame := start + i
+			v := 0.0
+			if frame >= 0 && frame < t.nframes {
+				for ch := range t.nchannels {
+					v += t.samples[frame*t.nchannels+ch]
+				}
+				v /= float64(t.nchannels)
+			}
+			buf[i] = v * window[i]
+		}
+		X := fft.FFTReal(buf)
+		sum := 0.0
+		for k := range nbins {
+			// log compression makes quiet onsets count
+			mag := math.Log1p(100 * math.Hypot(real(X[k]), imag(X[k])))
+			if d := mag - prevMags[k]; d > 0 {
+				sum += d
+			}
+			prevMags[k] = mag
+		}
+		flux[h] = sum
+		maxFlux = max(maxFlux, sum)
+	}
+	if maxFlux > 0 {
+		for h := range flux {
+			flux[h] /= maxFlux
+		}
+	}
+	return flux
+}
+
+// Onsets returns the frame indices of the transients detected in t.
+//
+// A hop counts as an onset if its spectral flux is a local maximum
+// which exceeds the local mean by threshold (in [0,1]) and it is at
+// least minGap frames after the previous onset.
+func (t *Tape) Onsets(threshold float64, minGap int) []int {
+	if t.nframes == 0 {
+		return nil
+	}
+	flux := t.spectralFlux()
+	const meanRadius = 8
+	var onsets []int
+	last := -minGap
+	for h, v := range flux {
+		if h > 0 && v <= flux[h-1] {
+			continue
+		}
+		if h+1 < len(flux) && v < flux[h+1] {
+			continue
+		}
+		lo, hi := max(0, h-meanRadius), min(len(flux), h+meanRadius+1)
+		mean := 0.0
+		for _, x := range flux[lo:hi] {
+			mean += x
+		}
+		mean /= float64(hi - lo)
+		if v < mean+threshold {
+			continue
+		}
+		frame := t.refineOnset(h * onsetHopSize)
+		if frame-last < minGap {
+			continue
+		}
+		onsets = append(onsets, frame)
+		last = frame
+	}
+	return onsets
+}
+
+// refineOnset narrows down an onset found at hop resolution: it
+// returns the start of the block with the largest energy increase in
+// the analysis window centered at frame.
+func (t *Tape) refineOnset(frame int) int {
+	const blockSize = 16
+	start := max(0, frame-onsetWindowSize/2)
+	end := min(t.nframes, frame+onsetWindowSize/2)
+	best, bestRise := frame, math.Inf(-1)
+	prevEnergy := 0.0
+	if start >= blockSize {
+		prevEnergy = t.blockEnergy(start-blockSize, start)
+	}
+	for b := start; b < end; b += blockSize {
+		energy := t.blockEnergy(b, min(b+blockSize, end))
+		if rise := energy - prevEnergy; rise > bestRise {
+			best, bestRise = b, rise
+		}
+		prevEnergy = energy
+	}
+	if bestRise <= 0 {
+		return frame
+	}
+	return best
+}
+
+// blockEnergy returns the mean squared sample value in frames [start,end).
+func (t *Tape) blockEnergy(start, end int) float64 {
+	sum := 0.0
+	for _, v := range t.samples[start*t.nchannels : end*t.nchannels] {
+		sum += v * v
+	}
+	return sum / float64(max(1, end-start))
+}
+
+// SlicesAt cuts t at the given frame indices. The first slice always
+// starts at frame 0, so joining the slices gives back t.
+func (t *Tape) SlicesAt(onsets []int) []*Tape {
+	var slices []*Tape
+	start := 0
+	for _, onset := range onsets {
+		if onset <= start || onset >= t.nframes {
+			continue
+		}
+		slices = append(slices, t.slice(start, onset))
+		start = onset
+	}
+	slices = append(slices, t.slice(start, t.nframes))
+	return slices
+}
+
+func getOnsetParams(vm *VM, word string) (threshold float64, minGap int, err error) {
+	threshold = 0.1
+	if v := vm.GetVal(":onset/threshold"); v != nil {
+		if n, ok := v.(Num); ok {
+			threshold = float64(n)
+		} else {
+			return 0, 0, fmt.Errorf("%s: :onset/threshold must be number", word)
+		}
+	}
+	minGap = SampleRate() / 20
+	if v := vm.GetVal(":onset/gap"); v != nil {
+		if n, ok := v.(Num); ok {
+			minGap = max(0, int(n))
+		} else {
+			return 0, 0, fmt.Errorf("%s: :onset/gap must be number (frames)", word)
+		}
+	}
+	return threshold, minGap, nil
+}
+
+func init() {
+	RegisterMethod[*Tape]("onsets", 1, func(vm *VM) error {
+		t, err := Pop[*Tape](vm)
+		if err != nil {
+			return err
+		}
+		threshold, minGap, err := getOnsetParams(vm, "onsets")
+		if err != nil {
+			return err
+		}
+		onsets := t.Onsets(threshold, minGap)
+		result := make(Vec, len(onsets))
+		for i, onset := range onsets {
+			result[i] = Num(onset)
+		}
+		vm.Push(result)
+		return nil
+	})
+
+	RegisterMethod[*Tape]("slices", 1, func(vm *VM) error {
+		t, err := Pop[*Tape](vm)
+		if err != nil {
+			return err
+		}
+		threshold, minGap, err := getOnsetParams(vm, "slices")
+		if err != nil {
+			return err
+		}
+		slices := t.SlicesAt(t.Onsets(threshold, minGap))
+		result := make(Vec, len(slices))
+		for i, slice := range slices {
+			result[i] = slice
+		}
+		vm.Push(result)
+		return nil
+	})
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"sync"
+)
+
+// parallelBlockSize is the number of frames the parts of a mix are
+// rendered in at a time by takeParallel.
+const parallelBlockSize = 8192
+
+// mixNode records that a stream combines parts which can be computed
+// independently of each other, so that Take can render them in
+// parallel.
+type mixNode struct {
+	op    SmpBinOp // folds the frames of the parts
+	any   bool     // it plays while any part does (arrange), not while all do (+, *, ...)
+	parts []mixPart
+}
+
+// mixPart is a part of a mix, starting at a frame of the mix.
+type mixPart struct {
+	start  int
+	stream Stream
+}
+
+// renderThreads returns the number of goroutines Take may use, from
+// :threads if set, from -threads otherwise.
+func renderThreads(vm *VM) int {
+	if vm != nil {
+		if n, ok := vm.GetVal(":threads").(Num); ok {
+			return max(int(n), 1)
+		}
+	}
+	return max(flags.Threads, 1)
+}
+
+// renderNode is a node of the tree of mixes rendered by takeParallel.
+// The leaves play streams, the other nodes mix their children.
+type renderNode struct {
+	nch      int
+	start    int // first frame, counting from the start of the render
+	op       SmpBinOp
+	any      bool
+	children []*renderNode
+	stream   Stream // leaves only
+	buf      []Smp  // the current block
+	end      int    // frame at which it has ended, -1 while playing
+}
+
+// newRenderNode returns the node rendering s in nch channels from
+// frame start on, appending its leaves to leaves.
+func newRenderNode(s Stream, nch, start int, leaves *[]*renderNode) *renderNode {
+	n := &renderNode{nch: nch, start: start, end: -1, buf: make([]Smp, parallelBlockSize*nch)}
+	if s.mix == nil || len(s.mix.parts) == 0 || s.nchannels != nch {
+		n.stream = s.WithNChannels(nch).clone()
+		*leaves = append(*leaves, n)
+		return n
+	}
+	n.op, n.any = s.mix.op, s.mix.any
+	for _, p := range s.mix.parts {
+		n.children = append(n.children, newRenderNode(p.stream, nch, start+p.start, leaves))
+	}
+	return n
+}
+
+// renderLeaf fills the buffer of leaf n with the block of frames
+// starting at from.
+func (n *renderNode) renderLeaf(from int) {
+	clear(n.buf)
+	for i := max(n.start-from, 0); i < parallelBlockSize && n.end < 0; i += blockFrames {
+		want := min(blockFrames, parallelBlockSize-i)
+		if got := n.stream.NextBlock(n.buf[i*n.nch : (i+want)*n.nch]); got < want {
+			n.end = from + i + got
+			clear(n.buf[(i+got)*n.nch:])
+		}
+	}
+}
+
+// mix fills the buffer of node n with the combination of its children,
+// in the order the stream it stands for combines them.
+func (n *renderNode) mix(from int) {
+	if n.children == nil {
+		return
+	}
+	for _, c := range n.children {
+		c.mix(from)
+	}
+	copy(n.buf, n.children[0].buf)
+	for _, c := range n.children[1:] {
+		for i, smp := range c.buf {
+			n.buf[i] = n.op(n.buf[i], smp)
+		}
+	}
+	if n.end < 0 {
+		n.end = n.childrenEnd(from)
+	}
+	if n.end >= 0 {
+		clear(n.buf[max(n.end-from, 0)*n.nch:])
+	}
+}
+
+// childrenEnd returns the frame at which the children of n have made it
+// end (any of them for +, all of them for arrange), or -1.
+func (n *renderNode) childrenEnd(from int) int {
+	end := -1
+	for _, c := range n.children {
+		switch {
+		case c.end < 0 && n.any:
+			return -1
+		case c.end < 0:
+		case end < 0 || (n.any && c.end > end) || (!n.any && c.end < end):
+			end = c.end
+		}
+	}
+	return end
+}
+
+// takeParallel renders nframes frames of s like Take does, the leaves
+// of its tree of mixes on up to threads goroutines, one block at a time.
+// The parts of a mix are combined in the same order as by the stream,
+// so the result is the same.
+func (s Stream) takeParallel(vm *VM, nframes, threads int) *Tape {
+	nch := s.nchannels
+	t := makeTape(nch, nframes)
+	var leaves []*renderNode
+	root := newRenderNode(s, nch, 0, &leaves)
+	logger.Debug("rendering in parallel", "leaves", len(leaves), "threads", threads)
+	type job struct {
+		leaf *renderNode
+		from int
+	}
+	jobs := make(chan job)
+	var wg sync.WaitGroup
+	for range min(threads, len(leaves)) {
+		go func() {
+			for j := range jobs {
+				j.leaf.renderLeaf(j.from)
+				wg.Done()
+			}
+		}()
+	}
+	defer close(jobs)
+	for from := 0; from < nframes; from += parallelBlockSize {
+		for _, leaf := range leaves {
+			wg.Add(1)
+			jobs <- job{leaf, from}
+		}
+		wg.Wait()
+		root.mix(from)
+		n := min(parallelBlockSize, nframes-from)
+		if root.end >= 0 {
+			n = min(n, max(root.end-from, 0))
+		}
+		copy(t.samples[from*nch:], root.buf[:n*nch])
+		if vm != nil {
+			if vm.Checkpoint() {
+				break
+			}
+			vm.ReportTapeProgress(t, nframes, from+n)
+		}
+		if n < min(parallelBlockSize, nframes-from) {
+			break // ended
+		}
+	}
+	return t
+}
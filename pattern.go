@@ -0,0 +1,352 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// patNode is a node of a parsed pattern.
+//
+// A node is either a note (leaf), a sequence which divides its time
+// span evenly among its steps, a stack which plays all its layers at
+// the same time (chords), or an alternation which plays one of its
+// choices per cycle.
+type patNode struct {
+	kind     patKind
+	note     float64
+	rest     bool
+	children []*patNode
+}
+
+type patKind int
+
+const (
+	patNote patKind = iota
+	patSequence
+	patStack
+	patAlternation
+)
+
+// patEvent is a note of a pattern, with start and duration in cycles.
+type patEvent struct {
+	start float64
+	dur   float64
+	note  float64
+}
+
+type patParser struct {
+	src string
+	pos int
+}
+
+func (p *patParser) errorf(format string, a ...any) error {
+	return fmt.Errorf("pat: at %d: %s", p.pos, fmt.Sprintf(format, a...))
+}
+
+func (p *patParser) skipSpace() {
+	for p.pos < len(p.src) && unicode.IsSpace(rune(p.src[p.pos])) {
+		p.pos++
+	}
+}
+
+func (p *patParser) peek() byte {
+	if p.pos < len(p.src) {
+		return p.src[p.pos]
+	}
+	return 0
+}
+
+// parseStack parses layers separated by ',' up to the closing
+// bracket (or the end of input if close == 0).
+func (p *patParser) parseStack(close byte) (*patNode, error) {
+	stack := &patNode{kind: patStack}
+	for {
+		seq, err := p.parseSequence(close)
+		if err != nil {
+			return nil, err
+		}
+		stack.children = append(stack.children, seq)
+		if p.peek() != ',' {
+			break
+		}
+		p.pos++
+	}
+	if p.peek() != close {
+		if close == 0 {
+			return nil, p.errorf("unexpected %q", p.peek())
+		}
+		return nil, p.errorf("missing %q", close)
+	}
+	if close != 0 {
+		p.pos++
+	}
+	if len(stack.children) == 1 {
+		return stack.children[0], nil
+	}
+	return stack, nil
+}
+
+func (p *patParser) parseSequence(close byte) (*patNode, error) {
+	seq := &patNode{kind: patSequence}
+	for {
+		p.skipSpace()
+		ch := p.peek()
+		if ch == 0 || ch == close || ch == ',' {
+			break
+		}
+		step, err := p.parseStep()
+		if err != nil {
+			return nil, err
+		}
+		seq.children = append(seq.children, step)
+	}
+	return seq, nil
+}
+
+// parseStep parses an atom, a [subsequence] or an <alternation>,
+// optionally followed by *n (play n times within the step).
+func (p *patParser) parseStep() (*patNode, error) {
+	var node *patNode
+	var err error
+	switch p.peek() {
+	case '[':
+		p.pos++
+		node, err = p.parseStack(']')
+	case '<':
+		p.pos++
+		var seq *patNode
+		seq, err = p.parseSequence('>')
+		if err == nil && p.peek() != '>' {
+			err = p.errorf("missing '>'")
+		}
+		if err == nil {
+			p.pos++
+			node = &patNode{kind: patAlternation, children: seq.children}
+		}
+	default:
+		node, err = p.parseAtom()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if p.peek() == '*' {
+		p.pos++
+		start := p.pos
+		for p.pos < len(p.src) && unicode.IsDigit(rune(p.src[p.pos])) {
+			p.pos++
+		}
+		n, err := strconv.Atoi(p.src[start:p.pos])
+		if err != nil || n < 1 {
+			return nil, p.errorf("invalid repeat count")
+		}
+		rep := &patNode{kind: patSequence}
+		for range n {
+			rep.children = append(rep.children, node)
+		}
+		node = rep
+	}
+	return node, nil
+}
+
+func (p *patParser) parseAtom() (*patNode, error) {
+	start := p.pos
+	for p.pos < len(p.src) && !strings.ContainsRune(" \t\r\n[]<>,*", rune(p.src[p.pos])) {
+		p.pos++
+	}
+	text := p.src[start:p.pos]
+	if text == "" {
+		return nil, p.errorf("unexpected %q", p.peek())
+	}
+	if text == "~" {
+		return &patNode{kind: patNote, rest: true}, nil
+	}
+	if midi, ok := parseNoteName(text); ok {
+		return &patNode{kind: patNote, note: float64(midi)}, nil
+	}
+	if f, err := strconv.ParseFloat(text, 64); err == nil {
+		return &patNode{kind: patNote, note: f}, nil
+	}
+	p.pos = start
+	return nil, p.errorf("invalid note %q", text)
+}
+
+// parsePattern parses a pattern in a subset of the TidalCycles mini
+// notation: notes (c-4, d#5 or MIDI numbers), rests (~), [sub
+// sequences], chords ([c-4,e-4,g-4]), alternations (<c-4 d-4>) and
+// repetition (c-4*2).
+func parsePattern(src string) (*patNode, error) {
+	p := &patParser{src: src}
+	return p.parseStack(0)
+}
+
+// events appends the notes of cycle which node plays in the span
+// [start,start+dur) to events.
+func (node *patNode) events(cycle int, start, dur float64, events []patEvent) []patEvent {
+	switch node.kind {
+	case patNote:
+		if !node.rest {
+			events = append(events, patEvent{start: start, dur: dur, note: node.note})
+		}
+	case patSequence:
+		if len(node.children) == 0 {
+			break
+		}
+		step := dur / float64(len(node.children))
+		for i, child := range node.children {
+			events = child.events(cycle, start+float64(i)*step, step, events)
+		}
+	case patStack:
+		for _, child := range node.children {
+			events = child.events(cycle, start, dur, events)
+		}
+	case patAlternation:
+		if len(node.children) > 0 {
+			events = node.children[cycle%len(node.children)].events(cycle, start, dur, events)
+		}
+	}
+	return events
+}
+
+// patLane is a monophonic part of a rendered pattern.
+type patLane struct {
+	events []patEvent // in frames, sorted by start
+}
+
+// patternLanes renders cycles cycles of node into lanes such that the
+// notes of a lane do not overlap, using framesPerCycle frames per cycle.
+func patternLanes(node *patNode, cycles int, framesPerCycle float64) []patLane {
+	var events []patEvent
+	for cycle := range cycles {
+		events = node.events(cycle, float64(cycle), 1, events)
+	}
+	slices.SortStableFunc(events, func(a, b patEvent) int {
+		switch {
+		case a.start < b.start:
+			return -1
+		case a.start > b.start:
+			return 1
+		}
+		return 0
+	})
+	var lanes []patLane
+	for _, e := range events {
+		e.start = math.Round(e.start * framesPerCycle)
+		e.dur = math.Round(e.dur * framesPerCycle)
+		li := slices.IndexFunc(lanes, func(l patLane) bool {
+			last := l.events[len(l.events)-1]
+			return last.start+last.dur <= e.start
+		})
+		if li == -1 {
+			lanes = append(lanes, patLane{})
+			li = len(lanes) - 1
+		}
+		lanes[li].events = append(lanes[li].events, e)
+	}
+	return lanes
+}
+
+// PatternStreams renders a pattern into a gate and a note stream with
+// one channel per lane. Gates are high for legato times the duration
+// of each note (but always drop before the next note of their lane);
+// notes hold the MIDI note of the last note on.
+func PatternStreams(lanes []patLane, nframes int, legato float64) (gate Stream, notes Stream) {
+	nlanes := max(1, len(lanes))
+	gateTape := makeTape(nlanes, nframes)
+	noteTape := makeTape(nlanes, nframes)
+	for li, lane := range lanes {
+		for i, e := range lane.events {
+			start := int(e.start)
+			end := nframes
+			if i+1 < len(lane.events) {
+				end = int(lane.events[i+1].start)
+			}
+			gateEnd := min(start+max(1, int(e.dur*legato)), end)
+			if i+1 < len(lane.events) && gateEnd >= end {
+				gateEnd = end - 1
+			}
+			if i == 0 {
+				start = 0
+			}
+			for f := start; f < min(end, nframes); f++ {
+				noteTape.samples[f*nlanes+li] = e.note
+			}
+			for f := int(e.start); f < min(gateEnd, nframes); f++ {
+				gateTape.samples[f*nlanes+li] = 1
+			}
+		}
+	}
+	return gateTape.Stream(), noteTape.Stream()
+}
+
+// baseBPM returns the tempo set in :bpm (flags.BPM if unset), the
+// tempo of the transport before its first tempo change.
+func baseBPM(vm *VM) (float64, error) {
+	if v := vm.GetVal(":bpm"); v != nil {
+		if n, ok := v.(Num); ok && n > 0 {
+			return float64(n), nil
+		}
+		return 0, errors.New(":bpm must be a positive number")
+	}
+	return flags.BPM, nil
+}
+
+// getBPM returns the tempo of the transport at its position.
+func getBPM(vm *VM, word string) (float64, error) {
+	m, pos, err := vm.tempo()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", word, err)
+	}
+	return m.BPM(pos), nil
+}
+
+func init() {
+	RegisterWord("pat", func(vm *VM) error {
+		src, err := Pop[Str](vm)
+		if err != nil {
+			return err
+		}
+		node, err := parsePattern(string(src))
+		if err != nil {
+			return err
+		}
+		beats := 4.0
+		if v := vm.GetVal(":pat/beats"); v != nil {
+			if n, ok := v.(Num); ok && n > 0 {
+				beats = float64(n)
+			} else {
+				return fmt.Errorf("pat: :pat/beats must be a positive number")
+			}
+		}
+		cycles := 1
+		if v := vm.GetVal(":pat/cycles"); v != nil {
+			if n, ok := v.(Num); ok && n >= 1 {
+				cycles = int(n)
+			} else {
+				return fmt.Errorf("pat: :pat/cycles must be a number >= 1")
+			}
+		}
+		legato := 0.9
+		if v := vm.GetVal(":pat/legato"); v != nil {
+			if n, ok := v.(Num); ok {
+				legato = float64(n)
+			} else {
+				return fmt.Errorf("pat: :pat/legato must be number")
+			}
+		}
+		bpm, err := getBPM(vm, "pat")
+		if err != nil {
+			return err
+		}
+		framesPerCycle := beats * 60 / bpm * float64(SampleRate())
+		nframes := int(math.Round(framesPerCycle * float64(cycles)))
+		gate, notes := PatternStreams(patternLanes(node, cycles, framesPerCycle), nframes, legato)
+		vm.Push(gate)
+		vm.Push(notes)
+		return nil
+	})
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// pdShape is a phase transfer curve of the phase distortion oscillator.
+type pdShape int
+
+const (
+	pdSaw pdShape = iota
+	pdSquare
+	pdPulse
+	pdRes
+)
+
+var pdShapeNames = map[Str]pdShape{
+	"saw":    pdSaw,
+	"square": pdSquare,
+	"pulse":  pdPulse,
+	"res":    pdRes,
+}
+
+// pdMinKnee keeps the knees of the transfer curves away from the ends
+// of the cycle, where they would divide by zero.
+const pdMinKnee = 0.001
+
+// pdMaxResonance is the ratio of the resonance of the res shape to the
+// frequency at an amount of 1.
+const pdMaxResonance = 16
+
+// pdSample returns the output of the phase distortion oscillator at
+// phase (in [0,1)) for shape distorted by amount (0..1). The distorted
+// phase reads an inverted cosine, which an amount of 0 leaves as it is
+// (except for the res shape).
+func pdSample(shape pdShape, phase, amount float64) float64 {
+	amount = min(max(amount, 0), 1)
+	switch shape {
+	case pdSaw:
+		// the first half of the cosine in the first (1-amount)/2 of the cycle
+		knee := max(0.5*(1-amount), pdMinKnee)
+		if phase < knee {
+			phase = 0.5 * phase / knee
+		} else {
+			phase = 0.5 + 0.5*(phase-knee)/(1-knee)
+		}
+	case pdSquare:
+		// each half of the cosine in 1-amount of its half of the cycle,
+		// holding its end for the rest
+		half := math.Floor(2 * phase)
+		knee := max(1-amount, pdMinKnee)
+		phase = 0.5*half + 0.5*min((2*phase-half)/knee, 1)
+	case pdPulse:
+		// the whole cosine in the last 1-amount of the cycle
+		width := max(1-amount, pdMinKnee)
+		phase = max(phase-(1-width), 0) / width
+	case pdRes:
+		// a cosine at 1..16 times the frequency restarted each cycle,
+		// faded out by a falling saw; the offset and scale center it
+		ratio := 1 + (pdMaxResonance-1)*amount
+		v := (1 - phase) * (1 - math.Cos(2*math.Pi*ratio*phase))
+		return (v - 0.5) * 2 / 3
+	}
+	return -math.Cos(2 * math.Pi * phase)
+}
+
+// PDOsc is a Casio CZ style phase distortion oscillator: the phase
+// runs through the transfer curve of shape, bent by amount, before it
+// reads a cosine.
+func PDOsc(freq, amount Stream, shape pdShape, phase float64) Stream {
+	return makeTransformStreamN(1, []Stream{freq, amount}, func(inputs []Stream) Stepper {
+		fnext := inputs[0].Mono().Next
+		anext := inputs[1].Mono().Next
+		ph := phase
+		if ph < 0.0 || ph >= 1.0 {
+			ph = 0.0
+		}
+		sr := float64(SampleRate())
+		out := make(Frame, 1)
+		return func() (Frame, bool) {
+			fframe, ok := fnext()
+			if !ok {
+				return nil, false
+			}
+			aframe, ok := anext()
+			if !ok {
+				return nil, false
+			}
+			out[0] = Smp(pdSample(shape, ph, aframe[0]))
+			ph = wrapPhase(ph + fframe[0]/sr)
+			return out, true
+		}
+	})
+}
+
+func init() {
+	RegisterWord("~pd", func(vm *VM) error {
+		freq, err := vm.GetStream(":freq")
+		if err != nil {
+			return err
+		}
+		amount, err := vm.GetStream(":pd/amount")
+		if err != nil {
+			return err
+		}
+		shapeVal := vm.GetVal(":pd/shape")
+		name, _ := shapeVal.(Str)
+		shape, ok := pdShapeNames[name]
+		if !ok {
+			return fmt.Errorf(`~pd: :pd/shape must be "saw", "square", "pulse" or "res", got %v`, shapeVal)
+		}
+		phase, err := vm.GetFloat(":phase")
+		if err != nil {
+			return err
+		}
+		vm.Push(PDOsc(freq, amount, shape, phase))
+		return nil
+	})
+}
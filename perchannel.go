@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+)
+
+// Channel returns channel ch of s as a mono stream.
+func (s Stream) Channel(ch int) Stream {
+	nch := s.nchannels
+	return makeBlockStream(1, s.nframes, func() BlockStepper {
+		in := s.clone()
+		ibuf := make([]Smp, blockFrames*nch)
+		return func(buf []Smp) int {
+			n := in.NextBlock(ibuf[:len(buf)*nch])
+			for i := range n {
+				buf[i] = ibuf[i*nch+ch]
+			}
+			return n
+		}
+	})
+}
+
+// MergeStreams returns a stream whose channels are the mono streams
+// channels, in order. It ends with the shortest finite one.
+func MergeStreams(channels []Stream) Stream {
+	return makeTransformStreamN(len(channels), channels, func(inputs []Stream) Stepper {
+		nexts := make([]Stepper, len(inputs))
+		for i, s := range inputs {
+			nexts[i] = s.Mono().Next
+		}
+		out := make(Frame, len(inputs))
+		return func() (Frame, bool) {
+			for ch, next := range nexts {
+				frame, ok := next()
+				if !ok {
+					return nil, false
+				}
+				out[ch] = frame[0]
+			}
+			return out, true
+		}
+	})
+}
+
+// MidSide converts a stereo stream between left/right and mid/side
+// like Tape.MidSide.
+func (s Stream) MidSide(decode bool) (Stream, error) {
+	if s.nchannels != 2 {
+		return Stream{}, fmt.Errorf("expected stereo stream, got %d channels", s.nchannels)
+	}
+	scale := 0.5
+	if decode {
+		scale = 1
+	}
+	return makeTransformStream([]Stream{s}, func(inputs []Stream) Stepper {
+		next := inputs[0].Next
+		out := make(Frame, 2)
+		return func() (Frame, bool) {
+			frame, ok := next()
+			if !ok {
+				return nil, false
+			}
+			a, b := frame[0], frame[1]
+			out[0] = (a + b) * scale
+			out[1] = (a - b) * scale
+			return out, true
+		}
+	}), nil
+}
+
+// channelBodies returns the code per-channel applies to each of
+// nchannels channels: body for all of them, or the items of a vector
+// of quotations, one per channel.
+func channelBodies(body Val, nchannels int) ([]Evaler, error) {
+	bodies := make([]Evaler, nchannels)
+	if v, ok := body.(Vec); ok && len(v) > 0 && isVecOfVecs(v) {
+		if len(v) != nchannels {
+			return nil, fmt.Errorf("%d bodies for %d channels", len(v), nchannels)
+		}
+		for i, item := range v {
+			bodies[i] = item.(Vec)
+		}
+		return bodies, nil
+	}
+	e, ok := body.(Evaler)
+	if !ok {
+		return nil, fmt.Errorf("expected a quotation or a vector of quotations, got %T", body)
+	}
+	for i := range bodies {
+		bodies[i] = e
+	}
+	return bodies, nil
+}
+
+func isVecOfVecs(v Vec) bool {
+	for _, item := range v {
+		if _, ok := item.(Vec); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// applyPerChannel evaluates the bodies on the channels of input, each
+// in its own env frame with the channel on the stack and its index in
+// :channel, and merges the mono sums of the values they leave.
+func applyPerChannel(vm *VM, name string, input Stream, bodies []Evaler) (Stream, error) {
+	results := make([]Stream, input.nchannels)
+	for ch := range input.nchannels {
+		if err := vm.DoPushEnv(); err != nil {
+			return Stream{}, err
+		}
+		vm.SetVal(":channel", Num(ch))
+		depth := len(vm.valStack)
+		vm.Push(input.Channel(ch))
+		if err := bodies[ch].Eval(vm); err != nil {
+			vm.DoPopEnv()
+			return Stream{}, err
+		}
+		if n := len(vm.valStack) - depth; n != 1 {
+			vm.DoPopEnv()
+			return Stream{}, fmt.Errorf("%s: channel %d: expected the body to leave 1 value, got %d", name, ch, n)
+		}
+		result := vm.Pop()
+		vm.DoPopEnv()
+		s, err := streamFromVal(result)
+		if err != nil {
+			return Stream{}, fmt.Errorf("%s: channel %d: %w", name, ch, err)
+		}
+		results[ch] = s.Mono()
+	}
+	return MergeStreams(results), nil
+}
+
+func init() {
+	RegisterWord("per-channel", func(vm *VM) error {
+		body := vm.Pop()
+		input, err := streamFromVal(vm.Pop())
+		if err != nil {
+			return fmt.Errorf("per-channel: %w", err)
+		}
+		bodies, err := channelBodies(body, input.nchannels)
+		if err != nil {
+			return fmt.Errorf("per-channel: %w", err)
+		}
+		result, err := applyPerChannel(vm, "per-channel", input, bodies)
+		if err != nil {
+			return err
+		}
+		vm.Push(result)
+		return nil
+	})
+
+	RegisterWord("per-ms", func(vm *VM) error {
+		body := vm.Pop()
+		input, err := streamFromVal(vm.Pop())
+		if err != nil {
+			return fmt.Errorf("per-ms: %w", err)
+		}
+		ms, err := input.MidSide(false)
+		if err != nil {
+			return fmt.Errorf("per-ms: %w", err)
+		}
+		bodies, err := channelBodies(body, 2)
+		if err != nil {
+			return fmt.Errorf("per-ms: %w", err)
+		}
+		result, err := applyPerChannel(vm, "per-ms", ms, bodies)
+		if err != nil {
+			return err
+		}
+		lr, err := result.MidSide(true)
+		if err != nil {
+			return err
+		}
+		vm.Push(lr)
+		return nil
+	})
+}
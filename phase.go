@@ -0,0 +1,155 @@
+package main
+
+import (
+	"math"
+	"math/cmplx"
+
+	"github.com/mjibson/go-dsp/fft"
+)
+
+// quadratureCoefs are the coefficients of the two chains of allpasses
+// of quadratureNetwork, by Olli Niemitalo: their outputs are 90 degrees
+// apart within a degree over most of the audible range.
+var quadratureCoefs = [2][4]float64{
+	{0.6923878, 0.9360654322959, 0.9882295226860, 0.9987488452737},
+	{0.4021921162426, 0.8561710882420, 0.9722909545651, 0.9952884791278},
+}
+
+// quadratureNetwork runs a signal through two chains of second-order
+// allpasses, giving two versions of it with the same magnitude and a
+// phase difference of 90 degrees: the second leads the first.
+type quadratureNetwork struct {
+	x, y  [2][4][2]Smp // last two inputs and outputs of each section
+	delay Smp          // the first chain is one sample late
+}
+
+func (q *quadratureNetwork) process(in Smp) (Smp, Smp) {
+	var out [2]Smp
+	for c := range 2 {
+		v := in
+		for i, a := range quadratureCoefs[c] {
+			x, y := &q.x[c][i], &q.y[c][i]
+			w := Smp(a*a)*(v+y[1]) - x[1]
+			x[1], x[0] = x[0], v
+			y[1], y[0] = y[0], w
+			v = w
+		}
+		out[c] = v
+	}
+	first := q.delay
+	q.delay = out[0]
+	return first, out[1]
+}
+
+// Invert returns s with its polarity flipped.
+func (s Stream) Invert() Stream {
+	return makeBlockStream(s.nchannels, s.nframes, func() BlockStepper {
+		in := s.clone()
+		return func(buf []Smp) int {
+			n := in.NextBlock(buf)
+			for i := range buf[:n*s.nchannels] {
+				buf[i] = -buf[i]
+			}
+			return n
+		}
+	})
+}
+
+// RotatePhase advances the phase of every frequency of each channel of
+// input by the same number of degrees (a stream), by mixing the outputs
+// of a quadratureNetwork. The network itself shifts the phases too, by
+// an amount going with the frequency, so at 0 degrees the result is an
+// allpass filtered input, sounding the same; what changes with degrees
+// is the shape of the waveform.
+func RotatePhase(input, degrees Stream) Stream {
+	nchannels := input.nchannels
+	return makeTransformStream([]Stream{input, degrees}, func(inputs []Stream) Stepper {
+		next := inputs[0].Next
+		dnext := inputs[1].Mono().Next
+		nets := make([]quadratureNetwork, nchannels)
+		out := make(Frame, nchannels)
+		return func() (Frame, bool) {
+			frame, ok := next()
+			if !ok {
+				return nil, false
+			}
+			d, ok := dnext()
+			if !ok {
+				return nil, false
+			}
+			sin, cos := math.Sincos(float64(d[0]) * math.Pi / 180)
+			for ch := range nchannels {
+				a, b := nets[ch].process(frame[ch])
+				out[ch] = Smp(cos)*a + Smp(sin)*b
+			}
+			return out, true
+		}
+	})
+}
+
+// MinPhase returns the minimum-phase version of t, with the magnitude
+// spectrum of each channel kept and the energy moved to the start, by
+// folding the real cepstrum. The cepstrum is computed over four times
+// the length of t to keep it from wrapping around.
+func (t *Tape) MinPhase() *Tape {
+	nc := t.nchannels
+	out := makeTape(nc, t.nframes)
+	if t.nframes == 0 {
+		return out
+	}
+	size := 1
+	for size < 4*t.nframes {
+		size *= 2
+	}
+	x := make([]float64, size)
+	for ch := range nc {
+		for i := range t.nframes {
+			x[i] = t.samples[i*nc+ch]
+		}
+		X := fft.FFTReal(x)
+		for k, v := range X {
+			X[k] = complex(math.Log(max(cmplx.Abs(v), 1e-12)), 0)
+		}
+		c := fft.IFFT(X)
+		// keep the causal part of the cepstrum, doubled
+		for n := 1; n < size/2; n++ {
+			c[n] *= 2
+			c[size-n] = 0
+		}
+		C := fft.FFT(c)
+		for k, v := range C {
+			C[k] = cmplx.Exp(v)
+		}
+		y := fft.IFFT(C)
+		for i := range t.nframes {
+			out.samples[i*nc+ch] = real(y[i])
+		}
+	}
+	return out
+}
+
+func init() {
+	RegisterWord("invert", func(vm *VM) error {
+		input, err := streamFromVal(vm.Pop())
+		if err != nil {
+			return err
+		}
+		vm.Push(input.Invert())
+		return nil
+	})
+
+	RegisterWord("rotate-phase", func(vm *VM) error {
+		degrees, err := streamFromVal(vm.Pop())
+		if err != nil {
+			return err
+		}
+		input, err := streamFromVal(vm.Pop())
+		if err != nil {
+			return err
+		}
+		vm.Push(RotatePhase(input, degrees))
+		return nil
+	})
+
+	RegisterGoMethod[*Tape]("min-phase", (*Tape).MinPhase)
+}
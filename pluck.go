@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// pluckMinFreq is the lowest frequency ~pluck plays, which sets the
+// size of its delay line.
+const pluckMinFreq = 20.0
+
+// PluckOsc is a Karplus-Strong plucked string: a burst of white noise
+// one period long, drawn from r, circulates in a delay line of one
+// period of freq, through a two-tap lowpass of damping (0..1) which
+// takes away the high harmonics faster than the low ones. The loop gain
+// makes the string decay by 60 dB in decay seconds. With pos in (0,1),
+// the burst is combed as if the string was plucked at that fraction of
+// its length, which takes out the harmonics having a node there.
+func PluckOsc(freq Stream, r Rng, decay, damping, pos float64) Stream {
+	damping = min(max(damping, 0), 1)
+	pos = min(max(pos, 0), 1)
+	return makeTransformStreamN(1, []Stream{freq}, func(inputs []Stream) Stepper {
+		fnext := inputs[0].Mono().Next
+		sr := float64(SampleRate())
+		size := int(sr/pluckMinFreq) + 4
+		line := make([]float64, size)
+		w := 0
+		// the lowpass mixes the last two samples read from the line,
+		// delaying by s samples, which the read position makes up for
+		s := damping / 2
+		var prev float64
+		lastPeriod, gain := 0.0, 1.0
+		var burst []float64
+		n := 0
+		r := r
+		out := make(Frame, 1)
+		return func() (Frame, bool) {
+			fframe, ok := fnext()
+			if !ok {
+				return nil, false
+			}
+			f := min(max(fframe[0], pluckMinFreq), sr/4)
+			period := sr / f
+			if burst == nil {
+				burst = make([]float64, int(period))
+				for i := range burst {
+					var u float64
+					r, u = r.Next()
+					burst[i] = 2*u - 1
+				}
+				if k := int(pos * period); k > 0 {
+					for i := len(burst) - 1; i >= k; i-- {
+						burst[i] -= burst[i-k]
+					}
+				}
+			}
+			// read one period minus the delay of the lowpass back
+			d := max(period-s, 1)
+			rp := float64(w) - d
+			if rp < 0 {
+				rp += float64(size)
+			}
+			i0 := int(rp)
+			frac := rp - float64(i0)
+			i1 := (i0 + 1) % size
+			delayed := line[i0]*(1-frac) + line[i1]*frac
+			filtered := (1-s)*delayed + s*prev
+			prev = delayed
+			if period != lastPeriod {
+				lastPeriod = period
+				gain = math.Pow(0.001, period/(decay*sr))
+			}
+			y := gain * filtered
+			if n < len(burst) {
+				y += burst[n]
+				n++
+			}
+			line[w] = y
+			w = (w + 1) % size
+			out[0] = Smp(y)
+			return out, true
+		}
+	})
+}
+
+func init() {
+	RegisterWord("~pluck", func(vm *VM) error {
+		freq, err := vm.GetStream(":freq")
+		if err != nil {
+			return err
+		}
+		seed, err := vm.GetInt(":seed")
+		if err != nil {
+			return err
+		}
+		decay, err := vm.GetFloat(":pluck/decay")
+		if err != nil {
+			return err
+		}
+		if decay <= 0 {
+			return fmt.Errorf("~pluck: :pluck/decay must be positive, got %v", decay)
+		}
+		damping, err := vm.GetFloat(":pluck/damping")
+		if err != nil {
+			return err
+		}
+		pos, err := vm.GetFloat(":pluck/pos")
+		if err != nil {
+			return err
+		}
+		vm.Push(PluckOsc(freq, NewRng(int64(seed)), decay, damping, pos))
+		return nil
+	})
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// polyVoice holds the control values the allocator feeds to a voice.
+type polyVoice struct {
+	gate   float64
+	note   float64
+	freq   float64
+	lane   int // gate channel which triggered the current note, -1 if none
+	onAt   int // frame of the last note on
+	offAt  int // frame of the last note off
+	active bool
+}
+
+// polyState is the allocator state of one running instance of a
+// poly stream.
+type polyState struct {
+	voices []polyVoice
+	frame  int
+	a4     float64 // frequency of MIDI note 69
+}
+
+// polyShared connects the control streams of the voices to the
+// allocator state of the currently starting poly instance.
+type polyShared struct {
+	current *polyState
+}
+
+func newPolyState(nvoices int) *polyState {
+	ps := &polyState{voices: make([]polyVoice, nvoices)}
+	for i := range ps.voices {
+		ps.voices[i].lane = -1
+	}
+	return ps
+}
+
+// control returns an infinite mono stream yielding get(voice) of the
+// allocator state which was current when its stepper was created.
+func (sh *polyShared) control(voice int, get func(v *polyVoice) float64) Stream {
+	return makeRewindableStream(1, 0, func() Stepper {
+		state := sh.current
+		out := make(Frame, 1)
+		return func() (Frame, bool) {
+			out[0] = get(&state.voices[voice])
+			return out, true
+		}
+	})
+}
+
+// noteOn assigns a voice to a note starting on lane: the free voice
+// which was released earliest, or if all voices are held, the one
+// held longest.
+func (ps *polyState) noteOn(lane int, note float64) {
+	vi := -1
+	for i := range ps.voices {
+		v := &ps.voices[i]
+		if v.lane == -1 && (vi == -1 || v.offAt < ps.voices[vi].offAt) {
+			vi = i
+		}
+	}
+	if vi == -1 {
+		vi = 0
+		for i := range ps.voices {
+			if ps.voices[i].onAt < ps.voices[vi].onAt {
+				vi = i
+			}
+		}
+	}
+	v := &ps.voices[vi]
+	stolen := v.lane != -1
+	v.lane = lane
+	v.note = note
+	v.freq = NoteFreq(note, ps.a4)
+	v.onAt = ps.frame
+	v.active = true
+	if stolen {
+		// a stolen voice sees its gate drop for a frame so that
+		// envelopes driven by :gate restart
+		v.gate = 0
+	} else {
+		v.gate = 1
+	}
+}
+
+func (ps *polyState) noteOff(lane int) {
+	for i := range ps.voices {
+		v := &ps.voices[i]
+		if v.lane == lane {
+			v.lane = -1
+			v.gate = 0
+			v.offAt = ps.frame
+		}
+	}
+}
+
+// Poly mixes voices to stereo, driving them from a gate stream whose
+// channels are independent note lanes. A rising edge on a lane starts
+// a note with the pitch of the corresponding channel of pitch (a MIDI
+// note if useNotes, a frequency otherwise), a falling edge ends it.
+// Notes are tuned to A4 at a4 Hz. The result ends when gate ends.
+func Poly(gate Stream, pitch Stream, useNotes bool, a4 float64, voices []Stream, sh *polyShared) Stream {
+	lanes := gate.nchannels
+	nvoices := len(voices)
+	return makeTransformStreamN(2, []Stream{gate, pitch}, func(inputs []Stream) Stepper {
+		state := newPolyState(nvoices)
+		state.a4 = a4
+		sh.current = state
+		vnexts := make([]Stepper, nvoices)
+		vchannels := make([]int, nvoices)
+		for i, vs := range voices {
+			vs = vs.clone()
+			if vs.nchannels > 2 {
+				vs = vs.Stereo()
+			}
+			vnexts[i] = vs.Next
+			vchannels[i] = vs.nchannels
+		}
+		gnext := inputs[0].Next
+		pnext := inputs[1].Next
+		held := make([]bool, lanes)
+		out := make(Frame, 2)
+		return func() (Frame, bool) {
+			g, ok := gnext()
+			if !ok {
+				return nil, false
+			}
+			p, ok := pnext()
+			if !ok {
+				return nil, false
+			}
+			// voices stolen in the previous frame get their gate back
+			for i := range state.voices {
+				if v := &state.voices[i]; v.lane != -1 {
+					v.gate = 1
+				}
+			}
+			for lane := range lanes {
+				on := g[lane] > 0
+				if on && !held[lane] {
+					note := p[min(lane, len(p)-1)]
+					if !useNotes {
+						note = FreqNote(note, a4)
+					}
+					state.noteOn(lane, note)
+				} else if !on && held[lane] {
+					state.noteOff(lane)
+				}
+				held[lane] = on
+			}
+			out[0], out[1] = 0, 0
+			for i, next := range vnexts {
+				if next == nil || !state.voices[i].active {
+					continue
+				}
+				frame, ok := next()
+				if !ok {
+					vnexts[i] = nil
+					continue
+				}
+				if vchannels[i] == 1 {
+					out[0] += frame[0] * math.Sqrt2 / 2
+					out[1] += frame[0] * math.Sqrt2 / 2
+				} else {
+					out[0] += frame[0]
+					out[1] += frame[1]
+				}
+			}
+			state.frame++
+			return out, true
+		}
+	})
+}
+
+func init() {
+	RegisterWord("poly", func(vm *VM) error {
+		body := vm.Pop()
+		voiceGen, ok := body.(Evaler)
+		if !ok {
+			return fmt.Errorf("poly: expected closure on stack, got %T", body)
+		}
+		gate, err := streamFromVal(vm.Pop())
+		if err != nil {
+			return err
+		}
+		polyphony := 8
+		if v := vm.GetVal(":polyphony"); v != nil {
+			if n, ok := v.(Num); ok {
+				polyphony = max(1, int(n))
+			} else {
+				return fmt.Errorf("poly: :polyphony must be number")
+			}
+		}
+		useNotes := false
+		pitchVal := vm.GetVal(":note")
+		if pitchVal != nil {
+			useNotes = true
+		} else {
+			pitchVal = vm.GetVal(":freq")
+			if pitchVal == nil {
+				return fmt.Errorf("poly: neither :note nor :freq is set")
+			}
+		}
+		pitch, err := streamFromVal(pitchVal)
+		if err != nil {
+			return fmt.Errorf("poly: cannot use pitch: %w", err)
+		}
+		a4, err := positiveEnvFloat(vm, "poly", ":a4")
+		if err != nil {
+			return err
+		}
+
+		sh := &polyShared{current: newPolyState(polyphony)}
+		voices := make([]Stream, polyphony)
+		for i := range polyphony {
+			if err := vm.DoPushEnv(); err != nil {
+				return err
+			}
+			vm.SetVal(":voice", Num(i))
+			vm.SetVal(":gate", sh.control(i, func(v *polyVoice) float64 { return v.gate }))
+			vm.SetVal(":note", sh.control(i, func(v *polyVoice) float64 { return v.note }))
+			vm.SetVal(":freq", sh.control(i, func(v *polyVoice) float64 { return v.freq }))
+			if err := voiceGen.Eval(vm); err != nil {
+				vm.DoPopEnv()
+				return err
+			}
+			voiceVal := vm.Pop()
+			vm.DoPopEnv()
+			vs, err := streamFromVal(voiceVal)
+			if err != nil {
+				return fmt.Errorf("poly: voice %d did not yield a stream: %w", i, err)
+			}
+			voices[i] = vs
+		}
+		vm.Push(Poly(gate, pitch, useNotes, a4, voices, sh))
+		return nil
+	})
+}
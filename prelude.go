@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// defaultPreludePath is the prelude watched in dev mode without
+	// -prelude: the one in a source checkout.
+	defaultPreludePath = "assets/prelude.tape"
+	// userPreludePath and projectPreludePath are layered on top of
+	// the prelude if they exist.
+	userPreludePath    = "~/.mixtape/prelude.tape"
+	projectPreludePath = "prelude.tape"
+)
+
+// readPrelude returns the source of the prelude: the file given with
+// -prelude, or the one embedded into the binary.
+func readPrelude() (src []byte, name string, err error) {
+	if flags.Prelude != "" {
+		path, err := expandPath(flags.Prelude)
+		if err != nil {
+			return nil, "", err
+		}
+		src, err = os.ReadFile(path)
+		if err != nil {
+			return nil, "", fmt.Errorf("cannot load prelude: %w", err)
+		}
+		return src, path, nil
+	}
+	src, err = assets.ReadFile("assets/prelude.tape")
+	if err != nil {
+		return nil, "", fmt.Errorf("cannot load prelude from embed.FS: %w", err)
+	}
+	return src, "<prelude>", nil
+}
+
+// preludeLayers returns the files evaluated after the prelude, in
+// order: the user's prelude, the project prelude in the working
+// directory (both only if they exist) and the files given with
+// -prelude-layer. Later layers can redefine the words of earlier ones.
+func preludeLayers() ([]string, error) {
+	var layers []string
+	seen := make(map[string]bool)
+	if flags.Prelude != "" {
+		if path, err := expandPath(flags.Prelude); err == nil {
+			if abs, err := filepath.Abs(path); err == nil {
+				seen[abs] = true
+			}
+		}
+	}
+	add := func(path string, required bool) error {
+		path, err := expandPath(path)
+		if err != nil {
+			return err
+		}
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		if seen[abs] {
+			return nil
+		}
+		if !fileExists(abs) {
+			if required {
+				return fmt.Errorf("prelude layer not found: %s", path)
+			}
+			return nil
+		}
+		seen[abs] = true
+		layers = append(layers, path)
+		return nil
+	}
+	for _, path := range []string{userPreludePath, projectPreludePath} {
+		if err := add(path, false); err != nil {
+			return nil, err
+		}
+	}
+	for _, path := range flags.PreludeLayers {
+		if err := add(path, true); err != nil {
+			return nil, err
+		}
+	}
+	return layers, nil
+}
+
+// preludeFiles returns the files the prelude is loaded from: the
+// -prelude file (if any) and the layers.
+func preludeFiles() []string {
+	var files []string
+	if flags.Prelude != "" {
+		if path, err := expandPath(flags.Prelude); err == nil {
+			files = append(files, path)
+		}
+	}
+	layers, _ := preludeLayers()
+	return append(files, layers...)
+}
+
+// evalPrelude evaluates src in the root environment.
+func (vm *VM) evalPrelude(src []byte, name string) error {
+	if vm.evalDepth.Get() > 0 {
+		// called from a word: keep the stack and env frames of the caller
+		savedEnvStack := vm.envStack
+		vm.envStack = []Map{rootEnv}
+		defer func() { vm.envStack = savedEnvStack }()
+		return vm.ParseAndEval(bytes.NewReader(src), name)
+	}
+	// a top-level evaluation would replace the result of the last one
+	// and put the definitions into the base envs
+	result, stats, baseEnvs := vm.evalResult, vm.renderStats, vm.baseEnvs
+	vm.baseEnvs = nil
+	defer func() {
+		vm.evalResult, vm.renderStats = result, stats
+		vm.SetBaseEnvs(baseEnvs...)
+	}()
+	if err := vm.ParseAndEval(bytes.NewReader(src), name); err != nil {
+		return fmt.Errorf("error while parsing %s: %w", name, err)
+	}
+	return nil
+}
+
+// LoadPrelude evaluates the prelude and its layers in the root
+// environment. Calling it again redefines the words they define
+// without touching the rest of the VM state, which makes it possible
+// to iterate on the prelude without restarting.
+func (vm *VM) LoadPrelude() error {
+	src, name, err := readPrelude()
+	if err != nil {
+		return err
+	}
+	if err := vm.evalPrelude(src, name); err != nil {
+		return err
+	}
+	layers, err := preludeLayers()
+	if err != nil {
+		return err
+	}
+	for _, path := range layers {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("cannot load prelude layer: %w", err)
+		}
+		if err := vm.evalPrelude(src, path); err != nil {
+			return err
+		}
+		logger.Debug("loaded prelude layer", "path", path)
+	}
+	return nil
+}
+
+func init() {
+	RegisterWord("reload-prelude", func(vm *VM) error {
+		return vm.LoadPrelude()
+	})
+}
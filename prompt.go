@@ -1,3 +1,5 @@
+//go:build cgo && !js
+
 package main
 
 type PromptInputMode int
@@ -95,7 +97,8 @@ func (p *Prompt) Render(tp TilePane) {
 	switch p.mode {
 	case PromptInputModeText:
 		tp.DrawString(0, 0, p.prompt)
-		inputPane := tp.SubPane(len(p.prompt), 0, width-len(p.prompt), 1)
+		promptWidth := stringWidth(p.prompt)
+		inputPane := tp.SubPane(promptWidth, 0, width-promptWidth, 1)
 		p.input.Render(inputPane)
 	case PromptInputModeChar:
 		tp.DrawString(0, 0, p.prompt)
@@ -104,8 +107,8 @@ func (p *Prompt) Render(tp TilePane) {
 
 func (p *Prompt) initKeymap() {
 	p.keymap = CreateKeyMap()
-	p.keymap.Bind("Escape", p.handleCancel)
-	p.keymap.Bind("C-g", p.handleCancel)
+	p.keymap.BindAction("prompt.cancel", "Escape", p.handleCancel)
+	p.keymap.BindAction("prompt.cancel", "C-g", p.handleCancel)
 }
 
 func (p *Prompt) handleTextConfirm() {
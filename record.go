@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+)
+
+// recording holds the stop channel shared by the recordings in
+// progress, closed by StopRecording.
+var recording struct {
+	mu    sync.Mutex
+	stop  chan struct{}
+	count int
+	sigs  chan os.Signal
+}
+
+// startRecording registers a recording and returns the channel closed
+// when it should stop. While recordings run, an interrupt (Ctrl-C on
+// the command line) stops them instead of ending the process.
+func startRecording() <-chan struct{} {
+	recording.mu.Lock()
+	defer recording.mu.Unlock()
+	if recording.stop == nil {
+		recording.stop = make(chan struct{})
+	}
+	if recording.count == 0 {
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, os.Interrupt)
+		go func() {
+			for range sigs {
+				StopRecording()
+			}
+		}()
+		recording.sigs = sigs
+	}
+	recording.count++
+	return recording.stop
+}
+
+// stopRecording unregisters a recording started by startRecording.
+func stopRecording() {
+	recording.mu.Lock()
+	defer recording.mu.Unlock()
+	recording.count--
+	if recording.count == 0 {
+		signal.Stop(recording.sigs)
+		close(recording.sigs)
+		recording.sigs = nil
+		recording.stop = nil
+	}
+}
+
+// StopRecording stops the recordings in progress, which return what
+// they have recorded so far. It reports whether there were any.
+func StopRecording() bool {
+	recording.mu.Lock()
+	defer recording.mu.Unlock()
+	if recording.stop == nil {
+		return false
+	}
+	close(recording.stop)
+	recording.stop = nil
+	return true
+}
+
+func init() {
+	RegisterWord("record", func(vm *VM) error {
+		n, err := Pop[Num](vm)
+		if err != nil {
+			return err
+		}
+		if n < 0 {
+			return fmt.Errorf("record: length must be >= 0, got %v", n)
+		}
+		if err := vm.checkSandbox("recording"); err != nil {
+			return err
+		}
+		t, err := recordInput(vm, int(n))
+		if err != nil {
+			return err
+		}
+		vm.Push(t)
+		return nil
+	})
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// streamNodes counts the streams created since the program started.
+var streamNodes atomic.Int64
+
+// RenderStats summarizes a top-level evaluation: how long it took,
+// how much it allocated, how many stream nodes it built and, if the
+// result is a tape, its size and level.
+type RenderStats struct {
+	Frames    int
+	Channels  int
+	WallTime  time.Duration
+	Peak      float64
+	RMS       float64
+	Allocated uint64 // bytes allocated during the evaluation
+	Streams   int64  // stream nodes created during the evaluation
+}
+
+type renderStatsStart struct {
+	time    time.Time
+	alloc   uint64
+	streams int64
+}
+
+func totalAlloc() uint64 {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return ms.TotalAlloc
+}
+
+func startRenderStats() renderStatsStart {
+	return renderStatsStart{
+		time:    time.Now(),
+		alloc:   totalAlloc(),
+		streams: streamNodes.Load(),
+	}
+}
+
+func (start renderStatsStart) finish(result Val) *RenderStats {
+	stats := &RenderStats{
+		WallTime:  time.Since(start.time),
+		Allocated: totalAlloc() - start.alloc,
+		Streams:   streamNodes.Load() - start.streams,
+	}
+	if t, ok := result.(*Tape); ok {
+		stats.Frames = t.nframes
+		stats.Channels = t.nchannels
+		stats.Peak = t.Peak()
+		stats.RMS = t.RMS()
+	}
+	return stats
+}
+
+// Duration returns the length of the rendered audio.
+func (stats *RenderStats) Duration() time.Duration {
+	return time.Duration(float64(stats.Frames) / float64(SampleRate()) * float64(time.Second))
+}
+
+// Realtime returns how many times faster than realtime the render was.
+func (stats *RenderStats) Realtime() float64 {
+	if stats.WallTime <= 0 {
+		return math.Inf(1)
+	}
+	return stats.Duration().Seconds() / stats.WallTime.Seconds()
+}
+
+func formatDBFS(amp float64) string {
+	if amp <= 0 {
+		return "-inf dBFS"
+	}
+	return fmt.Sprintf("%.1f dBFS", 20*math.Log10(amp))
+}
+
+func (stats *RenderStats) String() string {
+	var parts []string
+	if stats.Frames > 0 {
+		parts = append(parts,
+			fmt.Sprintf("%d frames x %d ch (%.2fs) in %.2fs (%.1fx realtime)",
+				stats.Frames, stats.Channels, stats.Duration().Seconds(), stats.WallTime.Seconds(), stats.Realtime()),
+			"peak "+formatDBFS(stats.Peak),
+			"RMS "+formatDBFS(stats.RMS))
+	} else {
+		parts = append(parts, fmt.Sprintf("%.2fs", stats.WallTime.Seconds()))
+	}
+	parts = append(parts,
+		fmt.Sprintf("%.1f MB allocated", float64(stats.Allocated)/(1<<20)),
+		fmt.Sprintf("%d streams", stats.Streams))
+	return strings.Join(parts, ", ")
+}
+
+// estimateTimeLeft extrapolates the time needed to render the
+// remaining frames from the rate achieved so far. There is no estimate
+// until the render has run long enough for the rate to be meaningful.
+func estimateTimeLeft(elapsed time.Duration, nfdone, nftotal int) (time.Duration, bool) {
+	if elapsed < time.Second || nfdone <= 0 || nftotal <= nfdone {
+		return 0, false
+	}
+	framesPerSecond := float64(nfdone) / elapsed.Seconds()
+	return time.Duration(float64(nftotal-nfdone) / framesPerSecond * float64(time.Second)), true
+}
+
+// formatTimeLeft formats d like 42s, 3m05s or 1h02m.
+func formatTimeLeft(d time.Duration) string {
+	s := int(d.Round(time.Second).Seconds())
+	switch {
+	case s < 60:
+		return fmt.Sprintf("%ds", s)
+	case s < 3600:
+		return fmt.Sprintf("%dm%02ds", s/60, s%60)
+	default:
+		return fmt.Sprintf("%dh%02dm", s/3600, s%3600/60)
+	}
+}
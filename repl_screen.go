@@ -0,0 +1,198 @@
+//go:build cgo && !js
+
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+type replEntry struct {
+	input  string
+	output string // the values left on the stack, or the error
+	err    bool
+	done   bool
+}
+
+// ReplScreen evaluates one-line expressions in an evaluation slot of
+// its own, showing the values they leave on the stack (or the error) in
+// a scrollback. The definitions of the current buffer of the editor (as
+// of its last successful evaluation) are visible in the REPL, but the
+// ones made in the REPL stay there.
+type ReplScreen struct {
+	app          *App
+	input        *InputField
+	keymap       KeyMap
+	entries      []*replEntry
+	history      []string
+	historyIndex int // len(history) when not browsing the history
+	scroll       int // lines scrolled up from the bottom
+	lastHeight   int
+}
+
+func CreateReplScreen(app *App) (*ReplScreen, error) {
+	rs := &ReplScreen{
+		app:    app,
+		keymap: CreateKeyMap(),
+	}
+	rs.input = CreateInputField(InputFieldCallbacks{
+		onConfirm: func() { rs.eval(false) },
+		onCancel:  app.Reset,
+	})
+	rs.keymap.BindAction("repl.eval-play", "C-p", func() { rs.eval(true) })
+	rs.keymap.BindAction("repl.history-previous", "Up", func() { rs.browseHistory(-1) })
+	rs.keymap.BindAction("repl.history-next", "Down", func() { rs.browseHistory(1) })
+	rs.keymap.BindAction("repl.scroll-up", "PageUp", func() { rs.scroll += max(rs.lastHeight-1, 1) })
+	rs.keymap.BindAction("repl.scroll-down", "PageDown", func() { rs.scroll = max(rs.scroll-max(rs.lastHeight-1, 1), 0) })
+	rs.keymap.BindAction("repl.clear", "C-l", func() {
+		rs.entries = nil
+		rs.scroll = 0
+	})
+	return rs, nil
+}
+
+func (rs *ReplScreen) Keymap() KeyMap {
+	return rs.keymap
+}
+
+func (rs *ReplScreen) HandleKey(key Key) (KeyHandler, bool) {
+	if next, handled := rs.keymap.HandleKey(key); handled {
+		return next, handled
+	}
+	return rs.input.HandleKey(key)
+}
+
+func (rs *ReplScreen) OnChar(app *App, char rune) {
+	rs.input.OnChar(char)
+}
+
+func (rs *ReplScreen) browseHistory(delta int) {
+	if len(rs.history) == 0 {
+		return
+	}
+	rs.historyIndex = min(max(rs.historyIndex+delta, 0), len(rs.history))
+	rs.input.Reset()
+	if rs.historyIndex < len(rs.history) {
+		rs.input.SetText(rs.history[rs.historyIndex])
+	}
+}
+
+// eval evaluates the input in the background, cancelling any running
+// evaluation first. If play is set, the result is played.
+func (rs *ReplScreen) eval(play bool) {
+	src := strings.TrimSpace(rs.input.Text())
+	if src == "" {
+		return
+	}
+	rs.input.Reset()
+	if len(rs.history) == 0 || rs.history[len(rs.history)-1] != src {
+		rs.history = append(rs.history, src)
+	}
+	rs.historyIndex = len(rs.history)
+	rs.scroll = 0
+	app := rs.app
+	app.ClearLastError()
+	slot := app.replSlot
+	slot.Cancel()
+	entry := &replEntry{input: src}
+	rs.entries = append(rs.entries, entry)
+	vm := slot.vm
+	if buffer := app.bm.GetCurrentBuffer(); buffer != nil {
+		if bufferSlot := app.bufferSlot(buffer); bufferSlot != nil && bufferSlot.vm.resultEnv != nil {
+			vm.SetBaseEnvs(bufferSlot.vm.resultEnv, slot.env)
+		} else {
+			vm.SetBaseEnvs(slot.env)
+		}
+	}
+	go func() {
+		err := vm.ParseAndEval(strings.NewReader(src), "<repl>")
+		var values []string
+		top, downmix := vm.evalResult, vm.resultDownmix
+		if err == nil && len(vm.valStack) > 0 {
+			// the top of the stack is rendered if it is a finite stream
+			for _, v := range vm.valStack[:len(vm.valStack)-1] {
+				values = append(values, v.String())
+			}
+			values = append(values, top.String())
+		}
+		app.postEvent(func() {
+			entry.done = true
+			slot.resetRenderProgress()
+			switch {
+			case errors.Is(err, ErrEvalCancelled):
+				entry.output = "cancelled"
+				entry.err = true
+			case err != nil:
+				entry.output = formatError(err)
+				entry.err = true
+			default:
+				entry.output = strings.Join(values, " ")
+				if play && top != nil {
+					app.audio.StopAllPlayers()
+					if err := app.audio.PlayTape(top, downmix, rs); err != nil {
+						app.SetLastError(err)
+					}
+				}
+			}
+		}, false)
+	}()
+}
+
+func (rs *ReplScreen) Render(app *App, ts *TileScreen) {
+	historyPane, rest := ts.GetPane().SplitY(-2)
+	statusPane, inputPane := rest.SplitY(-1)
+
+	type line struct {
+		text  string
+		color Color
+	}
+	var lines []line
+	for _, e := range rs.entries {
+		lines = append(lines, line{"> " + e.input, ColorText})
+		output, color := e.output, ColorText
+		switch {
+		case !e.done:
+			output = "..."
+		case e.err:
+			color = ColorError
+		}
+		for _, s := range strings.Split(output, "\n") {
+			lines = append(lines, line{s, color})
+		}
+	}
+	height := historyPane.Height()
+	rs.lastHeight = height
+	rs.scroll = min(rs.scroll, max(len(lines)-height, 0))
+	start := len(lines) - height - rs.scroll
+	for y := range height {
+		if i := start + y; i >= 0 && i < len(lines) {
+			historyPane.WithFg(lines[i].color, func() {
+				historyPane.DrawString(0, y, lines[i].text)
+			})
+		}
+	}
+
+	status := "Enter: eval, C-p: eval and play, Up/Down: history, PageUp/PageDown: scroll, C-l: clear"
+	if slot := app.replSlot; slot.vm.IsEvaluating() {
+		status = "evaluating... (F9: pause)"
+		if progress := slot.renderProgress(); progress != "" {
+			status = "rendering: " + progress + " (F9: pause/resume)"
+		}
+	}
+	if background := app.backgroundProgress(app.replSlot); background != "" {
+		status += " | " + background
+	}
+	statusPane.WithFgBg(ColorText, ColorMark, func() {
+		statusPane.Clear()
+		statusPane.DrawString(0, 0, status)
+	})
+
+	inputPane.DrawString(0, 0, "> ")
+	rs.input.Render(inputPane.SubPane(2, 0, max(inputPane.Width()-2, 0), 1))
+}
+
+func (rs *ReplScreen) Reset() {
+	rs.scroll = 0
+}
+
+func (rs *ReplScreen) Close() {}
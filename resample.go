@@ -2,10 +2,25 @@ package main
 
 import (
 	"math"
+)
 
-	"github.com/dh1tw/gosamplerate"
+// converter types, same values as in libsamplerate, plus the pure Go
+// sinc converter (the only one used for the sinc types without cgo)
+const (
+	srcSincBestQuality = iota
+	srcSincMediumQuality
+	srcSincFastest
+	srcZeroOrderHold
+	srcLinear
+	srcGoSinc
 )
 
+// sampleRateConverter resamples interleaved blocks of a stream,
+// keeping state between calls.
+type sampleRateConverter interface {
+	Process(in []float32, ratio float64, endOfInput bool) ([]float32, error)
+}
+
 const (
 	resampleBlockFrames = 1024
 	resampleMaxRatio    = 1.0 * 16
@@ -22,7 +37,7 @@ func resampleStream(input Stream, converterType int, ratio float64) Stream {
 		for i, smp := range t.samples {
 			tempBuf[i] = float32(smp)
 		}
-		resampledBuf, err := gosamplerate.Simple(tempBuf, ratio, t.nchannels, converterType)
+		resampledBuf, err := resampleBuffer(tempBuf, ratio, t.nchannels, converterType)
 		if err != nil {
 			return makeEmptyStream(nchannels)
 		}
@@ -47,7 +62,7 @@ func resampleStream(input Stream, converterType int, ratio float64) Stream {
 	return makeRewindableStream(nchannels, 0, func() Stepper {
 		inputBufferLen := resampleBlockFrames * nchannels
 		outputBufferLen := int(math.Ceil(resampleBlockFrames*resampleMaxRatio)) * nchannels
-		src, err := gosamplerate.New(converterType, nchannels, outputBufferLen)
+		src, err := newSampleRateConverter(converterType, nchannels, outputBufferLen)
 		if err != nil {
 			return func() (Frame, bool) { return nil, false }
 		}
@@ -102,7 +117,7 @@ func resampleStream(input Stream, converterType int, ratio float64) Stream {
 }
 
 func isValidRatio(ratio float64) bool {
-	if !gosamplerate.IsValidRatio(ratio) {
+	if !isValidConverterRatio(ratio) {
 		return false
 	}
 	if ratio < resampleMinRatio || ratio > resampleMaxRatio {
@@ -125,8 +140,8 @@ func init() {
 		if err != nil {
 			return err
 		}
-		if converterType < 0 || converterType > 4 {
-			return vm.Errorf("resample: invalid converterType in :resample/converter: %d - must be between 0..4", converterType)
+		if converterType < 0 || converterType > srcGoSinc {
+			return vm.Errorf("resample: invalid converterType in :resample/converter: %d - must be between 0..%d", converterType, srcGoSinc)
 		}
 		stream, err := streamFromVal(vm.Pop())
 		if err != nil {
@@ -149,8 +164,8 @@ func init() {
 		if err != nil {
 			return err
 		}
-		if converterType < 0 || converterType > 4 {
-			return vm.Errorf("resample: invalid converterType: %d - must be between 0..4", converterType)
+		if converterType < 0 || converterType > srcGoSinc {
+			return vm.Errorf("resample: invalid converterType: %d - must be between 0..%d", converterType, srcGoSinc)
 		}
 		t, err := Pop[*Tape](vm)
 		if err != nil {
@@ -160,7 +175,7 @@ func init() {
 		for i, smp := range t.samples {
 			tempBuf[i] = float32(smp)
 		}
-		resampledBuf, err := gosamplerate.Simple(tempBuf, ratio, t.nchannels, converterType)
+		resampledBuf, err := resampleBuffer(tempBuf, ratio, t.nchannels, converterType)
 		if err != nil {
 			return err
 		}
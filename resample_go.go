@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// linearConverter resamples by linear interpolation (or zero order
+// hold) between neighbouring input frames.
+type linearConverter struct {
+	nchannels int
+	hold      bool      // zero order hold instead of linear interpolation
+	prev      []float32 // last input frame of the previous block
+	pos       float64   // read position in input frames, relative to prev
+	buf       []float32
+}
+
+func (c *linearConverter) Process(in []float32, ratio float64, endOfInput bool) ([]float32, error) {
+	nc := c.nchannels
+	c.buf = append(append(c.buf[:0], c.prev...), in...)
+	n := len(c.buf) / nc
+	if n == 0 {
+		return nil, nil
+	}
+	step := 1 / ratio
+	var out []float32
+	for c.pos < float64(n-1) || (endOfInput && c.pos < float64(n)) {
+		i := int(c.pos)
+		frac := float32(c.pos - float64(i))
+		for ch := range nc {
+			a := c.buf[i*nc+ch]
+			if c.hold || i+1 >= n {
+				out = append(out, a)
+				continue
+			}
+			b := c.buf[(i+1)*nc+ch]
+			out = append(out, a+(b-a)*frac)
+		}
+		c.pos += step
+	}
+	c.prev = append(c.prev[:0], c.buf[(n-1)*nc:]...)
+	c.pos -= float64(n - 1)
+	return out, nil
+}
+
+const (
+	sincTableDensity = 512 // kernel table entries per zero crossing
+	sincKaiserBeta   = 8.6
+)
+
+// sincConverter is a band limited resampler convolving the input
+// with a Kaiser windowed sinc kernel. When downsampling, the kernel is
+// stretched to cut off at the output Nyquist frequency.
+type sincConverter struct {
+	nchannels int
+	zeros     int       // zero crossings on each side of the kernel
+	table     []float64 // kernel from 0 to zeros, sincTableDensity entries per crossing
+	buf       []float32 // input frames not yet consumed, with history
+	pos       float64   // read position in frames of buf
+	started   bool
+	end       int // frame index in buf where real input ends, -1 if unknown
+}
+
+func besselI0(x float64) float64 {
+	sum, term := 1.0, 1.0
+	for k := 1; term > 1e-12*sum; k++ {
+		term *= (x / (2 * float64(k))) * (x / (2 * float64(k)))
+		sum += term
+	}
+	return sum
+}
+
+func newSincConverter(nchannels, zeros int) *sincConverter {
+	n := zeros*sincTableDensity + 1
+	table := make([]float64, n)
+	i0Beta := besselI0(sincKaiserBeta)
+	for i := range n {
+		x := float64(i) / sincTableDensity
+		sinc := 1.0
+		if i > 0 {
+			sinc = math.Sin(math.Pi*x) / (math.Pi * x)
+		}
+		r := x / float64(zeros)
+		window := besselI0(sincKaiserBeta*math.Sqrt(max(0, 1-r*r))) / i0Beta
+		table[i] = sinc * window
+	}
+	return &sincConverter{nchannels: nchannels, zeros: zeros, table: table, end: -1}
+}
+
+// kernel returns the (unscaled) kernel value at distance x zero crossings.
+func (c *sincConverter) kernel(x float64) float64 {
+	x = math.Abs(x) * sincTableDensity
+	i := int(x)
+	if i >= len(c.table)-1 {
+		return 0
+	}
+	frac := x - float64(i)
+	return c.table[i] + (c.table[i+1]-c.table[i])*frac
+}
+
+func (c *sincConverter) Process(in []float32, ratio float64, endOfInput bool) ([]float32, error) {
+	nc := c.nchannels
+	cutoff := min(1, ratio)
+	span := float64(c.zeros) / cutoff // kernel half width in input frames
+	pad := int(math.Ceil(span)) + 1
+	if !c.started {
+		// silence before the first frame
+		c.buf = make([]float32, pad*nc)
+		c.pos = float64(pad)
+		c.started = true
+	}
+	c.buf = append(c.buf, in...)
+	if endOfInput && c.end == -1 {
+		c.end = len(c.buf) / nc
+		c.buf = append(c.buf, make([]float32, pad*nc)...)
+	}
+	n := len(c.buf) / nc
+	step := 1 / ratio
+	var out []float32
+	acc := make([]float64, nc)
+	for {
+		if c.end >= 0 {
+			if c.pos >= float64(c.end) {
+				break
+			}
+		} else if c.pos+span+1 >= float64(n) {
+			break
+		}
+		i0 := max(0, int(math.Ceil(c.pos-span)))
+		i1 := min(n-1, int(math.Floor(c.pos+span)))
+		clear(acc)
+		for i := i0; i <= i1; i++ {
+			w := c.kernel((float64(i)-c.pos)*cutoff) * cutoff
+			if w == 0 {
+				continue
+			}
+			for ch := range nc {
+				acc[ch] += w * float64(c.buf[i*nc+ch])
+			}
+		}
+		for ch := range nc {
+			out = append(out, float32(acc[ch]))
+		}
+		c.pos += step
+	}
+	// drop frames which are no longer needed
+	if drop := int(c.pos-span) - 1; drop > 0 && c.end == -1 {
+		c.buf = append(c.buf[:0], c.buf[drop*nc:]...)
+		c.pos -= float64(drop)
+	}
+	return out, nil
+}
+
+// newGoSampleRateConverter returns a pure Go converter of the given
+// type. The sinc types differ in the length of the kernel.
+func newGoSampleRateConverter(converterType, nchannels int) (sampleRateConverter, error) {
+	switch converterType {
+	case srcSincBestQuality, srcGoSinc:
+		return newSincConverter(nchannels, 64), nil
+	case srcSincMediumQuality:
+		return newSincConverter(nchannels, 24), nil
+	case srcSincFastest:
+		return newSincConverter(nchannels, 8), nil
+	case srcZeroOrderHold:
+		return &linearConverter{nchannels: nchannels, hold: true}, nil
+	case srcLinear:
+		return &linearConverter{nchannels: nchannels}, nil
+	}
+	return nil, fmt.Errorf("invalid converter type: %d", converterType)
+}
+
+// resampleBufferGo resamples interleaved samples in one go using a pure
+// Go converter.
+func resampleBufferGo(buf []float32, ratio float64, nchannels, converterType int) ([]float32, error) {
+	src, err := newGoSampleRateConverter(converterType, nchannels)
+	if err != nil {
+		return nil, err
+	}
+	return src.Process(buf, ratio, true)
+}
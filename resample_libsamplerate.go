@@ -0,0 +1,30 @@
+//go:build cgo && !js
+
+package main
+
+import (
+	"github.com/dh1tw/gosamplerate"
+)
+
+// resampleBuffer resamples interleaved samples in one go.
+func resampleBuffer(buf []float32, ratio float64, nchannels, converterType int) ([]float32, error) {
+	if converterType == srcGoSinc {
+		return resampleBufferGo(buf, ratio, nchannels, converterType)
+	}
+	return gosamplerate.Simple(buf, ratio, nchannels, converterType)
+}
+
+func newSampleRateConverter(converterType, nchannels, outputBufferLen int) (sampleRateConverter, error) {
+	if converterType == srcGoSinc {
+		return newGoSampleRateConverter(converterType, nchannels)
+	}
+	src, err := gosamplerate.New(converterType, nchannels, outputBufferLen)
+	if err != nil {
+		return nil, err
+	}
+	return &src, nil
+}
+
+func isValidConverterRatio(ratio float64) bool {
+	return gosamplerate.IsValidRatio(ratio)
+}
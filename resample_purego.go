@@ -0,0 +1,17 @@
+//go:build !cgo || js
+
+package main
+
+// Without cgo, all converter types are served by the pure Go converters.
+
+func resampleBuffer(buf []float32, ratio float64, nchannels, converterType int) ([]float32, error) {
+	return resampleBufferGo(buf, ratio, nchannels, converterType)
+}
+
+func newSampleRateConverter(converterType, nchannels, outputBufferLen int) (sampleRateConverter, error) {
+	return newGoSampleRateConverter(converterType, nchannels)
+}
+
+func isValidConverterRatio(ratio float64) bool {
+	return ratio >= 1.0/256 && ratio <= 256
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// Resonators runs each channel of input through a bank of two-pole
+// resonators in parallel, mode i ringing at freqs[i] Hz and decaying by
+// 60 dB in decays[i] seconds. A unit impulse makes mode i ring with an
+// amplitude of gains[i]. Modes at or above Nyquist are silent.
+func Resonators(input Stream, freqs, decays, gains []Stream) Stream {
+	nmodes := len(freqs)
+	nchannels := input.nchannels
+	inputs := append([]Stream{input}, freqs...)
+	inputs = append(inputs, decays...)
+	inputs = append(inputs, gains...)
+	return makeTransformStream(inputs, func(inputs []Stream) Stepper {
+		next := inputs[0].Next
+		params := make([]Stepper, 3*nmodes)
+		for i, s := range inputs[1:] {
+			params[i] = s.Mono().Next
+		}
+		sr := float64(SampleRate())
+		type mode struct {
+			freq, decay   float64 // of the current coefficients
+			a1, a2, scale float64
+			y1, y2        []float64 // per channel
+		}
+		modes := make([]mode, nmodes)
+		for i := range modes {
+			modes[i] = mode{freq: -1, y1: make([]float64, nchannels), y2: make([]float64, nchannels)}
+		}
+		values := make([]float64, 3*nmodes)
+		out := make(Frame, nchannels)
+		return func() (Frame, bool) {
+			frame, ok := next()
+			if !ok {
+				return nil, false
+			}
+			for i, pnext := range params {
+				p, ok := pnext()
+				if !ok {
+					return nil, false
+				}
+				values[i] = p[0]
+			}
+			clear(out)
+			for i := range modes {
+				m := &modes[i]
+				freq, decay, gain := values[i], values[nmodes+i], values[2*nmodes+i]
+				if freq != m.freq || decay != m.decay {
+					m.freq, m.decay = freq, decay
+					w := 2 * math.Pi * freq / sr
+					if freq <= 0 || freq >= sr/2 || decay <= 0 {
+						m.a1, m.a2, m.scale = 0, 0, 0
+					} else {
+						r := math.Pow(0.001, 1/(decay*sr))
+						m.a1, m.a2, m.scale = 2*r*math.Cos(w), -r*r, math.Sin(w)
+					}
+				}
+				for c, x := range frame {
+					y := m.a1*m.y1[c] + m.a2*m.y2[c] + m.scale*gain*x
+					m.y2[c], m.y1[c] = m.y1[c], y
+					out[c] += y
+				}
+			}
+			return out, true
+		}
+	})
+}
+
+// modeParams returns the per mode streams of a resonators parameter:
+// the items of a vector of n numbers or streams, or a number or stream
+// for all modes.
+func modeParams(v Val, n int, what string) ([]Stream, error) {
+	result := make([]Stream, n)
+	if vec, ok := v.(Vec); ok {
+		if len(vec) != n {
+			return nil, fmt.Errorf("%d %s for %d modes", len(vec), what, n)
+		}
+		for i, item := range vec {
+			s, err := streamFromVal(item)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", what, err)
+			}
+			result[i] = s
+		}
+		return result, nil
+	}
+	s, err := streamFromVal(v)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", what, err)
+	}
+	for i := range result {
+		result[i] = s
+	}
+	return result, nil
+}
+
+func init() {
+	RegisterWord("resonators", func(vm *VM) error {
+		gainsVal := vm.Pop()
+		decaysVal := vm.Pop()
+		freqVec, err := Pop[Vec](vm)
+		if err != nil {
+			return err
+		}
+		input, err := streamFromVal(vm.Pop())
+		if err != nil {
+			return err
+		}
+		if len(freqVec) == 0 {
+			return fmt.Errorf("resonators: no modes")
+		}
+		freqs, err := modeParams(freqVec, len(freqVec), "freqs")
+		if err != nil {
+			return fmt.Errorf("resonators: %w", err)
+		}
+		decays, err := modeParams(decaysVal, len(freqVec), "decays")
+		if err != nil {
+			return fmt.Errorf("resonators: %w", err)
+		}
+		gains, err := modeParams(gainsVal, len(freqVec), "gains")
+		if err != nil {
+			return fmt.Errorf("resonators: %w", err)
+		}
+		vm.Push(Resonators(input, freqs, decays, gains))
+		return nil
+	})
+}
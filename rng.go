@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// Rng is the state of a splitmix64 random number generator. It is a
+// value: drawing a number gives a new Rng, so the same Rng always draws
+// the same numbers, however often and wherever it is used.
+type Rng struct {
+	state uint64
+}
+
+func (r Rng) getVal() Val { return r }
+
+func (r Rng) String() string {
+	return fmt.Sprintf("Rng(%#x)", r.state)
+}
+
+// NewRng returns the Rng seeded with seed.
+func NewRng(seed int64) Rng {
+	return Rng{state: uint64(seed)}
+}
+
+// Next returns the Rng after r and a number from r in [0,1).
+func (r Rng) Next() (Rng, float64) {
+	r.state += 0x9e3779b97f4a7c15
+	z := r.state
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	z ^= z >> 31
+	return r, float64(z>>11) / (1 << 53)
+}
+
+// rngFromVal returns v if it is an Rng, or the Rng seeded with v if it
+// is a number.
+func rngFromVal(v Val) (Rng, error) {
+	switch v := v.(type) {
+	case Rng:
+		return v, nil
+	case Num:
+		return NewRng(int64(v)), nil
+	}
+	return Rng{}, fmt.Errorf("expected Rng or seed, got %T", v)
+}
+
+// RandStream returns a mono stream of numbers in [0,1) drawn from r,
+// a new one rate times a second, held in between. Its clones draw the
+// same numbers.
+func RandStream(r Rng, rate Stream) Stream {
+	return makeBlockStream(1, rate.nframes, func() BlockStepper {
+		rate := rate.Mono()
+		rbuf := make([]Smp, blockFrames)
+		r := r
+		var x float64
+		sr := float64(SampleRate())
+		// the phase in cycles times sr, which keeps whole rates exact
+		phase := sr // draws at the first frame
+		return func(buf []Smp) int {
+			n := rate.NextBlock(rbuf[:len(buf)])
+			for i, f := range rbuf[:n] {
+				if phase >= sr {
+					phase = math.Mod(phase, sr)
+					r, x = r.Next()
+				}
+				buf[i] = Smp(x)
+				phase += float64(f)
+			}
+			return n
+		}
+	})
+}
+
+func init() {
+	RegisterWord("rng", func(vm *VM) error {
+		seed, err := Pop[Num](vm)
+		if err != nil {
+			return err
+		}
+		vm.Push(NewRng(int64(seed)))
+		return nil
+	})
+
+	RegisterWord("rng/next", func(vm *VM) error {
+		r, err := Pop[Rng](vm)
+		if err != nil {
+			return err
+		}
+		r, x := r.Next()
+		vm.Push(r)
+		vm.Push(Num(x))
+		return nil
+	})
+
+	RegisterWord("~rand", func(vm *VM) error {
+		rate, err := streamFromVal(vm.Pop())
+		if err != nil {
+			return err
+		}
+		r, err := rngFromVal(vm.Pop())
+		if err != nil {
+			return fmt.Errorf("~rand: %w", err)
+		}
+		vm.Push(RandStream(r, rate))
+		return nil
+	})
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"math"
+)
+
+// rotaryCrossover is the frequency in Hz which splits the input between
+// the horn and the drum of a rotary speaker.
+const rotaryCrossover = 800.0
+
+// rotor is the horn or the drum of a rotary speaker.
+type rotor struct {
+	slow, fast float64 // rotation speeds in Hz
+	accel      float64 // seconds to get most of the way to fast
+	decel      float64 // seconds to get most of the way to slow
+	depth      float64 // Doppler delay swing in seconds
+	am         float64 // amplitude modulation depth
+}
+
+var (
+	rotaryHorn = rotor{slow: 0.83, fast: 6.75, accel: 0.6, decel: 0.9, depth: 0.00045, am: 0.5}
+	rotaryDrum = rotor{slow: 0.7, fast: 5.9, accel: 3.5, decel: 4.5, depth: 0.0003, am: 0.25}
+)
+
+// Rotary plays the mono sum of input through a rotary (Leslie) speaker
+// picked up by two microphones on either side. Above the crossover, the
+// sound comes from the horn, below it from the drum, each rotating at
+// its slow speed where speed is below 0.5 and its fast one elsewhere,
+// speeding up and slowing down at its own rate.
+func Rotary(input, speed Stream) Stream {
+	return makeTransformStreamN(2, []Stream{input, speed}, func(inputs []Stream) Stepper {
+		inext := inputs[0].Mono().Next
+		snext := inputs[1].Mono().Next
+		sr := float64(SampleRate())
+		horn := newRotorState(rotaryHorn, sr)
+		drum := newRotorState(rotaryDrum, sr)
+		lpCoef := 1 - math.Exp(-2*math.Pi*rotaryCrossover/sr)
+		var lp1, lp2 float64
+		out := make(Frame, 2)
+		return func() (Frame, bool) {
+			frame, ok := inext()
+			if !ok {
+				return nil, false
+			}
+			sframe, ok := snext()
+			if !ok {
+				return nil, false
+			}
+			fast := sframe[0] >= 0.5
+			x := float64(frame[0])
+			// two one-pole lowpasses in series, the highs being the
+			// rest, so that the two paths sum back to the input
+			lp1 += lpCoef * (x - lp1)
+			lp2 += lpCoef * (lp1 - lp2)
+			hl, hr := horn.step(x-lp2, fast)
+			dl, dr := drum.step(lp2, fast)
+			out[0] = Smp(hl + dl)
+			out[1] = Smp(hr + dr)
+			return out, true
+		}
+	})
+}
+
+// rotorState is a rotor turning in a rotary speaker.
+type rotorState struct {
+	rotor
+	sr           float64
+	rate         float64 // current speed in Hz
+	phase        float64
+	accel, decel float64 // one-pole coefficients towards the target speed
+	buf          []float64
+	writeIdx     int
+	center       float64 // delay in frames at rest
+}
+
+func newRotorState(r rotor, sr float64) *rotorState {
+	center := math.Ceil(r.depth*sr) + 1
+	return &rotorState{
+		rotor:  r,
+		sr:     sr,
+		rate:   r.slow,
+		accel:  1 - math.Exp(-1/(r.accel/3*sr)),
+		decel:  1 - math.Exp(-1/(r.decel/3*sr)),
+		buf:    make([]float64, int(2*center)+2),
+		center: center,
+	}
+}
+
+// step feeds x to the rotor and returns what the left and the right
+// microphones pick up, a quarter of a turn apart.
+func (r *rotorState) step(x float64, fast bool) (float64, float64) {
+	if fast {
+		r.rate += r.accel * (r.fast - r.rate)
+	} else {
+		r.rate += r.decel * (r.slow - r.rate)
+	}
+	r.buf[r.writeIdx] = x
+	l := r.tap(r.phase)
+	rr := r.tap(r.phase + 0.25)
+	r.writeIdx = (r.writeIdx + 1) % len(r.buf)
+	r.phase = wrapPhase(r.phase + r.rate/r.sr)
+	return l, rr
+}
+
+// tap returns the sound reaching a microphone when the rotor is at
+// phase from it: delayed as it moves away and quieter as it faces away.
+func (r *rotorState) tap(phase float64) float64 {
+	s := math.Sin(2 * math.Pi * phase) // distance from the microphone
+	delay := r.center + r.depth*r.sr*s
+	y := delayTap(r.buf, 1, 0, r.writeIdx, delay)
+	return y * (1 - r.am*s) / (1 + r.am)
+}
+
+func init() {
+	RegisterWord("rotary", func(vm *VM) error {
+		speed, err := streamFromVal(vm.Pop())
+		if err != nil {
+			return err
+		}
+		input, err := streamFromVal(vm.Pop())
+		if err != nil {
+			return err
+		}
+		vm.Push(Rotary(input, speed))
+		return nil
+	})
+}
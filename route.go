@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+)
+
+// channelMatrices holds matrices converting streams between channel
+// counts, keyed by the channel counts they convert from and to.
+type channelMatrices map[[2]int][][]Smp
+
+// downmixMatrices returns the matrices of :downmix, a vector of
+// matrices given as rows of gains (as for route, all vectors).
+func downmixMatrices(vm *VM) (channelMatrices, error) {
+	var v Vec
+	switch x := vm.GetVal(":downmix").(type) {
+	case nil:
+	case Vec:
+		v = x
+	default:
+		return nil, fmt.Errorf("downmix: expected a vector of matrices, got %v", x)
+	}
+	ms := make(channelMatrices, len(v))
+	for k, item := range v {
+		rows, ok := item.(Vec)
+		if !ok || len(rows) == 0 {
+			return nil, fmt.Errorf("downmix: matrix %d: expected rows of gains, got %v", k, item)
+		}
+		first, ok := rows[0].(Vec)
+		if !ok {
+			return nil, fmt.Errorf("downmix: matrix %d: expected a vector of gains per input channel, got %v", k, rows[0])
+		}
+		if len(first) == 0 || len(first) == len(rows) {
+			return nil, fmt.Errorf("downmix: matrix %d: %d channels to %d is no conversion", k, len(first), len(rows))
+		}
+		m, err := routeMatrix(rows, len(first))
+		if err != nil {
+			return nil, fmt.Errorf("downmix: matrix %d: %w", k, err)
+		}
+		ms[[2]int{len(first), len(rows)}] = m
+	}
+	return ms, nil
+}
+
+// channelMatrix returns the matrix converting from channels to to
+// channels: the one in ms, if any, otherwise the default one of
+// defaultChannelMatrix.
+func channelMatrix(ms channelMatrices, from, to int) ([][]Smp, error) {
+	if from < 1 || to < 1 {
+		return nil, fmt.Errorf("cannot convert %d channels to %d", from, to)
+	}
+	if m, ok := ms[[2]int{from, to}]; ok {
+		return m, nil
+	}
+	return defaultChannelMatrix(from, to), nil
+}
+
+// defaultChannelMatrix returns a matrix which folds from channels onto
+// fewer (output channel j is the average of the input channels i with
+// i%to == j, all of them for mono) or repeats them over more (output
+// channel j is input channel j%from, a mono channel everywhere). Both
+// counts are positive.
+func defaultChannelMatrix(from, to int) [][]Smp {
+	m := make([][]Smp, to)
+	for j := range to {
+		m[j] = make([]Smp, from)
+		if to >= from {
+			m[j][j%from] = 1
+			continue
+		}
+		n := 0
+		for i := j; i < from; i += to {
+			n++
+		}
+		for i := j; i < from; i += to {
+			m[j][i] = 1 / Smp(n)
+		}
+	}
+	return m
+}
+
+// convertChannels returns s converted to nchannels channels with the
+// matrices of :downmix.
+func convertChannels(vm *VM, s Stream, nchannels int) (Stream, error) {
+	if s.nchannels == nchannels {
+		return s, nil
+	}
+	ms, err := downmixMatrices(vm)
+	if err != nil {
+		return Stream{}, err
+	}
+	return s.ConvertChannels(nchannels, ms)
+}
+
+// mixFrame returns channel ch of frame mixed by the matrix m, or as it
+// is if m is nil.
+func mixFrame(frame []Smp, ch int, m [][]Smp) Smp {
+	if m == nil {
+		return frame[ch]
+	}
+	var sum Smp
+	for i, g := range m[ch] {
+		sum += g * frame[i]
+	}
+	return sum
+}
+
+// Route returns a stream of len(m) channels mixed from the channels of
+// s by the matrix m: output channel j is the sum of input channel i
+// scaled by m[j][i].
+func (s Stream) Route(m [][]Smp) Stream {
+	nch := s.nchannels
+	nout := len(m)
+	return makeBlockStream(nout, s.nframes, func() BlockStepper {
+		in := s.clone()
+		ibuf := make([]Smp, blockFrames*nch)
+		return func(buf []Smp) int {
+			n := in.NextBlock(ibuf[:len(buf)/nout*nch])
+			for i := range n {
+				frame := ibuf[i*nch : (i+1)*nch]
+				for ch := range nout {
+					buf[i*nout+ch] = mixFrame(frame, ch, m)
+				}
+			}
+			return n
+		}
+	})
+}
+
+// routeMatrix returns the matrix given by the rows of v for a stream of
+// nchannels channels: a number picks an input channel, a vector gives
+// the gain of each input channel.
+func routeMatrix(v Vec, nchannels int) ([][]Smp, error) {
+	if len(v) == 0 {
+		return nil, fmt.Errorf("no output channels")
+	}
+	m := make([][]Smp, len(v))
+	for j, row := range v {
+		if ch, ok := row.(Num); ok {
+			if ch != Num(int(ch)) || ch < 0 || int(ch) >= nchannels {
+				return nil, fmt.Errorf("output %d: no input channel %v of %d", j, ch, nchannels)
+			}
+			m[j] = make([]Smp, nchannels)
+			m[j][int(ch)] = 1
+			continue
+		}
+		gains, err := numsFromVal(row, nchannels)
+		if err != nil {
+			return nil, fmt.Errorf("output %d: expected a channel index or %d gains, got %v", j, nchannels, row)
+		}
+		m[j] = make([]Smp, nchannels)
+		for i, g := range gains {
+			m[j][i] = Smp(g)
+		}
+	}
+	return m, nil
+}
+
+func init() {
+	RegisterWord("route", func(vm *VM) error {
+		rows, err := Pop[Vec](vm)
+		if err != nil {
+			return err
+		}
+		input, err := streamFromVal(vm.Pop())
+		if err != nil {
+			return err
+		}
+		m, err := routeMatrix(rows, input.nchannels)
+		if err != nil {
+			return fmt.Errorf("route: %w", err)
+		}
+		vm.Push(input.Route(m))
+		return nil
+	})
+}
@@ -10,6 +10,15 @@ for t in tests/*.tape; do
   fi
 done
 
+# the examples of the gallery must evaluate
+for t in examples/*.tape; do
+  if ./mixtape -loglevel warn -f $t >/dev/null; then
+    ((++ok))
+  else
+    ((++fail))
+  fi
+done
+
 if [ "$fail" -eq 0 ]; then
   echo "$ok OK"
 else
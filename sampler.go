@@ -0,0 +1,244 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+type envStage int
+
+const (
+	envOff envStage = iota
+	envAttack
+	envDecay
+	envSustain
+	envRelease
+)
+
+// samplerVoice is one playing instance of the sampled tape.
+type samplerVoice struct {
+	pos   float64 // read position in frames
+	rate  float64 // frames to advance per output frame
+	stage envStage
+	level float64
+	step  float64 // level change per frame in the current stage
+	age   int     // frames since note on, used for voice stealing
+}
+
+// SamplerParams configures Sampler.
+type SamplerParams struct {
+	RootNote  float64 // MIDI note at which the tape plays at its original speed
+	A4        float64 // frequency of MIDI note 69 in Hz
+	UseNotes  bool    // pitch stream carries MIDI notes (not frequencies)
+	Polyphony int
+	OneShot   bool // ignore gate off: voices play until the end of the tape
+	Attack    int  // in frames
+	Decay     int  // in frames
+	Sustain   float64
+	Release   int // in frames
+}
+
+func (v *samplerVoice) enter(stage envStage, p *SamplerParams) {
+	v.stage = stage
+	switch stage {
+	case envAttack:
+		if p.Attack <= 0 {
+			v.level = 1
+			v.enter(envDecay, p)
+			return
+		}
+		v.step = (1 - v.level) / float64(p.Attack)
+	case envDecay:
+		if p.Decay <= 0 || v.level <= p.Sustain {
+			v.level = min(v.level, p.Sustain)
+			v.enter(envSustain, p)
+			return
+		}
+		v.step = (p.Sustain - v.level) / float64(p.Decay)
+	case envSustain:
+		v.step = 0
+	case envRelease:
+		if p.Release <= 0 {
+			v.level = 0
+			v.stage = envOff
+			return
+		}
+		v.step = -v.level / float64(p.Release)
+	}
+}
+
+// advance moves the envelope forward by one frame.
+func (v *samplerVoice) advance(p *SamplerParams) {
+	v.level += v.step
+	switch v.stage {
+	case envAttack:
+		if v.level >= 1 {
+			v.level = 1
+			v.enter(envDecay, p)
+		}
+	case envDecay:
+		if v.level <= p.Sustain {
+			v.level = p.Sustain
+			v.enter(envSustain, p)
+		}
+	case envRelease:
+		if v.level <= 0 {
+			v.level = 0
+			v.stage = envOff
+		}
+	}
+}
+
+// Sampler plays t polyphonically: each rising edge of gate starts a
+// voice, pitched by the value of pitch at that moment relative to
+// p.RootNote. Falling edges release the held voices (unless
+// p.OneShot). The result ends when gate ends.
+func (t *Tape) Sampler(gate Stream, pitch Stream, p SamplerParams) Stream {
+	nc := t.nchannels
+	nf := t.nframes
+	p.Polyphony = max(1, p.Polyphony)
+	p.Sustain = min(max(p.Sustain, 0), 1)
+	rootFreq := NoteFreq(p.RootNote, p.A4)
+	return makeTransformStreamN(nc, []Stream{gate, pitch}, func(inputs []Stream) Stepper {
+		gnext := inputs[0].Mono().Next
+		pnext := inputs[1].Mono().Next
+		voices := make([]samplerVoice, p.Polyphony)
+		out := make(Frame, nc)
+		frame := make(Frame, nc)
+		gateOn := false
+		return func() (Frame, bool) {
+			g, ok := gnext()
+			if !ok {
+				return nil, false
+			}
+			pf, ok := pnext()
+			if !ok {
+				return nil, false
+			}
+			on := g[0] > 0
+			if on && !gateOn {
+				var rate float64
+				if p.UseNotes {
+					rate = math.Pow(2, (pf[0]-p.RootNote)/12)
+				} else {
+					rate = pf[0] / rootFreq
+				}
+				// take a free voice or steal the oldest one
+				vi := 0
+				for i := range voices {
+					if voices[i].stage == envOff {
+						vi = i
+						break
+					}
+					if voices[i].age > voices[vi].age {
+						vi = i
+					}
+				}
+				v := &voices[vi]
+				*v = samplerVoice{rate: rate}
+				v.enter(envAttack, &p)
+			} else if !on && gateOn && !p.OneShot {
+				for i := range voices {
+					v := &voices[i]
+					if v.stage != envOff && v.stage != envRelease {
+						v.enter(envRelease, &p)
+					}
+				}
+			}
+			gateOn = on
+			clear(out)
+			for i := range voices {
+				v := &voices[i]
+				if v.stage == envOff {
+					continue
+				}
+				if v.pos < 0 || v.pos > float64(nf-1) {
+					v.stage = envOff
+					continue
+				}
+				t.GetInterpolatedFrameAtIndex(v.pos, frame)
+				for ch := range nc {
+					out[ch] += frame[ch] * v.level
+				}
+				v.pos += v.rate
+				v.age++
+				v.advance(&p)
+			}
+			return out, true
+		}
+	})
+}
+
+func getSamplerParam(vm *VM, name string, def float64) (float64, error) {
+	if v := vm.GetVal(name); v != nil {
+		if n, ok := v.(Num); ok {
+			return float64(n), nil
+		}
+		return 0, fmt.Errorf("sampler: %s must be number", name)
+	}
+	return def, nil
+}
+
+func init() {
+	RegisterWord("sampler", func(vm *VM) error {
+		gate, err := streamFromVal(vm.Pop())
+		if err != nil {
+			return err
+		}
+		t, err := Pop[*Tape](vm)
+		if err != nil {
+			return err
+		}
+		var p SamplerParams
+		pitchVal := vm.GetVal(":note")
+		if pitchVal != nil {
+			p.UseNotes = true
+		} else {
+			pitchVal = vm.GetVal(":freq")
+			if pitchVal == nil {
+				return fmt.Errorf("sampler: neither :note nor :freq is set")
+			}
+		}
+		pitch, err := streamFromVal(pitchVal)
+		if err != nil {
+			return fmt.Errorf("sampler: cannot use pitch: %w", err)
+		}
+		sr := float64(SampleRate())
+		if p.RootNote, err = getSamplerParam(vm, ":rootnote", 60); err != nil {
+			return err
+		}
+		if p.A4, err = positiveEnvFloat(vm, "sampler", ":a4"); err != nil {
+			return err
+		}
+		polyphony, err := getSamplerParam(vm, ":polyphony", 8)
+		if err != nil {
+			return err
+		}
+		p.Polyphony = int(polyphony)
+		oneShot, err := getSamplerParam(vm, ":oneshot", 0)
+		if err != nil {
+			return err
+		}
+		p.OneShot = oneShot != 0
+		attack, err := getSamplerParam(vm, ":attack", 0.002*sr)
+		if err != nil {
+			return err
+		}
+		p.Attack = int(attack)
+		decay, err := getSamplerParam(vm, ":decay", 0)
+		if err != nil {
+			return err
+		}
+		p.Decay = int(decay)
+		if p.Sustain, err = getSamplerParam(vm, ":sustain/level", 1); err != nil {
+			return err
+		}
+		release, err := getSamplerParam(vm, ":release", 0.05*sr)
+		if err != nil {
+			return err
+		}
+		p.Release = int(release)
+		vm.Push(t.Sampler(gate, pitch, p))
+		return nil
+	})
+}
@@ -0,0 +1,23 @@
+package main
+
+import "fmt"
+
+// The sandbox (-sandbox) makes it safe to audition scripts from
+// untrusted sources: words that write files, run programs, talk to the
+// network or record the audio input call checkSandbox before doing so.
+// Reading files (samples, other scripts) is still allowed.
+
+// checkSandbox returns an error if the VM is sandboxed. what describes
+// the refused operation.
+func (vm *VM) checkSandbox(what string) error {
+	if vm.sandbox {
+		return fmt.Errorf("%s is not allowed in sandbox mode", what)
+	}
+	return nil
+}
+
+func init() {
+	RegisterGoFunc("sandboxed?", func(vm *VM) bool {
+		return vm.sandbox
+	})
+}
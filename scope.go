@@ -0,0 +1,26 @@
+package main
+
+import "math"
+
+// phaseCorrelation returns the correlation of the first two channels
+// of t over frames [start,end): +1 for mono, 0 for unrelated channels,
+// -1 for channels in antiphase (which cancel when summed to mono).
+// Silence and mono tapes count as fully correlated.
+func (t *Tape) phaseCorrelation(start, end int) float64 {
+	if t.nchannels < 2 {
+		return 1
+	}
+	start, end = max(start, 0), min(end, t.nframes)
+	var lr, ll, rr float64
+	for i := start; i < end; i++ {
+		l := float64(t.samples[i*t.nchannels])
+		r := float64(t.samples[i*t.nchannels+1])
+		lr += l * r
+		ll += l * l
+		rr += r * r
+	}
+	if ll == 0 || rr == 0 {
+		return 1
+	}
+	return lr / math.Sqrt(ll*rr)
+}
@@ -0,0 +1,73 @@
+//go:build cgo && !js
+
+package main
+
+import (
+	"fmt"
+)
+
+const (
+	minScopeFrames     = 64
+	maxScopeFrames     = 1 << 15
+	defaultScopeFrames = 1024
+)
+
+// ScopeScreen continuously shows the most recent frames of the tape
+// being played, as waveforms or as an X/Y (lissajous) plot of the two
+// stereo channels.
+type ScopeScreen struct {
+	keymap      KeyMap
+	tapeDisplay *TapeDisplay
+	frames      int  // number of frames shown
+	xy          bool // Tab: X/Y mode
+}
+
+func CreateScopeScreen(app *App) (*ScopeScreen, error) {
+	tapeDisplay, err := app.createTapeDisplay()
+	if err != nil {
+		return nil, err
+	}
+	ss := &ScopeScreen{
+		keymap:      CreateKeyMap(),
+		tapeDisplay: tapeDisplay,
+		frames:      defaultScopeFrames,
+	}
+	ss.keymap.BindAction("scope.xy", "Tab", func() { ss.xy = !ss.xy })
+	ss.keymap.BindAction("scope.zoom-in", "M-=", func() { ss.frames = max(ss.frames/2, minScopeFrames) })
+	ss.keymap.BindAction("scope.zoom-out", "M--", func() { ss.frames = min(ss.frames*2, maxScopeFrames) })
+	ss.keymap.BindAction("scope.zoom-reset", "M-0", func() { ss.frames = defaultScopeFrames })
+	return ss, nil
+}
+
+func (ss *ScopeScreen) Keymap() KeyMap {
+	return ss.keymap
+}
+
+func (ss *ScopeScreen) HandleKey(key Key) (KeyHandler, bool) {
+	return ss.keymap.HandleKey(key)
+}
+
+func (ss *ScopeScreen) Render(app *App, ts *TileScreen) {
+	scopePane, statusPane := ts.GetPane().SplitY(-1)
+	mode := "waveform"
+	if ss.xy {
+		mode = "X/Y"
+	}
+	player := app.audio.CurrentTapePlayer()
+	if player == nil {
+		statusPane.DrawString(0, 0, fmt.Sprintf("%s, %d frames: nothing is playing", mode, ss.frames))
+		return
+	}
+	t, frame := player.currentTapeFrame()
+	start := max(frame-ss.frames, 0)
+	renderScopeView(scopePane, ss.tapeDisplay, t, start, ss.frames, ss.xy)
+	status := fmt.Sprintf("%s, %d frames (%.1f ms)", mode, ss.frames, float64(ss.frames)*1000/float64(SampleRate()))
+	if t.nchannels >= 2 {
+		status += fmt.Sprintf(", correlation %+.2f", t.phaseCorrelation(start, start+ss.frames))
+	}
+	statusPane.DrawString(0, 0, status)
+}
+
+func (ss *ScopeScreen) Reset() {}
+
+func (ss *ScopeScreen) Close() {}
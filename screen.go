@@ -0,0 +1,16 @@
+//go:build cgo && !js
+
+package main
+
+// Screen is a UI screen that can render itself and provide a keymap overlay.
+type Screen interface {
+	Render(app *App, ts *TileScreen)
+	HandleKey(key Key) (KeyHandler, bool)
+	Reset()
+	Close()
+}
+
+// CharScreen is implemented by screens that want to handle character input.
+type CharScreen interface {
+	OnChar(app *App, char rune)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// runCommand runs cmd, which is either a string passed to sh -c or a
+// vector of strings (the program and its arguments, run without a
+// shell), and returns its standard output with trailing newlines
+// removed, like $(...) in the shell.
+func runCommand(cmd Val) (string, error) {
+	var argv []string
+	switch cmd := cmd.(type) {
+	case Str:
+		argv = []string{"sh", "-c", string(cmd)}
+	case Vec:
+		for _, arg := range cmd {
+			s, ok := arg.(Str)
+			if !ok {
+				return "", fmt.Errorf("command arguments must be strings, got %T", arg)
+			}
+			argv = append(argv, string(s))
+		}
+	default:
+		return "", fmt.Errorf("expected a string or a vector of strings, got %T", cmd)
+	}
+	if len(argv) == 0 {
+		return "", errors.New("empty command")
+	}
+	var stdout, stderr bytes.Buffer
+	c := exec.Command(argv[0], argv[1:]...)
+	c.Stdout = &stdout
+	c.Stderr = &stderr
+	if err := c.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%w: %s", err, msg)
+		}
+		return "", err
+	}
+	return strings.TrimRight(stdout.String(), "\n"), nil
+}
+
+func init() {
+	RegisterGoFunc("shell", func(vm *VM, cmd Val) (string, error) {
+		if err := vm.checkSandbox("running commands"); err != nil {
+			return "", err
+		}
+		return runCommand(cmd)
+	})
+}
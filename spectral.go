@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+
+	"github.com/mjibson/go-dsp/fft"
+)
+
+// spectralMinSize and spectralMaxSize bound :spectral/size.
+const (
+	spectralMinSize = 16
+	spectralMaxSize = 65536
+)
+
+// Spectral transforms each channel of t in the frequency domain. It
+// cuts t into Hann windowed frames of size frames, overlap of which
+// cover each frame of t, and evaluates body on the magnitudes and the
+// phases of the size/2+1 bins of each, which it replaces with those
+// body leaves. The results are windowed again and added up. Body runs
+// in one env frame for the whole of t, with the index of the frame in
+// :frame and the channel in :channel, so that variables set by body
+// keep their values from one frame to the next. Magnitudes are scaled so
+// that a sine of amplitude a centered in a bin shows up as a there.
+func Spectral(vm *VM, t *Tape, body Evaler, size, overlap int) (*Tape, error) {
+	nc := t.nchannels
+	hop := size / overlap
+	nbins := size/2 + 1
+	window := make([]float64, size)
+	for i := range window {
+		window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(size))
+	}
+	scale := 4 / float64(size)
+	out := makeTape(nc, t.nframes)
+	norm := make([]float64, t.nframes)
+	buf := make([]float64, size)
+	Y := make([]complex128, size)
+	if err := vm.DoPushEnv(); err != nil {
+		return nil, err
+	}
+	defer vm.DoPopEnv()
+	frame := 0
+	// the first frame ends with the first hop of t, so that each frame
+	// of t is covered by overlap frames
+	for start := hop - size; start < t.nframes; start += hop {
+		if vm.Checkpoint() {
+			break
+		}
+		for ch := range nc {
+			for i := range size {
+				buf[i] = 0
+				if j := start + i; j >= 0 && j < t.nframes {
+					buf[i] = t.samples[j*nc+ch] * window[i]
+				}
+			}
+			X := fft.FFTReal(buf)
+			mags := make(Vec, nbins)
+			phases := make(Vec, nbins)
+			for k := range nbins {
+				mags[k] = Num(cmplx.Abs(X[k]) * scale)
+				phases[k] = Num(cmplx.Phase(X[k]))
+			}
+			vm.SetVal(":frame", Num(frame))
+			vm.SetVal(":channel", Num(ch))
+			depth := len(vm.valStack)
+			vm.Push(mags)
+			vm.Push(phases)
+			if err := body.Eval(vm); err != nil {
+				return nil, err
+			}
+			if n := len(vm.valStack) - depth; n != 2 {
+				return nil, fmt.Errorf("spectral: frame %d: expected the body to leave 2 values, got %d", frame, n)
+			}
+			newPhases, err := numsFromVal(vm.Pop(), nbins)
+			if err != nil {
+				return nil, fmt.Errorf("spectral: frame %d: phases: %w", frame, err)
+			}
+			newMags, err := numsFromVal(vm.Pop(), nbins)
+			if err != nil {
+				return nil, fmt.Errorf("spectral: frame %d: magnitudes: %w", frame, err)
+			}
+			for k := range nbins {
+				Y[k] = cmplx.Rect(newMags[k]/scale, newPhases[k])
+				if k > 0 && k < size/2 {
+					Y[size-k] = cmplx.Conj(Y[k])
+				}
+			}
+			// the bins at DC and Nyquist of a real signal are real
+			Y[0] = complex(real(Y[0]), 0)
+			Y[size/2] = complex(real(Y[size/2]), 0)
+			y := fft.IFFT(Y)
+			for i := range size {
+				if j := start + i; j >= 0 && j < t.nframes {
+					out.samples[j*nc+ch] += real(y[i]) * window[i]
+				}
+			}
+		}
+		for i := range size {
+			if j := start + i; j >= 0 && j < t.nframes {
+				norm[j] += window[i] * window[i]
+			}
+		}
+		frame++
+	}
+	for j, n := range norm {
+		if n > 1e-9 {
+			for ch := range nc {
+				out.samples[j*nc+ch] /= n
+			}
+		}
+	}
+	return out, nil
+}
+
+// stftParams returns :spectral/size and :spectral/overlap, checked.
+func stftParams(vm *VM, name string) (size, overlap int, err error) {
+	size, err = vm.GetInt(":spectral/size")
+	if err != nil {
+		return 0, 0, err
+	}
+	if size < spectralMinSize || size > spectralMaxSize || size&(size-1) != 0 {
+		return 0, 0, fmt.Errorf("%s: :spectral/size must be a power of two in %d..%d, got %d", name, spectralMinSize, spectralMaxSize, size)
+	}
+	overlap, err = vm.GetInt(":spectral/overlap")
+	if err != nil {
+		return 0, 0, err
+	}
+	if overlap < 2 || overlap > size || size%overlap != 0 {
+		return 0, 0, fmt.Errorf("%s: :spectral/overlap must be at least 2 and divide :spectral/size, got %d", name, overlap)
+	}
+	return size, overlap, nil
+}
+
+func init() {
+	RegisterWord("spectral", func(vm *VM) error {
+		body, ok := vm.Pop().(Evaler)
+		if !ok {
+			return fmt.Errorf("spectral: expected a quotation")
+		}
+		t, ok := vm.Top().(*Tape)
+		if ok {
+			vm.Pop()
+		} else {
+			s, err := streamFromVal(vm.Pop())
+			if err != nil {
+				return fmt.Errorf("spectral: %w", err)
+			}
+			if s.nframes == 0 {
+				return fmt.Errorf("spectral: cannot transform an infinite stream, take a part of it first")
+			}
+			t = s.Take(vm, s.nframes)
+		}
+		size, overlap, err := stftParams(vm, "spectral")
+		if err != nil {
+			return err
+		}
+		result, err := Spectral(vm, t, body, size, overlap)
+		if err != nil {
+			return err
+		}
+		vm.Push(result)
+		return nil
+	})
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"image/color"
+	"math"
+	"math/cmplx"
+
+	"github.com/mjibson/go-dsp/fft"
+)
+
+const (
+	spectrogramFFTSize = 1024
+	spectrogramFloorDB = -96.0
+)
+
+// spectrogram computes the magnitude spectrum of channel ch of a
+// window of t on a width x height grid. Column x is the spectrum of a
+// Hann windowed FFT centered on the frame in the middle of the column;
+// row 0 is the Nyquist frequency, row height-1 is DC (linear frequency
+// scale, so aliasing shows up as lines folding back from the top).
+// Values are in [0,1], mapping spectrogramFloorDB..0 dBFS, where 0 dBFS
+// is the magnitude of a full scale sine.
+func (t *Tape) spectrogram(ch, windowSize, windowOffset, width, height int) []float32 {
+	out := make([]float32, width*height)
+	if width <= 0 || height <= 0 || t.nframes == 0 {
+		return out
+	}
+	n := spectrogramFFTSize
+	window := make([]float64, n)
+	for i := range window {
+		window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(n))
+	}
+	nbins := n/2 + 1
+	nc := t.nchannels
+	buf := make([]float64, n)
+	var X []complex128
+	lastCenter := -1
+	incr := float64(windowSize) / float64(width)
+	for x := range width {
+		center := windowOffset + int((float64(x)+0.5)*incr)
+		// zoomed in, neighbouring columns share the same spectrum
+		if center != lastCenter {
+			start := center - n/2
+			for i := range n {
+				v := 0.0
+				if frame := start + i; frame >= 0 && frame < t.nframes {
+					v = t.samples[frame*nc+ch]
+				}
+				buf[i] = v * window[i]
+			}
+			X = fft.FFTReal(buf)
+			lastCenter = center
+		}
+		for y := range height {
+			k0 := (height - 1 - y) * nbins / height
+			k1 := max((height-y)*nbins/height, k0+1)
+			mag := 0.0
+			for k := k0; k < k1; k++ {
+				mag = max(mag, cmplx.Abs(X[k]))
+			}
+			// a Hann windowed sine of amplitude A peaks at A*n/4
+			db := 20 * math.Log10(mag*4/float64(n)+1e-12)
+			out[y*width+x] = float32(min(max(1-db/spectrogramFloorDB, 0), 1))
+		}
+	}
+	return out
+}
+
+var spectrogramColorStops = []color.RGBA{
+	{0x00, 0x00, 0x00, 0xff},
+	{0x2a, 0x0a, 0x5a, 0xff},
+	{0xb4, 0x1e, 0x50, 0xff},
+	{0xfa, 0x8c, 0x14, 0xff},
+	{0xff, 0xff, 0xc8, 0xff},
+}
+
+// spectrogramColor maps an intensity in [0,1] to a color going from
+// black through purple, red and orange to pale yellow.
+func spectrogramColor(v float32) color.RGBA {
+	pos := min(max(float64(v), 0), 1) * float64(len(spectrogramColorStops)-1)
+	i := min(int(pos), len(spectrogramColorStops)-2)
+	frac := pos - float64(i)
+	a, b := spectrogramColorStops[i], spectrogramColorStops[i+1]
+	lerp := func(x, y uint8) uint8 {
+		return uint8(math.Round(float64(x) + (float64(y)-float64(x))*frac))
+	}
+	return color.RGBA{lerp(a.R, b.R), lerp(a.G, b.G), lerp(a.B, b.B), 0xff}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"math"
+	"math/cmplx"
+
+	"github.com/mjibson/go-dsp/fft"
+)
+
+// stftFunc transforms the spectrum X (all size bins, of which the
+// first size/2+1 count) of a frame of channel ch in place. control
+// holds the values of the control streams in the middle of the frame.
+type stftFunc func(ch int, X []complex128, control []float64)
+
+// STFTStream transforms each channel of s in the frequency domain, like
+// Spectral does, but as a stream: Hann windowed frames of size frames,
+// overlap of which cover each frame of s, go through the function mk
+// makes and are overlap-added. The mono control streams are read along
+// with s. The output is aligned with s, the latency of the frames made
+// up for by reading ahead, and ends with the shortest input.
+func STFTStream(s Stream, controls []Stream, size, overlap int, mk func(nchannels int) stftFunc) Stream {
+	nc := s.nchannels
+	hop := size / overlap
+	window := make([]float64, size)
+	for i := range window {
+		window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(size))
+	}
+	// the sum of the squared windows covering each frame
+	norm := make([]float64, hop)
+	for i, w := range window {
+		norm[i%hop] += w * w
+	}
+	inputs := append([]Stream{s}, controls...)
+	return makeTransformStream(inputs, func(inputs []Stream) Stepper {
+		next := inputs[0].Next
+		cnexts := make([]Stepper, len(controls))
+		for i, c := range inputs[1:] {
+			cnexts[i] = c.Mono().Next
+		}
+		process := mk(nc)
+		// in holds the frames of the current STFT frame, acc the sums of
+		// the frames written by it and those before
+		in := make([][]float64, nc)
+		acc := make([][]float64, nc)
+		for ch := range nc {
+			in[ch] = make([]float64, size)
+			acc[ch] = make([]float64, size)
+		}
+		cbufs := make([][]float64, len(controls))
+		for i := range cbufs {
+			cbufs[i] = make([]float64, size)
+		}
+		control := make([]float64, len(controls))
+		buf := make([]float64, size)
+		queue := make([]Smp, hop*nc)
+		qpos, qlen := 0, 0
+		start := -size // first frame of in
+		nin, nout := 0, 0
+		ended := false
+		fill := func() {
+			for ch := range nc {
+				copy(in[ch], in[ch][hop:])
+			}
+			for _, cb := range cbufs {
+				copy(cb, cb[hop:])
+			}
+			for i := size - hop; i < size; i++ {
+				var frame Frame
+				ok := false
+				if !ended {
+					frame, ok = next()
+					for j, cnext := range cnexts {
+						cf, cok := cnext()
+						if !cok {
+							ok = false
+							break
+						}
+						cbufs[j][i] = cf[0]
+					}
+					if ok {
+						nin++
+					} else {
+						ended = true
+					}
+				}
+				for ch := range nc {
+					if ok {
+						in[ch][i] = frame[ch]
+					} else {
+						in[ch][i] = 0
+					}
+				}
+			}
+			start += hop
+			for j, cb := range cbufs {
+				control[j] = cb[size/2]
+			}
+			for ch := range nc {
+				for i, w := range window {
+					buf[i] = in[ch][i] * w
+				}
+				X := fft.FFTReal(buf)
+				process(ch, X, control)
+				for k := 1; k < size/2; k++ {
+					X[size-k] = cmplx.Conj(X[k])
+				}
+				X[0] = complex(real(X[0]), 0)
+				X[size/2] = complex(real(X[size/2]), 0)
+				y := fft.IFFT(X)
+				a := acc[ch]
+				for i, w := range window {
+					a[i] += real(y[i]) * w
+				}
+				// the first hop of acc is complete
+				for i := range hop {
+					queue[i*nc+ch] = a[i] / norm[i]
+				}
+				copy(a, a[hop:])
+				clear(a[size-hop:])
+			}
+			// skip what comes before the start of s
+			qpos, qlen = min(max(-start, 0), hop), hop
+		}
+		out := make(Frame, nc)
+		return func() (Frame, bool) {
+			for qpos == qlen {
+				if ended && nout >= nin {
+					return nil, false
+				}
+				fill()
+			}
+			if ended && nout >= nin {
+				return nil, false
+			}
+			copy(out, queue[qpos*nc:(qpos+1)*nc])
+			qpos++
+			nout++
+			return out, true
+		}
+	})
+}
+
+// SpectralFreeze holds the spectrum of s while gate is on (> 0): from
+// each rising edge of gate, the magnitudes of the frame there sound on,
+// each bin turning at the rate its phase turned at then.
+func SpectralFreeze(s, gate Stream, size, overlap int) Stream {
+	nbins := size/2 + 1
+	return STFTStream(s, []Stream{gate}, size, overlap, func(nc int) stftFunc {
+		frozen := make([]bool, nc)
+		mags := make([][]float64, nc)
+		phases := make([][]float64, nc)
+		deltas := make([][]float64, nc)
+		last := make([][]float64, nc)
+		for ch := range nc {
+			mags[ch] = make([]float64, nbins)
+			phases[ch] = make([]float64, nbins)
+			deltas[ch] = make([]float64, nbins)
+			last[ch] = make([]float64, nbins)
+		}
+		return func(ch int, X []complex128, control []float64) {
+			on := control[0] > 0
+			for k := range nbins {
+				phase := cmplx.Phase(X[k])
+				if on && !frozen[ch] {
+					mags[ch][k] = cmplx.Abs(X[k])
+					phases[ch][k] = phase
+					deltas[ch][k] = phase - last[ch][k]
+				}
+				last[ch][k] = phase
+				if on {
+					if frozen[ch] {
+						phases[ch][k] = wrapAngle(phases[ch][k] + deltas[ch][k])
+					}
+					X[k] = cmplx.Rect(mags[ch][k], phases[ch][k])
+				}
+			}
+			frozen[ch] = on
+		}
+	})
+}
+
+// SpectralBlur smears the magnitudes of each bin of s over time, each
+// following those of s with a time constant of amount seconds (a
+// stream, read once per frame). The phases are those of s, where s has
+// any; in silence, each bin turns on at the rate of its frequency.
+func SpectralBlur(s, amount Stream, size, overlap int) Stream {
+	nbins := size/2 + 1
+	hop := size / overlap
+	sr := float64(SampleRate())
+	return STFTStream(s, []Stream{amount}, size, overlap, func(nc int) stftFunc {
+		mags := make([][]float64, nc)
+		phases := make([][]float64, nc)
+		for ch := range nc {
+			mags[ch] = make([]float64, nbins)
+			phases[ch] = make([]float64, nbins)
+		}
+		return func(ch int, X []complex128, control []float64) {
+			a := 0.0
+			if control[0] > 0 {
+				a = math.Exp(-float64(hop) / (control[0] * sr))
+			}
+			for k := range nbins {
+				m := cmplx.Abs(X[k])
+				mags[ch][k] = a*mags[ch][k] + (1-a)*m
+				if m > 1e-12 {
+					phases[ch][k] = cmplx.Phase(X[k])
+				} else {
+					phases[ch][k] = wrapAngle(phases[ch][k] + 2*math.Pi*float64(k*hop)/float64(size))
+				}
+				X[k] = cmplx.Rect(mags[ch][k], phases[ch][k])
+			}
+		}
+	})
+}
+
+// wrapAngle wraps x into [-pi,pi).
+func wrapAngle(x float64) float64 {
+	return x - 2*math.Pi*math.Floor((x+math.Pi)/(2*math.Pi))
+}
+
+func init() {
+	RegisterWord("freeze", func(vm *VM) error {
+		gate, err := streamFromVal(vm.Pop())
+		if err != nil {
+			return err
+		}
+		input, err := streamFromVal(vm.Pop())
+		if err != nil {
+			return err
+		}
+		size, overlap, err := stftParams(vm, "freeze")
+		if err != nil {
+			return err
+		}
+		vm.Push(SpectralFreeze(input, gate, size, overlap))
+		return nil
+	})
+
+	RegisterWord("blur", func(vm *VM) error {
+		amount, err := streamFromVal(vm.Pop())
+		if err != nil {
+			return err
+		}
+		input, err := streamFromVal(vm.Pop())
+		if err != nil {
+			return err
+		}
+		size, overlap, err := stftParams(vm, "blur")
+		if err != nil {
+			return err
+		}
+		vm.Push(SpectralBlur(input, amount, size, overlap))
+		return nil
+	})
+}
@@ -13,6 +13,9 @@ type Stream struct {
 	nframes    int
 	newStepper StepperFactory
 	next       Stepper
+	newBlock   BlockStepperFactory // set if it is computed in blocks
+	block      BlockStepper        // shares its traversal with next
+	mix        *mixNode            // set if it mixes parts which can be rendered in parallel
 }
 
 func (s Stream) getVal() Val { return s }
@@ -34,11 +37,24 @@ func (s Stream) clone() Stream {
 	if s.newStepper == nil {
 		return s
 	}
+	if s.newBlock != nil {
+		block := s.newBlock()
+		return Stream{
+			nchannels:  s.nchannels,
+			nframes:    s.nframes,
+			newStepper: s.newStepper,
+			next:       frameStepper(s.nchannels, block),
+			newBlock:   s.newBlock,
+			block:      block,
+			mix:        s.mix,
+		}
+	}
 	return Stream{
 		nchannels:  s.nchannels,
 		nframes:    s.nframes,
 		newStepper: s.newStepper,
 		next:       s.newStepper(),
+		mix:        s.mix,
 	}
 }
 
@@ -63,6 +79,7 @@ type Streamable interface {
 }
 
 func makeStream(nchannels, nframes int, next Stepper) Stream {
+	streamNodes.Add(1)
 	return Stream{
 		nchannels: nchannels,
 		nframes:   nframes,
@@ -73,6 +90,7 @@ func makeStream(nchannels, nframes int, next Stepper) Stream {
 // makeRewindableStream constructs a Stream whose iteration can be restarted
 // by cloning. The factory must produce an independent Stepper each time.
 func makeRewindableStream(nchannels, nframes int, factory StepperFactory) Stream {
+	streamNodes.Add(1)
 	return Stream{
 		nchannels:  nchannels,
 		nframes:    nframes,
@@ -111,7 +129,25 @@ func makeDelayedStream(input Stream, extraFrames int, factory func(Stream) Stepp
 //   - has nframes = 0 if all inputs are infinite
 //     has nframes = length of the shortest finite input otherwise
 func makeTransformStream(inputs []Stream, mk func([]Stream) Stepper) Stream {
-	nchannels := inputs[0].nchannels
+	return makeTransformStreamN(inputs[0].nchannels, inputs, mk)
+}
+
+// makeTransformStreamN is like makeTransformStream, but the output
+// stream has nchannels channels.
+func makeTransformStreamN(nchannels int, inputs []Stream, mk func([]Stream) Stepper) Stream {
+	return makeRewindableStream(nchannels, transformFrames(inputs), func() Stepper {
+		clones := make([]Stream, len(inputs))
+		for i, s := range inputs {
+			clones[i] = s.clone()
+		}
+		return mk(clones)
+	})
+}
+
+// transformFrames returns the length of a stream transforming inputs: 0
+// if all inputs are infinite, the length of the shortest finite input
+// otherwise.
+func transformFrames(inputs []Stream) int {
 	nframesMin := inputs[0].nframes
 	nframesMax := inputs[0].nframes
 
@@ -124,20 +160,10 @@ func makeTransformStream(inputs []Stream, mk func([]Stream) Stepper) Stream {
 		}
 	}
 
-	var nframes int
 	if nframesMax == 0 {
-		nframes = 0
-	} else {
-		nframes = nframesMin
+		return 0
 	}
-
-	return makeRewindableStream(nchannels, nframes, func() Stepper {
-		clones := make([]Stream, len(inputs))
-		for i, s := range inputs {
-			clones[i] = s.clone()
-		}
-		return mk(clones)
-	})
+	return nframesMin
 }
 
 func makeEmptyStream(nchannels int) Stream {
@@ -158,28 +184,32 @@ func (s Stream) Stream() Stream {
 }
 
 func (s Stream) Take(vm *VM, nframes int) *Tape {
+	if s.mix != nil {
+		if threads := renderThreads(vm); threads > 1 {
+			return s.takeParallel(vm, nframes, threads)
+		}
+	}
 	nchannels := s.nchannels
 	t := makeTape(nchannels, nframes)
-	writeIndex := 0
-	end := nframes * nchannels
-	pct1 := end / 100
-	pct1 = pct1 - (pct1 % nchannels)
-	for frame := range s.Seq() {
-		for ch := range nchannels {
-			t.samples[writeIndex] = frame[ch]
-			writeIndex++
-		}
-		if writeIndex == end {
+	pct1 := max(nframes/100, 1)
+	nextReport := pct1
+	for written := 0; written < nframes; {
+		want := min(blockFrames, nframes-written)
+		n := s.NextBlock(t.samples[written*nchannels : (written+want)*nchannels])
+		written += n
+		if n < want {
+			clear(t.samples[written*nchannels:])
 			break
 		}
-		if vm != nil {
-			// Check cancellation frequently enough to make C-g feel responsive,
-			// but only report progress occasionally.
-			if vm.CancelRequested() {
+		if vm != nil && written < nframes {
+			// Check cancellation (and pausing) frequently enough to make
+			// C-g feel responsive, but only report progress occasionally.
+			if vm.Checkpoint() {
 				break
 			}
-			if pct1 > 0 && writeIndex%pct1 == 0 {
-				vm.ReportTapeProgress(t, end/nchannels, writeIndex/nchannels)
+			if written >= nextReport {
+				vm.ReportTapeProgress(t, nframes, written)
+				nextReport = written + pct1
 			}
 		}
 	}
@@ -209,76 +239,73 @@ func (s Stream) Mono() Stream {
 	if s.nchannels == 1 {
 		return s.clone()
 	}
-	return makeRewindableStream(1, s.nframes, func() Stepper {
-		out := make(Frame, 1)
-		next := s.clone().Next
-		return func() (Frame, bool) {
-			frame, ok := next()
-			if !ok {
-				return nil, false
-			}
-			var sum Smp
-			for ch := range s.nchannels {
-				sum += frame[ch]
+	nch := s.nchannels
+	return makeBlockStream(1, s.nframes, func() BlockStepper {
+		in := s.clone()
+		ibuf := make([]Smp, blockFrames*nch)
+		return func(buf []Smp) int {
+			n := in.NextBlock(ibuf[:len(buf)*nch])
+			for i := range n {
+				var sum Smp
+				for _, smp := range ibuf[i*nch : (i+1)*nch] {
+					sum += smp
+				}
+				buf[i] = sum / Smp(nch)
 			}
-			out[0] = sum / Smp(len(frame))
-			return out, true
+			return n
 		}
 	})
 }
 
 func (s Stream) Stereo() Stream {
-	if s.nchannels == 2 {
-		return s.clone()
-	}
-	return makeRewindableStream(2, s.nframes, func() Stepper {
-		out := make(Frame, 2)
-		next := s.clone().Next
-		return func() (Frame, bool) {
-			frame, ok := next()
-			if !ok {
-				return nil, false
-			}
-			out[0] = frame[0]
-			out[1] = frame[0]
-			return out, true
-		}
-	})
+	return s.WithNChannels(2)
 }
 
+// WithNChannels returns s converted to nchannels channels by the matrix
+// defaultChannelMatrix gives for it.
 func (s Stream) WithNChannels(nchannels int) Stream {
 	switch nchannels {
+	case s.nchannels:
+		return s.clone()
 	case 1:
 		return s.Mono()
-	case 2:
-		return s.Stereo()
 	}
-	return s
+	return s.Route(defaultChannelMatrix(s.nchannels, nchannels))
+}
+
+// ConvertChannels returns s converted to nchannels channels by the
+// matrix channelMatrix gives for it with ms.
+func (s Stream) ConvertChannels(nchannels int, ms channelMatrices) (Stream, error) {
+	m, err := channelMatrix(ms, s.nchannels, nchannels)
+	if err != nil {
+		return Stream{}, err
+	}
+	if _, ok := ms[[2]int{s.nchannels, nchannels}]; ok {
+		return s.Route(m), nil
+	}
+	return s.WithNChannels(nchannels), nil
 }
 
 func (s Stream) Combine(other Stream, op SmpBinOp) Stream {
 	nchannels := s.nchannels
-	return makeTransformStream([]Stream{s, other}, func(inputs []Stream) Stepper {
-		out := make(Frame, nchannels)
-		lhs := inputs[0]
-		rhs := inputs[1]
-		snext := lhs.WithNChannels(nchannels).Next
-		onext := rhs.WithNChannels(nchannels).Next
-		return func() (Frame, bool) {
-			frame, ok := snext()
-			if !ok {
-				return nil, false
-			}
-			oframe, ok := onext()
-			if !ok {
-				return nil, false
+	result := makeBlockTransformStream([]Stream{s, other}, func(inputs []Stream) BlockStepper {
+		lhs := inputs[0].WithNChannels(nchannels)
+		rhs := inputs[1].WithNChannels(nchannels)
+		obuf := make([]Smp, blockFrames*nchannels)
+		return func(buf []Smp) int {
+			n := lhs.NextBlock(buf)
+			if n == 0 {
+				return 0
 			}
-			for i := range nchannels {
-				out[i] = op(frame[i], oframe[i])
+			n = min(n, rhs.NextBlock(obuf[:n*nchannels]))
+			for i, smp := range obuf[:n*nchannels] {
+				buf[i] = op(buf[i], smp)
 			}
-			return out, true
+			return n
 		}
 	})
+	result.mix = &mixNode{op: op, parts: []mixPart{{0, s}, {0, other}}}
+	return result
 }
 
 func (s Stream) Join(other Stream) Stream {
@@ -316,19 +343,14 @@ func applySmpUnOp(vm *VM, op SmpUnOp) error {
 		return nil
 	}
 	s := input.Stream()
-	result := makeTransformStream([]Stream{s}, func(inputs []Stream) Stepper {
-		s := inputs[0]
-		out := make(Frame, s.nchannels)
-		next := s.Next
-		return func() (Frame, bool) {
-			frame, ok := next()
-			if !ok {
-				return nil, false
+	result := makeBlockTransformStream([]Stream{s}, func(inputs []Stream) BlockStepper {
+		in := inputs[0]
+		return func(buf []Smp) int {
+			n := in.NextBlock(buf)
+			for i, smp := range buf[:n*in.nchannels] {
+				buf[i] = op(smp)
 			}
-			for ch := range s.nchannels {
-				out[ch] = op(frame[ch])
-			}
-			return out, true
+			return n
 		}
 	})
 	vm.Push(result)
@@ -350,7 +372,69 @@ func applySmpBinOp(vm *VM, op SmpBinOp) error {
 			return nil
 		}
 	}
-	result := lhs.Stream().Combine(rhs.Stream(), op)
+	ls := lhs.Stream()
+	rs, err := convertChannels(vm, rhs.Stream(), ls.nchannels)
+	if err != nil {
+		return err
+	}
+	vm.Push(ls.Combine(rs, op))
+	return nil
+}
+
+// applySmpRangeOp applies op to x and the bounds lo and hi, each a
+// number or a stream, leaving a number if all of them are numbers.
+// Streams of bounds are converted to the channels of x.
+func applySmpRangeOp(vm *VM, name string, op SmpRangeOp) error {
+	hi, err := Pop[Streamable](vm)
+	if err != nil {
+		return err
+	}
+	lo, err := Pop[Streamable](vm)
+	if err != nil {
+		return err
+	}
+	x, err := Pop[Streamable](vm)
+	if err != nil {
+		return err
+	}
+	loNum, loOk := lo.(Num)
+	hiNum, hiOk := hi.(Num)
+	if loOk && hiOk && loNum > hiNum {
+		return vm.Errorf("%s: min (%v) > max (%v)", name, loNum, hiNum)
+	}
+	if n, ok := x.(Num); ok && loOk && hiOk {
+		vm.Push(op(Smp(n), Smp(loNum), Smp(hiNum)))
+		return nil
+	}
+	s := x.Stream()
+	nchannels := s.nchannels
+	los, err := convertChannels(vm, lo.Stream(), nchannels)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	his, err := convertChannels(vm, hi.Stream(), nchannels)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	result := makeBlockTransformStream([]Stream{s, los, his}, func(inputs []Stream) BlockStepper {
+		in := inputs[0]
+		los := inputs[1]
+		his := inputs[2]
+		lbuf := make([]Smp, blockFrames*nchannels)
+		hbuf := make([]Smp, blockFrames*nchannels)
+		return func(buf []Smp) int {
+			n := in.NextBlock(buf)
+			if n == 0 {
+				return 0
+			}
+			n = min(n, los.NextBlock(lbuf[:n*nchannels]))
+			n = min(n, his.NextBlock(hbuf[:n*nchannels]))
+			for i, smp := range buf[:n*nchannels] {
+				buf[i] = op(smp, lbuf[i], hbuf[i])
+			}
+			return n
+		}
+	})
 	vm.Push(result)
 	return nil
 }
@@ -418,7 +502,11 @@ func init() {
 		if err != nil {
 			return err
 		}
-		vm.Push(stream.Mono())
+		mono, err := convertChannels(vm, stream, 1)
+		if err != nil {
+			return fmt.Errorf("mono: %w", err)
+		}
+		vm.Push(mono)
 		return nil
 	})
 
@@ -427,7 +515,11 @@ func init() {
 		if err != nil {
 			return err
 		}
-		vm.Push(stream.Stereo())
+		stereo, err := convertChannels(vm, stream, 2)
+		if err != nil {
+			return fmt.Errorf("stereo: %w", err)
+		}
+		vm.Push(stereo)
 		return nil
 	})
 
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	wsolaWindow    = 0.03  // seconds
+	wsolaTolerance = 0.008 // seconds the read position may move to fit
+)
+
+// warpAnchor pins the source frame src of a tape to the target frame
+// tgt of its warped version.
+type warpAnchor struct {
+	src, tgt float64
+}
+
+// warpMap maps between the source and the target frames of a warp:
+// linearly between the anchors, at the original speed beyond them.
+type warpMap []warpAnchor
+
+// srcOf returns the source frame at the target frame tgt.
+func (m warpMap) srcOf(tgt float64) float64 {
+	i := 1
+	for i < len(m)-1 && tgt > m[i].tgt {
+		i++
+	}
+	if len(m) == 1 || tgt < m[0].tgt || tgt > m[len(m)-1].tgt {
+		a := m[0]
+		if tgt > a.tgt {
+			a = m[len(m)-1]
+		}
+		return a.src + tgt - a.tgt
+	}
+	a, b := m[i-1], m[i]
+	return a.src + (tgt-a.tgt)*(b.src-a.src)/(b.tgt-a.tgt)
+}
+
+// tgtOf returns the target frame at the source frame src.
+func (m warpMap) tgtOf(src float64) float64 {
+	inverse := make(warpMap, len(m))
+	for i, a := range m {
+		inverse[i] = warpAnchor{a.tgt, a.src}
+	}
+	return inverse.srcOf(src)
+}
+
+// TimeStretch returns t played at the speeds given by m without
+// changing its pitch, by WSOLA: windows of t, picked where m says but
+// moved a little to continue the waveform of the one before, are
+// overlap-added at an even pace. All channels share the picks, which
+// are made on the mono sum. The result lasts until the target frame of
+// the end of t.
+func (t *Tape) TimeStretch(m warpMap) *Tape {
+	nc := t.nchannels
+	sr := float64(SampleRate())
+	n := max(int(wsolaWindow*sr)&^1, 4)
+	hop := n / 2
+	tol := int(wsolaTolerance * sr)
+	length := max(int(math.Round(m.tgtOf(float64(t.nframes)))), 0)
+	out := makeTape(nc, length)
+	mono := t.monoSum().samples
+	at := func(i int) float64 {
+		if i < 0 || i >= len(mono) {
+			return 0
+		}
+		return mono[i]
+	}
+	window := make([]float64, n)
+	for i := range window {
+		window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(n))
+	}
+	prev := 0
+	for k := 0; k*hop-hop < length; k++ {
+		start := k*hop - hop
+		pos := int(math.Round(m.srcOf(float64(k*hop)))) - hop
+		if k > 0 {
+			// the read position near pos whose window looks most like
+			// the continuation of the window before
+			natural := prev + hop
+			best, bestScore := pos, math.Inf(-1)
+			for d := -tol; d <= tol; d++ {
+				// normalized by the energy of the candidate, which can
+				// match no better than by being the continuation itself
+				dot, energy := 0.0, 1e-12
+				for i := 0; i < n; i += 2 {
+					x := at(pos + d + i)
+					dot += x * at(natural+i)
+					energy += x * x
+				}
+				score := dot / math.Sqrt(energy)
+				if score > bestScore || (score == bestScore && abs(d) < abs(best-pos)) {
+					best, bestScore = pos+d, score
+				}
+			}
+			pos = best
+		}
+		for i, w := range window {
+			o, s := start+i, pos+i
+			if o < 0 || o >= length || s < 0 || s >= t.nframes {
+				continue
+			}
+			for ch := range nc {
+				out.samples[o*nc+ch] += w * t.samples[s*nc+ch]
+			}
+		}
+		prev = pos
+	}
+	return out
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// warpMapFromVal returns the warp map given by a vector of [src tgt]
+// frame pairs, both going up. Unless the first anchor is at the start
+// of the source or the target, the starts are anchored together.
+func warpMapFromVal(v Vec) (warpMap, error) {
+	if len(v) == 0 {
+		return nil, fmt.Errorf("no anchors")
+	}
+	var m warpMap
+	for _, item := range v {
+		nums, err := numsFromVal(item, 2)
+		if err != nil {
+			return nil, fmt.Errorf("expected a [src tgt] pair, got %v", item)
+		}
+		a := warpAnchor{nums[0], nums[1]}
+		if len(m) == 0 && a.src > 0 && a.tgt > 0 {
+			m = append(m, warpAnchor{0, 0})
+		}
+		if len(m) > 0 {
+			last := m[len(m)-1]
+			if a.src <= last.src || a.tgt <= last.tgt {
+				return nil, fmt.Errorf("anchors must go up in both source and target, got %v after [%v %v]", item, last.src, last.tgt)
+			}
+		}
+		m = append(m, a)
+	}
+	return m, nil
+}
+
+func init() {
+	RegisterGoMethod[*Tape]("warp", func(t *Tape, anchors Vec) (*Tape, error) {
+		m, err := warpMapFromVal(anchors)
+		if err != nil {
+			return nil, err
+		}
+		return t.TimeStretch(m), nil
+	})
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// stutterFade is the length in frames of the fades at the edges of
+// the repeated slices, which keep them from clicking.
+const stutterFade = 64
+
+// stutterParams are the settings of a stutter effect, in frames.
+type stutterParams struct {
+	interval int     // length of the capture and of each repeat decision
+	slice    int     // length of a repeated slice
+	chance   float64 // probability of repeating in an interval
+	pitch    float64 // semitones added at each repeat
+	seed     int64
+}
+
+// Stutter plays input, capturing its last interval frames in a circular
+// buffer. At the start of each interval, with probability chance, it
+// plays the interval as repeats of a slice picked at random from the
+// capture instead, each repeat transposed by pitch semitones more than
+// the one before it.
+func Stutter(input Stream, p stutterParams) Stream {
+	nch := input.nchannels
+	return makeTransformStream([]Stream{input}, func(inputs []Stream) Stepper {
+		next := inputs[0].Next
+		rng := rand.New(rand.NewSource(p.seed))
+		capture := make([]Smp, p.interval*nch) // circular
+		writePos := 0                          // frame in capture
+		captured := 0                          // frames captured so far
+		pos := 0                               // frame in the interval
+		repeating := false
+		slice := make([]Smp, p.slice*nch) // the repeated slice
+		out := make(Frame, nch)
+		return func() (Frame, bool) {
+			frame, ok := next()
+			if !ok {
+				return nil, false
+			}
+			if pos == 0 {
+				repeating = captured >= p.interval && rng.Float64() < p.chance
+				if repeating {
+					nslices := p.interval / p.slice
+					// writePos is the oldest frame of the capture
+					start := writePos + rng.Intn(nslices)*p.slice
+					for i := range p.slice {
+						j := (start + i) % p.interval
+						copy(slice[i*nch:(i+1)*nch], capture[j*nch:])
+					}
+				}
+			}
+			if repeating {
+				k := pos / p.slice      // repeat number
+				offset := pos % p.slice // frame in the repeat
+				rate := math.Exp2(float64(k) * p.pitch / 12)
+				// transposed up, the slice wraps around within the repeat
+				srcOffset := math.Mod(float64(offset)*rate, float64(p.slice))
+				gain := Smp(min(1,
+					float64(offset+1)/stutterFade, float64(p.slice-offset)/stutterFade,
+					(srcOffset+1)/stutterFade, (float64(p.slice)-srcOffset)/stutterFade))
+				for ch := range nch {
+					// frame srcOffset of slice, read as a circular buffer
+					out[ch] = gain * delayTap(slice, nch, ch, 0, float64(p.slice)-srcOffset)
+				}
+			} else {
+				copy(out, frame)
+			}
+			// the capture follows the input, not the repeats
+			copy(capture[writePos*nch:], frame)
+			writePos = (writePos + 1) % p.interval
+			captured++
+			pos = (pos + 1) % p.interval
+			return out, true
+		}
+	})
+}
+
+func init() {
+	RegisterWord("stutter", func(vm *VM) error {
+		input, err := streamFromVal(vm.Pop())
+		if err != nil {
+			return err
+		}
+		bpm, err := getBPM(vm, "stutter")
+		if err != nil {
+			return err
+		}
+		framesPerBeat := 60 / bpm * float64(SampleRate())
+		beats, err := vm.GetFloat(":stutter/beats")
+		if err != nil {
+			return err
+		}
+		slice, err := vm.GetFloat(":stutter/slice")
+		if err != nil {
+			return err
+		}
+		if beats <= 0 || slice <= 0 || slice > beats {
+			return fmt.Errorf("stutter: expected 0 < :stutter/slice <= :stutter/beats, got %v and %v", slice, beats)
+		}
+		chance, err := vm.GetFloat(":stutter/chance")
+		if err != nil {
+			return err
+		}
+		pitch, err := vm.GetFloat(":stutter/pitch")
+		if err != nil {
+			return err
+		}
+		seed, err := vm.GetInt(":seed")
+		if err != nil {
+			return err
+		}
+		p := stutterParams{
+			interval: max(int(math.Round(beats*framesPerBeat)), 1),
+			slice:    max(int(math.Round(slice*framesPerBeat)), 1),
+			chance:   chance,
+			pitch:    pitch,
+			seed:     int64(seed),
+		}
+		p.slice = min(p.slice, p.interval)
+		vm.Push(Stutter(input, p))
+		return nil
+	})
+}
@@ -3,20 +3,20 @@ package main
 import (
 	"encoding/binary"
 	"fmt"
-	"github.com/dh1tw/gosamplerate"
 	"github.com/go-audio/audio"
 	"github.com/go-audio/wav"
-	gl "github.com/go-gl/gl/v3.1/gles2"
-	mgl "github.com/go-gl/mathgl/mgl32"
 	"github.com/hajimehoshi/go-mp3"
 	"github.com/mitchellh/go-homedir"
-	"github.com/mjibson/go-dsp/fft"
 	"io"
 	"math"
 	"os"
 	"path/filepath"
+	"runtime"
+	"slices"
 	"strings"
-	"unsafe"
+	"sync"
+	"sync/atomic"
+	"weak"
 )
 
 // DefaultWaveSize defines the size of builtin single-cycle waveforms
@@ -26,6 +26,46 @@ type Tape struct {
 	nchannels int
 	nframes   int
 	samples   []Smp
+	buf       *tapeBuffer // nil while the samples belong to the tape alone
+	offset    int         // index of samples[0] in buf.samples
+	view      bool        // samples belong to another tape: modifications write through
+}
+
+// tapeBuffer holds the samples of a tape and of its views, which all
+// write to them. Slicing a tape gives a buffer of its own over the same
+// samples: sharers counts the buffers sharing them, and the tapes of a
+// buffer copy the samples before writing while it is more than one
+// (copy on write).
+type tapeBuffer struct {
+	samples []Smp
+	tapes   []weak.Pointer[Tape]
+	sharers *atomic.Int32
+}
+
+func newTapeBuffer(samples []Smp, sharers *atomic.Int32) *tapeBuffer {
+	sharers.Add(1)
+	b := &tapeBuffer{samples: samples, sharers: sharers}
+	runtime.AddCleanup(b, func(n *atomic.Int32) { n.Add(-1) }, sharers)
+	return b
+}
+
+// attach makes t a tape of b, with its samples starting at offset.
+func (b *tapeBuffer) attach(t *Tape, offset int) {
+	end := offset + t.nframes*t.nchannels
+	t.buf = b
+	t.offset = offset
+	t.samples = b.samples[offset:end:end]
+	b.tapes = append(b.tapes, weak.Make(t))
+}
+
+// rebase moves the tapes of b still alive to a new buffer over samples.
+func (b *tapeBuffer) rebase(samples []Smp) {
+	nb := newTapeBuffer(samples, new(atomic.Int32))
+	for _, p := range b.tapes {
+		if t := p.Value(); t != nil {
+			nb.attach(t, t.offset)
+		}
+	}
 }
 
 type TapeProvider interface {
@@ -59,15 +99,12 @@ func (t *Tape) String() string {
 func (t *Tape) Stream() Stream {
 	nc := t.nchannels
 	nf := t.nframes
-	return makeRewindableStream(nc, nf, func() Stepper {
+	return makeBlockStream(nc, nf, func() BlockStepper {
 		index := 0
-		return func() (Frame, bool) {
-			if index >= nf*nc {
-				return nil, false
-			}
-			frame := t.samples[index : index+nc]
-			index += nc
-			return frame, true
+		return func(buf []Smp) int {
+			n := copy(buf, t.samples[index:nf*nc])
+			index += n
+			return n / nc
 		}
 	})
 }
@@ -78,6 +115,7 @@ func (t *Tape) removeDCInPlace() {
 	if nf == 0 {
 		return
 	}
+	t.own()
 	nc := t.nchannels
 	smps := t.samples
 	sum := make(Frame, nc)
@@ -177,9 +215,32 @@ func (t *Tape) AtPhase(phase Stream) Stream {
 	if nf == 0 {
 		return makeEmptyStream(nc)
 	}
-	return makeTransformStream([]Stream{phase}, func(inputs []Stream) Stepper {
+	return makeBlockTransformStreamN(nc, []Stream{phase}, func(inputs []Stream) BlockStepper {
+		in := inputs[0]
+		pch := in.nchannels
+		pbuf := make([]Smp, blockFrames*pch)
+		return func(buf []Smp) int {
+			n := in.NextBlock(pbuf[:len(buf)/nc*pch])
+			for i := range n {
+				p := math.Mod(float64(pbuf[i*pch]), 1.0)
+				if p < 0 {
+					p += 1.0
+				}
+				t.GetInterpolatedFrameAtPhase(p, buf[i*nc:(i+1)*nc])
+			}
+			return n
+		}
+	})
+}
+
+// wavesAtPhase reads all of the mono waves at the phase of a single
+// phase stream, giving a stream with one channel per wave. The shapes
+// stay in phase and share one phasor.
+func wavesAtPhase(waves []*Tape, phase Stream) Stream {
+	return makeTransformStreamN(len(waves), []Stream{phase}, func(inputs []Stream) Stepper {
 		pnext := inputs[0].Next
-		out := make(Frame, nc)
+		out := make(Frame, len(waves))
+		smp := Frame{0}
 		return func() (Frame, bool) {
 			frame, ok := pnext()
 			if !ok {
@@ -189,47 +250,15 @@ func (t *Tape) AtPhase(phase Stream) Stream {
 			if p < 0 {
 				p += 1.0
 			}
-			t.GetInterpolatedFrameAtPhase(p, out)
+			for i, wave := range waves {
+				wave.GetInterpolatedFrameAtPhase(p, smp)
+				out[i] = smp[0]
+			}
 			return out, true
 		}
 	})
 }
 
-// buildFFTLowpass takes a single-channel tape and returns a
-// half-size, lowpassed version using FFT bin masking.  It zeroess
-// bins above half the Nyquist and downsamples by 2.
-// if t is not single-channel or its frame count <=1, returns t.
-func (t *Tape) buildFFTLowpass() *Tape {
-	if t.nchannels != 1 || t.nframes <= 1 {
-		return t
-	}
-	nf := t.nframes
-	// FFT expects complex input.
-	x := make([]complex128, nf)
-	for i, v := range t.samples {
-		x[i] = complex(Num(v), 0)
-	}
-	X := fft.FFT(x)
-
-	// Zero upper half of bins (simple brickwall at N/4 of original
-	// sample rate, since we will downsample by 2).
-	for k := nf/4 + 1; k < nf-(nf/4); k++ {
-		X[k] = 0
-	}
-
-	// IFFT back.
-	xt := fft.IFFT(X)
-	// Downsample by 2 with implicit box filter from lowpass.
-	nextN := nf / 2
-	out := makeTape(1, nextN)
-	for i := range nextN {
-		// fft.IFFT divides by N; xt[2*i] has that scaling already.
-		out.samples[i] = Smp(real(xt[2*i]))
-	}
-	out.removeDCInPlace()
-	return out
-}
-
 func sinTape(size int) *Tape {
 	if size == 0 {
 		size = DefaultWaveSize
@@ -319,16 +348,110 @@ func sawTape(size int) *Tape {
 	return t
 }
 
-func (t *Tape) Slice(start, end int) *Tape {
-	nframes := end - start
-	slicedTape := &Tape{
+// own gives t its own copy of its samples if they may be shared
+// with another tape, keeping its views attached. Operations modifying a
+// tape call it first.
+func (t *Tape) own() {
+	if t.buf != nil && t.buf.sharers.Load() > 1 {
+		t.buf.rebase(slices.Clone(t.buf.samples))
+	}
+}
+
+// buffer returns the buffer of t, making one if it has none yet.
+func (t *Tape) buffer() *tapeBuffer {
+	if t.buf == nil {
+		newTapeBuffer(t.samples, new(atomic.Int32)).attach(t, 0)
+	}
+	return t.buf
+}
+
+// Copy returns a tape with a copy of the samples of t.
+func (t *Tape) Copy() *Tape {
+	return &Tape{
 		nchannels: t.nchannels,
-		nframes:   nframes,
-		samples:   t.samples[start*t.nchannels : end*t.nchannels],
+		nframes:   t.nframes,
+		samples:   slices.Clone(t.samples),
 	}
+}
+
+// Slice returns the frames of t between [start,end). The slice shares
+// samples with t until one of them gets modified (copy on write).
+func (t *Tape) Slice(start, end int) (*Tape, error) {
+	if start < 0 || start > end || end > t.nframes {
+		return nil, fmt.Errorf("frames %d to %d out of range of %d", start, end, t.nframes)
+	}
+	return t.slice(start, end), nil
+}
+
+// slice is Slice for bounds known to be in range.
+func (t *Tape) slice(start, end int) *Tape {
+	b := t.buffer()
+	nc := t.nchannels
+	slicedTape := &Tape{
+		nchannels: nc,
+		nframes:   end - start,
+	}
+	lo, hi := t.offset+start*nc, t.offset+end*nc
+	newTapeBuffer(b.samples[lo:hi:hi], b.sharers).attach(slicedTape, 0)
 	return slicedTape
 }
 
+// View returns the frames of t between [start,end) as a tape which
+// shares samples with t: modifying one modifies the other.
+func (t *Tape) View(start, end int) (*Tape, error) {
+	if start < 0 || start > end || end > t.nframes {
+		return nil, fmt.Errorf("frames %d to %d out of range of %d", start, end, t.nframes)
+	}
+	view := &Tape{
+		nchannels: t.nchannels,
+		nframes:   end - start,
+		view:      true,
+	}
+	t.buffer().attach(view, t.offset+start*t.nchannels)
+	return view, nil
+}
+
+// Shift rotates the frames of t in place so that frame amount comes
+// first.
+func (t *Tape) Shift(amount int) {
+	if t.nframes == 0 {
+		return
+	}
+	t.own()
+	n := (amount%t.nframes + t.nframes) % t.nframes * t.nchannels
+	slices.Reverse(t.samples[:n])
+	slices.Reverse(t.samples[n:])
+	slices.Reverse(t.samples)
+}
+
+// MixAt adds the frames of rhs to t starting at frame offset, growing
+// t if needed.
+func (t *Tape) MixAt(rhs *Tape, offset int) error {
+	nchannels := t.nchannels
+	end := offset + rhs.nframes
+	t.own()
+	if t.nframes < end {
+		if t.view {
+			return fmt.Errorf("cannot grow a view")
+		}
+		extraFramesNeeded := end - t.nframes
+		t.samples = append(t.samples, make([]Smp, extraFramesNeeded*nchannels)...)
+		t.nframes += extraFramesNeeded
+		if t.buf != nil {
+			t.buf.rebase(t.samples)
+		}
+	}
+	s := rhs.Stream().WithNChannels(nchannels)
+	writeIndex := offset * nchannels
+	for frame := range s.Seq() {
+		for i := range nchannels {
+			t.samples[writeIndex] += frame[i]
+			writeIndex++
+		}
+	}
+	return nil
+}
+
 func (t *Tape) WriteToWav(path string) error {
 	f, err := os.Create(path)
 	if err != nil {
@@ -337,7 +460,15 @@ func (t *Tape) WriteToWav(path string) error {
 	defer f.Close()
 	sr := SampleRate()
 	enc := wav.NewEncoder(f, sr, 16, t.nchannels, 1)
+	// record the version in the INFO chunk (ISFT) to make it possible
+	// to tell which mixtape rendered a file
+	enc.Metadata = &wav.Metadata{Software: "mixtape " + Version}
 	defer enc.Close()
+	if t.nchannels > 2 {
+		if err := writeExtensibleWavHeader(enc); err != nil {
+			return err
+		}
+	}
 	nsamples := t.nframes * t.nchannels
 	intBuf := &audio.IntBuffer{
 		Format: &audio.Format{
@@ -357,6 +488,48 @@ func (t *Tape) WriteToWav(path string) error {
 	return nil
 }
 
+// wavChannelMasks gives the speakers of the channels of the usual
+// multichannel layouts: quad, 5.1 and 7.1.
+var wavChannelMasks = map[int]uint32{
+	4: 0x33,
+	6: 0x3f,
+	8: 0x63f,
+}
+
+// wavSubFormatPCM is the GUID of integer PCM samples.
+var wavSubFormatPCM = [16]byte{1, 0, 0, 0, 0, 0, 0x10, 0, 0x80, 0, 0, 0xaa, 0, 0x38, 0x9b, 0x71}
+
+// writeExtensibleWavHeader writes the header of a WAV file to enc in
+// the WAVE_FORMAT_EXTENSIBLE format, which files of more than two
+// channels should use. The channels of quad, 5.1 and 7.1 files are
+// assigned to speakers, those of other sizes (ambisonics, say) are not.
+// The encoder writes the rest of the file after it.
+func writeExtensibleWavHeader(enc *wav.Encoder) error {
+	blockAlign := enc.NumChans * enc.BitDepth / 8
+	for _, v := range []any{
+		[4]byte{'R', 'I', 'F', 'F'},
+		uint32(0), // file size, written by Close
+		[4]byte{'W', 'A', 'V', 'E'},
+		[4]byte{'f', 'm', 't', ' '},
+		uint32(40), // chunk size
+		uint16(0xfffe),
+		uint16(enc.NumChans),
+		uint32(enc.SampleRate),
+		uint32(enc.SampleRate * blockAlign),
+		uint16(blockAlign),
+		uint16(enc.BitDepth),
+		uint16(22), // size of the extension
+		uint16(enc.BitDepth),
+		wavChannelMasks[enc.NumChans],
+		wavSubFormatPCM,
+	} {
+		if err := enc.AddLE(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func init() {
 	RegisterMethod[*Tape]("shift", 2, func(vm *VM) error {
 		amount, err := Pop[Num](vm)
@@ -377,11 +550,9 @@ func init() {
 		if amount < 1.0 {
 			amount = Num(t.nframes) * amount
 		}
-		amountSamples := int(math.Round(float64(amount))) % t.nframes
-		t.samples = append(t.samples[amountSamples:], t.samples[:amountSamples]...)
+		t.Shift(int(math.Round(float64(amount))))
 		return nil
 	})
-
 }
 
 func expandPath(path string) (string, error) {
@@ -397,18 +568,98 @@ func fileExists(path string) bool {
 	return err == nil
 }
 
-func resolveTapePath(path string) (string, error) {
+// findTapeFile returns p if it names a file of a known extension which
+// exists, or p with the first known extension that names one.
+func findTapeFile(p string) (string, bool) {
+	for _, ext := range []string{".tape", ".wav", ".mp3"} {
+		if strings.ToLower(filepath.Ext(p)) == ext {
+			return p, fileExists(p)
+		}
+	}
+	for _, ext := range []string{".tape", ".wav", ".mp3"} {
+		if pathWithExt := p + ext; fileExists(pathWithExt) {
+			return pathWithExt, true
+		}
+	}
+	return "", false
+}
+
+// samplePath returns the directories of :samples/path, a string or a
+// vector of strings.
+func samplePath(vm *VM) ([]string, error) {
+	switch v := vm.GetVal(":samples/path").(type) {
+	case nil:
+		return nil, nil
+	case Str:
+		return []string{string(v)}, nil
+	case Vec:
+		dirs := make([]string, len(v))
+		for i, item := range v {
+			dir, ok := item.(Str)
+			if !ok {
+				return nil, fmt.Errorf(":samples/path: expected strings, got %T at index %d", item, i)
+			}
+			dirs[i] = string(dir)
+		}
+		return dirs, nil
+	default:
+		return nil, fmt.Errorf(":samples/path: expected a string or a vector of strings, got %T", v)
+	}
+}
+
+// scriptDir returns the directory of the script file holding the
+// innermost executing token, or "" if it comes from no file (-e, the
+// repl, an unsaved buffer or the builtin prelude).
+func (vm *VM) scriptDir() string {
+	stack := vm.tokenStack.Get()
+	for i := len(stack) - 1; i >= 0; i-- {
+		tok := stack[i]
+		if tok == nil {
+			continue
+		}
+		name := tok.pos.Filename
+		if name == "" || name == "-D" || strings.HasPrefix(name, "<") {
+			continue
+		}
+		return filepath.Dir(name)
+	}
+	return ""
+}
+
+// resolveTapePath returns the file a path given to load names. A
+// relative path is looked up from the directory of the script being
+// evaluated (the working directory if there is none), then in the
+// directories of :samples/path, in order, which are themselves relative
+// to the directory of the script.
+func resolveTapePath(vm *VM, path string) (string, error) {
 	p, err := expandPath(path)
 	if err != nil {
 		return "", err
 	}
-	for _, ext := range []string{".tape", ".wav", ".mp3"} {
-		if strings.ToLower(filepath.Ext(p)) == ext {
-			return p, nil
+	if filepath.IsAbs(p) {
+		if found, ok := findTapeFile(p); ok {
+			return found, nil
+		}
+		return "", fmt.Errorf("tape not found: %s", path)
+	}
+	base := vm.scriptDir()
+	if found, ok := findTapeFile(filepath.Join(base, p)); ok {
+		return found, nil
+	}
+	dirs, err := samplePath(vm)
+	if err != nil {
+		return "", err
+	}
+	for _, dir := range dirs {
+		dir, err := expandPath(dir)
+		if err != nil {
+			return "", err
+		}
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(base, dir)
 		}
-		pathWithExt := fmt.Sprintf("%s%s", p, ext)
-		if fileExists(pathWithExt) {
-			return pathWithExt, nil
+		if found, ok := findTapeFile(filepath.Join(dir, p)); ok {
+			return found, nil
 		}
 	}
 	return "", fmt.Errorf("tape not found: %s", path)
@@ -432,13 +683,31 @@ func loadTape(vm *VM, path string) (*Tape, error) {
 	}
 	defer f.Close()
 
+	// a nested evaluation leaves its result on the stack of the caller
+	depth := len(vm.valStack)
 	if err := vm.ParseAndEval(f, path); err != nil {
 		return nil, err
 	}
-	tape, ok := vm.evalResult.(*Tape)
+	result := vm.evalResult
+	if vm.evalDepth.Get() > 0 {
+		result = nil
+		if len(vm.valStack) > depth {
+			result = vm.Top()
+		}
+		vm.valStack = vm.valStack[:depth]
+	}
+	if s, ok := result.(Stream); ok && s.nframes > 0 {
+		result = s.Take(vm, s.nframes)
+	}
+	tape, ok := result.(*Tape)
 	if !ok {
 		return nil, fmt.Errorf("tape script did not produce a tape: %s", path)
 	}
+	if err := vm.checkSandbox("caching the render of " + path); err != nil {
+		// the render is still usable, it just cannot be cached
+		logger.Debug("not caching tape", "err", err)
+		return tape, nil
+	}
 	if err := tape.WriteToWav(wavPath); err != nil {
 		return nil, err
 	}
@@ -501,7 +770,7 @@ func loadWav(path string) (*Tape, error) {
 		}
 		logger.Debug("resampling wav data", "path", path)
 		startTime = GetTime()
-		resampledBuf, err := gosamplerate.Simple(float32Buf, float64(sr)/float64(wavSR), nchannels, gosamplerate.SRC_SINC_BEST_QUALITY)
+		resampledBuf, err := resampleBuffer(float32Buf, float64(sr)/float64(wavSR), nchannels, srcSincBestQuality)
 		if err != nil {
 			return nil, err
 		}
@@ -559,7 +828,7 @@ func loadMP3(path string) (*Tape, error) {
 		logger.Debug("decoded mp3 file", "path", path, "seconds", GetTime()-startTime)
 		startTime = GetTime()
 		logger.Debug("resampling mp3 data", "path", path)
-		resampledBuf, err := gosamplerate.Simple(float32Buf, float64(sr)/float64(mp3SR), nchannels, gosamplerate.SRC_SINC_BEST_QUALITY)
+		resampledBuf, err := resampleBuffer(float32Buf, float64(sr)/float64(mp3SR), nchannels, srcSincBestQuality)
 		if err != nil {
 			return nil, err
 		}
@@ -633,7 +902,7 @@ func init() {
 		if err != nil {
 			return err
 		}
-		path, err := resolveTapePath(string(pathVal))
+		path, err := resolveTapePath(vm, string(pathVal))
 		if err != nil {
 			return err
 		}
@@ -642,10 +911,22 @@ func init() {
 }
 
 type TapeReader struct {
+	mu            sync.Mutex // guards the tape and the swap against Swap
 	tape          *Tape
 	tapeOffset    int
 	audioChannels int
 	audioOffset   int
+	frameOffset   int  // added to the frames reported by GetCurrentFrame
+	frameShift    int  // moves the reported frames after a swap jumped in the tape
+	loop          bool // restart from the beginning at the end of the tape
+	// matrix converting the channels of tape to the audio channels
+	m [][]Smp
+	// tape being crossfaded to by Swap
+	next       *Tape
+	nextM      [][]Smp
+	nextFrame  int // position in next
+	fadeFrames int
+	fadeDone   int
 }
 
 func writeSampleAsFloat32bits(buf []byte, index int, smp Smp) {
@@ -658,14 +939,112 @@ func writeSampleAsFloat32bits(buf []byte, index int, smp Smp) {
 
 func (tr *TapeReader) GetCurrentFrame(bytesStillInAudioBuffer int) int {
 	samplesStillInAudioBuffer := bytesStillInAudioBuffer / 4
-	return (tr.audioOffset - samplesStillInAudioBuffer) / tr.audioChannels
+	frame := (tr.audioOffset - samplesStillInAudioBuffer) / tr.audioChannels
+	if tr.loop && tr.tape.nframes > 0 {
+		frame %= tr.tape.nframes
+	}
+	return tr.frameOffset + tr.frameShift + frame
+}
+
+// currentTape returns the tape being read.
+func (tr *TapeReader) currentTape() *Tape {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	return tr.tape
+}
+
+// Swap crossfades the reader to t over fadeFrames frames, continuing
+// at the current position. If t is shorter than that, it continues at
+// the position modulo the length of t.
+func (tr *TapeReader) Swap(t *Tape, fadeFrames int, downmix channelMatrices) error {
+	nextM, err := audioMatrix(downmix, t.nchannels, tr.audioChannels)
+	if err != nil {
+		return err
+	}
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	frame := tr.tapeOffset / tr.tape.nchannels
+	if tr.next != nil {
+		// swapped again during a crossfade: fade out what fades in
+		tr.tape, tr.m, frame = tr.next, tr.nextM, tr.nextFrame
+		tr.tapeOffset = frame * tr.tape.nchannels
+	}
+	nextFrame := frame
+	if t.nframes > 0 && nextFrame >= t.nframes {
+		nextFrame %= t.nframes
+	}
+	tr.frameShift += nextFrame - frame
+	tr.next = t
+	tr.nextM = nextM
+	tr.nextFrame = nextFrame
+	tr.fadeFrames = max(fadeFrames, 1)
+	tr.fadeDone = 0
+	return nil
+}
+
+// sampleFor returns the sample of frame of t for audio channel ch,
+// mixed by the matrix m converting the channels of t to those of the
+// audio (nil if they are the same). Frames past the end of t are
+// silent.
+func (t *Tape) sampleFor(frame, ch int, m [][]Smp) Smp {
+	if frame < 0 || frame >= t.nframes {
+		return 0
+	}
+	tc := t.nchannels
+	return mixFrame(t.samples[frame*tc:(frame+1)*tc], ch, m)
+}
+
+// audioMatrix returns the matrix of downmix converting from channels of
+// a tape to to channels of audio, nil if there is nothing to convert.
+func audioMatrix(downmix channelMatrices, from, to int) ([][]Smp, error) {
+	if from == to {
+		return nil, nil
+	}
+	return channelMatrix(downmix, from, to)
+}
+
+// readCrossfade fills buf with the crossfade from the tape to the next
+// one, switching over to the next tape when the crossfade is done.
+func (tr *TapeReader) readCrossfade(buf []byte) (int, error) {
+	nc := tr.audioChannels
+	frame := tr.tapeOffset / tr.tape.nchannels
+	writeIndex := 0
+	m, nextM := tr.m, tr.nextM
+	for writeIndex+nc*4 <= len(buf) && tr.fadeDone < tr.fadeFrames {
+		g := Smp(tr.fadeDone) / Smp(tr.fadeFrames)
+		for ch := range nc {
+			smp := (1-g)*tr.tape.sampleFor(frame, ch, m) + g*tr.next.sampleFor(tr.nextFrame, ch, nextM)
+			writeSampleAsFloat32bits(buf, writeIndex, smp)
+			writeIndex += 4
+			tr.audioOffset++
+		}
+		frame++
+		tr.nextFrame++
+		tr.fadeDone++
+	}
+	tr.tapeOffset = min(frame, tr.tape.nframes) * tr.tape.nchannels
+	if tr.fadeDone == tr.fadeFrames {
+		tr.tape, tr.m = tr.next, tr.nextM
+		tr.tapeOffset = min(tr.nextFrame, tr.tape.nframes) * tr.tape.nchannels
+		tr.next = nil
+	}
+	return writeIndex, nil
 }
 
 func (tr *TapeReader) Read(buf []byte) (int, error) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	if tr.next != nil {
+		return tr.readCrossfade(buf)
+	}
 	samples := tr.tape.samples
 	tapeOffset := tr.tapeOffset
 	audioOffset := tr.audioOffset
 	samplesLeft := len(samples) - tapeOffset
+	if samplesLeft == 0 && tr.loop && len(samples) > 0 {
+		tapeOffset = 0
+		samplesLeft = len(samples)
+	}
 	if samplesLeft == 0 {
 		logger.Debug("playing finished")
 		return 0, io.EOF
@@ -674,60 +1053,15 @@ func (tr *TapeReader) Read(buf []byte) (int, error) {
 	writeIndex := 0
 	srcChannels := tr.tape.nchannels
 	dstChannels := tr.audioChannels
-	switch srcChannels {
-	case 1:
-		switch dstChannels {
-		case 1:
-			framesToWrite := min(bufLengthInSamples, samplesLeft)
-			bytesToWrite := framesToWrite * 4
-			for writeIndex < bytesToWrite {
-				smp := samples[tapeOffset]
-				tapeOffset++
-				writeSampleAsFloat32bits(buf, writeIndex, smp)
-				writeIndex += 4
-				audioOffset++
-			}
-		case 2:
-			framesToWrite := min(bufLengthInSamples/2, samplesLeft)
-			bytesToWrite := framesToWrite * 8
-			for writeIndex < bytesToWrite {
-				smp := samples[tapeOffset]
-				tapeOffset++
-				writeSampleAsFloat32bits(buf, writeIndex, smp)
-				writeIndex += 4
-				audioOffset++
-				writeSampleAsFloat32bits(buf, writeIndex, smp)
-				writeIndex += 4
-				audioOffset++
-			}
-		}
-	case 2:
-		switch dstChannels {
-		case 1:
-			framesToWrite := min(bufLengthInSamples, samplesLeft/2)
-			bytesToWrite := framesToWrite * 4
-			for writeIndex < bytesToWrite {
-				smp := (samples[tapeOffset] + samples[tapeOffset+1]) / 2.0
-				tapeOffset += 2
-				writeSampleAsFloat32bits(buf, writeIndex, smp)
-				writeIndex += 4
-				audioOffset++
-			}
-		case 2:
-			framesToWrite := min(bufLengthInSamples/2, samplesLeft/2)
-			bytesToWrite := framesToWrite * 8
-			for writeIndex < bytesToWrite {
-				smp := samples[tapeOffset]
-				tapeOffset++
-				writeSampleAsFloat32bits(buf, writeIndex, smp)
-				writeIndex += 4
-				audioOffset++
-				smp = samples[tapeOffset]
-				tapeOffset++
-				writeSampleAsFloat32bits(buf, writeIndex, smp)
-				writeIndex += 4
-				audioOffset++
-			}
+	m := tr.m
+	framesToWrite := min(bufLengthInSamples/dstChannels, samplesLeft/srcChannels)
+	for range framesToWrite {
+		frame := samples[tapeOffset : tapeOffset+srcChannels]
+		tapeOffset += srcChannels
+		for ch := range dstChannels {
+			writeSampleAsFloat32bits(buf, writeIndex, mixFrame(frame, ch, m))
+			writeIndex += 4
+			audioOffset++
 		}
 	}
 	tr.tapeOffset = tapeOffset
@@ -735,13 +1069,20 @@ func (tr *TapeReader) Read(buf []byte) (int, error) {
 	return writeIndex, nil
 }
 
-func MakeTapeReader(tape *Tape, nchannels int) *TapeReader {
+// MakeTapeReader returns a reader playing tape as nchannels channels of
+// audio, converted with the matrices of downmix.
+func MakeTapeReader(tape *Tape, nchannels int, downmix channelMatrices) (*TapeReader, error) {
+	m, err := audioMatrix(downmix, tape.nchannels, nchannels)
+	if err != nil {
+		return nil, err
+	}
 	return &TapeReader{
 		tape:          tape,
 		tapeOffset:    0,
 		audioChannels: nchannels,
 		audioOffset:   0,
-	}
+		m:             m,
+	}, nil
 }
 
 func init() {
@@ -754,6 +1095,15 @@ func init() {
 		return nil
 	})
 
+	RegisterWord("selection", func(vm *VM) error {
+		if t := vm.Selection(); t != nil {
+			vm.Push(t)
+		} else {
+			vm.Push(Nil)
+		}
+		return nil
+	})
+
 	RegisterWord("tape1", func(vm *VM) error {
 		nframesNum, err := Pop[Num](vm)
 		if err != nil {
@@ -870,23 +1220,34 @@ func init() {
 		return nil
 	})
 
-	RegisterMethod[*Tape]("slice", 3, func(vm *VM) error {
-		endNum, err := Pop[Num](vm)
+	RegisterMethod[Vec]("at/phase", 2, func(vm *VM) error {
+		phase, err := streamFromVal(vm.Pop())
 		if err != nil {
 			return err
 		}
-		startNum, err := Pop[Num](vm)
+		v, err := Pop[Vec](vm)
 		if err != nil {
 			return err
 		}
-		t, err := Pop[*Tape](vm)
-		if err != nil {
-			return err
+		waves := make([]*Tape, len(v))
+		for i, item := range v {
+			tp, ok := item.(TapeProvider)
+			if !ok || tp.Tape().nchannels != 1 || tp.Tape().nframes == 0 {
+				return vm.Errorf("Vec.at/phase: item %d is not a mono wave: %v", i, item)
+			}
+			waves[i] = tp.Tape()
 		}
-		vm.Push(t.Slice(int(startNum), int(endNum)))
+		if len(waves) == 0 {
+			return vm.Errorf("Vec.at/phase: no waves")
+		}
+		vm.Push(wavesAtPhase(waves, phase))
 		return nil
 	})
 
+	RegisterGoMethod[*Tape]("slice", (*Tape).Slice)
+	RegisterGoMethod[*Tape]("view", (*Tape).View)
+	RegisterGoMethod[*Tape]("copy", (*Tape).Copy)
+
 	RegisterMethod[*Tape]("+@", 3, func(vm *VM) error {
 		offsetNum, err := Pop[Num](vm)
 		if err != nil {
@@ -900,237 +1261,9 @@ func init() {
 		if err != nil {
 			return err
 		}
-		offset := int(offsetNum)
-		nchannels := lhs.nchannels
-		end := offset + rhs.nframes
-		if lhs.nframes < end {
-			extraFramesNeeded := end - lhs.nframes
-			lhs.samples = append(lhs.samples, make([]Smp, extraFramesNeeded*nchannels)...)
-			lhs.nframes += extraFramesNeeded
-		}
-		s := rhs.Stream().WithNChannels(nchannels)
-		writeIndex := offset * nchannels
-		for frame := range s.Seq() {
-			for i := range nchannels {
-				lhs.samples[writeIndex] += frame[i]
-				writeIndex++
-			}
+		if err := lhs.MixAt(rhs, int(offsetNum)); err != nil {
+			return vm.Errorf("+@: %w", err)
 		}
 		return nil
 	})
 }
-
-// TapeDisplay
-
-const (
-	pointVertexShader = `
-		precision highp float;
-		attribute vec2 a_position;
-		uniform mat4 u_transform;
-		void main(void) {
-			gl_Position = u_transform * vec4(a_position, 0.0, 1.0);
-		};` + "\x00"
-	pointFragmentShader = `
-		precision highp float;
-		uniform vec4 u_color;
-		void main(void) {
-			gl_FragColor = u_color;
-		};` + "\x00"
-)
-
-type PointVertex struct {
-	position [2]float32
-}
-
-type TapeDisplay struct {
-	tape        *Tape
-	pixelRect   Rect
-	vertices    [][]PointVertex
-	program     Program
-	a_position  int32
-	u_transform int32
-	u_color     int32
-}
-
-func CreateTapeDisplay() (*TapeDisplay, error) {
-	program, err := CreateProgram(pointVertexShader, pointFragmentShader)
-	if err != nil {
-		return nil, err
-	}
-	td := &TapeDisplay{
-		program:     program,
-		a_position:  program.GetAttribLocation("a_position\x00"),
-		u_transform: program.GetUniformLocation("u_transform\x00"),
-		u_color:     program.GetUniformLocation("u_color\x00"),
-	}
-	return td, nil
-}
-
-func (td *TapeDisplay) Render(tape *Tape, pixelRect Rect, windowSize int, windowOffset int, playheadFrames []int) {
-	pixelWidth, pixelHeight := pixelRect.Dx(), pixelRect.Dy()
-	if pixelWidth == 0 || pixelHeight == 0 {
-		return
-	}
-	if td.tape != tape || td.pixelRect != pixelRect {
-		td.tape = tape
-		td.pixelRect = pixelRect
-		td.vertices = make([][]PointVertex, tape.nchannels)
-		for ch := range tape.nchannels {
-			td.vertices[ch] = make([]PointVertex, pixelWidth*2)
-			for x := range pixelWidth {
-				px := float32(x) + 0.5
-				idx := x * 2
-				td.vertices[ch][idx].position[0] = px
-				td.vertices[ch][idx+1].position[0] = px
-			}
-		}
-	}
-	channelHeight := float32(pixelHeight) / float32(tape.nchannels)
-	channelHeightHalf := channelHeight / 2.0
-	incr := float64(windowSize) / float64(pixelWidth)
-	readIndex := float64(windowOffset)
-	channelClipped := make([]bool, tape.nchannels)
-	for x := range pixelWidth {
-		i0 := int(math.Floor(readIndex))
-		i1 := int(math.Ceil(readIndex + incr))
-		if i1 <= i0 {
-			i1 = i0 + 1
-		}
-		if i0 < 0 {
-			i0 = 0
-		}
-		if i1 > tape.nframes {
-			i1 = tape.nframes
-		}
-		channelTop := float32(0)
-		for ch := range tape.nchannels {
-			minVal := math.Inf(1)
-			maxVal := math.Inf(-1)
-			base := ch
-			for i := i0; i < i1; i++ {
-				smp := float64(tape.samples[base+i*tape.nchannels])
-				if smp < minVal {
-					minVal = smp
-				}
-				if smp > maxVal {
-					maxVal = smp
-				}
-			}
-			if math.Abs(minVal) > 1.0 || math.Abs(maxVal) > 1.0 {
-				channelClipped[ch] = true
-			}
-			yMin := channelTop + channelHeightHalf - float32(minVal)*channelHeightHalf
-			yMax := channelTop + channelHeightHalf - float32(maxVal)*channelHeightHalf
-
-			// When the signal is constant (min == max), our per-column vertical line
-			// collapses to a point. gles2 doesn't reliably rasterize zero-length lines,
-			// so we expand it to at least ~1 pixel so constant tapes are visible.
-			height := yMin - yMax
-			if height < 1.0 {
-				center := (yMin + yMax) * 0.5
-				half := float32(0.5)
-				yMin = center + half
-				yMax = center - half
-
-				// Clamp to the channel bounds by shifting the segment while
-				// preserving its minimum height.
-				upper := channelTop + channelHeight
-				if yMin > upper {
-					shift := yMin - upper
-					yMin -= shift
-					yMax -= shift
-				}
-				if yMax < channelTop {
-					shift := channelTop - yMax
-					yMin += shift
-					yMax += shift
-				}
-			}
-
-			idx := x * 2
-			td.vertices[ch][idx].position[1] = yMin
-			td.vertices[ch][idx+1].position[1] = yMax
-			channelTop += channelHeight
-		}
-		readIndex += incr
-	}
-	// Build transform once (pixel space -> clip space)
-	ux := 2.0 / float32(fbSize.X)
-	uy := 2.0 / float32(fbSize.Y)
-	mScale := mgl.Scale3D(ux, -uy, 1)
-	tx := -1.0 + ux*float32(pixelRect.Min.X)
-	ty := 1.0 - uy*float32(pixelRect.Min.Y)
-	mTranslate := mgl.Translate3D(tx, ty, 0)
-	mTransform := mTranslate.Mul4(mScale)
-
-	td.program.Use()
-	gl.UniformMatrix4fv(td.u_transform, 1, false, &mTransform[0])
-	gl.Enable(gl.BLEND)
-	gl.BlendFunc(gl.SRC_ALPHA, gl.ONE_MINUS_SRC_ALPHA)
-	gl.EnableVertexAttribArray(uint32(td.a_position))
-
-	stride := int32(unsafe.Sizeof(PointVertex{}))
-
-	// Draw faint waveform fill + stroke per channel for a more polished look.
-	for ch := range tape.nchannels {
-		ptr := gl.Ptr(&td.vertices[ch][0].position[0])
-		count := int32(len(td.vertices[ch]))
-
-		// subtle fill
-		gl.LineWidth(3.0)
-		gl.Uniform4f(td.u_color, 1.0, 1.0, 1.0, 0.16)
-		gl.VertexAttribPointer(uint32(td.a_position), 2, gl.FLOAT, false, stride, ptr)
-		gl.DrawArrays(gl.LINES, 0, count)
-
-		// crisp stroke
-		gl.LineWidth(1.0)
-		gl.Uniform4f(td.u_color, 1.0, 1.0, 1.0, 0.9)
-		gl.VertexAttribPointer(uint32(td.a_position), 2, gl.FLOAT, false, stride, ptr)
-		gl.DrawArrays(gl.LINES, 0, count)
-	}
-
-	// Zero lines and bounds per channel
-	lineVerts := [2]PointVertex{{position: [2]float32{0, 0}}, {position: [2]float32{float32(pixelWidth), 0}}}
-	for ch := range tape.nchannels {
-		channelTop := float32(ch) * channelHeight
-		// zero line
-		lineVerts[0].position[1] = channelTop + channelHeightHalf
-		lineVerts[1].position[1] = channelTop + channelHeightHalf
-		gl.Uniform4f(td.u_color, 1.0, 1.0, 1.0, 0.15)
-		gl.LineWidth(1.0)
-		gl.VertexAttribPointer(uint32(td.a_position), 2, gl.FLOAT, false, stride, gl.Ptr(&lineVerts[0].position[0]))
-		gl.DrawArrays(gl.LINES, 0, 2)
-
-		// guard lines
-		guardColor := [4]float32{1.0, 1.0, 1.0, 0.12}
-		if channelClipped[ch] {
-			guardColor = [4]float32{1.0, 0.2, 0.2, 0.7}
-		}
-		gl.Uniform4f(td.u_color, guardColor[0], guardColor[1], guardColor[2], guardColor[3])
-		lineVerts[0].position[1] = channelTop
-		lineVerts[1].position[1] = channelTop
-		gl.VertexAttribPointer(uint32(td.a_position), 2, gl.FLOAT, false, stride, gl.Ptr(&lineVerts[0].position[0]))
-		gl.DrawArrays(gl.LINES, 0, 2)
-		lineVerts[0].position[1] = channelTop + channelHeight
-		lineVerts[1].position[1] = channelTop + channelHeight
-		gl.VertexAttribPointer(uint32(td.a_position), 2, gl.FLOAT, false, stride, gl.Ptr(&lineVerts[0].position[0]))
-		gl.DrawArrays(gl.LINES, 0, 2)
-	}
-
-	// Playhead indicators
-	for _, playheadFrame := range playheadFrames {
-		playheadX := int(math.Round(float64(playheadFrame-windowOffset) / incr))
-		if playheadX >= 0 && playheadX < pixelWidth {
-			px := float32(playheadX) + 0.5
-			playheadVerts := [2]PointVertex{{position: [2]float32{px, 0}}, {position: [2]float32{px, float32(gl.SAMPLE_LOCATION_PIXEL_GRID_HEIGHT_NV)}}}
-			gl.LineWidth(1.0)
-			gl.Uniform4f(td.u_color, 1.0, 1.0, 1.0, 0.5)
-			gl.VertexAttribPointer(uint32(td.a_position), 2, gl.FLOAT, false, stride, gl.Ptr(&playheadVerts[0].position[0]))
-			gl.DrawArrays(gl.LINES, 0, 2)
-		}
-	}
-
-	gl.LineWidth(1.0)
-	gl.Disable(gl.BLEND)
-	gl.DisableVertexAttribArray(uint32(td.a_position))
-}
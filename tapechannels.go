@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+)
+
+// Per-channel tape operations. Like the editing operations, they
+// return new tapes.
+
+// Channels splits t into mono tapes, one per channel.
+func (t *Tape) Channels() []*Tape {
+	nc := t.nchannels
+	result := make([]*Tape, nc)
+	for ch := range nc {
+		mono := makeTape(1, t.nframes)
+		for i := range t.nframes {
+			mono.samples[i] = t.samples[i*nc+ch]
+		}
+		result[ch] = mono
+	}
+	return result
+}
+
+// MergeChannels builds a tape whose channels are the channels of the
+// given tapes, in order. The result is as long as the longest input,
+// shorter ones are padded with silence.
+func MergeChannels(tapes []*Tape) *Tape {
+	nc, nf := 0, 0
+	for _, t := range tapes {
+		nc += t.nchannels
+		nf = max(nf, t.nframes)
+	}
+	out := makeTape(nc, nf)
+	offset := 0
+	for _, t := range tapes {
+		for i := range t.nframes {
+			copy(out.samples[i*nc+offset:], t.samples[i*t.nchannels:(i+1)*t.nchannels])
+		}
+		offset += t.nchannels
+	}
+	return out
+}
+
+// SwapChannels returns t with its channels in reverse order (left and
+// right swapped for a stereo tape).
+func (t *Tape) SwapChannels() *Tape {
+	nc := t.nchannels
+	out := makeTape(nc, t.nframes)
+	for i := range t.nframes {
+		for ch := range nc {
+			out.samples[i*nc+ch] = t.samples[i*nc+nc-1-ch]
+		}
+	}
+	return out
+}
+
+// MidSide converts a stereo tape between left/right and mid/side
+// representation. Encoding computes mid = (L+R)/2 and side = (L-R)/2,
+// decoding L = mid+side and R = mid-side, so the two are inverses.
+func (t *Tape) MidSide(decode bool) (*Tape, error) {
+	if t.nchannels != 2 {
+		return nil, fmt.Errorf("expected stereo tape, got %d channels", t.nchannels)
+	}
+	scale := 0.5
+	if decode {
+		scale = 1
+	}
+	out := makeTape(2, t.nframes)
+	for i := range t.nframes {
+		a, b := t.samples[i*2], t.samples[i*2+1]
+		out.samples[i*2] = (a + b) * scale
+		out.samples[i*2+1] = (a - b) * scale
+	}
+	return out, nil
+}
+
+func init() {
+	RegisterGoMethod[*Tape]("channels", func(t *Tape) Vec {
+		channels := t.Channels()
+		result := make(Vec, len(channels))
+		for i, mono := range channels {
+			result[i] = mono
+		}
+		return result
+	})
+	RegisterGoFunc("merge", func(v Vec) (*Tape, error) {
+		if len(v) == 0 {
+			return nil, fmt.Errorf("nothing to merge")
+		}
+		tapes := make([]*Tape, len(v))
+		for i, item := range v {
+			switch x := item.(type) {
+			case TapeProvider:
+				tapes[i] = x.Tape()
+				if tapes[i].nchannels == 0 {
+					return nil, fmt.Errorf("item %d has no channels", i)
+				}
+			case Streamable:
+				s := x.Stream()
+				if s.nchannels == 0 {
+					return nil, fmt.Errorf("item %d has no channels", i)
+				}
+				if s.nframes == 0 {
+					return nil, fmt.Errorf("item %d is an infinite stream", i)
+				}
+				tapes[i] = s.Take(nil, s.nframes)
+			default:
+				return nil, fmt.Errorf("item %d is not a tape: %v", i, item)
+			}
+		}
+		return MergeChannels(tapes), nil
+	})
+	RegisterGoMethod[*Tape]("swap-channels", (*Tape).SwapChannels)
+	RegisterGoMethod[*Tape]("ms-encode", func(t *Tape) (*Tape, error) {
+		return t.MidSide(false)
+	})
+	RegisterGoMethod[*Tape]("ms-decode", func(t *Tape) (*Tape, error) {
+		return t.MidSide(true)
+	})
+}
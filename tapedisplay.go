@@ -0,0 +1,584 @@
+//go:build cgo && !js
+
+package main
+
+import (
+	gl "github.com/go-gl/gl/v3.1/gles2"
+	mgl "github.com/go-gl/mathgl/mgl32"
+	"image"
+	"math"
+	"unsafe"
+)
+
+const (
+	pointVertexShader = `
+		precision highp float;
+		attribute vec2 a_position;
+		uniform mat4 u_transform;
+		void main(void) {
+			gl_Position = u_transform * vec4(a_position, 0.0, 1.0);
+		};` + "\x00"
+	pointFragmentShader = `
+		precision highp float;
+		uniform vec4 u_color;
+		void main(void) {
+			gl_FragColor = u_color;
+		};` + "\x00"
+	imageVertexShader = `
+		precision highp float;
+		attribute vec2 a_position;
+		attribute vec2 a_texcoord;
+		uniform mat4 u_transform;
+		varying vec2 v_texcoord;
+		void main(void) {
+			gl_Position = u_transform * vec4(a_position, 0.0, 1.0);
+			v_texcoord = a_texcoord;
+		};` + "\x00"
+	imageFragmentShader = `
+		precision mediump float;
+		uniform sampler2D u_tex;
+		varying vec2 v_texcoord;
+		void main(void) {
+			gl_FragColor = texture2D(u_tex, v_texcoord);
+		};` + "\x00"
+)
+
+type PointVertex struct {
+	position [2]float32
+}
+
+type ImageVertex struct {
+	position [2]float32
+	texcoord [2]float32
+}
+
+// spectrogramKey identifies the window of a tape shown by the
+// spectrogram texture, which is only recomputed when it changes.
+type spectrogramKey struct {
+	tape         *Tape
+	pixelRect    Rect
+	windowSize   int
+	windowOffset int
+}
+
+type TapeDisplay struct {
+	tape         *Tape
+	pixelRect    Rect
+	vertices     [][]PointVertex // per-column min/max segments for each channel
+	rmsVertices  [][]PointVertex // per-column -rms/+rms segments for each channel
+	lineWidthMax float32
+	program      Program
+	a_position   int32
+	u_transform  int32
+	u_color      int32
+
+	scopeVertices []PointVertex
+
+	spectrogramKey spectrogramKey
+	spectrogramTex Texture
+	imageProgram   Program
+	i_position     int32
+	i_texcoord     int32
+	i_transform    int32
+	i_tex          int32
+}
+
+func CreateTapeDisplay() (*TapeDisplay, error) {
+	program, err := CreateProgram(pointVertexShader, pointFragmentShader)
+	if err != nil {
+		return nil, err
+	}
+	imageProgram, err := CreateProgram(imageVertexShader, imageFragmentShader)
+	if err != nil {
+		return nil, err
+	}
+	tex, err := CreateTexture()
+	if err != nil {
+		return nil, err
+	}
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+	var lineWidthRange [2]float32
+	gl.GetFloatv(gl.ALIASED_LINE_WIDTH_RANGE, &lineWidthRange[0])
+	td := &TapeDisplay{
+		lineWidthMax:   max(1, lineWidthRange[1]),
+		program:        program,
+		a_position:     program.GetAttribLocation("a_position\x00"),
+		u_transform:    program.GetUniformLocation("u_transform\x00"),
+		u_color:        program.GetUniformLocation("u_color\x00"),
+		spectrogramTex: tex,
+		imageProgram:   imageProgram,
+		i_position:     imageProgram.GetAttribLocation("a_position\x00"),
+		i_texcoord:     imageProgram.GetAttribLocation("a_texcoord\x00"),
+		i_transform:    imageProgram.GetUniformLocation("u_transform\x00"),
+		i_tex:          imageProgram.GetUniformLocation("u_tex\x00"),
+	}
+	return td, nil
+}
+
+// setLineWidth sets the GL line width to w logical pixels, scaled by
+// the content scale so that lines keep their apparent thickness on
+// HiDPI displays.
+func (td *TapeDisplay) setLineWidth(w float32) {
+	gl.LineWidth(min(w*contentScale, td.lineWidthMax))
+}
+
+// pixelTransform maps pixel coordinates relative to the top left
+// corner of pixelRect to clip space.
+func pixelTransform(pixelRect Rect) mgl.Mat4 {
+	ux := 2.0 / float32(fbSize.X)
+	uy := 2.0 / float32(fbSize.Y)
+	mScale := mgl.Scale3D(ux, -uy, 1)
+	tx := -1.0 + ux*float32(pixelRect.Min.X)
+	ty := 1.0 - uy*float32(pixelRect.Min.Y)
+	mTranslate := mgl.Translate3D(tx, ty, 0)
+	return mTranslate.Mul4(mScale)
+}
+
+// columnSegment returns the y coordinates of a vertical segment
+// spanning lo..hi (sample values) in a channel lane. Segments shorter
+// than one pixel are expanded because gles2 doesn't reliably
+// rasterize zero-length lines.
+func columnSegment(lo, hi float64, channelTop, channelHeight float32) (y0, y1 float32) {
+	channelHeightHalf := channelHeight / 2.0
+	y0 = channelTop + channelHeightHalf - float32(lo)*channelHeightHalf
+	y1 = channelTop + channelHeightHalf - float32(hi)*channelHeightHalf
+	if y0-y1 < 1.0 {
+		center := (y0 + y1) * 0.5
+		y0 = center + 0.5
+		y1 = center - 0.5
+
+		// Clamp to the channel bounds by shifting the segment while
+		// preserving its minimum height.
+		upper := channelTop + channelHeight
+		if y0 > upper {
+			shift := y0 - upper
+			y0 -= shift
+			y1 -= shift
+		}
+		if y1 < channelTop {
+			shift := channelTop - y1
+			y0 += shift
+			y1 += shift
+		}
+	}
+	return y0, y1
+}
+
+// drawSpectrogram draws the spectrogram of each channel of a window
+// of tape into its lane, using the transform set up by Render.
+func (td *TapeDisplay) drawSpectrogram(tape *Tape, pixelRect Rect, windowSize, windowOffset int, mTransform *mgl.Mat4) {
+	pixelWidth, pixelHeight := pixelRect.Dx(), pixelRect.Dy()
+	key := spectrogramKey{tape, pixelRect, windowSize, windowOffset}
+	td.spectrogramTex.Bind()
+	if td.spectrogramKey != key {
+		td.spectrogramKey = key
+		img := image.NewRGBA(image.Rect(0, 0, pixelWidth, pixelHeight))
+		for ch := range tape.nchannels {
+			top := ch * pixelHeight / tape.nchannels
+			rows := (ch+1)*pixelHeight/tape.nchannels - top
+			values := tape.spectrogram(ch, windowSize, windowOffset, pixelWidth, rows)
+			for y := range rows {
+				for x := range pixelWidth {
+					img.SetRGBA(x, top+y, spectrogramColor(values[y*pixelWidth+x]))
+				}
+			}
+		}
+		gl.PixelStorei(gl.UNPACK_ALIGNMENT, 1)
+		gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RGBA,
+			int32(pixelWidth), int32(pixelHeight),
+			0, gl.RGBA, gl.UNSIGNED_BYTE,
+			gl.Ptr(img.Pix))
+	}
+	w, h := float32(pixelWidth), float32(pixelHeight)
+	quad := [6]ImageVertex{
+		{[2]float32{0, 0}, [2]float32{0, 0}},
+		{[2]float32{w, 0}, [2]float32{1, 0}},
+		{[2]float32{0, h}, [2]float32{0, 1}},
+		{[2]float32{w, 0}, [2]float32{1, 0}},
+		{[2]float32{w, h}, [2]float32{1, 1}},
+		{[2]float32{0, h}, [2]float32{0, 1}},
+	}
+	td.imageProgram.Use()
+	gl.UniformMatrix4fv(td.i_transform, 1, false, &mTransform[0])
+	var activeTexture int32
+	gl.GetIntegerv(gl.ACTIVE_TEXTURE, &activeTexture)
+	gl.Uniform1i(td.i_tex, activeTexture-gl.TEXTURE0)
+	stride := int32(unsafe.Sizeof(ImageVertex{}))
+	gl.EnableVertexAttribArray(uint32(td.i_position))
+	gl.EnableVertexAttribArray(uint32(td.i_texcoord))
+	gl.VertexAttribPointer(uint32(td.i_position), 2, gl.FLOAT, false, stride, gl.Ptr(&quad[0].position[0]))
+	gl.VertexAttribPointer(uint32(td.i_texcoord), 2, gl.FLOAT, false, stride, gl.Ptr(&quad[0].texcoord[0]))
+	gl.DrawArrays(gl.TRIANGLES, 0, int32(len(quad)))
+	gl.DisableVertexAttribArray(uint32(td.i_position))
+	gl.DisableVertexAttribArray(uint32(td.i_texcoord))
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+}
+
+// Render draws a window of tape into pixelRect: the min/max and RMS
+// envelope of each channel, or its spectrogram if spectral is set.
+// The selection (if active) is shaded.
+func (td *TapeDisplay) Render(tape *Tape, pixelRect Rect, windowSize int, windowOffset int, playheadFrames []int, spectral bool, sel tapeSelection) {
+	pixelWidth, pixelHeight := pixelRect.Dx(), pixelRect.Dy()
+	if pixelWidth == 0 || pixelHeight == 0 {
+		return
+	}
+	if td.tape != tape || td.pixelRect != pixelRect {
+		td.tape = tape
+		td.pixelRect = pixelRect
+		td.vertices = make([][]PointVertex, tape.nchannels)
+		td.rmsVertices = make([][]PointVertex, tape.nchannels)
+		for ch := range tape.nchannels {
+			td.vertices[ch] = make([]PointVertex, pixelWidth*2)
+			td.rmsVertices[ch] = make([]PointVertex, pixelWidth*2)
+			for x := range pixelWidth {
+				px := float32(x) + 0.5
+				idx := x * 2
+				td.vertices[ch][idx].position[0] = px
+				td.vertices[ch][idx+1].position[0] = px
+				td.rmsVertices[ch][idx].position[0] = px
+				td.rmsVertices[ch][idx+1].position[0] = px
+			}
+		}
+	}
+	channelHeight := float32(pixelHeight) / float32(tape.nchannels)
+	channelHeightHalf := channelHeight / 2.0
+	incr := float64(windowSize) / float64(pixelWidth)
+	readIndex := float64(windowOffset)
+	channelClipped := make([]bool, tape.nchannels)
+	for x := range pixelWidth {
+		i0 := int(math.Floor(readIndex))
+		i1 := int(math.Ceil(readIndex + incr))
+		if i1 <= i0 {
+			i1 = i0 + 1
+		}
+		if i0 < 0 {
+			i0 = 0
+		}
+		if i1 > tape.nframes {
+			i1 = tape.nframes
+		}
+		channelTop := float32(0)
+		for ch := range tape.nchannels {
+			minVal := math.Inf(1)
+			maxVal := math.Inf(-1)
+			sumSquares := 0.0
+			base := ch
+			for i := i0; i < i1; i++ {
+				smp := float64(tape.samples[base+i*tape.nchannels])
+				if smp < minVal {
+					minVal = smp
+				}
+				if smp > maxVal {
+					maxVal = smp
+				}
+				sumSquares += smp * smp
+			}
+			if i1 <= i0 {
+				minVal, maxVal = 0, 0
+			}
+			if math.Abs(minVal) > 1.0 || math.Abs(maxVal) > 1.0 {
+				channelClipped[ch] = true
+			}
+			rms := math.Sqrt(sumSquares / float64(max(1, i1-i0)))
+			// the RMS band is centered on the column's mean so that it
+			// stays inside the min/max envelope for signals with DC
+			center := (minVal + maxVal) / 2
+			rmsLo := max(minVal, center-rms)
+			rmsHi := min(maxVal, center+rms)
+
+			idx := x * 2
+			y0, y1 := columnSegment(minVal, maxVal, channelTop, channelHeight)
+			td.vertices[ch][idx].position[1] = y0
+			td.vertices[ch][idx+1].position[1] = y1
+			y0, y1 = columnSegment(rmsLo, rmsHi, channelTop, channelHeight)
+			td.rmsVertices[ch][idx].position[1] = y0
+			td.rmsVertices[ch][idx+1].position[1] = y1
+			channelTop += channelHeight
+		}
+		readIndex += incr
+	}
+	mTransform := pixelTransform(pixelRect)
+
+	if spectral {
+		td.drawSpectrogram(tape, pixelRect, windowSize, windowOffset, &mTransform)
+	}
+
+	td.program.Use()
+	gl.UniformMatrix4fv(td.u_transform, 1, false, &mTransform[0])
+	gl.Enable(gl.BLEND)
+	gl.BlendFunc(gl.SRC_ALPHA, gl.ONE_MINUS_SRC_ALPHA)
+	gl.EnableVertexAttribArray(uint32(td.a_position))
+
+	stride := int32(unsafe.Sizeof(PointVertex{}))
+
+	// Dual shading per channel: the min/max envelope in a lighter shade,
+	// the RMS band on top of it in a stronger one. Columns are exactly
+	// one framebuffer pixel apart, so these lines are not scaled.
+	gl.LineWidth(1.0)
+	if !spectral {
+		for ch := range tape.nchannels {
+			count := int32(len(td.vertices[ch]))
+
+			gl.Uniform4f(td.u_color, 1.0, 1.0, 1.0, 0.45)
+			gl.VertexAttribPointer(uint32(td.a_position), 2, gl.FLOAT, false, stride, gl.Ptr(&td.vertices[ch][0].position[0]))
+			gl.DrawArrays(gl.LINES, 0, count)
+
+			gl.Uniform4f(td.u_color, 1.0, 1.0, 1.0, 0.9)
+			gl.VertexAttribPointer(uint32(td.a_position), 2, gl.FLOAT, false, stride, gl.Ptr(&td.rmsVertices[ch][0].position[0]))
+			gl.DrawArrays(gl.LINES, 0, count)
+		}
+	}
+
+	// Selection
+	if sel.active() {
+		x0 := max(float32(float64(sel.start-windowOffset)/incr), 0)
+		x1 := min(float32(float64(sel.end-windowOffset)/incr), float32(pixelWidth))
+		if x1 > x0 {
+			h := float32(pixelHeight)
+			quad := [6]PointVertex{
+				{[2]float32{x0, 0}}, {[2]float32{x1, 0}}, {[2]float32{x0, h}},
+				{[2]float32{x1, 0}}, {[2]float32{x1, h}}, {[2]float32{x0, h}},
+			}
+			gl.Uniform4f(td.u_color, 0.3, 0.5, 1.0, 0.25)
+			gl.VertexAttribPointer(uint32(td.a_position), 2, gl.FLOAT, false, stride, gl.Ptr(&quad[0].position[0]))
+			gl.DrawArrays(gl.TRIANGLES, 0, int32(len(quad)))
+		}
+	}
+
+	// Zero lines and bounds per channel
+	lineVerts := [2]PointVertex{{position: [2]float32{0, 0}}, {position: [2]float32{float32(pixelWidth), 0}}}
+	for ch := range tape.nchannels {
+		channelTop := float32(ch) * channelHeight
+		// zero line
+		td.setLineWidth(1.0)
+		if !spectral {
+			lineVerts[0].position[1] = channelTop + channelHeightHalf
+			lineVerts[1].position[1] = channelTop + channelHeightHalf
+			gl.Uniform4f(td.u_color, 1.0, 1.0, 1.0, 0.15)
+			gl.VertexAttribPointer(uint32(td.a_position), 2, gl.FLOAT, false, stride, gl.Ptr(&lineVerts[0].position[0]))
+			gl.DrawArrays(gl.LINES, 0, 2)
+		}
+
+		// guard lines
+		guardColor := [4]float32{1.0, 1.0, 1.0, 0.12}
+		if channelClipped[ch] {
+			guardColor = [4]float32{1.0, 0.2, 0.2, 0.7}
+		}
+		gl.Uniform4f(td.u_color, guardColor[0], guardColor[1], guardColor[2], guardColor[3])
+		lineVerts[0].position[1] = channelTop
+		lineVerts[1].position[1] = channelTop
+		gl.VertexAttribPointer(uint32(td.a_position), 2, gl.FLOAT, false, stride, gl.Ptr(&lineVerts[0].position[0]))
+		gl.DrawArrays(gl.LINES, 0, 2)
+		lineVerts[0].position[1] = channelTop + channelHeight
+		lineVerts[1].position[1] = channelTop + channelHeight
+		gl.VertexAttribPointer(uint32(td.a_position), 2, gl.FLOAT, false, stride, gl.Ptr(&lineVerts[0].position[0]))
+		gl.DrawArrays(gl.LINES, 0, 2)
+	}
+
+	// Playhead indicators
+	for _, playheadFrame := range playheadFrames {
+		playheadX := int(math.Round(float64(playheadFrame-windowOffset) / incr))
+		if playheadX >= 0 && playheadX < pixelWidth {
+			px := float32(playheadX) + 0.5
+			playheadVerts := [2]PointVertex{{position: [2]float32{px, 0}}, {position: [2]float32{px, float32(pixelHeight)}}}
+			td.setLineWidth(1.0)
+			gl.Uniform4f(td.u_color, 1.0, 1.0, 1.0, 0.5)
+			gl.VertexAttribPointer(uint32(td.a_position), 2, gl.FLOAT, false, stride, gl.Ptr(&playheadVerts[0].position[0]))
+			gl.DrawArrays(gl.LINES, 0, 2)
+		}
+	}
+
+	gl.LineWidth(1.0)
+	gl.Disable(gl.BLEND)
+	gl.DisableVertexAttribArray(uint32(td.a_position))
+}
+
+// Level meter colors by level: green up to -12 dBFS, yellow up to
+// -3 dBFS, red above.
+var meterZones = []struct {
+	db    float64
+	color [4]float32
+}{
+	{-12, [4]float32{0.2, 0.8, 0.3, 0.9}},
+	{-3, [4]float32{0.9, 0.8, 0.2, 0.9}},
+	{0, [4]float32{1.0, 0.25, 0.2, 0.9}},
+}
+
+// RenderMeter draws a vertical level meter for each channel: the RMS
+// level as a solid bar colored by zone, the peak level as a fainter
+// bar above it, the peak hold as a line and a clip indicator at the
+// top.
+func (td *TapeDisplay) RenderMeter(m *LevelMeter, pixelRect Rect) {
+	pixelWidth, pixelHeight := pixelRect.Dx(), pixelRect.Dy()
+	nc := len(m.Peak)
+	if pixelWidth == 0 || pixelHeight == 0 || nc == 0 {
+		return
+	}
+	mTransform := pixelTransform(pixelRect)
+	td.program.Use()
+	gl.UniformMatrix4fv(td.u_transform, 1, false, &mTransform[0])
+	gl.Enable(gl.BLEND)
+	gl.BlendFunc(gl.SRC_ALPHA, gl.ONE_MINUS_SRC_ALPHA)
+	gl.EnableVertexAttribArray(uint32(td.a_position))
+	stride := int32(unsafe.Sizeof(PointVertex{}))
+	drawQuad := func(x0, y0, x1, y1 float32, color [4]float32) {
+		if x1 <= x0 || y1 <= y0 {
+			return
+		}
+		quad := [6]PointVertex{
+			{[2]float32{x0, y0}}, {[2]float32{x1, y0}}, {[2]float32{x0, y1}},
+			{[2]float32{x1, y0}}, {[2]float32{x1, y1}}, {[2]float32{x0, y1}},
+		}
+		gl.Uniform4f(td.u_color, color[0], color[1], color[2], color[3])
+		gl.VertexAttribPointer(uint32(td.a_position), 2, gl.FLOAT, false, stride, gl.Ptr(&quad[0].position[0]))
+		gl.DrawArrays(gl.TRIANGLES, 0, int32(len(quad)))
+	}
+	laneWidth := float32(pixelWidth) / float32(nc)
+	clipHeight := min(float32(pixelHeight)/10, 6)
+	barHeight := float32(pixelHeight) - clipHeight - 1
+	levelY := func(level float64) float32 {
+		return float32(pixelHeight) - float32(meterFraction(level))*barHeight
+	}
+	dbY := func(db float64) float32 {
+		return levelY(math.Pow(10, db/20))
+	}
+	for ch := range nc {
+		x0 := float32(ch)*laneWidth + 1
+		x1 := float32(ch+1)*laneWidth - 1
+		drawQuad(x0, clipHeight+1, x1, float32(pixelHeight), [4]float32{1, 1, 1, 0.06})
+		// peak bar
+		drawQuad(x0, levelY(m.Peak[ch]), x1, float32(pixelHeight), [4]float32{1, 1, 1, 0.25})
+		// RMS bar, one quad per zone
+		bottom := float32(pixelHeight)
+		rmsY := levelY(m.RMS[ch])
+		for _, zone := range meterZones {
+			top := max(dbY(zone.db), rmsY)
+			drawQuad(x0, top, x1, bottom, zone.color)
+			bottom = min(bottom, top)
+		}
+		// peak hold
+		if m.Hold[ch] > 0 {
+			y := levelY(m.Hold[ch])
+			drawQuad(x0, y-1, x1, y+1, [4]float32{1, 1, 1, 0.8})
+		}
+		clipColor := [4]float32{1, 1, 1, 0.12}
+		if m.Clip[ch] {
+			clipColor = [4]float32{1.0, 0.2, 0.2, 0.9}
+		}
+		drawQuad(x0, 0, x1, clipHeight, clipColor)
+	}
+	gl.Disable(gl.BLEND)
+	gl.DisableVertexAttribArray(uint32(td.a_position))
+}
+
+// RenderScope draws frames [start,start+n) of tape as an oscilloscope:
+// one trace per channel lane, or if xy is set, the first two channels
+// against each other (left on the x axis, right on the y axis) in a
+// centered square.
+func (td *TapeDisplay) RenderScope(tape *Tape, start, n int, pixelRect Rect, xy bool) {
+	pixelWidth, pixelHeight := pixelRect.Dx(), pixelRect.Dy()
+	start, end := max(start, 0), min(start+n, tape.nframes)
+	if pixelWidth == 0 || pixelHeight == 0 || tape.nchannels == 0 || end-start < 2 {
+		return
+	}
+	n = end - start
+	mTransform := pixelTransform(pixelRect)
+	td.program.Use()
+	gl.UniformMatrix4fv(td.u_transform, 1, false, &mTransform[0])
+	gl.Enable(gl.BLEND)
+	gl.BlendFunc(gl.SRC_ALPHA, gl.ONE_MINUS_SRC_ALPHA)
+	gl.EnableVertexAttribArray(uint32(td.a_position))
+	stride := int32(unsafe.Sizeof(PointVertex{}))
+	if cap(td.scopeVertices) < n {
+		td.scopeVertices = make([]PointVertex, n)
+	}
+	verts := td.scopeVertices[:n]
+	drawLines := func(mode uint32, verts []PointVertex, color [4]float32) {
+		gl.Uniform4f(td.u_color, color[0], color[1], color[2], color[3])
+		gl.VertexAttribPointer(uint32(td.a_position), 2, gl.FLOAT, false, stride, gl.Ptr(&verts[0].position[0]))
+		gl.DrawArrays(mode, 0, int32(len(verts)))
+	}
+	gridColor := [4]float32{1, 1, 1, 0.15}
+	td.setLineWidth(1.0)
+	if xy {
+		size := float32(min(pixelWidth, pixelHeight))
+		x0 := (float32(pixelWidth) - size) / 2
+		y0 := (float32(pixelHeight) - size) / 2
+		half := size / 2
+		// axes and the mono diagonal
+		grid := []PointVertex{
+			{[2]float32{x0 + half, y0}}, {[2]float32{x0 + half, y0 + size}},
+			{[2]float32{x0, y0 + half}}, {[2]float32{x0 + size, y0 + half}},
+			{[2]float32{x0, y0 + size}}, {[2]float32{x0 + size, y0}},
+		}
+		drawLines(gl.LINES, grid, gridColor)
+		rch := min(1, tape.nchannels-1)
+		for i := range n {
+			frame := (start + i) * tape.nchannels
+			l := min(max(float32(tape.samples[frame]), -1), 1)
+			r := min(max(float32(tape.samples[frame+rch]), -1), 1)
+			verts[i].position = [2]float32{x0 + half + l*half, y0 + half - r*half}
+		}
+		drawLines(gl.LINE_STRIP, verts, [4]float32{0.4, 1.0, 0.5, 0.6})
+	} else {
+		laneHeight := float32(pixelHeight) / float32(tape.nchannels)
+		xScale := float32(pixelWidth) / float32(n-1)
+		for ch := range tape.nchannels {
+			center := (float32(ch) + 0.5) * laneHeight
+			zero := []PointVertex{{[2]float32{0, center}}, {[2]float32{float32(pixelWidth), center}}}
+			drawLines(gl.LINES, zero, gridColor)
+			for i := range n {
+				smp := min(max(float32(tape.samples[(start+i)*tape.nchannels+ch]), -1), 1)
+				verts[i].position = [2]float32{float32(i) * xScale, center - smp*laneHeight/2}
+			}
+			drawLines(gl.LINE_STRIP, verts, [4]float32{0.4, 1.0, 0.5, 0.9})
+		}
+	}
+	gl.Disable(gl.BLEND)
+	gl.DisableVertexAttribArray(uint32(td.a_position))
+}
+
+// RenderWavetable draws the waves of a wavetable level as a stacked 3D
+// wireframe (see wtView), fading towards the back. If morph is not
+// negative, the wave at that morph position is drawn highlighted at
+// its depth.
+func (td *TapeDisplay) RenderWavetable(waves Waveset, morph float64, pixelRect Rect) {
+	pixelWidth, pixelHeight := pixelRect.Dx(), pixelRect.Dy()
+	if pixelWidth == 0 || pixelHeight == 0 || len(waves) == 0 {
+		return
+	}
+	view := makeWtView(float32(pixelWidth), float32(pixelHeight), min(pixelWidth/2, waves[0].nframes))
+	mTransform := pixelTransform(pixelRect)
+	td.program.Use()
+	gl.UniformMatrix4fv(td.u_transform, 1, false, &mTransform[0])
+	gl.Enable(gl.BLEND)
+	gl.BlendFunc(gl.SRC_ALPHA, gl.ONE_MINUS_SRC_ALPHA)
+	gl.EnableVertexAttribArray(uint32(td.a_position))
+	stride := int32(unsafe.Sizeof(PointVertex{}))
+	if cap(td.scopeVertices) < view.npoints {
+		td.scopeVertices = make([]PointVertex, view.npoints)
+	}
+	verts := td.scopeVertices[:view.npoints]
+	drawLine := func(z float64, sample func(i int) float64, color [4]float32) {
+		for i := range verts {
+			x, y := view.project(i, sample(i), z)
+			verts[i].position = [2]float32{x, y}
+		}
+		gl.Uniform4f(td.u_color, color[0], color[1], color[2], color[3])
+		gl.VertexAttribPointer(uint32(td.a_position), 2, gl.FLOAT, false, stride, gl.Ptr(&verts[0].position[0]))
+		gl.DrawArrays(gl.LINE_STRIP, 0, int32(len(verts)))
+	}
+	td.setLineWidth(1.0)
+	n := len(waves)
+	for _, w := range shownWaves(n) {
+		z := waveDepth(w, n)
+		alpha := float32(0.9 - 0.6*z)
+		drawLine(z, func(i int) float64 { return waveAt(waves[w], i, view.npoints) }, [4]float32{0.4, 1.0, 0.5, alpha})
+	}
+	if morph >= 0 {
+		td.setLineWidth(2.0)
+		drawLine(morph, func(i int) float64 { return morphAtPoint(waves, morph, i, view.npoints) }, [4]float32{1.0, 0.6, 0.2, 1.0})
+	}
+	gl.Disable(gl.BLEND)
+	gl.DisableVertexAttribArray(uint32(td.a_position))
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"slices"
+)
+
+// Waveform editor operations. All of them leave their input alone and
+// return a new tape.
+
+// Reverse returns t played backwards.
+func (t *Tape) Reverse() *Tape {
+	nc := t.nchannels
+	out := makeTape(nc, t.nframes)
+	for i := range t.nframes {
+		copy(out.samples[i*nc:(i+1)*nc], t.samples[(t.nframes-1-i)*nc:])
+	}
+	return out
+}
+
+// Fade returns t with its first (fade in) or last (fade out) nframes
+// frames multiplied by a gain going from 0 to 1 (or 1 to 0). The gain
+// is x^curve where x goes linearly between 0 and 1: curve 1 gives a
+// linear fade, larger values a slower start, smaller ones a faster one.
+func (t *Tape) Fade(nframes int, curve float64, out bool) *Tape {
+	result := t.Copy()
+	nc := t.nchannels
+	nframes = min(max(nframes, 0), t.nframes)
+	for i := range nframes {
+		gain := math.Pow(float64(i)/float64(nframes), curve)
+		frame := i
+		if out {
+			frame = t.nframes - 1 - i
+		}
+		for ch := range nc {
+			result.samples[frame*nc+ch] *= gain
+		}
+	}
+	return result
+}
+
+// Peak returns the largest absolute sample value of t.
+func (t *Tape) Peak() float64 {
+	peak := 0.0
+	for _, smp := range t.samples {
+		peak = max(peak, math.Abs(smp))
+	}
+	return peak
+}
+
+// RMS returns the root mean square of all samples of t.
+func (t *Tape) RMS() float64 {
+	if len(t.samples) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, smp := range t.samples {
+		sum += smp * smp
+	}
+	return math.Sqrt(sum / float64(len(t.samples)))
+}
+
+// Gain returns t with all samples multiplied by gain.
+func (t *Tape) Gain(gain float64) *Tape {
+	result := t.Copy()
+	for i := range result.samples {
+		result.samples[i] *= gain
+	}
+	return result
+}
+
+// Normalize scales t so that its peak (or, if rms, its RMS level)
+// becomes level. Silent tapes are returned unchanged.
+func (t *Tape) Normalize(level float64, rms bool) *Tape {
+	current := t.Peak()
+	if rms {
+		current = t.RMS()
+	}
+	if current == 0 {
+		return t.Copy()
+	}
+	return t.Gain(level / current)
+}
+
+// TrimSilence returns t without the leading and trailing frames in
+// which no channel exceeds threshold in absolute value.
+func (t *Tape) TrimSilence(threshold float64) *Tape {
+	nc := t.nchannels
+	loud := func(frame int) bool {
+		return slices.ContainsFunc(t.samples[frame*nc:(frame+1)*nc], func(smp Smp) bool {
+			return math.Abs(smp) > threshold
+		})
+	}
+	start := 0
+	for start < t.nframes && !loud(start) {
+		start++
+	}
+	end := t.nframes
+	for end > start && !loud(end-1) {
+		end--
+	}
+	return t.slice(start, end)
+}
+
+// Insert returns t with the frames of other spliced in before frame
+// (converted to the channel count of t).
+func (t *Tape) Insert(other *Tape, frame int) (*Tape, error) {
+	if frame < 0 || frame > t.nframes {
+		return nil, fmt.Errorf("frame %d out of range [0,%d]", frame, t.nframes)
+	}
+	nc := t.nchannels
+	inserted := other.Stream().WithNChannels(nc).Take(nil, other.nframes)
+	if inserted.nchannels != nc {
+		return nil, fmt.Errorf("cannot insert %d channels into %d", other.nchannels, nc)
+	}
+	out := makeTape(nc, t.nframes+other.nframes)
+	n := copy(out.samples, t.samples[:frame*nc])
+	n += copy(out.samples[n:], inserted.samples)
+	copy(out.samples[n:], t.samples[frame*nc:])
+	return out, nil
+}
+
+// spliceAlignWindow is how far splice looks for a zero crossing at
+// each junction, in seconds.
+const spliceAlignWindow = 0.02
+
+// crossfadeCurve gives the gains of the incoming and the outgoing side
+// of a crossfade at x, going from 0 to 1.
+type crossfadeCurve func(x float64) (in, out float64)
+
+var crossfadeCurves = map[Str]crossfadeCurve{
+	"linear": func(x float64) (float64, float64) { return x, 1 - x },
+	"equal-power": func(x float64) (float64, float64) {
+		return math.Sin(x * math.Pi / 2), math.Cos(x * math.Pi / 2)
+	},
+	"s-curve": func(x float64) (float64, float64) {
+		in := 0.5 - 0.5*math.Cos(x*math.Pi)
+		return in, 1 - in
+	},
+}
+
+// spliceJoint is the crossfade of a splice junction: nframes long, with
+// the gains of curve.
+type spliceJoint struct {
+	nframes int
+	curve   crossfadeCurve
+}
+
+// lastRisingZeroCrossing returns the last frame of the mono tape t in
+// [start,end) which is not negative while the frame before it is, or end
+// if there is none.
+func (t *Tape) lastRisingZeroCrossing(start, end int) int {
+	for i := min(end, t.nframes) - 1; i >= max(start, 1); i-- {
+		if t.samples[i-1] < 0 && t.samples[i] >= 0 {
+			return i
+		}
+	}
+	return end
+}
+
+// Splice joins tapes one after the other, crossfading each into the
+// next with the joint between them (converted to the largest channel
+// count). A crossfade is no longer than the tapes it joins have room
+// for. With align, the end of each tape before a junction and the start
+// of the tape after it are trimmed to the nearest rising zero crossing,
+// so that the tapes meet where one goes up through zero.
+func Splice(tapes []*Tape, joints []spliceJoint, align bool) *Tape {
+	nc := 1
+	for _, t := range tapes {
+		nc = max(nc, t.nchannels)
+	}
+	window := int(spliceAlignWindow * float64(SampleRate()))
+	parts := make([]*Tape, len(tapes))
+	for i, t := range tapes {
+		start, end := 0, t.nframes
+		if align {
+			mono := t.monoSum()
+			if i > 0 {
+				start = int(math.Ceil(mono.risingZeroCrossing(0, float64(window))))
+			}
+			if i < len(tapes)-1 {
+				end = max(mono.lastRisingZeroCrossing(t.nframes-window, t.nframes), start)
+			}
+		}
+		parts[i] = t.slice(start, end).Stream().WithNChannels(nc).Take(nil, end-start)
+	}
+	// fit the crossfades into the tapes, each one taking its frames
+	// from those the crossfade before left free
+	fades := make([]int, len(joints))
+	free := parts[0].nframes
+	for i, j := range joints {
+		fades[i] = min(max(j.nframes, 0), free, parts[i+1].nframes)
+		free = parts[i+1].nframes - fades[i]
+	}
+	total := 0
+	for _, p := range parts {
+		total += p.nframes
+	}
+	for _, n := range fades {
+		total -= n
+	}
+	out := makeTape(nc, total)
+	pos := copy(out.samples, parts[0].samples) / nc
+	for i, p := range parts[1:] {
+		n := fades[i]
+		start := pos - n
+		for k := range p.nframes {
+			dst := out.samples[(start+k)*nc : (start+k+1)*nc]
+			src := p.samples[k*nc : (k+1)*nc]
+			if k < n {
+				in, fadeOut := joints[i].curve((float64(k) + 0.5) / float64(n))
+				for ch := range nc {
+					dst[ch] = dst[ch]*fadeOut + src[ch]*in
+				}
+			} else {
+				copy(dst, src)
+			}
+		}
+		pos = start + p.nframes
+	}
+	return out
+}
+
+// crossfadeCurveFromVal returns the crossfade curve named by v.
+func crossfadeCurveFromVal(v Val) (crossfadeCurve, error) {
+	name, ok := v.(Str)
+	if !ok {
+		return nil, fmt.Errorf("crossfade curve must be a string, got %v", v)
+	}
+	curve, ok := crossfadeCurves[name]
+	if !ok {
+		return nil, fmt.Errorf(`crossfade curve must be "linear", "equal-power" or "s-curve", got %q`, string(name))
+	}
+	return curve, nil
+}
+
+// spliceJoints returns the n joints given by v: a number of frames for
+// all of them, or a vector with a number of frames or a [frames curve]
+// pair for each. The curve defaults to curve.
+func spliceJoints(v Val, n int, curve crossfadeCurve) ([]spliceJoint, error) {
+	joint := func(item Val) (spliceJoint, error) {
+		switch x := item.(type) {
+		case Num:
+			return spliceJoint{int(x), curve}, nil
+		case Vec:
+			if len(x) == 2 {
+				if frames, ok := x[0].(Num); ok {
+					c, err := crossfadeCurveFromVal(x[1])
+					return spliceJoint{int(frames), c}, err
+				}
+			}
+		}
+		return spliceJoint{}, fmt.Errorf("expected frames or [frames curve], got %v", item)
+	}
+	joints := make([]spliceJoint, n)
+	if v, ok := v.(Vec); ok && (len(v) != 2 || !isStr(v[1])) {
+		if len(v) != n {
+			return nil, fmt.Errorf("%d crossfades for %d junctions", len(v), n)
+		}
+		for i, item := range v {
+			j, err := joint(item)
+			if err != nil {
+				return nil, err
+			}
+			joints[i] = j
+		}
+		return joints, nil
+	}
+	j, err := joint(v)
+	if err != nil {
+		return nil, err
+	}
+	for i := range joints {
+		joints[i] = j
+	}
+	return joints, nil
+}
+
+func isStr(v Val) bool {
+	_, ok := v.(Str)
+	return ok
+}
+
+func getFadeCurve(vm *VM) (float64, error) {
+	if v := vm.GetVal(":fade/curve"); v != nil {
+		if n, ok := v.(Num); ok && n > 0 {
+			return float64(n), nil
+		}
+		return 0, fmt.Errorf(":fade/curve must be a positive number")
+	}
+	return 1, nil
+}
+
+func init() {
+	RegisterGoMethod[*Tape]("reverse", (*Tape).Reverse)
+	RegisterGoMethod[*Tape]("fadein", func(vm *VM, t *Tape, nframes int) (*Tape, error) {
+		curve, err := getFadeCurve(vm)
+		if err != nil {
+			return nil, err
+		}
+		return t.Fade(nframes, curve, false), nil
+	})
+	RegisterGoMethod[*Tape]("fadeout", func(vm *VM, t *Tape, nframes int) (*Tape, error) {
+		curve, err := getFadeCurve(vm)
+		if err != nil {
+			return nil, err
+		}
+		return t.Fade(nframes, curve, true), nil
+	})
+	RegisterGoMethod[*Tape]("normalize", func(t *Tape, level float64) *Tape {
+		return t.Normalize(level, false)
+	})
+	RegisterGoMethod[*Tape]("normalize/rms", func(t *Tape, level float64) *Tape {
+		return t.Normalize(level, true)
+	})
+	RegisterGoMethod[*Tape]("trim-silence", func(vm *VM, t *Tape) (*Tape, error) {
+		threshold := 0.001
+		if v := vm.GetVal(":trim/threshold"); v != nil {
+			n, ok := v.(Num)
+			if !ok {
+				return nil, fmt.Errorf(":trim/threshold must be number")
+			}
+			threshold = float64(n)
+		}
+		return t.TrimSilence(threshold), nil
+	})
+	RegisterGoMethod[*Tape]("insert", (*Tape).Insert)
+	RegisterWord("splice", func(vm *VM) error {
+		xfade := vm.Pop()
+		v, err := Pop[Vec](vm)
+		if err != nil {
+			return err
+		}
+		if len(v) == 0 {
+			return fmt.Errorf("splice: no tapes")
+		}
+		tapes := make([]*Tape, len(v))
+		for i, item := range v {
+			tp, ok := item.(TapeProvider)
+			if !ok {
+				return fmt.Errorf("splice: item %d is not a tape: %v", i, item)
+			}
+			tapes[i] = tp.Tape()
+		}
+		curve := crossfadeCurves["equal-power"]
+		if v := vm.GetVal(":splice/curve"); v != nil {
+			curve, err = crossfadeCurveFromVal(v)
+			if err != nil {
+				return fmt.Errorf("splice: :splice/curve: %w", err)
+			}
+		}
+		joints, err := spliceJoints(xfade, len(tapes)-1, curve)
+		if err != nil {
+			return fmt.Errorf("splice: %w", err)
+		}
+		align := false
+		if v := vm.GetVal(":splice/align"); v != nil {
+			n, ok := v.(Num)
+			if !ok {
+				return fmt.Errorf("splice: :splice/align must be a boolean, got %v", v)
+			}
+			align = n != 0
+		}
+		vm.Push(Splice(tapes, joints, align))
+		return nil
+	})
+}
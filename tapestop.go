@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// tapeStopFade is the length in frames of the fades which keep the
+// performance effects from clicking when they end.
+const tapeStopFade = 64
+
+// TapeStop plays input, and from each rising edge of gate on, slows it
+// down to a halt over length frames like a tape machine or a turntable
+// losing power: the playback rate falls exponentially from 1 and the
+// sound stops at length frames. When gate falls, input plays again.
+func TapeStop(input, gate Stream, length int) Stream {
+	nch := input.nchannels
+	return makeTransformStreamN(nch, []Stream{input, gate}, func(inputs []Stream) Stepper {
+		inext := inputs[0].WithNChannels(nch).Next
+		gnext := inputs[1].Mono().Next
+		// the read position falls behind by less than length frames
+		buf := make([]Smp, (length+2)*nch) // circular
+		n := length + 2
+		writePos := 0
+		gateOn := false
+		t := 0         // frames since the stop started
+		readPos := 0.0 // frames behind writePos
+		rate := 1.0
+		decay := math.Exp(-5 / float64(length)) // rate is below 1% at the end
+		since := tapeStopFade                   // frames since the stop ended
+		out := make(Frame, nch)
+		return func() (Frame, bool) {
+			frame, ok := inext()
+			if !ok {
+				return nil, false
+			}
+			g, ok := gnext()
+			if !ok {
+				return nil, false
+			}
+			copy(buf[writePos*nch:], frame)
+			on := g[0] > 0
+			if on && !gateOn {
+				t, readPos, rate = 0, 0, 1
+			} else if !on && gateOn {
+				since = 0
+			}
+			gateOn = on
+			switch {
+			case on && t < length:
+				// the oldest frame read is length frames behind
+				gain := Smp(min(1, float64(length-t)/tapeStopFade))
+				for ch := range nch {
+					out[ch] = gain * delayTap(buf, nch, ch, writePos, readPos)
+				}
+				readPos += 1 - rate
+				rate *= decay
+				t++
+			case on:
+				clear(out)
+			default:
+				gain := Smp(min(1, float64(since+1)/tapeStopFade))
+				for ch := range nch {
+					out[ch] = gain * frame[ch]
+				}
+				since++
+			}
+			writePos = (writePos + 1) % n
+			return out, true
+		}
+	})
+}
+
+// RevFreeze plays input, and from each rising edge of gate on, plays the
+// length frames before it backwards, over and over, until gate falls.
+func RevFreeze(input, gate Stream, length int) Stream {
+	nch := input.nchannels
+	return makeTransformStreamN(nch, []Stream{input, gate}, func(inputs []Stream) Stepper {
+		inext := inputs[0].WithNChannels(nch).Next
+		gnext := inputs[1].Mono().Next
+		capture := make([]Smp, length*nch) // circular
+		writePos := 0
+		frozen := make([]Smp, length*nch) // the frozen frames, newest first
+		gateOn := false
+		pos := 0              // frame in frozen
+		loops := 0            // times frozen has played through
+		since := tapeStopFade // frames since the freeze ended
+		out := make(Frame, nch)
+		return func() (Frame, bool) {
+			frame, ok := inext()
+			if !ok {
+				return nil, false
+			}
+			g, ok := gnext()
+			if !ok {
+				return nil, false
+			}
+			on := g[0] > 0
+			if on && !gateOn {
+				for i := range length {
+					j := (writePos - 1 - i + 2*length) % length
+					copy(frozen[i*nch:(i+1)*nch], capture[j*nch:])
+				}
+				pos, loops = 0, 0
+			} else if !on && gateOn {
+				since = 0
+			}
+			gateOn = on
+			if on {
+				// the first time through continues from the input, then
+				// the loop point is faded
+				gain := min(1, float64(length-pos)/tapeStopFade)
+				if loops > 0 {
+					gain = min(gain, float64(pos+1)/tapeStopFade)
+				}
+				for ch := range nch {
+					out[ch] = Smp(gain) * frozen[pos*nch+ch]
+				}
+				if pos++; pos == length {
+					pos = 0
+					loops++
+				}
+			} else {
+				gain := Smp(min(1, float64(since+1)/tapeStopFade))
+				for ch := range nch {
+					out[ch] = gain * frame[ch]
+				}
+				since++
+			}
+			// the capture follows the input, not the freeze
+			copy(capture[writePos*nch:], frame)
+			writePos = (writePos + 1) % length
+			return out, true
+		}
+	})
+}
+
+// performanceLength returns the length in frames of a performance
+// effect from its env key in beats.
+func performanceLength(vm *VM, word, key string) (int, error) {
+	bpm, err := getBPM(vm, word)
+	if err != nil {
+		return 0, err
+	}
+	beats, err := vm.GetFloat(key)
+	if err != nil {
+		return 0, err
+	}
+	if beats <= 0 {
+		return 0, fmt.Errorf("%s: %s must be positive, got %v", word, key, beats)
+	}
+	return max(int(math.Round(beats*60/bpm*float64(SampleRate()))), 1), nil
+}
+
+func init() {
+	RegisterWord("tapestop", func(vm *VM) error {
+		gate, err := streamFromVal(vm.Pop())
+		if err != nil {
+			return err
+		}
+		input, err := streamFromVal(vm.Pop())
+		if err != nil {
+			return err
+		}
+		length, err := performanceLength(vm, "tapestop", ":tapestop/beats")
+		if err != nil {
+			return err
+		}
+		vm.Push(TapeStop(input, gate, length))
+		return nil
+	})
+	RegisterWord("revfreeze", func(vm *VM) error {
+		gate, err := streamFromVal(vm.Pop())
+		if err != nil {
+			return err
+		}
+		input, err := streamFromVal(vm.Pop())
+		if err != nil {
+			return err
+		}
+		length, err := performanceLength(vm, "revfreeze", ":revfreeze/beats")
+		if err != nil {
+			return err
+		}
+		vm.Push(RevFreeze(input, gate, length))
+		return nil
+	})
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// scriptTemplate is a starting point for a new script, read from
+// assets/templates/<name>.tape.
+type scriptTemplate struct {
+	name string
+	help string
+}
+
+var scriptTemplates = []scriptTemplate{
+	{"song", "an empty song: sounds, parts of a few bars and their arrangement"},
+	{"drums", "a drum loop: kick, snare and hi-hat arranged on the beats of a bar"},
+	{"ambient", "an ambient patch: a chord of detuned saws, a drifting lowpass and an ensemble"},
+	{"chain", "a sample-processing chain: a sample through a highpass, an echo and an ensemble"},
+}
+
+// templateNames returns the names of the templates.
+func templateNames() []string {
+	names := make([]string, len(scriptTemplates))
+	for i, t := range scriptTemplates {
+		names[i] = t.name
+	}
+	return names
+}
+
+// templateVars are the values of the placeholders of the templates:
+// {{name}}, {{bpm}} and {{sample}}.
+type templateVars struct {
+	name   string  // title of the script
+	bpm    float64 // tempo
+	sample string  // file loaded by the chain template, "" for a stand-in
+}
+
+// sampleStandIn is the sound processed by the chain template when no
+// sample is given.
+const sampleStandIn = "( 0.001s 0.5s perc ~noise * ) 1s take"
+
+// expandTemplate returns the template called name with its placeholders
+// replaced by vars.
+func expandTemplate(name string, vars templateVars) ([]byte, error) {
+	src, err := assets.ReadFile("assets/templates/" + name + ".tape")
+	if err != nil {
+		return nil, fmt.Errorf("unknown template %q, expected one of: %s", name, strings.Join(templateNames(), ", "))
+	}
+	sample := sampleStandIn
+	if vars.sample != "" {
+		sample = tapeString(vars.sample) + " load"
+	}
+	r := strings.NewReplacer(
+		"{{name}}", vars.name,
+		"{{bpm}}", strconv.FormatFloat(vars.bpm, 'g', -1, 64),
+		"{{sample}}", sample,
+	)
+	return []byte(r.Replace(string(src))), nil
+}
+
+// tapeString returns s as a string literal of the DSL, which does not
+// interpret escapes: a raw string if s has quotes or backslashes.
+func tapeString(s string) string {
+	if strings.ContainsAny(s, "\"\\") {
+		return "`" + s + "`"
+	}
+	return `"` + s + `"`
+}
+
+// runNew writes a new script from a template to each file in args,
+// refusing to overwrite existing files.
+func runNew(args []string, template, sample string, list bool) error {
+	if list {
+		for _, t := range scriptTemplates {
+			fmt.Printf("%-8s %s\n", t.name, t.help)
+		}
+		return nil
+	}
+	if len(args) == 0 {
+		return errors.New("new: give the file to create")
+	}
+	for _, path := range args {
+		if filepath.Ext(path) == "" {
+			path += ".tape"
+		}
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		data, err := expandTemplate(template, templateVars{name: name, bpm: flags.BPM, sample: sample})
+		if err != nil {
+			return err
+		}
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(data)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s: new %s script\n", path, template)
+	}
+	return nil
+}
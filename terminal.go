@@ -0,0 +1,323 @@
+//go:build cgo && !js
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image/color"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+)
+
+// terminalInput is a key press read from the terminal. Printable
+// keys also carry the typed character, which is delivered after the
+// key (like GLFW does) so that key chords can swallow it.
+type terminalInput struct {
+	key  Key
+	char rune
+}
+
+// charKeyName returns the name GLFW would give to the key typing r on
+// a US keyboard layout.
+func charKeyName(r rune) Key {
+	switch {
+	case r == ' ':
+		return "Space"
+	case r >= 'A' && r <= 'Z':
+		return Key("S-" + string(r-'A'+'a'))
+	}
+	return Key(string(r))
+}
+
+// escape sequences of special keys, as sent by xterm compatible terminals
+var terminalKeySequences = map[string]Key{
+	"[A": "Up", "[B": "Down", "[C": "Right", "[D": "Left",
+	"OA": "Up", "OB": "Down", "OC": "Right", "OD": "Left",
+	"[H": "Home", "[F": "End", "OH": "Home", "OF": "End",
+	"[1~": "Home", "[4~": "End", "[7~": "Home", "[8~": "End",
+	"[2~": "Insert", "[3~": "Delete", "[5~": "PageUp", "[6~": "PageDown",
+	"OP": "F1", "OQ": "F2", "OR": "F3", "OS": "F4",
+	"[11~": "F1", "[12~": "F2", "[13~": "F3", "[14~": "F4",
+	"[15~": "F5", "[17~": "F6", "[18~": "F7", "[19~": "F8",
+	"[20~": "F9", "[21~": "F10", "[23~": "F11", "[24~": "F12",
+}
+
+// terminalModifiers maps the xterm modifier parameter to key name prefixes.
+var terminalModifiers = map[string]string{
+	"2": "S-", "3": "M-", "4": "M-S-", "5": "C-", "6": "C-S-", "7": "C-M-", "8": "C-M-S-",
+}
+
+// decodeTerminalKey decodes the escape sequence following ESC in seq
+// (e.g. "[1;5C" for C-Right) into a key name.
+func decodeTerminalKey(seq string) (Key, bool) {
+	if key, ok := terminalKeySequences[seq]; ok {
+		return key, true
+	}
+	// modified keys: CSI 1 ; mod X or CSI n ; mod ~
+	if params, final, ok := strings.Cut(seq[1:], ";"); ok && len(final) >= 2 {
+		prefix, ok := terminalModifiers[final[:len(final)-1]]
+		if !ok {
+			return "", false
+		}
+		last := final[len(final)-1:]
+		base := "[" + params + last
+		if last != "~" {
+			base = "[" + last
+		}
+		if key, ok := terminalKeySequences[base]; ok {
+			return Key(prefix + key), true
+		}
+	}
+	return "", false
+}
+
+// decodeTerminalInput splits the bytes of one read from the terminal
+// into key presses and characters.
+func decodeTerminalInput(buf []byte) []terminalInput {
+	var inputs []terminalInput
+	for len(buf) > 0 {
+		b := buf[0]
+		switch {
+		case b == 0x1b:
+			if len(buf) == 1 {
+				inputs = append(inputs, terminalInput{key: "Escape"})
+				buf = buf[1:]
+				continue
+			}
+			if buf[1] == '[' || buf[1] == 'O' {
+				// CSI/SS3: parameters up to the final byte
+				end := 2
+				for end < len(buf) && (buf[end] < 0x40 || buf[end] > 0x7e) {
+					end++
+				}
+				if end < len(buf) {
+					if key, ok := decodeTerminalKey(string(buf[1 : end+1])); ok {
+						inputs = append(inputs, terminalInput{key: key})
+					}
+					buf = buf[end+1:]
+					continue
+				}
+			}
+			// ESC x is how terminals send M-x
+			for _, in := range decodeTerminalInput(buf[1:2]) {
+				inputs = append(inputs, terminalInput{key: "M-" + in.key})
+			}
+			buf = buf[2:]
+		case b == '\r':
+			inputs = append(inputs, terminalInput{key: "Enter"})
+			buf = buf[1:]
+		case b == '\n':
+			// C-Enter cannot be told apart from Enter, but C-j can
+			inputs = append(inputs, terminalInput{key: "C-Enter"})
+			buf = buf[1:]
+		case b == '\t':
+			inputs = append(inputs, terminalInput{key: "Tab"})
+			buf = buf[1:]
+		case b == 0x7f || b == 0x08:
+			inputs = append(inputs, terminalInput{key: "Backspace"})
+			buf = buf[1:]
+		case b == 0:
+			inputs = append(inputs, terminalInput{key: "C-Space"})
+			buf = buf[1:]
+		case b < 0x20:
+			if b <= 26 {
+				inputs = append(inputs, terminalInput{key: Key("C-" + string(rune('a'+b-1)))})
+			} else if b == 0x1f {
+				inputs = append(inputs, terminalInput{key: "C-S--"})
+			}
+			buf = buf[1:]
+		default:
+			r, size := utf8.DecodeRune(buf)
+			inputs = append(inputs, terminalInput{key: charKeyName(r), char: r})
+			buf = buf[size:]
+		}
+	}
+	return inputs
+}
+
+// terminalScreen writes the cells of a text TileScreen to the
+// terminal, redrawing only the rows which changed since the last frame.
+type terminalScreen struct {
+	out       *os.File
+	trueColor bool
+	prev      []TextCell
+	size      Size
+	frame     bytes.Buffer
+}
+
+// terminalHasTrueColor reports whether the terminal advertises 24-bit
+// color support via $COLORTERM. Over SSH this is often not forwarded,
+// in which case colors are approximated with the xterm 256 color palette.
+func terminalHasTrueColor() bool {
+	switch os.Getenv("COLORTERM") {
+	case "truecolor", "24bit":
+		return true
+	}
+	return false
+}
+
+// xterm256Color returns the index of the color of the xterm 256 color
+// palette (6x6x6 cube or gray ramp) closest to c.
+func xterm256Color(c color.RGBA) int {
+	cubeIndex := func(v uint8) int {
+		switch {
+		case v < 48:
+			return 0
+		case v < 115:
+			return 1
+		}
+		return min(5, (int(v)-35)/40)
+	}
+	cubeLevel := func(i int) int {
+		if i == 0 {
+			return 0
+		}
+		return 55 + i*40
+	}
+	dist := func(r, g, b int) int {
+		dr, dg, db := r-int(c.R), g-int(c.G), b-int(c.B)
+		return dr*dr + dg*dg + db*db
+	}
+	ri, gi, bi := cubeIndex(c.R), cubeIndex(c.G), cubeIndex(c.B)
+	cube := 16 + 36*ri + 6*gi + bi
+	cubeDist := dist(cubeLevel(ri), cubeLevel(gi), cubeLevel(bi))
+	avg := (int(c.R) + int(c.G) + int(c.B)) / 3
+	grayIndex := min(23, max(0, (avg-3)/10))
+	grayLevel := 8 + grayIndex*10
+	if dist(grayLevel, grayLevel, grayLevel) < cubeDist {
+		return 232 + grayIndex
+	}
+	return cube
+}
+
+func (t *terminalScreen) sgrColor(c Color, base int) string {
+	rgba := color.RGBAModel.Convert(c).(color.RGBA)
+	if !t.trueColor {
+		return fmt.Sprintf("\x1b[%d;5;%dm", base, xterm256Color(rgba))
+	}
+	return fmt.Sprintf("\x1b[%d;2;%d;%d;%dm", base, rgba.R, rgba.G, rgba.B)
+}
+
+func (t *terminalScreen) draw(ts *TileScreen) error {
+	if t.size != ts.size {
+		t.size = ts.size
+		t.prev = nil
+		t.frame.WriteString("\x1b[2J")
+	}
+	b := &t.frame
+	var fg, bg Color
+	for y := range ts.size.Y {
+		row := ts.cells[y*ts.size.X : (y+1)*ts.size.X]
+		if t.prev != nil && rowsEqual(row, t.prev[y*ts.size.X:(y+1)*ts.size.X]) {
+			continue
+		}
+		fmt.Fprintf(b, "\x1b[%d;1H", y+1)
+		for _, cell := range row {
+			if cell.r == 0 {
+				// second half of a wide rune
+				continue
+			}
+			if cell.fg != fg {
+				fg = cell.fg
+				b.WriteString(t.sgrColor(fg, 38))
+			}
+			if cell.bg != bg {
+				bg = cell.bg
+				b.WriteString(t.sgrColor(bg, 48))
+			}
+			b.WriteRune(cell.r)
+		}
+	}
+	t.prev = append(t.prev[:0], ts.cells...)
+	if b.Len() == 0 {
+		return nil
+	}
+	b.WriteString("\x1b[0m")
+	_, err := t.out.Write(b.Bytes())
+	b.Reset()
+	return err
+}
+
+func rowsEqual(a, b []TextCell) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// WithTerminal runs app in the controlling terminal, drawing its
+// screens as text. This is the frontend of -safe mode and the
+// fallback when OpenGL cannot be used.
+func WithTerminal(app *App) error {
+	term, err := openTerminal()
+	if err != nil {
+		return err
+	}
+	defer term.restore()
+	size, err := term.size()
+	if err != nil {
+		return err
+	}
+	app.textMode = true
+	app.ts = CreateTextScreen(size)
+	if err := app.Init(); err != nil {
+		return err
+	}
+	defer app.Close()
+	input := make(chan []byte)
+	go func() {
+		for {
+			buf := make([]byte, 256)
+			n, err := os.Stdin.Read(buf)
+			if err != nil {
+				close(input)
+				return
+			}
+			input <- buf[:n]
+		}
+	}()
+	screen := &terminalScreen{out: os.Stdout, trueColor: terminalHasTrueColor()}
+	// a hangup (e.g. a dropped SSH connection) or termination ends the
+	// session like a quit, so that journal and view states get saved
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP, syscall.SIGTERM)
+	defer signal.Stop(hangup)
+	frameDuration := time.Second / desiredFPS
+	for app.IsRunning() {
+		if newSize, err := term.size(); err == nil && newSize != app.ts.size {
+			app.ts.Resize(newSize)
+		}
+		if err := app.Render(); err != nil {
+			return err
+		}
+		if err := screen.draw(app.ts); err != nil {
+			return err
+		}
+		select {
+		case buf, ok := <-input:
+			if !ok {
+				return nil
+			}
+			for _, in := range decodeTerminalInput(buf) {
+				app.dispatchKey(in.key)
+				if in.char != 0 {
+					app.OnChar(in.char)
+				}
+			}
+		case <-hangup:
+			return nil
+		case <-time.After(frameDuration):
+		}
+		if err := app.Update(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || js)
+
+package main
+
+import "fmt"
+
+type rawTerminal struct{}
+
+func openTerminal() (*rawTerminal, error) {
+	return nil, fmt.Errorf("the terminal frontend is not supported on this platform")
+}
+
+func (t *rawTerminal) size() (Size, error) {
+	return Size{}, nil
+}
+
+func (t *rawTerminal) restore() {}
@@ -0,0 +1,62 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// rawTerminal is the controlling terminal switched to raw mode.
+type rawTerminal struct {
+	fd    uintptr
+	saved syscall.Termios
+}
+
+func ioctl(fd, req uintptr, arg unsafe.Pointer) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(arg)); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// openTerminal puts the terminal on stdin into raw mode and switches
+// to the alternate screen.
+func openTerminal() (*rawTerminal, error) {
+	t := &rawTerminal{fd: os.Stdin.Fd()}
+	if err := ioctl(t.fd, ioctlGetTermios, unsafe.Pointer(&t.saved)); err != nil {
+		return nil, fmt.Errorf("stdin is not a terminal: %w", err)
+	}
+	raw := t.saved
+	raw.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP |
+		syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	raw.Oflag &^= syscall.OPOST
+	raw.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	raw.Cflag &^= syscall.CSIZE | syscall.PARENB
+	raw.Cflag |= syscall.CS8
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	if err := ioctl(t.fd, ioctlSetTermios, unsafe.Pointer(&raw)); err != nil {
+		return nil, err
+	}
+	// alternate screen, hide cursor
+	os.Stdout.WriteString("\x1b[?1049h\x1b[?25l")
+	return t, nil
+}
+
+func (t *rawTerminal) size() (Size, error) {
+	var ws struct {
+		Row, Col, Xpixel, Ypixel uint16
+	}
+	if err := ioctl(os.Stdout.Fd(), syscall.TIOCGWINSZ, unsafe.Pointer(&ws)); err != nil {
+		return Size{}, err
+	}
+	return Size{X: int(ws.Col), Y: int(ws.Row)}, nil
+}
+
+func (t *rawTerminal) restore() {
+	os.Stdout.WriteString("\x1b[0m\x1b[?25h\x1b[?1049l")
+	ioctl(t.fd, ioctlSetTermios, unsafe.Pointer(&t.saved))
+}
@@ -0,0 +1,341 @@
+//go:build cgo && !js
+
+package main
+
+import (
+	"image/color"
+	"math"
+)
+
+// createTapeDisplay returns a GL tape display, or nil in text mode.
+func (app *App) createTapeDisplay() (*TapeDisplay, error) {
+	if app.textMode {
+		return nil, nil
+	}
+	return CreateTapeDisplay()
+}
+
+// renderTapeView shows a window of tape in pane: via td if there is
+// one (GL), otherwise as text (text mode). If spectral is set, the
+// spectrogram of each channel is shown instead of its waveform.
+func renderTapeView(pane TilePane, td *TapeDisplay, tape *Tape, windowSize, windowOffset int, playheadFrames []int, spectral bool, sel tapeSelection) {
+	if td != nil {
+		td.Render(tape, pane.GetPixelRect(), windowSize, windowOffset, playheadFrames, spectral, sel)
+		return
+	}
+	if spectral {
+		drawSpectrogramText(pane, tape, windowSize, windowOffset, playheadFrames, sel)
+		return
+	}
+	drawTapeText(pane, tape, windowSize, windowOffset, playheadFrames, sel)
+}
+
+// renderLevelMeter shows the levels of m in pane, via td if there is
+// one (GL), otherwise as text.
+func renderLevelMeter(pane TilePane, td *TapeDisplay, m *LevelMeter) {
+	if td != nil {
+		td.RenderMeter(m, pane.GetPixelRect())
+		return
+	}
+	drawMeterText(pane, m)
+}
+
+var meterEighths = []rune(" ▁▂▃▄▅▆▇█")
+
+// meterTextColor returns the color of a text level meter at db.
+func meterTextColor(db float64) Color {
+	switch {
+	case db > -3:
+		return ColorRed
+	case db > -12:
+		return color.RGBA{0x80, 0x80, 0x00, 0xff}
+	default:
+		return ColorGreen
+	}
+}
+
+// drawMeterText draws the peak level of each channel as a vertical bar
+// of eighth blocks colored by zone, with a clip indicator on the top
+// row.
+func drawMeterText(pane TilePane, m *LevelMeter) {
+	width, height := pane.Width(), pane.Height()
+	nc := len(m.Peak)
+	if width <= 0 || height < 2 || nc == 0 {
+		return
+	}
+	pane.Clear()
+	rows := height - 1
+	for ch := range nc {
+		x0 := ch * width / nc
+		w := (ch+1)*width/nc - x0
+		if w > 1 {
+			w-- // gap between channels
+		}
+		eighths := int(math.Round(meterFraction(m.Peak[ch]) * float64(rows*8)))
+		for r := range rows {
+			glyph := meterEighths[min(max(eighths-r*8, 0), 8)]
+			db := meterFloorDB * (1 - (float64(r)+0.5)/float64(rows))
+			pane.WithFgBg(meterTextColor(db), ColorBackground, func() {
+				for x := range w {
+					pane.DrawRune(x0+x, height-1-r, glyph)
+				}
+			})
+		}
+		if m.Clip[ch] {
+			pane.WithFgBg(ColorWhite, ColorRed, func() {
+				for x := range w {
+					pane.DrawRune(x0+x, 0, '!')
+				}
+			})
+		}
+	}
+}
+
+// renderScopeView shows frames [start,start+n) of tape in pane as an
+// oscilloscope (see TapeDisplay.RenderScope).
+func renderScopeView(pane TilePane, td *TapeDisplay, tape *Tape, start, n int, xy bool) {
+	if td != nil {
+		td.RenderScope(tape, start, n, pane.GetPixelRect(), xy)
+		return
+	}
+	drawScopeText(pane, tape, start, n, xy)
+}
+
+// drawScopeText plots the samples of a scope view as dots, one per
+// text cell they fall into.
+func drawScopeText(pane TilePane, tape *Tape, start, n int, xy bool) {
+	width, height := pane.Width(), pane.Height()
+	pane.Clear()
+	start, end := max(start, 0), min(start+n, tape.nframes)
+	if width <= 0 || height <= 0 || tape.nchannels == 0 || end <= start {
+		return
+	}
+	n = end - start
+	toCell := func(v float64, cells int) int {
+		v = min(max(v, -1), 1)
+		return min(int((v+1)/2*float64(cells)), cells-1)
+	}
+	pane.WithFg(ColorGreen, func() {
+		if xy {
+			rch := min(1, tape.nchannels-1)
+			for i := start; i < end; i++ {
+				l := float64(tape.samples[i*tape.nchannels])
+				r := float64(tape.samples[i*tape.nchannels+rch])
+				pane.DrawRune(toCell(l, width), height-1-toCell(r, height), '•')
+			}
+			return
+		}
+		nc := tape.nchannels
+		for ch := range nc {
+			top := ch * height / nc
+			rows := (ch+1)*height/nc - top
+			if rows <= 0 {
+				continue
+			}
+			for x := range width {
+				i := start + x*n/width
+				smp := float64(tape.samples[i*nc+ch])
+				pane.DrawRune(x, top+rows-1-toCell(smp, rows), '•')
+			}
+		}
+	})
+}
+
+// drawSpectrogramText draws the spectrogram of each channel of a window
+// of tape using upper half blocks whose foreground and background
+// colors give two spectrogram rows per text row. Playheads and the
+// edges of the selection are drawn as vertical lines.
+func drawSpectrogramText(pane TilePane, tape *Tape, windowSize, windowOffset int, playheadFrames []int, sel tapeSelection) {
+	width, height := pane.Width(), pane.Height()
+	if width <= 0 || height <= 0 || tape.nchannels == 0 {
+		return
+	}
+	pane.Clear()
+	nc := tape.nchannels
+	incr := float64(windowSize) / float64(width)
+	playheadColumns := make(map[int]bool)
+	for _, frame := range playheadFrames {
+		playheadColumns[int(math.Round(float64(frame-windowOffset)/incr))] = true
+	}
+	selectionColumns := make(map[int]bool)
+	if sel.active() {
+		selectionColumns[int(math.Round(float64(sel.start-windowOffset)/incr))] = true
+		selectionColumns[int(math.Round(float64(sel.end-windowOffset)/incr))-1] = true
+	}
+	for ch := range nc {
+		top := ch * height / nc
+		rows := (ch+1)*height/nc - top
+		if rows <= 0 {
+			continue
+		}
+		values := tape.spectrogram(ch, windowSize, windowOffset, width, 2*rows)
+		for r := range rows {
+			for x := range width {
+				upper := spectrogramColor(values[2*r*width+x])
+				lower := spectrogramColor(values[(2*r+1)*width+x])
+				if playheadColumns[x] || selectionColumns[x] {
+					fg := ColorWhite
+					if !playheadColumns[x] {
+						fg = ColorHighlight
+					}
+					pane.WithFgBg(fg, lower, func() {
+						pane.DrawRune(x, top+r, '│')
+					})
+					continue
+				}
+				pane.WithFgBg(upper, lower, func() {
+					pane.DrawRune(x, top+r, '▀')
+				})
+			}
+		}
+	}
+}
+
+// drawTapeText draws the min/max envelope of each channel of a window
+// of tape using half block characters, giving two vertical steps per
+// text row. Clipped columns are drawn red, playheads highlighted and
+// the selection shaded.
+func drawTapeText(pane TilePane, tape *Tape, windowSize, windowOffset int, playheadFrames []int, sel tapeSelection) {
+	width, height := pane.Width(), pane.Height()
+	if width <= 0 || height <= 0 || tape.nchannels == 0 {
+		return
+	}
+	pane.Clear()
+	nc := tape.nchannels
+	incr := float64(windowSize) / float64(width)
+	playheadColumns := make(map[int]bool)
+	for _, frame := range playheadFrames {
+		playheadColumns[int(math.Round(float64(frame-windowOffset)/incr))] = true
+	}
+	for x := range width {
+		i0 := windowOffset + int(math.Floor(float64(x)*incr))
+		i1 := windowOffset + int(math.Ceil(float64(x+1)*incr))
+		i0 = max(i0, 0)
+		i1 = min(max(i1, i0+1), tape.nframes)
+		bg := ColorBackground
+		if sel.active() && i0 < sel.end && i1 > sel.start {
+			bg = ColorMark
+		}
+		if playheadColumns[x] {
+			bg = ColorHighlight
+		}
+		for ch := range nc {
+			top := ch * height / nc
+			rows := (ch+1)*height/nc - top
+			if rows <= 0 {
+				continue
+			}
+			minVal, maxVal := 0.0, 0.0
+			if i0 < i1 {
+				minVal, maxVal = math.Inf(1), math.Inf(-1)
+				for i := i0; i < i1; i++ {
+					smp := tape.samples[i*nc+ch]
+					minVal = min(minVal, smp)
+					maxVal = max(maxVal, smp)
+				}
+			}
+			fg := ColorText
+			if math.Abs(minVal) > 1 || math.Abs(maxVal) > 1 {
+				fg = ColorRed
+			}
+			// half rows covered by [minVal,maxVal], 0 at the top
+			halves := 2 * rows
+			toHalf := func(v float64) int {
+				v = min(max(v, -1), 1)
+				return min(int((1-v)/2*float64(halves)), halves-1)
+			}
+			h0, h1 := toHalf(maxVal), toHalf(minVal)
+			pane.WithFgBg(fg, bg, func() {
+				for r := range rows {
+					upper := 2*r >= h0 && 2*r <= h1
+					lower := 2*r+1 >= h0 && 2*r+1 <= h1
+					glyph := ' '
+					switch {
+					case upper && lower:
+						glyph = '█'
+					case upper:
+						glyph = '▀'
+					case lower:
+						glyph = '▄'
+					}
+					pane.DrawRune(x, top+r, glyph)
+				}
+			})
+		}
+	}
+}
+
+// renderWavetableView shows the waves of a wavetable level in pane as
+// a stacked 3D wireframe, highlighting the wave at morph unless it is
+// negative (see TapeDisplay.RenderWavetable).
+func renderWavetableView(pane TilePane, td *TapeDisplay, waves Waveset, morph float64) {
+	if td != nil {
+		td.RenderWavetable(waves, morph, pane.GetPixelRect())
+		return
+	}
+	drawWavetableText(pane, waves, morph)
+}
+
+// drawWavetableText plots the waves of a wavetable view as dots, one
+// per text cell they fall into.
+func drawWavetableText(pane TilePane, waves Waveset, morph float64) {
+	width, height := pane.Width(), pane.Height()
+	pane.Clear()
+	if width <= 0 || height <= 0 || len(waves) == 0 {
+		return
+	}
+	view := makeWtView(float32(width), float32(height), width)
+	plot := func(z float64, sample func(i int) float64) {
+		for i := range view.npoints {
+			x, y := view.project(i, sample(i), z)
+			cx, cy := int(x), int(y)
+			if cx >= 0 && cx < width && cy >= 0 && cy < height {
+				pane.DrawRune(cx, cy, '•')
+			}
+		}
+	}
+	n := len(waves)
+	pane.WithFg(ColorGreen, func() {
+		for _, w := range shownWaves(n) {
+			plot(waveDepth(w, n), func(i int) float64 { return waveAt(waves[w], i, view.npoints) })
+		}
+	})
+	if morph >= 0 {
+		pane.WithFg(ColorError, func() {
+			plot(morph, func(i int) float64 { return morphAtPoint(waves, morph, i, view.npoints) })
+		})
+	}
+}
+
+// drawSpectrumText draws the harmonics of a wave as bars, the
+// harmonics of ref (the same wave at mip level 0) behind them, so that
+// the part removed by the mip level shows up in a different color.
+func drawSpectrumText(pane TilePane, harmonics, ref []float64) {
+	width, height := pane.Width(), pane.Height()
+	pane.Clear()
+	if width <= 0 || height <= 0 || len(ref) == 0 {
+		return
+	}
+	peak := 0.0
+	for _, m := range ref {
+		peak = max(peak, m)
+	}
+	ncols := min(width, len(ref))
+	// higher levels have fewer harmonics: pad them to the same range
+	padded := make([]float64, len(ref))
+	copy(padded, harmonics)
+	refCols := spectrumColumns(ref, peak, ncols)
+	cols := spectrumColumns(padded, peak, ncols)
+	bar := func(x int, v float64, fg Color) {
+		rows := int(math.Round(v * float64(height)))
+		pane.WithFg(fg, func() {
+			for y := height - rows; y < height; y++ {
+				pane.DrawRune(x, y, '█')
+			}
+		})
+	}
+	for x := range ncols {
+		bar(x, refCols[x], ColorMismatch)
+		bar(x, cols[x], ColorGreen)
+	}
+}
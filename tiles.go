@@ -1,57 +1,211 @@
+//go:build cgo && !js
+
 package main
 
 import (
 	"fmt"
 	gl "github.com/go-gl/gl/v3.1/gles2"
 	mgl "github.com/go-gl/mathgl/mgl32"
+	"golang.org/x/image/font"
+	"golang.org/x/text/width"
 	"image"
 	"math"
+	"unicode"
 	"unsafe"
 )
 
-type TileMap struct {
-	img         image.Image
-	sizeInTiles Size
-	tex         Texture
+// runeWidth returns the number of character cells r occupies on
+// screen: 2 for East Asian wide and fullwidth runes (CJK, most emoji)
+// and 1 for everything else.
+func runeWidth(r rune) int {
+	switch width.LookupRune(r).Kind() {
+	case width.EastAsianWide, width.EastAsianFullwidth:
+		return 2
+	}
+	return 1
 }
 
-func CreateTileMap(img image.Image, sizeInTiles Size) (*TileMap, error) {
-	tex, err := CreateTexture()
-	if err != nil {
-		return nil, err
+// stringWidth returns the number of character cells s occupies on screen.
+func stringWidth(s string) int {
+	w := 0
+	for _, r := range s {
+		w += runeWidth(r)
 	}
-	// Ensure tightly-packed pixel rows for uploads (important for single-channel Alpha textures).
-	gl.PixelStorei(gl.UNPACK_ALIGNMENT, 1)
+	return w
+}
 
-	mapSize := img.Bounds().Size()
-	switch img := img.(type) {
-	case *image.Alpha:
-		gl.TexImage2D(gl.TEXTURE_2D, 0, gl.ALPHA,
-			int32(mapSize.X), int32(mapSize.Y),
-			0, gl.ALPHA, gl.UNSIGNED_BYTE,
-			gl.Ptr(img.Pix))
-	default:
-		return nil, fmt.Errorf("cannot create TileMap OpenGL texture from image of type %T", img)
+// GlyphSheet is one texture of the glyph cache with room for
+// sizeInTiles.X*sizeInTiles.Y glyphs.
+type GlyphSheet struct {
+	img   *image.Alpha
+	tex   Texture
+	used  int
+	dirty bool // img has changes not yet uploaded to tex
+}
+
+// glyphSlot locates a cached glyph in the sheets of a TileMap.
+type glyphSlot struct {
+	sheet      int
+	col        int
+	row        int
+	substitute bool // the glyph is a '?' standing in for a missing rune
+}
+
+// TileMap is an on-demand glyph cache: glyphs are rendered into
+// sheets (textures) the first time they are drawn, using the first
+// font in fonts which provides them.
+//
+// Every tile is two cells wide so that double-width glyphs fit;
+// single-width glyphs occupy the left half of their tile.
+type TileMap struct {
+	fonts       []*Font // primary font first, then fallbacks
+	faces       []font.Face
+	ascent      int
+	cellSize    Size
+	sizeInTiles Size // of a single sheet
+	sheets      []*GlyphSheet
+	slots       map[rune]glyphSlot
+}
+
+func CreateTileMap(fonts []*Font, size FontSizeInPoints, scale float32, sizeInTiles Size) (*TileMap, error) {
+	if len(fonts) == 0 {
+		return nil, fmt.Errorf("CreateTileMap: no fonts given")
+	}
+	if sizeInTiles.X <= 0 || sizeInTiles.Y <= 0 {
+		return nil, fmt.Errorf("sizeInTiles must be positive, got %v", sizeInTiles)
+	}
+	faces := make([]font.Face, len(fonts))
+	for i, f := range fonts {
+		face, err := f.GetFace(size, scale)
+		if err != nil {
+			return nil, err
+		}
+		faces[i] = face
+	}
+	// the cell size is determined by the ASCII and Latin-1 glyphs of the primary font
+	cellSize, err := fonts[0].GetCellSize(faces[0], 256)
+	if err != nil {
+		return nil, err
 	}
 	tm := &TileMap{
-		img:         img,
+		fonts:       fonts,
+		faces:       faces,
+		ascent:      faces[0].Metrics().Ascent.Ceil(),
+		cellSize:    cellSize,
 		sizeInTiles: sizeInTiles,
-		tex:         tex,
+		slots:       make(map[rune]glyphSlot),
+	}
+	// ASCII is always needed; caching it up front also guarantees that
+	// '?' is available as a substitute.
+	for r := range rune(128) {
+		if _, err := tm.cacheGlyph(r, 0, false); err != nil {
+			tm.Close()
+			return nil, err
+		}
 	}
 	return tm, nil
 }
 
-func (tm *TileMap) GetMapSize() Size {
-	return tm.img.Bounds().Size()
+// fontIndexFor returns the index of the first font which provides a
+// glyph for r, or -1 if none of them does.
+func (tm *TileMap) fontIndexFor(r rune) int {
+	for i, f := range tm.fonts {
+		if f.HasGlyph(r) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (tm *TileMap) cacheGlyph(r rune, fontIndex int, substitute bool) (glyphSlot, error) {
+	perSheet := tm.sizeInTiles.X * tm.sizeInTiles.Y
+	if len(tm.sheets) == 0 || tm.sheets[len(tm.sheets)-1].used == perSheet {
+		tex, err := CreateTexture()
+		if err != nil {
+			return glyphSlot{}, err
+		}
+		gl.BindTexture(gl.TEXTURE_2D, 0)
+		tileWidth := 2 * tm.cellSize.X
+		img := image.NewAlpha(image.Rect(0, 0, tileWidth*tm.sizeInTiles.X, tm.cellSize.Y*tm.sizeInTiles.Y))
+		tm.sheets = append(tm.sheets, &GlyphSheet{img: img, tex: tex})
+	}
+	sheetIndex := len(tm.sheets) - 1
+	sheet := tm.sheets[sheetIndex]
+	slot := glyphSlot{
+		sheet:      sheetIndex,
+		col:        sheet.used % tm.sizeInTiles.X,
+		row:        sheet.used / tm.sizeInTiles.X,
+		substitute: substitute,
+	}
+	sheet.used++
+	if !substitute {
+		x := slot.col * 2 * tm.cellSize.X
+		y := slot.row * tm.cellSize.Y
+		cells := image.Rect(x, y, x+runeWidth(r)*tm.cellSize.X, y+tm.cellSize.Y)
+		DrawGlyph(tm.faces[fontIndex], sheet.img, cells, tm.ascent, r)
+		sheet.dirty = true
+	}
+	tm.slots[r] = slot
+	return slot, nil
+}
+
+// lookup returns the slot holding the glyph for r, rendering it into
+// the cache on first use. Runes which none of the fonts can display
+// get the glyph of '?' (with substitute set).
+func (tm *TileMap) lookup(r rune) glyphSlot {
+	if slot, ok := tm.slots[r]; ok {
+		return slot
+	}
+	fontIndex := -1
+	if r >= 0 && r <= unicode.MaxRune {
+		fontIndex = tm.fontIndexFor(r)
+	}
+	if fontIndex < 0 {
+		slot := tm.slots['?']
+		slot.substitute = true
+		tm.slots[r] = slot
+		return slot
+	}
+	slot, err := tm.cacheGlyph(r, fontIndex, false)
+	if err != nil {
+		logger.Debug("cannot cache glyph", "rune", r, "error", err)
+		slot = tm.slots['?']
+		slot.substitute = true
+	}
+	return slot
 }
 
+// upload sends the changed sheets to the GPU.
+func (tm *TileMap) upload() {
+	// Ensure tightly-packed pixel rows for uploads (important for single-channel Alpha textures).
+	gl.PixelStorei(gl.UNPACK_ALIGNMENT, 1)
+	for _, sheet := range tm.sheets {
+		if !sheet.dirty {
+			continue
+		}
+		sheet.tex.Bind()
+		size := sheet.img.Bounds().Size()
+		gl.TexImage2D(gl.TEXTURE_2D, 0, gl.ALPHA,
+			int32(size.X), int32(size.Y),
+			0, gl.ALPHA, gl.UNSIGNED_BYTE,
+			gl.Ptr(sheet.img.Pix))
+		sheet.dirty = false
+	}
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+}
+
+// GetTileSize returns the size of a single-width character cell in pixels.
 func (tm *TileMap) GetTileSize() Size {
-	mapSize := tm.GetMapSize()
-	return Size{X: mapSize.X / tm.sizeInTiles.X, Y: mapSize.Y / tm.sizeInTiles.Y}
+	return tm.cellSize
 }
 
 func (tm *TileMap) Close() error {
-	return tm.tex.Close()
+	for _, sheet := range tm.sheets {
+		sheet.tex.Close()
+	}
+	tm.sheets = nil
+	tm.slots = nil
+	return nil
 }
 
 const (
@@ -91,9 +245,22 @@ type TileVertex struct {
 	bgColor  [4]float32
 }
 
+// TextCell is one character cell of a TileScreen without a TileMap.
+// The second cell of a double-width rune has r == 0.
+type TextCell struct {
+	r      rune
+	fg, bg Color
+}
+
+// TileScreen collects the glyphs drawn by screens. With a TileMap
+// they become textured quads rendered via GL; without one (see
+// CreateTextScreen) they are stored as a grid of TextCells which a
+// terminal frontend can display.
 type TileScreen struct {
 	tm          *TileMap
-	vertices    []TileVertex
+	cells       []TextCell
+	size        Size                 // in cells, only used without a TileMap
+	vertices    map[int][]TileVertex // by glyph sheet
 	program     Program
 	a_position  int32
 	a_texcoord  int32
@@ -106,20 +273,13 @@ type TileScreen struct {
 }
 
 func (tm *TileMap) CreateScreen() (*TileScreen, error) {
-	program, err := func() (Program, error) {
-		switch img := tm.img.(type) {
-		case *image.Alpha:
-			return CreateProgram(tileVertexShader, tileFragmentShaderA)
-		default:
-			return Program{}, fmt.Errorf("cannot create TileMap from image of type %T", img)
-		}
-	}()
+	program, err := CreateProgram(tileVertexShader, tileFragmentShaderA)
 	if err != nil {
 		return nil, err
 	}
 	ts := &TileScreen{
 		tm:          tm,
-		vertices:    make([]TileVertex, 0, 6*4096),
+		vertices:    map[int][]TileVertex{0: make([]TileVertex, 0, 6*4096)},
 		program:     program,
 		a_position:  program.GetAttribLocation("a_position\x00"),
 		a_texcoord:  program.GetAttribLocation("a_texcoord\x00"),
@@ -133,83 +293,90 @@ func (tm *TileMap) CreateScreen() (*TileScreen, error) {
 	return ts, nil
 }
 
-func (ts *TileScreen) Clear() {
-	ts.vertices = ts.vertices[:0]
+// CreateTextScreen creates a TileScreen of the given size (in cells)
+// which does not need GL.
+func CreateTextScreen(size Size) *TileScreen {
+	ts := &TileScreen{
+		fgColor: ColorText,
+		bgColor: ColorBackground,
+	}
+	ts.Resize(size)
+	return ts
+}
+
+// Resize changes the size of a text screen and clears it.
+func (ts *TileScreen) Resize(size Size) {
+	ts.size = size
+	ts.cells = make([]TextCell, size.X*size.Y)
+	ts.Clear()
 }
 
-func (ts *TileScreen) DrawRune(x, y int, r rune) {
-	rows := ts.tm.sizeInTiles.Y
-	cols := ts.tm.sizeInTiles.X
-	if rows <= 0 || cols <= 0 {
+// Cell returns the text cell at (x,y) of a text screen.
+func (ts *TileScreen) Cell(x, y int) TextCell {
+	return ts.cells[y*ts.size.X+x]
+}
+
+func (ts *TileScreen) Clear() {
+	if ts.tm == nil {
+		for i := range ts.cells {
+			ts.cells[i] = TextCell{r: ' ', fg: ColorText, bg: ColorBackground}
+		}
 		return
 	}
-
-	// The font atlas only contains rows*cols glyphs. Clamp out-of-range runes to a
-	// fallback to avoid sampling outside the atlas (which otherwise clamps to the
-	// texture edge and looks like garbage glyphs).
-	nGlyphs := rows * cols
-	if r < 0 || int(r) >= nGlyphs {
-		r = '?'
+	for page, vertices := range ts.vertices {
+		ts.vertices[page] = vertices[:0]
 	}
+}
 
-	col := int(r) % cols
-	row := int(r) / cols
+// DrawRune draws r at cell (x,y) and returns the number of cells it
+// covers (2 for wide runes, 1 otherwise).
+func (ts *TileScreen) DrawRune(x, y int, r rune) int {
+	tm := ts.tm
+	w := runeWidth(r)
+	if tm == nil {
+		if x < 0 || y < 0 || x+w > ts.size.X || y >= ts.size.Y {
+			return w
+		}
+		i := y*ts.size.X + x
+		ts.cells[i] = TextCell{r: r, fg: ts.fgColor, bg: ts.bgColor}
+		if w == 2 {
+			ts.cells[i+1] = TextCell{fg: ts.fgColor, bg: ts.bgColor}
+		}
+		return w
+	}
+	slot := tm.lookup(r)
+	if slot.substitute && w == 2 {
+		// keep the layout width of the original rune
+		ts.DrawRune(x, y, '?')
+		ts.DrawRune(x+1, y, ' ')
+		return w
+	}
 	x0 := float32(x)
-	x1 := float32(x + 1)
+	x1 := float32(x + w)
 	y0 := float32(-y)
 	y1 := float32(-y - 1)
 
-	// Compute UVs in pixel space. No texel inset needed with GL_NEAREST filtering.
-	mapSize := ts.tm.GetMapSize()
-	tileSize := ts.tm.GetTileSize()
-	atlasW := float32(mapSize.X)
-	atlasH := float32(mapSize.Y)
-	tileW := float32(tileSize.X)
-	tileH := float32(tileSize.Y)
-
-	s0 := (float32(col) * tileW) / atlasW
-	s1 := (float32(col+1) * tileW) / atlasW
-	t0 := (float32(row) * tileH) / atlasH
-	t1 := (float32(row+1) * tileH) / atlasH
+	// Compute UVs in pixel space. No texel inset needed with GL_NEAREST
+	// filtering. Tiles are two cells wide, single-width runes only use
+	// the left half.
+	cols := float32(tm.sizeInTiles.X)
+	rows := float32(tm.sizeInTiles.Y)
+	s0 := float32(slot.col) / cols
+	s1 := (float32(slot.col) + float32(w)/2) / cols
+	t0 := float32(slot.row) / rows
+	t1 := float32(slot.row+1) / rows
 
 	fgColor := ColorTo4Float32(ts.fgColor)
 	bgColor := ColorTo4Float32(ts.bgColor)
-	ts.vertices = append(ts.vertices, TileVertex{
-		position: [2]float32{x0, y0},
-		texcoord: [2]float32{s0, t0},
-		fgColor:  fgColor,
-		bgColor:  bgColor,
-	})
-	ts.vertices = append(ts.vertices, TileVertex{
-		position: [2]float32{x0, y1},
-		texcoord: [2]float32{s0, t1},
-		fgColor:  fgColor,
-		bgColor:  bgColor,
-	})
-	ts.vertices = append(ts.vertices, TileVertex{
-		position: [2]float32{x1, y1},
-		texcoord: [2]float32{s1, t1},
-		fgColor:  fgColor,
-		bgColor:  bgColor,
-	})
-	ts.vertices = append(ts.vertices, TileVertex{
-		position: [2]float32{x1, y1},
-		texcoord: [2]float32{s1, t1},
-		fgColor:  fgColor,
-		bgColor:  bgColor,
-	})
-	ts.vertices = append(ts.vertices, TileVertex{
-		position: [2]float32{x1, y0},
-		texcoord: [2]float32{s1, t0},
-		fgColor:  fgColor,
-		bgColor:  bgColor,
-	})
-	ts.vertices = append(ts.vertices, TileVertex{
-		position: [2]float32{x0, y0},
-		texcoord: [2]float32{s0, t0},
-		fgColor:  fgColor,
-		bgColor:  bgColor,
-	})
+	ts.vertices[slot.sheet] = append(ts.vertices[slot.sheet],
+		TileVertex{position: [2]float32{x0, y0}, texcoord: [2]float32{s0, t0}, fgColor: fgColor, bgColor: bgColor},
+		TileVertex{position: [2]float32{x0, y1}, texcoord: [2]float32{s0, t1}, fgColor: fgColor, bgColor: bgColor},
+		TileVertex{position: [2]float32{x1, y1}, texcoord: [2]float32{s1, t1}, fgColor: fgColor, bgColor: bgColor},
+		TileVertex{position: [2]float32{x1, y1}, texcoord: [2]float32{s1, t1}, fgColor: fgColor, bgColor: bgColor},
+		TileVertex{position: [2]float32{x1, y0}, texcoord: [2]float32{s1, t0}, fgColor: fgColor, bgColor: bgColor},
+		TileVertex{position: [2]float32{x0, y0}, texcoord: [2]float32{s0, t0}, fgColor: fgColor, bgColor: bgColor},
+	)
+	return w
 }
 
 func (ts *TileScreen) SetFg(c Color) {
@@ -221,44 +388,23 @@ func (ts *TileScreen) SetBg(c Color) {
 }
 
 func (ts *TileScreen) DrawString(x, y int, s string) {
-	// range over a string gives byte offsets; we want rune cell offsets.
+	// range over a string gives byte offsets; we want cell offsets.
 	i := 0
 	for _, r := range s {
-		ts.DrawRune(x+i, y, r)
-		i++
+		i += ts.DrawRune(x+i, y, r)
 	}
 }
 
 func (ts *TileScreen) Render() {
-	if len(ts.vertices) == 0 {
+	tm := ts.tm
+	if tm == nil {
 		return
 	}
-	tm := ts.tm
+	tm.upload()
 	ts.program.Use()
-	tm.tex.Bind()
 	var activeTexture int32
 	gl.GetIntegerv(gl.ACTIVE_TEXTURE, &activeTexture)
 	gl.Uniform1i(ts.u_tex, activeTexture-gl.TEXTURE0)
-	gl.EnableVertexAttribArray(uint32(ts.a_position))
-	gl.VertexAttribPointer(
-		uint32(ts.a_position), 2, gl.FLOAT, false,
-		int32(unsafe.Sizeof(TileVertex{})),
-		gl.Ptr(&ts.vertices[0].position[0]))
-	gl.EnableVertexAttribArray(uint32(ts.a_texcoord))
-	gl.VertexAttribPointer(
-		uint32(ts.a_texcoord), 2, gl.FLOAT, false,
-		int32(unsafe.Sizeof(TileVertex{})),
-		gl.Ptr(&ts.vertices[0].texcoord[0]))
-	gl.EnableVertexAttribArray(uint32(ts.a_fgColor))
-	gl.VertexAttribPointer(
-		uint32(ts.a_fgColor), 3, gl.FLOAT, false,
-		int32(unsafe.Sizeof(TileVertex{})),
-		gl.Ptr(&ts.vertices[0].fgColor[0]))
-	gl.EnableVertexAttribArray(uint32(ts.a_bgColor))
-	gl.VertexAttribPointer(
-		uint32(ts.a_bgColor), 3, gl.FLOAT, false,
-		int32(unsafe.Sizeof(TileVertex{})),
-		gl.Ptr(&ts.vertices[0].bgColor[0]))
 	tileSize := tm.GetTileSize()
 	rectSizeInTiles := Size{
 		X: fbSize.X / tileSize.X,
@@ -284,7 +430,35 @@ func (ts *TileScreen) Render() {
 	mTranslate := mgl.Translate3D(tx, ty, 0)
 	mTransform := mTranslate.Mul4(mScale)
 	gl.UniformMatrix4fv(ts.u_transform, 1, false, &mTransform[0])
-	gl.DrawArrays(gl.TRIANGLES, 0, int32(len(ts.vertices)))
+	gl.EnableVertexAttribArray(uint32(ts.a_position))
+	gl.EnableVertexAttribArray(uint32(ts.a_texcoord))
+	gl.EnableVertexAttribArray(uint32(ts.a_fgColor))
+	gl.EnableVertexAttribArray(uint32(ts.a_bgColor))
+	// one draw call per glyph sheet
+	for sheetIndex, sheet := range tm.sheets {
+		vertices := ts.vertices[sheetIndex]
+		if len(vertices) == 0 {
+			continue
+		}
+		sheet.tex.Bind()
+		gl.VertexAttribPointer(
+			uint32(ts.a_position), 2, gl.FLOAT, false,
+			int32(unsafe.Sizeof(TileVertex{})),
+			gl.Ptr(&vertices[0].position[0]))
+		gl.VertexAttribPointer(
+			uint32(ts.a_texcoord), 2, gl.FLOAT, false,
+			int32(unsafe.Sizeof(TileVertex{})),
+			gl.Ptr(&vertices[0].texcoord[0]))
+		gl.VertexAttribPointer(
+			uint32(ts.a_fgColor), 3, gl.FLOAT, false,
+			int32(unsafe.Sizeof(TileVertex{})),
+			gl.Ptr(&vertices[0].fgColor[0]))
+		gl.VertexAttribPointer(
+			uint32(ts.a_bgColor), 3, gl.FLOAT, false,
+			int32(unsafe.Sizeof(TileVertex{})),
+			gl.Ptr(&vertices[0].bgColor[0]))
+		gl.DrawArrays(gl.TRIANGLES, 0, int32(len(vertices)))
+	}
 	gl.DisableVertexAttribArray(uint32(ts.a_position))
 	gl.DisableVertexAttribArray(uint32(ts.a_texcoord))
 	gl.DisableVertexAttribArray(uint32(ts.a_fgColor))
@@ -292,11 +466,43 @@ func (ts *TileScreen) Render() {
 	gl.BindTexture(gl.TEXTURE_2D, 0)
 }
 
+// CellAt returns the screen cell containing the framebuffer pixel p.
+func (ts *TileScreen) CellAt(p Point) Point {
+	if ts.tm == nil {
+		return p
+	}
+	tileSize := ts.tm.GetTileSize()
+	borderSize := Size{
+		X: (fbSize.X % tileSize.X) / 2,
+		Y: (fbSize.Y % tileSize.Y) / 2,
+	}
+	floorDiv := func(a, b int) int {
+		if a < 0 {
+			return (a - b + 1) / b
+		}
+		return a / b
+	}
+	return Point{
+		X: floorDiv(p.X-borderSize.X, tileSize.X),
+		Y: floorDiv(p.Y-borderSize.Y, tileSize.Y),
+	}
+}
+
 type TilePane struct {
 	ts   *TileScreen
 	rect Rect
 }
 
+// Contains reports whether the screen cell p is inside the pane.
+func (tp TilePane) Contains(p Point) bool {
+	return p.In(tp.rect)
+}
+
+// Local converts the screen cell p to pane coordinates.
+func (tp TilePane) Local(p Point) Point {
+	return p.Sub(tp.rect.Min)
+}
+
 func (tp TilePane) Width() int {
 	return tp.rect.Dx()
 }
@@ -306,6 +512,9 @@ func (tp TilePane) Height() int {
 }
 
 func (tp TilePane) GetPixelRect() Rect {
+	if tp.ts.tm == nil {
+		return tp.rect
+	}
 	tileSize := tp.ts.tm.GetTileSize()
 	borderSize := Size{
 		X: (fbSize.X % tileSize.X) / 2,
@@ -416,13 +625,19 @@ func (tp TilePane) WithFgBg(fg, bg Color, fn func()) {
 	fn()
 }
 
-func (tp TilePane) DrawRune(x, y int, r rune) {
+// DrawRune draws r at (x,y) and returns the number of cells it covers.
+// A wide rune which does not fit at the right edge is drawn as a space.
+func (tp TilePane) DrawRune(x, y int, r rune) int {
 	rect := tp.rect
 	screenX := rect.Min.X + x
 	screenY := rect.Min.Y + y
 	if screenX < rect.Max.X && screenY < rect.Max.Y {
-		tp.ts.DrawRune(screenX, screenY, r)
+		if screenX+runeWidth(r) > rect.Max.X {
+			r = ' '
+		}
+		return tp.ts.DrawRune(screenX, screenY, r)
 	}
+	return runeWidth(r)
 }
 
 func (tp TilePane) FillWith(r rune) {
@@ -438,8 +653,9 @@ func (tp TilePane) Clear() {
 }
 
 func (tp TilePane) DrawString(x, y int, s string) {
-	for offset, r := range s {
-		tp.DrawRune(x+offset, y, r)
+	offset := 0
+	for _, r := range s {
+		offset += tp.DrawRune(x+offset, y, r)
 	}
 }
 
@@ -462,6 +678,9 @@ func (tp TilePane) SubPane(x, y, w, h int) TilePane {
 }
 
 func (ts *TileScreen) GetPane() TilePane {
+	if ts.tm == nil {
+		return TilePane{ts: ts, rect: Rect{Max: ts.size}}
+	}
 	tileSize := ts.tm.GetTileSize()
 	return TilePane{
 		ts: ts,
@@ -473,5 +692,8 @@ func (ts *TileScreen) GetPane() TilePane {
 }
 
 func (ts *TileScreen) Close() error {
+	if ts.tm == nil {
+		return nil
+	}
 	return ts.program.Close()
 }
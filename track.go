@@ -0,0 +1,263 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"slices"
+)
+
+const (
+	trackHopSize   = 256
+	trackThreshold = 0.15  // YIN threshold: lower is stricter
+	trackGate      = 0.003 // about -50 dBFS, below which the pitch holds
+	trackAttack    = 0.002 // seconds
+	trackRelease   = 0.08  // seconds
+)
+
+// ampFollower follows the amplitude of a signal, rising fast and
+// falling slowly.
+type ampFollower struct {
+	attack, release float64
+	amp             float64
+}
+
+func newAmpFollower(sr float64) *ampFollower {
+	return &ampFollower{
+		attack:  1 - math.Exp(-1/(trackAttack*sr)),
+		release: 1 - math.Exp(-1/(trackRelease*sr)),
+	}
+}
+
+func (f *ampFollower) step(x float64) float64 {
+	x = math.Abs(x)
+	if x > f.amp {
+		f.amp += f.attack * (x - f.amp)
+	} else {
+		f.amp += f.release * (x - f.amp)
+	}
+	return f.amp
+}
+
+// yinPitch estimates the frequency of the periodic signal in buf with
+// the YIN algorithm, looking for periods from minLag to maxLag frames,
+// buf having at least 2*maxLag frames. It returns 0 if buf is not
+// periodic enough. d is scratch space of maxLag+1 values.
+func yinPitch(buf []float64, minLag, maxLag int, sr float64, d []float64) float64 {
+	w := len(buf) - maxLag
+	// difference function
+	for tau := 1; tau <= maxLag; tau++ {
+		sum := 0.0
+		for i := range w {
+			diff := buf[i] - buf[i+tau]
+			sum += diff * diff
+		}
+		d[tau] = sum
+	}
+	// cumulative mean normalized difference
+	d[0] = 1
+	running := 0.0
+	for tau := 1; tau <= maxLag; tau++ {
+		running += d[tau]
+		if running == 0 {
+			d[tau] = 1
+			continue
+		}
+		d[tau] *= float64(tau) / running
+	}
+	for tau := max(minLag, 2); tau < maxLag; tau++ {
+		if d[tau] >= trackThreshold {
+			continue
+		}
+		// the bottom of this dip
+		for tau+1 < maxLag && d[tau+1] < d[tau] {
+			tau++
+		}
+		// parabolic interpolation between the neighbours
+		period := float64(tau)
+		a, b, c := d[tau-1], d[tau], d[tau+1]
+		if den := a - 2*b + c; den != 0 {
+			period += (a - c) / (2 * den)
+		}
+		return sr / period
+	}
+	return 0
+}
+
+// TrackPitch follows the pitch of the monophonic mono sum of input
+// between minFreq and maxFreq Hz, updated every trackHopSize frames.
+// While the input is silent or not periodic, the last pitch holds; it
+// is 0 until one is found.
+func TrackPitch(input Stream, minFreq, maxFreq float64) Stream {
+	return makeTransformStream([]Stream{input}, func(inputs []Stream) Stepper {
+		next := inputs[0].Mono().Next
+		sr := float64(SampleRate())
+		minLag := int(sr / maxFreq)
+		maxLag := int(math.Ceil(sr / minFreq))
+		ring := make([]float64, 2*maxLag) // the last frames of the input
+		pos := 0
+		buf := make([]float64, len(ring)) // ring in order
+		d := make([]float64, maxLag+1)
+		follower := newAmpFollower(sr)
+		freq := 0.0
+		hop := 0
+		out := make(Frame, 1)
+		return func() (Frame, bool) {
+			frame, ok := next()
+			if !ok {
+				return nil, false
+			}
+			x := float64(frame[0])
+			ring[pos] = x
+			pos = (pos + 1) % len(ring)
+			amp := follower.step(x)
+			if hop++; hop == trackHopSize {
+				hop = 0
+				if amp > trackGate {
+					n := copy(buf, ring[pos:])
+					copy(buf[n:], ring[:pos])
+					if f := yinPitch(buf, minLag, maxLag, sr, d); f > 0 {
+						freq = f
+					}
+				}
+			}
+			out[0] = Smp(freq)
+			return out, true
+		}
+	})
+}
+
+// Pitch estimates the pitch of the mono sum of t between minFreq and
+// maxFreq Hz with the YIN algorithm, one value every trackHopSize
+// frames, from the frames around it. A value is 0 where t is silent or
+// not periodic enough.
+func (t *Tape) Pitch(minFreq, maxFreq float64) []float64 {
+	sr := float64(SampleRate())
+	minLag := int(sr / maxFreq)
+	maxLag := int(math.Ceil(sr / minFreq))
+	nhops := (t.nframes + trackHopSize - 1) / trackHopSize
+	pitches := make([]float64, nhops)
+	buf := make([]float64, 2*maxLag)
+	d := make([]float64, maxLag+1)
+	for h := range nhops {
+		start := h*trackHopSize - maxLag
+		energy := 0.0
+		for i := range buf {
+			v := 0.0
+			if frame := start + i; frame >= 0 && frame < t.nframes {
+				for ch := range t.nchannels {
+					v += t.samples[frame*t.nchannels+ch]
+				}
+				v /= float64(t.nchannels)
+			}
+			buf[i] = v
+			energy += v * v
+		}
+		if math.Sqrt(energy/float64(len(buf))) > trackGate {
+			pitches[h] = yinPitch(buf, minLag, maxLag, sr, d)
+		}
+	}
+	return pitches
+}
+
+// medianPitch returns the median of the non-zero pitches, 0 if there
+// are none.
+func medianPitch(pitches []float64) float64 {
+	var found []float64
+	for _, p := range pitches {
+		if p > 0 {
+			found = append(found, p)
+		}
+	}
+	if len(found) == 0 {
+		return 0
+	}
+	slices.Sort(found)
+	return found[len(found)/2]
+}
+
+// getTrackRange returns the frequency range of the pitch search.
+func getTrackRange(vm *VM) (minFreq, maxFreq float64, err error) {
+	minFreq, err = vm.GetFloat(":track/min")
+	if err != nil {
+		return 0, 0, err
+	}
+	maxFreq, err = vm.GetFloat(":track/max")
+	if err != nil {
+		return 0, 0, err
+	}
+	if minFreq <= 0 || maxFreq <= minFreq || maxFreq >= float64(SampleRate())/4 {
+		return 0, 0, fmt.Errorf("expected 0 < :track/min < :track/max < sr/4, got %v and %v", minFreq, maxFreq)
+	}
+	return minFreq, maxFreq, nil
+}
+
+// TrackAmp follows the amplitude of the mono sum of input.
+func TrackAmp(input Stream) Stream {
+	return makeTransformStream([]Stream{input}, func(inputs []Stream) Stepper {
+		next := inputs[0].Mono().Next
+		follower := newAmpFollower(float64(SampleRate()))
+		out := make(Frame, 1)
+		return func() (Frame, bool) {
+			frame, ok := next()
+			if !ok {
+				return nil, false
+			}
+			out[0] = Smp(follower.step(float64(frame[0])))
+			return out, true
+		}
+	})
+}
+
+func init() {
+	RegisterWord("track", func(vm *VM) error {
+		input, err := streamFromVal(vm.Pop())
+		if err != nil {
+			return err
+		}
+		minFreq, maxFreq, err := getTrackRange(vm)
+		if err != nil {
+			return fmt.Errorf("track: %w", err)
+		}
+		vm.Push(TrackPitch(input, minFreq, maxFreq))
+		vm.Push(TrackAmp(input))
+		return nil
+	})
+	RegisterMethod[*Tape]("pitch", 1, func(vm *VM) error {
+		t, err := Pop[*Tape](vm)
+		if err != nil {
+			return err
+		}
+		minFreq, maxFreq, err := getTrackRange(vm)
+		if err != nil {
+			return fmt.Errorf("pitch: %w", err)
+		}
+		pitches := t.Pitch(minFreq, maxFreq)
+		result := make(Vec, len(pitches))
+		for i, p := range pitches {
+			result[i] = Num(p)
+		}
+		vm.Push(result)
+		return nil
+	})
+
+	RegisterMethod[*Tape]("rootnote", 1, func(vm *VM) error {
+		t, err := Pop[*Tape](vm)
+		if err != nil {
+			return err
+		}
+		minFreq, maxFreq, err := getTrackRange(vm)
+		if err != nil {
+			return fmt.Errorf("rootnote: %w", err)
+		}
+		freq := medianPitch(t.Pitch(minFreq, maxFreq))
+		if freq == 0 {
+			return fmt.Errorf("rootnote: no pitch found in tape")
+		}
+		a4, err := positiveEnvFloat(vm, "rootnote", ":a4")
+		if err != nil {
+			return err
+		}
+		vm.Push(Num(FreqNote(freq, a4)))
+		return nil
+	})
+}
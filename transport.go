@@ -0,0 +1,253 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+// tempoChange sets the tempo from a beat on.
+type tempoChange struct {
+	beat, bpm float64
+}
+
+// tempoMap converts between beats and frames. Before the first change
+// the tempo is bpm, the tempo of :bpm.
+type tempoMap struct {
+	bpm     float64
+	changes []tempoChange // sorted by beat
+}
+
+// segments calls f with the beats at which the tempo changes and the
+// tempo from there, up to the next one, until f returns false.
+func (m tempoMap) segments(f func(start, end, bpm float64) bool) {
+	start, bpm := 0.0, m.bpm
+	for _, c := range m.changes {
+		if c.beat > start && !f(start, c.beat, bpm) {
+			return
+		}
+		start, bpm = max(start, c.beat), c.bpm
+	}
+	f(start, math.Inf(1), bpm)
+}
+
+// BPM returns the tempo at beat.
+func (m tempoMap) BPM(beat float64) float64 {
+	bpm := m.bpm
+	for _, c := range m.changes {
+		if c.beat > beat {
+			break
+		}
+		bpm = c.bpm
+	}
+	return bpm
+}
+
+// Frame returns the frame at which beat starts, beat 0 being at frame 0.
+func (m tempoMap) Frame(beat float64) float64 {
+	sr := float64(SampleRate())
+	frame := 0.0
+	m.segments(func(start, end, bpm float64) bool {
+		frame += (min(beat, end) - start) * 60 / bpm * sr
+		return beat > end
+	})
+	return frame
+}
+
+// Beat returns the beat position at frame, the inverse of Frame.
+func (m tempoMap) Beat(frame float64) float64 {
+	sr := float64(SampleRate())
+	beat, at := 0.0, 0.0 // at: frame of the start of the segment
+	m.segments(func(start, end, bpm float64) bool {
+		framesPerBeat := 60 / bpm * sr
+		segment := (end - start) * framesPerBeat
+		if frame < at+segment {
+			beat = start + (frame-at)/framesPerBeat
+			return false
+		}
+		at += segment
+		return true
+	})
+	return beat
+}
+
+// Frames returns the number of frames from beat start to start+beats.
+func (m tempoMap) Frames(start, beats float64) float64 {
+	return m.Frame(start+beats) - m.Frame(start)
+}
+
+// Transport is the clock shared by the time-based words of a VM: a
+// song position in beats, which runs in real time while playing, and
+// the tempo changes of the song. Words which place things in time
+// start them at the position and follow the tempo changes from there.
+type Transport struct {
+	mu      sync.Mutex
+	changes []tempoChange
+	pos     float64   // in beats, where the clock was started or stopped
+	started time.Time // when playing started, zero if stopped
+}
+
+// tempoMap returns the tempo map of the changes with bpm as the initial
+// tempo.
+func (t *Transport) tempoMap(bpm float64) tempoMap {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return tempoMap{bpm: bpm, changes: slices.Clone(t.changes)}
+}
+
+// Pos returns the song position in beats.
+func (t *Transport) Pos(bpm float64) float64 {
+	m := t.tempoMap(bpm)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.posLocked(m)
+}
+
+func (t *Transport) posLocked(m tempoMap) float64 {
+	if t.started.IsZero() {
+		return t.pos
+	}
+	elapsed := time.Since(t.started).Seconds() * float64(SampleRate())
+	return m.Beat(m.Frame(t.pos) + elapsed)
+}
+
+// Seek moves the song position to beat.
+func (t *Transport) Seek(beat float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pos = beat
+	if !t.started.IsZero() {
+		t.started = time.Now()
+	}
+}
+
+// Play starts the clock at the song position.
+func (t *Transport) Play() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.started.IsZero() {
+		t.started = time.Now()
+	}
+}
+
+// Stop stops the clock, keeping the position it has reached.
+func (t *Transport) Stop(bpm float64) {
+	m := t.tempoMap(bpm)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pos = t.posLocked(m)
+	t.started = time.Time{}
+}
+
+// IsPlaying reports whether the clock is running.
+func (t *Transport) IsPlaying() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return !t.started.IsZero()
+}
+
+// SetTempo changes the tempo to bpm from beat on, replacing a change at
+// the same beat.
+func (t *Transport) SetTempo(beat, bpm float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	i, found := slices.BinarySearchFunc(t.changes, beat, func(c tempoChange, beat float64) int {
+		return cmp.Compare(c.beat, beat)
+	})
+	if found {
+		t.changes[i].bpm = bpm
+		return
+	}
+	t.changes = slices.Insert(t.changes, i, tempoChange{beat: beat, bpm: bpm})
+}
+
+// ClearTempo removes the tempo changes, leaving the tempo of :bpm.
+func (t *Transport) ClearTempo() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.changes = nil
+}
+
+// tempo returns the tempo map of the transport, with the tempo of
+// :bpm before the first change, and the song position.
+func (vm *VM) tempo() (tempoMap, float64, error) {
+	bpm, err := baseBPM(vm)
+	if err != nil {
+		return tempoMap{}, 0, err
+	}
+	return vm.transport.tempoMap(bpm), vm.transport.Pos(bpm), nil
+}
+
+// BeatStream returns the beat position of each frame, starting at beat
+// start and following the tempo changes of m.
+func BeatStream(m tempoMap, start float64) Stream {
+	return makeRewindableStream(1, 0, func() Stepper {
+		frame := m.Frame(start)
+		out := make(Frame, 1)
+		return func() (Frame, bool) {
+			out[0] = Smp(m.Beat(frame))
+			frame++
+			return out, true
+		}
+	})
+}
+
+func init() {
+	RegisterGoFunc("transport/play", func(vm *VM) {
+		vm.transport.Play()
+	})
+	RegisterGoFunc("transport/stop", func(vm *VM) error {
+		bpm, err := baseBPM(vm)
+		if err != nil {
+			return err
+		}
+		vm.transport.Stop(bpm)
+		return nil
+	})
+	RegisterGoFunc("transport/playing?", func(vm *VM) bool {
+		return vm.transport.IsPlaying()
+	})
+	RegisterGoFunc("transport/pos", func(vm *VM) (float64, error) {
+		_, pos, err := vm.tempo()
+		return pos, err
+	})
+	RegisterGoFunc("transport/seek", func(vm *VM, beat float64) error {
+		if beat < 0 {
+			return fmt.Errorf("position must be >= 0, got %v", beat)
+		}
+		vm.transport.Seek(beat)
+		return nil
+	})
+	RegisterGoFunc("transport/tempo", func(vm *VM, bpm, beat float64) error {
+		if bpm <= 0 {
+			return fmt.Errorf("tempo must be a positive number, got %v", bpm)
+		}
+		if beat < 0 {
+			return fmt.Errorf("beat must be >= 0, got %v", beat)
+		}
+		vm.transport.SetTempo(beat, bpm)
+		return nil
+	})
+	RegisterGoFunc("transport/clear", func(vm *VM) {
+		vm.transport.ClearTempo()
+	})
+	RegisterGoFunc("transport/bpm", func(vm *VM, beat float64) (float64, error) {
+		m, _, err := vm.tempo()
+		return m.BPM(beat), err
+	})
+	RegisterGoFunc("transport/frame", func(vm *VM, beat float64) (float64, error) {
+		m, _, err := vm.tempo()
+		return m.Frame(beat), err
+	})
+	RegisterGoFunc("transport/length", func(vm *VM, beats float64) (float64, error) {
+		m, pos, err := vm.tempo()
+		return m.Frames(pos, beats), err
+	})
+	RegisterGoFunc("~beats", func(vm *VM) (Stream, error) {
+		m, pos, err := vm.tempo()
+		return BeatStream(m, pos), err
+	})
+}
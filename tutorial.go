@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// lesson is a step of the tutorial: text explaining something and
+// asking for a change, the code to start from, a solution to audition
+// and the checks the changed code must pass.
+type lesson struct {
+	title    string
+	text     []string
+	code     string
+	solution string
+	checks   []lessonCheck
+}
+
+// lessonCheck is an expression which must leave true on the stack when
+// evaluated with the result of the code of a lesson on it, and the hint
+// shown when it does not.
+type lessonCheck struct {
+	expr string
+	hint string
+}
+
+// parseLessons reads the lessons of the tutorial from src. Each starts
+// with a "# title" line followed by its text and the "== code",
+// "== solution" and "== check" sections. Each line of the check section
+// is an expression followed by "; hint".
+func parseLessons(src string) ([]*lesson, error) {
+	var lessons []*lesson
+	var l *lesson
+	section := ""
+	var code, solution strings.Builder
+	finish := func() {
+		if l != nil {
+			l.code = strings.TrimSpace(code.String()) + "\n"
+			l.solution = strings.TrimSpace(solution.String()) + "\n"
+			lessons = append(lessons, l)
+		}
+		code.Reset()
+		solution.Reset()
+	}
+	for i, line := range strings.Split(src, "\n") {
+		if title, ok := strings.CutPrefix(line, "# "); ok {
+			finish()
+			l = &lesson{title: title}
+			section = ""
+			continue
+		}
+		if l == nil {
+			if strings.TrimSpace(line) != "" {
+				return nil, fmt.Errorf("tutorial:%d: text before the first lesson", i+1)
+			}
+			continue
+		}
+		if name, ok := strings.CutPrefix(line, "== "); ok {
+			switch name {
+			case "code", "solution", "check":
+				section = name
+			default:
+				return nil, fmt.Errorf("tutorial:%d: unknown section %q", i+1, name)
+			}
+			continue
+		}
+		switch section {
+		case "":
+			l.text = append(l.text, line)
+		case "code":
+			code.WriteString(line + "\n")
+		case "solution":
+			solution.WriteString(line + "\n")
+		case "check":
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			expr, hint, _ := strings.Cut(line, ";")
+			l.checks = append(l.checks, lessonCheck{strings.TrimSpace(expr), strings.TrimSpace(hint)})
+		}
+	}
+	finish()
+	for _, l := range lessons {
+		for len(l.text) > 0 && strings.TrimSpace(l.text[len(l.text)-1]) == "" {
+			l.text = l.text[:len(l.text)-1]
+		}
+	}
+	return lessons, nil
+}
+
+// loadLessons returns the lessons of the built-in tutorial.
+func loadLessons() ([]*lesson, error) {
+	src, err := assets.ReadFile("assets/tutorial.txt")
+	if err != nil {
+		return nil, err
+	}
+	return parseLessons(string(src))
+}
+
+// errLessonCheck is returned by checkLesson when the code evaluates but
+// a check fails.
+var errLessonCheck = errors.New("not yet")
+
+// checkLesson evaluates code in vm, then the checks of l with its
+// result. It returns the result, and an error wrapping errLessonCheck
+// with the hint of the first check which fails.
+func checkLesson(vm *VM, l *lesson, code []byte) (Val, error) {
+	if err := vm.ParseAndEval(bytes.NewReader(code), "<tutorial>"); err != nil {
+		return nil, err
+	}
+	result := vm.evalResult
+	if result == nil {
+		return nil, fmt.Errorf("%w: the code left nothing on the stack", errLessonCheck)
+	}
+	if s, ok := result.(Stream); ok && s.nframes == 0 {
+		return nil, fmt.Errorf("%w: the result is an endless stream, cut it with take", errLessonCheck)
+	}
+	for _, c := range l.checks {
+		vm.SetVal("tutorial/result", result)
+		err := vm.ParseAndEval(strings.NewReader("@tutorial/result "+c.expr), "<check>")
+		if err != nil {
+			return result, fmt.Errorf("%w: %s (%v)", errLessonCheck, c.hint, err)
+		}
+		if ok, _ := vm.evalResult.(Num); ok == 0 {
+			return result, fmt.Errorf("%w: %s", errLessonCheck, c.hint)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,193 @@
+//go:build cgo && !js
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// TutorialScreen guides through the lessons of the tutorial: it shows
+// the text of a lesson above a scratch buffer holding its code, checks
+// the code when it is evaluated and plays it or the solution.
+type TutorialScreen struct {
+	app     *App
+	lessons []*lesson
+	index   int      // current lesson
+	codes   []string // the code of each lesson as last edited
+	passed  []bool
+	editor  *Editor
+	keymap  KeyMap
+	status  string // outcome of the last check
+	color   Color  // of status
+}
+
+func CreateTutorialScreen(app *App) (*TutorialScreen, error) {
+	lessons, err := loadLessons()
+	if err != nil {
+		return nil, err
+	}
+	tu := &TutorialScreen{
+		app:     app,
+		lessons: lessons,
+		codes:   make([]string, len(lessons)),
+		passed:  make([]bool, len(lessons)),
+		editor:  CreateEditor(),
+		keymap:  CreateKeyMap(),
+	}
+	for i, l := range lessons {
+		tu.codes[i] = l.code
+	}
+	tu.showLesson(0)
+	tu.keymap.BindAction("tutorial.check", "C-Enter", func() { tu.check(false) })
+	tu.keymap.BindAction("tutorial.play", "C-p", func() { tu.check(true) })
+	tu.keymap.BindAction("tutorial.play-solution", "M-p", tu.playSolution)
+	tu.keymap.BindAction("tutorial.next", "C-x n", func() { tu.showLesson(tu.index + 1) })
+	tu.keymap.BindAction("tutorial.previous", "C-x p", func() { tu.showLesson(tu.index - 1) })
+	tu.keymap.BindAction("tutorial.restart", "C-x r", func() {
+		tu.codes[tu.index] = tu.lessons[tu.index].code
+		tu.editor.SetText(tu.codes[tu.index])
+		tu.status = ""
+	})
+	return tu, nil
+}
+
+// showLesson switches to lesson i, keeping the code of the current one.
+func (tu *TutorialScreen) showLesson(i int) {
+	if i < 0 || i >= len(tu.lessons) {
+		return
+	}
+	if i != tu.index {
+		tu.codes[tu.index] = string(tu.editor.GetBytes())
+	}
+	tu.index = i
+	tu.editor.SetText(tu.codes[i])
+	tu.editor.Reset()
+	tu.status = ""
+}
+
+// check evaluates the code of the current lesson in the tutorial slot
+// and checks the result, then plays it if play is set.
+func (tu *TutorialScreen) check(play bool) {
+	app := tu.app
+	slot := app.tutorialSlot
+	slot.Cancel()
+	app.audio.StopAllPlayers()
+	index := tu.index
+	code := tu.editor.GetBytes()
+	tu.codes[index] = string(code)
+	tu.status, tu.color = "checking...", ColorText
+	go func() {
+		result, err := checkLesson(slot.vm, tu.lessons[index], code)
+		downmix := slot.vm.resultDownmix
+		app.postEvent(func() {
+			slot.resetRenderProgress()
+			if index != tu.index {
+				return
+			}
+			switch {
+			case errors.Is(err, ErrEvalCancelled):
+				tu.status, tu.color = "cancelled", ColorError
+			case errors.Is(err, errLessonCheck):
+				tu.status, tu.color = err.Error(), ColorError
+			case err != nil:
+				tu.status, tu.color = formatError(err), ColorError
+			default:
+				tu.passed[index] = true
+				tu.status, tu.color = "passed!", ColorPassed
+				if index+1 < len(tu.lessons) {
+					tu.status += " C-x n: next lesson"
+				}
+			}
+			if play && result != nil {
+				if err := app.audio.PlayTape(result, downmix, tu); err != nil {
+					app.SetLastError(err)
+				}
+			}
+		}, false)
+	}()
+}
+
+// playSolution evaluates the solution of the current lesson in the
+// tutorial slot and plays it.
+func (tu *TutorialScreen) playSolution() {
+	app := tu.app
+	slot := app.tutorialSlot
+	slot.Cancel()
+	app.audio.StopAllPlayers()
+	solution := tu.lessons[tu.index].solution
+	go func() {
+		err := slot.vm.ParseAndEval(strings.NewReader(solution), "<solution>")
+		result, downmix := slot.vm.evalResult, slot.vm.resultDownmix
+		app.postEvent(func() {
+			slot.resetRenderProgress()
+			if err != nil {
+				if !errors.Is(err, ErrEvalCancelled) {
+					app.SetLastError(err)
+				}
+				return
+			}
+			if err := app.audio.PlayTape(result, downmix, tu); err != nil {
+				app.SetLastError(err)
+			}
+		}, false)
+	}()
+}
+
+func (tu *TutorialScreen) Keymap() KeyMap {
+	return tu.keymap
+}
+
+func (tu *TutorialScreen) HandleKey(key Key) (KeyHandler, bool) {
+	if next, handled := tu.keymap.HandleKey(key); handled {
+		return next, handled
+	}
+	return tu.editor.HandleKey(key)
+}
+
+func (tu *TutorialScreen) OnChar(app *App, char rune) {
+	tu.editor.OnChar(char)
+}
+
+func (tu *TutorialScreen) Render(app *App, ts *TileScreen) {
+	l := tu.lessons[tu.index]
+	pane := ts.GetPane()
+	textPane, rest := pane.SplitY(float64(min(len(l.text)+3, pane.Height()/2)))
+	editorPane, bottom := rest.SplitY(-2)
+	statusPane, keysPane := bottom.SplitY(1)
+
+	done := ""
+	if tu.passed[tu.index] {
+		done = " (passed)"
+	}
+	textPane.WithFg(ColorPassed, func() {
+		textPane.DrawString(0, 0, fmt.Sprintf("Lesson %d/%d: %s%s", tu.index+1, len(tu.lessons), l.title, done))
+	})
+	for y, line := range l.text {
+		textPane.DrawString(0, y+2, line)
+	}
+
+	tu.editor.Render(editorPane, nil)
+
+	status, color := tu.status, tu.color
+	if slot := app.tutorialSlot; slot.vm.IsEvaluating() {
+		status, color = "evaluating... (F9: pause)", ColorText
+		if progress := slot.renderProgress(); progress != "" {
+			status = "rendering: " + progress + " (F9: pause/resume)"
+		}
+	}
+	statusPane.WithFg(color, func() {
+		statusPane.DrawString(0, 0, strings.SplitN(status, "\n", 2)[0])
+	})
+	keysPane.WithFgBg(ColorText, ColorMark, func() {
+		keysPane.Clear()
+		keysPane.DrawString(0, 0, "C-Enter: check, C-p: check and play, M-p: play the solution, C-x n/p: next/previous lesson, C-x r: restart the lesson")
+	})
+}
+
+func (tu *TutorialScreen) Reset() {
+	tu.editor.Reset()
+}
+
+func (tu *TutorialScreen) Close() {}
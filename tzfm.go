@@ -0,0 +1,87 @@
+package main
+
+import (
+	"math"
+)
+
+// TZFMOsc implements a through-zero FM operator pair: a sine modulator
+// at freq*ratio, modulating its own phase by feedback times its
+// previous output (in cycles), drives the frequency of a sine carrier
+// at freq. The carrier deviates by index times the modulator frequency,
+// so with an index above 1 its frequency goes through zero and its
+// phase runs backwards instead of folding over as with ~fm.
+//
+// Both operators start at phase, and stay coherent across the stream.
+func TZFMOsc(freq, ratio, index, feedback Stream, phase float64) Stream {
+	return makeTransformStreamN(1, []Stream{freq, ratio, index, feedback}, func(inputs []Stream) Stepper {
+		fnext := inputs[0].Mono().Next
+		rnext := inputs[1].Mono().Next
+		inext := inputs[2].Mono().Next
+		fbnext := inputs[3].Mono().Next
+		p := phase
+		if p < 0.0 || p >= 1.0 {
+			p = 0.0
+		}
+		cph, mph := p, p
+		// the feedback uses the mean of the last two outputs of the
+		// modulator, which keeps high amounts from oscillating at Nyquist
+		var m1, m2 float64
+		sr := float64(SampleRate())
+		out := make(Frame, 1)
+		return func() (Frame, bool) {
+			fframe, ok := fnext()
+			if !ok {
+				return nil, false
+			}
+			rframe, ok := rnext()
+			if !ok {
+				return nil, false
+			}
+			iframe, ok := inext()
+			if !ok {
+				return nil, false
+			}
+			fbframe, ok := fbnext()
+			if !ok {
+				return nil, false
+			}
+			f := fframe[0]
+			mfreq := f * rframe[0]
+			m := math.Sin(2 * math.Pi * (mph + fbframe[0]*(m1+m2)/2))
+			m2, m1 = m1, m
+			out[0] = Smp(math.Sin(2 * math.Pi * cph))
+			cfreq := f + iframe[0]*mfreq*m
+			cph = wrapPhase(cph + cfreq/sr)
+			mph = wrapPhase(mph + mfreq/sr)
+			return out, true
+		}
+	})
+}
+
+// wrapPhase wraps a phase which may run in either direction to [0,1).
+func wrapPhase(ph float64) float64 {
+	ph -= math.Floor(ph)
+	if ph >= 1.0 {
+		ph = 0.0
+	}
+	return ph
+}
+
+func init() {
+	RegisterWord("~tzfm", func(vm *VM) error {
+		var streams [4]Stream
+		for i, k := range []string{":freq", ":fm/ratio", ":index", ":fm/feedback"} {
+			s, err := vm.GetStream(k)
+			if err != nil {
+				return err
+			}
+			streams[i] = s
+		}
+		phase, err := vm.GetFloat(":phase")
+		if err != nil {
+			return err
+		}
+		vm.Push(TZFMOsc(streams[0], streams[1], streams[2], streams[3], phase))
+		return nil
+	})
+}
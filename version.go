@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is the version of mixtape. Release builds can override it
+// with -ldflags "-X main.Version=...".
+var Version = "0.5.0"
+
+// parseVersion parses a version of the form major[.minor[.patch]]
+// (with an optional leading v) into its three components.
+func parseVersion(s string) ([3]int, error) {
+	var v [3]int
+	parts := strings.Split(strings.TrimPrefix(s, "v"), ".")
+	if len(parts) > len(v) {
+		return v, fmt.Errorf("invalid version: %q", s)
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return v, fmt.Errorf("invalid version: %q", s)
+		}
+		v[i] = n
+	}
+	return v, nil
+}
+
+// checkRequiredVersion returns an error if the script requires a newer
+// major or minor version than this one. A newer patch version is only
+// worth a warning: patch releases do not change the language.
+func checkRequiredVersion(required string) error {
+	req, err := parseVersion(required)
+	if err != nil {
+		return err
+	}
+	have, err := parseVersion(Version)
+	if err != nil {
+		return err
+	}
+	switch {
+	case req[0] > have[0],
+		req[0] == have[0] && req[1] > have[1]:
+		return fmt.Errorf("script requires mixtape %s, this is mixtape %s", required, Version)
+	case req[0] == have[0] && req[1] == have[1] && req[2] > have[2]:
+		logger.Warn("script requires a newer patch release", "required", required, "version", Version)
+	}
+	return nil
+}
+
+func init() {
+	RegisterGoFunc("requires", checkRequiredVersion)
+	RegisterGoFunc("version", func() Str {
+		return Str(Version)
+	})
+}
@@ -0,0 +1,111 @@
+//go:build cgo && !js
+
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+// maxTapeZoom limits tape view zoom to 2^maxTapeZoom times the whole tape.
+const maxTapeZoom = 16
+
+// BufferViewState is the part of a buffer's presentation which is
+// remembered across buffer switches and restarts: cursor, scroll
+// position, selection and tape view zoom.
+type BufferViewState struct {
+	Line       int     `json:"line"`
+	Column     int     `json:"column"`
+	Top        int     `json:"top"`
+	Left       int     `json:"left"`
+	MarkActive bool    `json:"markActive,omitempty"`
+	MarkLine   int     `json:"markLine,omitempty"`
+	MarkColumn int     `json:"markColumn,omitempty"`
+	TapeZoom   int     `json:"tapeZoom,omitempty"`
+	TapeCenter float64 `json:"tapeCenter,omitempty"`
+}
+
+// ViewStateStore persists BufferViewStates keyed by file path.
+type ViewStateStore struct {
+	path   string
+	states map[string]BufferViewState
+}
+
+// OpenViewStateStore loads the view states saved at path (if any).
+func OpenViewStateStore(path string) (*ViewStateStore, error) {
+	p, err := expandPath(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &ViewStateStore{
+		path:   p,
+		states: make(map[string]BufferViewState),
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.states); err != nil {
+		logger.Warn("ignoring invalid view state file", "path", p, "error", err)
+		s.states = make(map[string]BufferViewState)
+	}
+	return s, nil
+}
+
+func (s *ViewStateStore) Get(path string) (BufferViewState, bool) {
+	state, ok := s.states[canonicalPath(path)]
+	return state, ok
+}
+
+func (s *ViewStateStore) Put(path string, state BufferViewState) {
+	s.states[canonicalPath(path)] = state
+}
+
+// Save writes all states to disk, replacing the previous file atomically.
+func (s *ViewStateStore) Save() error {
+	data, err := json.MarshalIndent(s.states, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// tapeWindow returns the size and offset of the part of a tape of nf
+// frames which is visible at the given zoom level (a power of two)
+// when the view is centered at center (a fraction of the tape length).
+func tapeWindow(nf int, zoom int, center float64) (size int, offset int) {
+	size = max(1, int(math.Ceil(float64(nf)/float64(int(1)<<zoom))))
+	if size >= nf {
+		return nf, 0
+	}
+	offset = int(math.Round(center*float64(nf))) - size/2
+	offset = min(max(offset, 0), nf-size)
+	return size, offset
+}
+
+// tapeSelection is a region [start,end) of frames selected in the
+// tape view. The zero value means no selection.
+type tapeSelection struct {
+	start, end int
+}
+
+func (sel tapeSelection) active() bool {
+	return sel.end > sel.start
+}
+
+// clamp limits sel to a tape of nf frames.
+func (sel tapeSelection) clamp(nf int) tapeSelection {
+	return tapeSelection{min(sel.start, nf), min(sel.end, nf)}
+}
@@ -4,9 +4,11 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"regexp"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"text/scanner"
 	"unicode"
 )
@@ -74,6 +76,10 @@ type Iterable interface {
 
 var rootEnv = make(Map)
 
+// rootEnvMu guards rootEnv, which is shared by all VMs: in the GUI,
+// several of them may be evaluating at the same time.
+var rootEnvMu sync.RWMutex
+
 func RegisterNum(name string, num Num) {
 	rootEnv.SetVal(name, num)
 }
@@ -87,6 +93,7 @@ func RegisterWord(name string, fun Fun) {
 type VM struct {
 	valStack    Vec           // values
 	envStack    []Map         // environments
+	baseEnvs    []Map         // kept over the root env by Reset, top-level definitions go to the last one
 	markerStack []int         // [ indices in valStack
 	quoteBuffer Vec           // quoted code
 	quoteDepth  int           // nesting level {... {.. {..} ..} ...}
@@ -96,8 +103,21 @@ type VM struct {
 	evalDepth            Box[int] // increases at every ParseAndEval() call
 	cancelRequested      bool     // closed when the current evaluation finishes (success, error, or cancellation).
 	doneCh               chan struct{}
-	evalResult           Val // top of stack after a successful evaluation
+	paused               bool         // evaluation blocks at the next checkpoint
+	pauseCond            *sync.Cond   // signalled when paused or cancelRequested changes
+	evalResult           Val          // top of stack after a successful evaluation
+	resultEnv            Map          // copy of the last base env after a successful evaluation
+	renderStats          *RenderStats // statistics of the last successful evaluation
+	selection            *Tape        // region selected in the tape view
+	sandbox              bool         // refuse file writes, shell-outs and network access
 	tapeProgressCallback func(t *Tape, nftotal, nfdone int)
+	inspectCallback      func(v Val)   // called by the inspect word, logs a description if nil
+	transport            *Transport    // clock of the time-based words
+	cacheGen             atomic.Uint64 // increases at every top-level evaluation, see Cache
+	// :downmix of the last successful evaluation, for playing evalResult
+	resultDownmix channelMatrices
+	// samples reachable after the last top-level evaluation, see releaseUnreachable
+	reachableSampleBytes int64
 }
 
 func CreateVM() (*VM, error) {
@@ -106,7 +126,9 @@ func CreateVM() (*VM, error) {
 		envStack:    []Map{rootEnv},
 		markerStack: make([]int, 0, 16),
 		doneCh:      make(chan struct{}),
+		transport:   &Transport{},
 	}
+	vm.pauseCond = sync.NewCond(&vm.evalMu)
 	return vm, nil
 }
 
@@ -140,15 +162,25 @@ func (vm *VM) Reset() {
 	vm.evalMu.Lock()
 	defer vm.evalMu.Unlock()
 	vm.valStack = vm.valStack[:0]
-	vm.envStack = vm.envStack[:1]
+	vm.envStack = append(vm.envStack[:1], vm.baseEnvs...)
 	vm.markerStack = vm.markerStack[:0]
 	vm.quoteBuffer = nil
 	vm.quoteDepth = 0
 	vm.tokenStack.Set(nil)
 	vm.evalDepth.Set(0)
 	vm.cancelRequested = false
+	vm.paused = false
 	vm.doneCh = make(chan struct{})
 	vm.evalResult = nil
+	vm.renderStats = nil
+}
+
+// SetBaseEnvs layers envs over the root env for the evaluations to
+// come, so that their top-level definitions go to the last of them
+// instead of the root env. It must not be called during evaluation.
+func (vm *VM) SetBaseEnvs(envs ...Map) {
+	vm.baseEnvs = envs
+	vm.envStack = append(vm.envStack[:1], envs...)
 }
 
 func (vm *VM) IsEvaluating() bool {
@@ -157,6 +189,20 @@ func (vm *VM) IsEvaluating() bool {
 	return vm.evalDepth.Get() > 0
 }
 
+// SetSelection sets the tape returned by the selection word.
+func (vm *VM) SetSelection(t *Tape) {
+	vm.evalMu.Lock()
+	defer vm.evalMu.Unlock()
+	vm.selection = t
+}
+
+// Selection returns the region selected in the tape view, or nil.
+func (vm *VM) Selection() *Tape {
+	vm.evalMu.Lock()
+	defer vm.evalMu.Unlock()
+	return vm.selection
+}
+
 func (vm *VM) CancelRequested() bool {
 	vm.evalMu.Lock()
 	defer vm.evalMu.Unlock()
@@ -166,6 +212,7 @@ func (vm *VM) CancelRequested() bool {
 func (vm *VM) CancelEvaluation() {
 	vm.evalMu.Lock()
 	vm.cancelRequested = true
+	vm.pauseCond.Broadcast()
 	doneCh := vm.doneCh
 	vm.evalMu.Unlock()
 	if doneCh != nil {
@@ -173,6 +220,41 @@ func (vm *VM) CancelEvaluation() {
 	}
 }
 
+// PauseEvaluation makes the running evaluation block at its next
+// checkpoint until ResumeEvaluation or CancelEvaluation is called.
+func (vm *VM) PauseEvaluation() {
+	vm.evalMu.Lock()
+	defer vm.evalMu.Unlock()
+	if vm.evalDepth.Get() > 0 {
+		vm.paused = true
+	}
+}
+
+func (vm *VM) ResumeEvaluation() {
+	vm.evalMu.Lock()
+	defer vm.evalMu.Unlock()
+	vm.paused = false
+	vm.pauseCond.Broadcast()
+}
+
+func (vm *VM) IsPaused() bool {
+	vm.evalMu.Lock()
+	defer vm.evalMu.Unlock()
+	return vm.paused
+}
+
+// Checkpoint is called by long-running computations at points where
+// they can be interrupted. It blocks while the evaluation is paused and
+// reports whether it has been cancelled.
+func (vm *VM) Checkpoint() (cancelled bool) {
+	vm.evalMu.Lock()
+	defer vm.evalMu.Unlock()
+	for vm.paused && !vm.cancelRequested {
+		vm.pauseCond.Wait()
+	}
+	return vm.cancelRequested
+}
+
 func (vm *VM) IsQuoting() bool {
 	return vm.quoteDepth > 0
 }
@@ -333,7 +415,7 @@ func (vm *VM) DoPushEnv() error {
 
 func (vm *VM) DoPopEnv() error {
 	stacksize := len(vm.envStack)
-	if stacksize == 1 {
+	if stacksize == 1+len(vm.baseEnvs) {
 		return vm.Errorf("attempt to pop root env")
 	}
 	vm.envStack = vm.envStack[:stacksize-1]
@@ -341,20 +423,33 @@ func (vm *VM) DoPopEnv() error {
 }
 
 func (vm *VM) SetVal(k, v any) {
+	if len(vm.envStack) == 1 {
+		rootEnvMu.Lock()
+		defer rootEnvMu.Unlock()
+	}
 	env := vm.TopEnv()
 	env.SetVal(k, v)
 }
 
 func (vm *VM) GetVal(k any) Val {
 	index := len(vm.envStack) - 1
-	for index >= 0 {
+	for index > 0 {
 		env := vm.envStack[index]
 		if val := env.GetVal(k); val != nil {
 			return val
 		}
 		index--
 	}
-	return nil
+	rootEnvMu.RLock()
+	defer rootEnvMu.RUnlock()
+	return vm.envStack[0].GetVal(k)
+}
+
+// SetGlobalVal sets k in the root env, whatever envs are on top of it.
+func (vm *VM) SetGlobalVal(k, v any) {
+	rootEnvMu.Lock()
+	defer rootEnvMu.Unlock()
+	rootEnv.SetVal(k, v)
 }
 
 func Get[T Val](vm *VM, k any) (T, error) {
@@ -436,6 +531,32 @@ func (t *Token) Equal(other Val) bool {
 	return Equal(t.getVal(), other.getVal())
 }
 
+var noteRegex = regexp.MustCompile(`(?i)^[cdefgab][#-][0-9]$`)
+
+// parseNoteName converts a tracker style note name (c-4, d#5) into a
+// MIDI note number.
+func parseNoteName(text string) (int, bool) {
+	if !noteRegex.MatchString(text) {
+		return 0, false
+	}
+	note := strings.ToLower(text)
+	base := map[byte]int{
+		'c': 0,
+		'd': 2,
+		'e': 4,
+		'f': 5,
+		'g': 7,
+		'a': 9,
+		'b': 11,
+	}[note[0]]
+	acc := 0
+	if note[1] == '#' {
+		acc = 1
+	}
+	octave := int(note[2] - '0')
+	return octave*12 + base + acc, true
+}
+
 func (vm *VM) Parse(r io.Reader, filename string) (Vec, error) {
 	var s scanner.Scanner
 	s.Init(r)
@@ -464,7 +585,6 @@ func (vm *VM) Parse(r io.Reader, filename string) (Vec, error) {
 	}
 	s.Filename = filename
 	var code = make(Vec, 0, 16384)
-	noteRegex := regexp.MustCompile(`(?i)^[cdefgab][#-][0-9]$`)
 	appendTokens := func(text string, vs ...Val) {
 		pos := s.Position
 		length := len(text)
@@ -502,23 +622,7 @@ func (vm *VM) Parse(r io.Reader, filename string) (Vec, error) {
 				default:
 					appendTokens(text, Num(f))
 				}
-			} else if noteRegex.MatchString(text) {
-				note := strings.ToLower(text)
-				base := map[byte]int{
-					'c': 0,
-					'd': 2,
-					'e': 4,
-					'f': 5,
-					'g': 7,
-					'a': 9,
-					'b': 11,
-				}[note[0]]
-				acc := 0
-				if note[1] == '#' {
-					acc = 1
-				}
-				octave := int(note[2] - '0')
-				midi := octave*12 + base + acc
+			} else if midi, ok := parseNoteName(text); ok {
 				appendTokens(text, Num(midi))
 			} else {
 				if len(text) > 1 {
@@ -539,7 +643,7 @@ func (vm *VM) Parse(r io.Reader, filename string) (Vec, error) {
 				}
 			}
 		default:
-			return nil, Err{Pos: s.Position, Err: fmt.Errorf("parse error at %s: %s", s.Position, s.TokenText())}
+			return nil, Err{Pos: s.Position, Len: len(s.TokenText()), Err: fmt.Errorf("parse error at %s: %s", s.Position, s.TokenText())}
 		}
 	}
 	return code, nil
@@ -568,20 +672,27 @@ func (vm *VM) Err(err error) error {
 	}
 	// Prefer the most recent non-prelude token on the stack (i.e., a user call
 	// site), falling back to the innermost token that raised the error.
-	var fallback *Token
+	var found, fallback *Token
+	var trace []scanner.Position
 	stack := vm.tokenStack.Get()
 	for i := len(stack) - 1; i >= 0; i-- {
 		if tok := stack[i]; tok != nil {
-			if tok.pos.Filename != "<prelude>" {
-				return Err{Pos: tok.pos, Err: err}
+			if n := len(trace); n == 0 || trace[n-1] != tok.pos {
+				trace = append(trace, tok.pos)
+			}
+			if found == nil && tok.pos.Filename != "<prelude>" {
+				found = tok
 			}
 			if fallback == nil {
 				fallback = tok
 			}
 		}
 	}
-	if fallback != nil {
-		return Err{Pos: fallback.pos, Err: err}
+	if found == nil {
+		found = fallback
+	}
+	if found != nil {
+		return Err{Pos: found.pos, Len: found.length, Err: err, Trace: trace}
 	}
 	return Err{Err: err}
 }
@@ -591,7 +702,7 @@ func (vm *VM) Errorf(format string, a ...any) error {
 }
 
 func (vm *VM) Eval(val Val) error {
-	if vm.CancelRequested() {
+	if vm.Checkpoint() {
 		// someone called CancelEvaluation()
 		return ErrEvalCancelled
 	}
@@ -629,8 +740,12 @@ func (vm *VM) Eval(val Val) error {
 
 func (vm *VM) ParseAndEval(r io.Reader, filename string) error {
 	evalDepth := vm.evalDepth.Get()
+	var statsStart renderStatsStart
 	if evalDepth == 0 {
 		vm.Reset()
+		vm.releaseUnreachable()
+		statsStart = startRenderStats()
+		vm.cacheGen.Add(1)
 	}
 
 	code, parseErr := vm.Parse(r, filename)
@@ -648,6 +763,9 @@ func (vm *VM) ParseAndEval(r io.Reader, filename string) error {
 	}
 
 	// end of top-level evaluation
+	if evalErr == nil {
+		vm.resultDownmix, evalErr = downmixMatrices(vm)
+	}
 	if evalErr == nil {
 		result := vm.Top()
 		if stream, ok := result.(Stream); ok {
@@ -656,7 +774,16 @@ func (vm *VM) ParseAndEval(r io.Reader, filename string) error {
 			}
 		}
 		vm.evalResult = result
+		vm.renderStats = statsStart.finish(result)
+		vm.resultEnv = nil
+		if n := len(vm.baseEnvs); n > 0 {
+			vm.resultEnv = maps.Clone(vm.baseEnvs[n-1])
+		}
 	}
+	vm.releaseUnreachable()
+	vm.evalMu.Lock()
+	vm.paused = false
+	vm.evalMu.Unlock()
 	close(vm.doneCh)
 	return evalErr
 }
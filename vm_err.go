@@ -1,13 +1,22 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 	"text/scanner"
 )
 
+// maxTraceFrames is the number of frames shown by Err.Traceback.
+const maxTraceFrames = 16
+
 type Err struct {
 	Pos scanner.Position
+	Len int // length of the token at Pos, 0 if unknown
 	Err error
+	// positions of the tokens being evaluated when the error was
+	// raised, innermost first
+	Trace []scanner.Position
 }
 
 func (e Err) getVal() Val {
@@ -27,9 +36,86 @@ func (e Err) Error() string {
 
 func (e Err) Unwrap() error { return e.Err }
 
+// Traceback describes the tokens being evaluated when the error was
+// raised, one per line, innermost first. It returns "" if the trace
+// shows nothing beyond the position of the error.
+func (e Err) Traceback() string {
+	if len(e.Trace) == 0 || len(e.Trace) == 1 && e.Trace[0] == e.Pos {
+		return ""
+	}
+	var sb strings.Builder
+	for i, pos := range e.Trace {
+		if i > 0 {
+			sb.WriteByte('\n')
+		}
+		if i == maxTraceFrames {
+			fmt.Fprintf(&sb, "  ... %d more", len(e.Trace)-i)
+			break
+		}
+		fmt.Fprintf(&sb, "  at %s:%d:%d", pos.Filename, pos.Line, pos.Column)
+	}
+	return sb.String()
+}
+
+// formatError returns the message of err followed by its traceback.
+func formatError(err error) string {
+	var e Err
+	if errors.As(err, &e) {
+		if tb := e.Traceback(); tb != "" {
+			return err.Error() + "\n" + tb
+		}
+	}
+	return err.Error()
+}
+
 func makeErr(err error) Err {
 	if wrappedErr, ok := err.(Err); ok {
 		return wrappedErr
 	}
 	return Err{Err: err}
 }
+
+func init() {
+	RegisterGoFunc("err?", func(v Val) bool {
+		_, ok := v.(Err)
+		return ok
+	})
+
+	RegisterMethod[Err]("err/message", 1, func(vm *VM) error {
+		e, err := Pop[Err](vm)
+		if err != nil {
+			return err
+		}
+		vm.Push(Str(e.Err.Error()))
+		return nil
+	})
+
+	RegisterMethod[Err]("err/pos", 1, func(vm *VM) error {
+		e, err := Pop[Err](vm)
+		if err != nil {
+			return err
+		}
+		if e.Pos.Line == 0 {
+			vm.Push(Nil)
+		} else {
+			vm.Push(Str(fmt.Sprintf("%s:%d:%d", e.Pos.Filename, e.Pos.Line, e.Pos.Column)))
+		}
+		return nil
+	})
+
+	// err/value returns the value thrown by throw, or nil if the error
+	// was raised by a word
+	RegisterMethod[Err]("err/value", 1, func(vm *VM) error {
+		e, err := Pop[Err](vm)
+		if err != nil {
+			return err
+		}
+		var tv ThrowValue
+		if errors.As(e.Err, &tv) {
+			vm.Push(tv.v)
+		} else {
+			vm.Push(Nil)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+)
+
+var (
+	vmPtrType  = reflect.TypeFor[*VM]()
+	errorType  = reflect.TypeFor[error]()
+	valType    = reflect.TypeFor[Val]()
+	streamType = reflect.TypeFor[Stream]()
+)
+
+// goFuncArg converts a value popped from the stack to a Go argument
+// of type t. The supported types are Num, float64, int, bool, Str,
+// string, Stream (from anything streamable) and any type implementing
+// Val (*Tape, Vec, Map, Val itself, ...).
+func goFuncArg(v Val, t reflect.Type) (reflect.Value, error) {
+	switch t {
+	case streamType:
+		s, err := streamFromVal(v)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return reflect.ValueOf(s), nil
+	}
+	switch t.Kind() {
+	case reflect.Float64, reflect.Int:
+		n, ok := v.(Num)
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("expected number, got %T", v)
+		}
+		if t.Kind() == reflect.Int {
+			return reflect.ValueOf(int(n)).Convert(t), nil
+		}
+		return reflect.ValueOf(float64(n)).Convert(t), nil
+	case reflect.Bool:
+		n, ok := v.(Num)
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("expected boolean, got %T", v)
+		}
+		return reflect.ValueOf(n != 0), nil
+	case reflect.String:
+		s, ok := v.(Str)
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("expected string, got %T", v)
+		}
+		return reflect.ValueOf(string(s)).Convert(t), nil
+	}
+	if v != nil && reflect.TypeOf(v).AssignableTo(t) {
+		return reflect.ValueOf(v), nil
+	}
+	return reflect.Value{}, fmt.Errorf("expected %s, got %T", t, v)
+}
+
+func goFuncArgTypeSupported(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Float64, reflect.Int, reflect.Bool, reflect.String:
+		return true
+	}
+	return t == streamType || t.Implements(valType)
+}
+
+func goFuncResultTypeSupported(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Float64, reflect.Int, reflect.Bool, reflect.String:
+		return true
+	}
+	return t.Implements(valType)
+}
+
+// adaptGoFunc wraps fn into a Fun which pops the arguments of fn from
+// the stack (the last argument is on top), calls fn and pushes its
+// results. fn may take *VM as its first parameter and may return an
+// error as its last result. It returns the Fun and the number of
+// stack arguments. Unsupported signatures panic: this is a programming
+// error detected at registration time.
+func adaptGoFunc(name string, fn any) (Fun, int) {
+	fv := reflect.ValueOf(fn)
+	ft := fv.Type()
+	if ft.Kind() != reflect.Func || ft.IsVariadic() {
+		panic(fmt.Sprintf("RegisterGoFunc %s: expected non-variadic func, got %s", name, ft))
+	}
+	withVM := ft.NumIn() > 0 && ft.In(0) == vmPtrType
+	var argTypes []reflect.Type
+	for i := range ft.NumIn() {
+		if i == 0 && withVM {
+			continue
+		}
+		t := ft.In(i)
+		if !goFuncArgTypeSupported(t) {
+			panic(fmt.Sprintf("RegisterGoFunc %s: unsupported parameter type %s", name, t))
+		}
+		argTypes = append(argTypes, t)
+	}
+	nresults := ft.NumOut()
+	withErr := nresults > 0 && ft.Out(nresults-1) == errorType
+	if withErr {
+		nresults--
+	}
+	for i := range nresults {
+		if t := ft.Out(i); !goFuncResultTypeSupported(t) {
+			panic(fmt.Sprintf("RegisterGoFunc %s: unsupported result type %s", name, t))
+		}
+	}
+	nargs := len(argTypes)
+	fun := func(vm *VM) error {
+		if len(vm.valStack) < nargs {
+			return vm.Errorf("%s: stack underflow", name)
+		}
+		in := make([]reflect.Value, 0, ft.NumIn())
+		if withVM {
+			in = append(in, reflect.ValueOf(vm))
+		}
+		args := vm.valStack[len(vm.valStack)-nargs:]
+		for i, t := range argTypes {
+			arg, err := goFuncArg(args[i], t)
+			if err != nil {
+				return vm.Errorf("%s: argument %d: %w", name, i+1, err)
+			}
+			in = append(in, arg)
+		}
+		vm.valStack = vm.valStack[:len(vm.valStack)-nargs]
+		out := fv.Call(in)
+		if withErr {
+			if err, _ := out[nresults].Interface().(error); err != nil {
+				return vm.Errorf("%s: %w", name, err)
+			}
+		}
+		for _, result := range out[:nresults] {
+			vm.Push(result.Interface())
+		}
+		return nil
+	}
+	return fun, nargs
+}
+
+// RegisterGoFunc registers an ordinary Go function as a word, for
+// example:
+//
+//	RegisterGoFunc("tape/silence", func(nchannels, nframes int) *Tape { ... })
+//
+// See adaptGoFunc for the supported signatures.
+func RegisterGoFunc(name string, fn any) {
+	fun, _ := adaptGoFunc(name, fn)
+	RegisterWord(name, fun)
+}
+
+// RegisterGoMethod registers an ordinary Go function as a method of
+// T, which must be the type of its first stack argument.
+func RegisterGoMethod[T any](name string, fn any) {
+	fun, nargs := adaptGoFunc(name, fn)
+	RegisterMethod[T](name, nargs, fun)
+}
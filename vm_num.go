@@ -146,10 +146,12 @@ func (n Num) String() string {
 }
 
 func (n Num) Stream() Stream {
-	return makeRewindableStream(1, 0, func() Stepper {
-		out := Frame{Smp(n)}
-		return func() (Frame, bool) {
-			return out, true
+	return makeBlockStream(1, 0, func() BlockStepper {
+		return func(buf []Smp) int {
+			for i := range buf {
+				buf[i] = Smp(n)
+			}
+			return len(buf)
 		}
 	})
 }
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// vocoderMaxBands limits :vocoder/bands.
+const vocoderMaxBands = 128
+
+// svfBandpass is a band-pass of unity gain at its center, made of two
+// TPT SVF stages in series (like bp2, with fixed coefficients) for the
+// steeper skirts a filter bank needs.
+type svfBandpass struct {
+	a1, a2, a3, k float64
+	ic1, ic2      [2][]float64 // per stage, per channel
+}
+
+func newSVFBandpass(freq, q float64, nchannels int) *svfBandpass {
+	g := svfCoefficient(freq)
+	k := 1 / q
+	a1 := 1 / (1 + g*(g+k))
+	f := &svfBandpass{a1: a1, a2: g * a1, a3: g * g * a1, k: k}
+	for i := range 2 {
+		f.ic1[i] = make([]float64, nchannels)
+		f.ic2[i] = make([]float64, nchannels)
+	}
+	return f
+}
+
+func (f *svfBandpass) step(c int, x float64) float64 {
+	for i := range 2 {
+		v3 := x - f.ic2[i][c]
+		v1 := f.a1*f.ic1[i][c] + f.a2*v3
+		v2 := f.ic2[i][c] + f.a2*f.ic1[i][c] + f.a3*v3
+		f.ic1[i][c] = 2*v1 - f.ic1[i][c]
+		f.ic2[i][c] = 2*v2 - f.ic2[i][c]
+		x = f.k * v1
+	}
+	return x
+}
+
+// vocoderBands returns the center frequencies of n bands spaced evenly
+// in pitch from lo to hi Hz, and the Q which makes neighbouring bands
+// cross at their -3 dB points. A single band is an octave wide.
+func vocoderBands(n int, lo, hi float64) ([]float64, float64) {
+	freqs := make([]float64, n)
+	ratio := 2.0
+	if n == 1 {
+		freqs[0] = math.Sqrt(lo * hi)
+	} else {
+		ratio = math.Pow(hi/lo, 1/float64(n-1))
+		for i := range freqs {
+			freqs[i] = lo * math.Pow(ratio, float64(i))
+		}
+	}
+	// at the edges of the band, a factor of sqrt(ratio) away from the
+	// center, each of the two stages is down by 1.5 dB
+	u := math.Sqrt(ratio) - 1/math.Sqrt(ratio)
+	return freqs, math.Sqrt(math.Sqrt2-1) / u
+}
+
+// Vocoder splits the mono sum of modulator and each channel of carrier
+// into n bands from lo to hi Hz, follows the amplitude of each band of
+// the modulator with the attack and release times in seconds, and sums
+// the bands of the carrier, each scaled by the amplitude of its band in
+// the modulator.
+func Vocoder(modulator, carrier Stream, n int, lo, hi, attack, release float64) Stream {
+	nchannels := carrier.nchannels
+	return makeTransformStream([]Stream{carrier, modulator}, func(inputs []Stream) Stepper {
+		cnext := inputs[0].Next
+		mnext := inputs[1].Mono().Next
+		sr := float64(SampleRate())
+		freqs, q := vocoderBands(n, lo, hi)
+		mbands := make([]*svfBandpass, n)
+		cbands := make([]*svfBandpass, n)
+		followers := make([]*ampFollower, n)
+		for i, f := range freqs {
+			mbands[i] = newSVFBandpass(f, q, 1)
+			cbands[i] = newSVFBandpass(f, q, nchannels)
+			followers[i] = &ampFollower{
+				attack:  1 - math.Exp(-1/(attack*sr)),
+				release: 1 - math.Exp(-1/(release*sr)),
+			}
+		}
+		out := make(Frame, nchannels)
+		return func() (Frame, bool) {
+			cframe, ok := cnext()
+			if !ok {
+				return nil, false
+			}
+			mframe, ok := mnext()
+			if !ok {
+				return nil, false
+			}
+			clear(out)
+			for i := range n {
+				// the mean of a rectified sine is 2/pi of its peak
+				amp := followers[i].step(mbands[i].step(0, mframe[0])) * math.Pi / 2
+				for c, x := range cframe {
+					out[c] += amp * cbands[i].step(c, x)
+				}
+			}
+			return out, true
+		}
+	})
+}
+
+func init() {
+	RegisterWord("vocoder", func(vm *VM) error {
+		carrier, err := streamFromVal(vm.Pop())
+		if err != nil {
+			return err
+		}
+		modulator, err := streamFromVal(vm.Pop())
+		if err != nil {
+			return err
+		}
+		n, err := vm.GetInt(":vocoder/bands")
+		if err != nil {
+			return err
+		}
+		if n < 1 || n > vocoderMaxBands {
+			return fmt.Errorf("vocoder: :vocoder/bands must be in 1..%d, got %d", vocoderMaxBands, n)
+		}
+		lo, err := positiveEnvFloat(vm, "vocoder", ":vocoder/min")
+		if err != nil {
+			return err
+		}
+		hi, err := positiveEnvFloat(vm, "vocoder", ":vocoder/max")
+		if err != nil {
+			return err
+		}
+		if lo >= hi || hi >= float64(SampleRate())/2 {
+			return fmt.Errorf("vocoder: expected :vocoder/min < :vocoder/max < %v Hz, got %v and %v", SampleRate()/2, lo, hi)
+		}
+		attack, err := positiveEnvFloat(vm, "vocoder", ":vocoder/attack")
+		if err != nil {
+			return err
+		}
+		release, err := positiveEnvFloat(vm, "vocoder", ":vocoder/release")
+		if err != nil {
+			return err
+		}
+		vm.Push(Vocoder(modulator, carrier, n, lo, hi, attack, release))
+		return nil
+	})
+}
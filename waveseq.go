@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// waveStep is one step of a wave sequence: a wavetable played for
+// nframes frames, the last xfade of which crossfade to the next step.
+type waveStep struct {
+	wt      *Wavetable
+	nframes int
+	xfade   int
+}
+
+// WaveSequence plays the steps one after the other at freq, from one
+// shared phase, like the wave sequences of a Korg Wavestation. It
+// starts over after the last step if loop is set, and stays on the
+// last one otherwise.
+func WaveSequence(freq Stream, steps []waveStep, loop bool, phase float64) Stream {
+	return makeRewindableStream(1, 0, func() Stepper {
+		fnext := freq.clone().Mono().Next
+		ph := phase
+		if ph < 0.0 || ph >= 1.0 {
+			ph = 0.0
+		}
+		sr := float64(SampleRate())
+		step, pos := 0, 0 // current step, frame within it
+		out := make(Frame, 1)
+		return func() (Frame, bool) {
+			fframe, ok := fnext()
+			if !ok {
+				return nil, false
+			}
+			f := fframe[0]
+			cur := steps[step]
+			last := step == len(steps)-1 && !loop
+			smp := cur.wt.SampleMip(ph, 0, f, sr)
+			if fadeStart := cur.nframes - cur.xfade; !last && pos >= fadeStart {
+				next := steps[(step+1)%len(steps)]
+				t := float64(pos-fadeStart+1) / float64(cur.xfade+1)
+				smp = (1-t)*smp + t*next.wt.SampleMip(ph, 0, f, sr)
+			}
+			out[0] = smp
+			ph = math.Mod(ph+f/sr, 1.0)
+			if !last {
+				pos++
+				if pos == cur.nframes {
+					step = (step + 1) % len(steps)
+					pos = 0
+				}
+			}
+			return out, true
+		}
+	})
+}
+
+func init() {
+	RegisterWord("~waveseq", func(vm *VM) error {
+		stepsVal := vm.Pop()
+		stepVec, ok := stepsVal.(Vec)
+		if !ok || len(stepVec) == 0 {
+			return fmt.Errorf("~waveseq: expected a vector of [ wave beats ] steps, got %v", stepsVal)
+		}
+		bpm, err := getBPM(vm, "~waveseq")
+		if err != nil {
+			return err
+		}
+		framesPerBeat := float64(SampleRate()) * 60 / bpm
+		defaultXfade, err := vm.GetFloat(":waveseq/xfade")
+		if err != nil {
+			return err
+		}
+		steps := make([]waveStep, len(stepVec))
+		for i, v := range stepVec {
+			step, ok := v.(Vec)
+			if !ok || len(step) < 2 || len(step) > 3 {
+				return fmt.Errorf("~waveseq: step %d: expected [ wave beats ] or [ wave beats xfade ], got %v", i, v)
+			}
+			wt, err := vm.wavetableFromVal(step[0])
+			if err != nil {
+				return fmt.Errorf("~waveseq: step %d: %w", i, err)
+			}
+			beats, ok := step[1].(Num)
+			if !ok || beats <= 0 {
+				return fmt.Errorf("~waveseq: step %d: length must be a positive number of beats, got %v", i, step[1])
+			}
+			xfade := defaultXfade
+			if len(step) == 3 {
+				n, ok := step[2].(Num)
+				if !ok || n < 0 {
+					return fmt.Errorf("~waveseq: step %d: crossfade must be a number of beats >= 0, got %v", i, step[2])
+				}
+				xfade = float64(n)
+			}
+			nframes := max(int(float64(beats)*framesPerBeat), 1)
+			steps[i] = waveStep{
+				wt:      wt,
+				nframes: nframes,
+				xfade:   min(max(int(xfade*framesPerBeat), 0), nframes),
+			}
+		}
+		freq, err := vm.GetStream(":freq")
+		if err != nil {
+			return err
+		}
+		phase, err := vm.GetFloat(":phase")
+		if err != nil {
+			return err
+		}
+		loop := true
+		if v := vm.GetVal(":waveseq/loop"); v != nil {
+			n, ok := v.(Num)
+			if !ok {
+				return fmt.Errorf("~waveseq: :waveseq/loop must be a boolean, got %v", v)
+			}
+			loop = n != 0
+		}
+		vm.Push(WaveSequence(freq, steps, loop, phase))
+		return nil
+	})
+}
@@ -0,0 +1,67 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"syscall/js"
+)
+
+// float32ArrayFromChannel copies channel ch of t into a new JS Float32Array.
+func float32ArrayFromChannel(t *Tape, ch int) js.Value {
+	buf := make([]byte, 4*t.nframes)
+	for i := range t.nframes {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(float32(t.samples[i*t.nchannels+ch])))
+	}
+	u8 := js.Global().Get("Uint8Array").New(len(buf))
+	js.CopyBytesToJS(u8, buf)
+	return js.Global().Get("Float32Array").New(u8.Get("buffer"))
+}
+
+// evalForJS evaluates script and describes the outcome as a JS object:
+// error (string or null), result (printed top of stack) and, if the
+// result is a tape, its sample rate and one Float32Array per channel.
+func evalForJS(vm *VM, script string) js.Value {
+	out := js.Global().Get("Object").New()
+	err := vm.ParseAndEval(bytes.NewReader([]byte(script)), "<web>")
+	if err != nil {
+		out.Set("error", err.Error())
+		return out
+	}
+	out.Set("error", js.Null())
+	result := vm.evalResult
+	if result == nil {
+		return out
+	}
+	out.Set("result", result.String())
+	if t, ok := result.(*Tape); ok {
+		channels := make([]any, t.nchannels)
+		for ch := range t.nchannels {
+			channels[ch] = float32ArrayFromChannel(t, ch)
+		}
+		out.Set("sampleRate", SampleRate())
+		out.Set("channels", js.ValueOf(channels))
+	}
+	return out
+}
+
+// runGui exposes the VM to the hosting page as the global mixtape
+// object (see web/index.html) and keeps the program alive.
+func runGui(vm *VM, args []string) error {
+	evalFunc := js.FuncOf(func(this js.Value, jsArgs []js.Value) any {
+		if len(jsArgs) != 1 {
+			return js.ValueOf(map[string]any{"error": "usage: mixtape.eval(script)"})
+		}
+		return evalForJS(vm, jsArgs[0].String())
+	})
+	js.Global().Set("mixtape", js.ValueOf(map[string]any{
+		"eval":       evalFunc,
+		"sampleRate": SampleRate(),
+	}))
+	if ready := js.Global().Get("onMixtapeReady"); ready.Type() == js.TypeFunction {
+		ready.Invoke()
+	}
+	select {}
+}
@@ -21,6 +21,10 @@ func init() {
 
 	RegisterWord("throw", func(vm *VM) error {
 		v := vm.Pop()
+		if e, ok := v.(Err); ok {
+			// rethrow an error caught by try
+			return e
+		}
 		return vm.Err(ThrowValue{v})
 	})
 
@@ -41,6 +45,41 @@ func init() {
 		return err
 	})
 
+	RegisterWord("try", func(vm *VM) error {
+		handler := vm.Pop()
+		body := vm.Pop()
+		stackState := vm.SaveStackState()
+		err := vm.Eval(body)
+		if err == nil || errors.Is(err, ErrEvalCancelled) {
+			return err
+		}
+		vm.RestoreStackState(stackState)
+		vm.Push(makeErr(err))
+		return vm.Eval(handler)
+	})
+
+	RegisterWord("with-cleanup", func(vm *VM) error {
+		cleanup := vm.Pop()
+		body := vm.Pop()
+		stackState := vm.SaveStackState()
+		err := vm.Eval(body)
+		if errors.Is(err, ErrEvalCancelled) {
+			// the cancelled evaluation would stop the cleanup too
+			return err
+		}
+		if err != nil {
+			vm.RestoreStackState(stackState)
+		}
+		if cleanupErr := vm.Eval(cleanup); cleanupErr != nil {
+			if err == nil {
+				return cleanupErr
+			}
+			// the error of body is the one to report
+			logger.Warn("with-cleanup: cleanup failed after body failed", "error", cleanupErr)
+		}
+		return err
+	})
+
 	RegisterWord("loop", func(vm *VM) error {
 		body := vm.Pop()
 		for {
@@ -141,6 +180,16 @@ func init() {
 		return nil
 	})
 
+	RegisterWord("global-set", func(vm *VM) error {
+		k := vm.Pop()
+		if sym, ok := k.(Sym); ok {
+			k = Str(sym)
+		}
+		v := vm.Pop()
+		vm.SetGlobalVal(k, v)
+		return nil
+	})
+
 	RegisterWord("get", func(vm *VM) error {
 		k := vm.Pop()
 		if sym, ok := k.(Sym); ok {
@@ -3,17 +3,35 @@ package main
 import (
 	"fmt"
 	"math"
+	"sync"
+	"sync/atomic"
 )
 
+// MaxMipLevel is the highest mip level of a wavetable unless
+// configured otherwise (see mipStrategy).
 const MaxMipLevel = 8
 
+// morphTraceStep is the number of frames between the morph positions
+// recorded by wavetable oscillators for the wavetable view.
+const morphTraceStep = 256
+
+// maxMorphTrace limits the length of the recorded morph trace.
+const maxMorphTrace = 1 << 20
+
 // Waveset is an array of single-channel tapes at a given level of a wavetable
 type Waveset []*Tape
 
 // Wavetable represents a collection of single-cycle waves with optional wave morphing.
 // Level 0 contains the base waves; additional mip levels are built lazily on demand.
 type Wavetable struct {
-	mips []Waveset // mips[level][wave][sample]; level 0 is the base table
+	mips     []Waveset // mips[level][wave][sample]; level 0 is the base table, nil until built
+	strategy mipStrategy
+	mipMu    sync.Mutex   // serializes building levels
+	built    atomic.Int32 // levels below built are ready to be read without mipMu
+	warps    []wtWarp     // applied to the phase by oscillators, see wtwarp.go
+
+	traceMu    sync.Mutex
+	morphTrace []float32 // morph of the last oscillator run over the table, one per morphTraceStep frames
 }
 
 func newWavetableFromWaveset(baseWaves Waveset) (*Wavetable, error) {
@@ -30,10 +48,17 @@ func newWavetableFromWaveset(baseWaves Waveset) (*Wavetable, error) {
 		}
 		t.removeDCInPlace()
 	}
-	wt := &Wavetable{}
-	wt.mips = make([]Waveset, 0, MaxMipLevel)
-	wt.mips = append(wt.mips, baseWaves)
-	return wt, nil
+	return newWavetable(baseWaves, defaultMipStrategy), nil
+}
+
+// newWavetable returns a wavetable over baseWaves (already checked and
+// without DC) building its mip levels according to strategy.
+func newWavetable(baseWaves Waveset, strategy mipStrategy) *Wavetable {
+	wt := &Wavetable{strategy: strategy}
+	wt.mips = make([]Waveset, strategy.maxLevel+1)
+	wt.mips[0] = baseWaves
+	wt.built.Store(1)
+	return wt
 }
 
 func newWavetableFromWave(baseWave *Tape) (*Wavetable, error) {
@@ -43,7 +68,7 @@ func newWavetableFromWave(baseWave *Tape) (*Wavetable, error) {
 func (wt *Wavetable) getVal() Val { return wt }
 
 func (wt *Wavetable) String() string {
-	levels := len(wt.mips)
+	levels := int(wt.built.Load())
 	waves := 0
 	size := 0
 	if levels > 0 {
@@ -52,6 +77,9 @@ func (wt *Wavetable) String() string {
 			size = wt.mips[0][0].nframes
 		}
 	}
+	if len(wt.warps) > 0 {
+		return fmt.Sprintf("Wavetable(waves=%d size=%d levels=%d warps=%s)", waves, size, levels, wt.warpNames())
+	}
 	return fmt.Sprintf("Wavetable(waves=%d size=%d levels=%d)", waves, size, levels)
 }
 
@@ -66,34 +94,62 @@ func (wt *Wavetable) Tape() *Tape {
 	return baseWaveset[0]
 }
 
-// ensureLevel builds mip level l if not present, ensuring l-1 exists first.
-func (wt *Wavetable) ensureLevel(l int) {
-	if l <= 0 {
-		return
+// recordMorph appends the morph position of frame n of an oscillator
+// run to the morph trace, starting a new trace at frame 0.
+func (wt *Wavetable) recordMorph(n int, morph Smp) {
+	wt.traceMu.Lock()
+	defer wt.traceMu.Unlock()
+	if n == 0 {
+		wt.morphTrace = wt.morphTrace[:0]
 	}
-	if l >= len(wt.mips) {
-		wt.ensureLevel(l - 1)
+	if len(wt.morphTrace) < maxMorphTrace {
+		wt.morphTrace = append(wt.morphTrace, float32(min(max(morph, 0), 1)))
 	}
-	for len(wt.mips) <= l {
-		wt.mips = append(wt.mips, nil)
+}
+
+// morphAt returns the morph position the last oscillator run over the
+// table was at in frame n. Played back in sync with a tape rendered
+// from that oscillator, it shows where in the table the sound is.
+func (wt *Wavetable) morphAt(n int) (float64, bool) {
+	wt.traceMu.Lock()
+	defer wt.traceMu.Unlock()
+	i := n / morphTraceStep
+	if n < 0 || i >= len(wt.morphTrace) {
+		return 0, false
 	}
-	if wt.mips[l] != nil {
+	return float64(wt.morphTrace[i]), true
+}
+
+// ensureLevel builds the mip levels up to l (clamped to the highest
+// level of the table) which have not been built yet. It is safe to call
+// from several goroutines, which wait for each other.
+func (wt *Wavetable) ensureLevel(l int) {
+	l = min(l, len(wt.mips)-1)
+	for int(wt.built.Load()) <= l {
+		wt.buildNextLevel()
+	}
+}
+
+// buildNextLevel builds the lowest mip level not built yet.
+func (wt *Wavetable) buildNextLevel() {
+	wt.mipMu.Lock()
+	defer wt.mipMu.Unlock()
+	l := int(wt.built.Load())
+	if l >= len(wt.mips) {
 		return
 	}
 	prev := wt.mips[l-1]
-	size := prev[0].nframes
-	if size <= 16 {
+	harmonics, size, ok := wt.strategy.levelSize(l, wt.mips[0][0].nframes)
+	if !ok {
 		wt.mips[l] = prev
-		return
-	}
-
-	next := make(Waveset, len(prev))
-	for i, wave := range prev {
-		nextWave := wave.buildFFTLowpass()
-		nextWave.removeDCInPlace()
-		next[i] = nextWave
+	} else {
+		next := make(Waveset, len(prev))
+		for i, wave := range prev {
+			next[i] = bandlimitWave(wave, harmonics, size, wt.strategy.smooth)
+		}
+		wt.mips[l] = next
 	}
-	wt.mips[l] = next
+	wt.built.Store(int32(l + 1))
 }
 
 // selectMipLevel chooses a mip level based on instantaneous frequency.
@@ -155,7 +211,8 @@ func (wt *Wavetable) SampleMip(phase, morph, freq float64, sr float64) Smp {
 	}
 	baseWaves := wt.mips[0]
 	baseWaveSize := baseWaves[0].nframes
-	lvl := min(selectMipLevel(float64(freq), sr, baseWaveSize), MaxMipLevel)
+	maxLevel := len(wt.mips) - 1
+	lvl := min(selectMipLevel(float64(freq), sr, baseWaveSize), maxLevel)
 	wt.ensureLevel(lvl)
 	// choose second level for crossfade if available
 	lvl2 := lvl
@@ -171,8 +228,8 @@ func (wt *Wavetable) SampleMip(phase, morph, freq float64, sr float64) Smp {
 			fade = 1
 		}
 	}
-	if lvl2 > MaxMipLevel {
-		lvl2 = MaxMipLevel
+	if lvl2 > maxLevel {
+		lvl2 = maxLevel
 	}
 	wt.ensureLevel(lvl2)
 	s0 := wt.sampleWaveAtLevel(lvl, phase, morph)
@@ -226,6 +283,7 @@ func WavetableOsc(freq Stream, phase float64, wt *Wavetable, morph Stream) Strea
 	return makeRewindableStream(1, 0, func() Stepper {
 		fnext := freq.Mono().Next
 		mnext := morph.Mono().Next
+		warp := wt.newWarpReader()
 		p := phase
 		if p < 0.0 || p >= 1.0 {
 			p = 0.0
@@ -233,6 +291,7 @@ func WavetableOsc(freq Stream, phase float64, wt *Wavetable, morph Stream) Strea
 		ph := Smp(p)
 		sr := Smp(SampleRate())
 		out := make(Frame, 1)
+		n := 0
 		return func() (Frame, bool) {
 			mframe, mok := mnext()
 			if !mok {
@@ -242,7 +301,15 @@ func WavetableOsc(freq Stream, phase float64, wt *Wavetable, morph Stream) Strea
 			if !fok {
 				return nil, false
 			}
-			out[0] = wt.SampleMip(ph, mframe[0], fframe[0], float64(sr))
+			if !warp.next() {
+				return nil, false
+			}
+			if n%morphTraceStep == 0 {
+				wt.recordMorph(n, mframe[0])
+			}
+			n++
+			wph, gain, mult := warp.apply(ph)
+			out[0] = gain * wt.SampleMip(wph, mframe[0], fframe[0]*mult, float64(sr))
 			inc := fframe[0] / sr
 			ph = math.Mod(ph+inc, 1.0)
 			return out, true
@@ -257,6 +324,7 @@ func FMOsc(wt *Wavetable, freq Stream, mod Stream, index Stream, phase float64)
 		fnext := freq.Mono().Next
 		mnext := mod.Mono().Next
 		inext := index.Mono().Next
+		warp := wt.newWarpReader()
 		p := phase
 		if p < 0.0 || p >= 1.0 {
 			p = 0.0
@@ -277,9 +345,13 @@ func FMOsc(wt *Wavetable, freq Stream, mod Stream, index Stream, phase float64)
 			if !fok {
 				return nil, false
 			}
+			if !warp.next() {
+				return nil, false
+			}
 
 			pmPhase := ph + iframe[0]*mframe[0]
-			out[0] = wt.SampleMip(pmPhase, 0, fframe[0], float64(sr))
+			wph, gain, mult := warp.apply(pmPhase)
+			out[0] = gain * wt.SampleMip(wph, 0, fframe[0]*mult, float64(sr))
 
 			inc := fframe[0] / sr
 			ph = math.Mod(ph+inc, 1.0)
@@ -291,7 +363,7 @@ func FMOsc(wt *Wavetable, freq Stream, mod Stream, index Stream, phase float64)
 func init() {
 	RegisterWord("wt", func(vm *VM) error {
 		v := vm.Pop()
-		wt, err := wavetableFromVal(v)
+		wt, err := vm.wavetableFromVal(v)
 		if err != nil {
 			return err
 		}
@@ -301,7 +373,7 @@ func init() {
 
 	RegisterWord("~wt", func(vm *VM) error {
 		wtVal := vm.Pop()
-		wt, err := wavetableFromVal(wtVal)
+		wt, err := vm.wavetableFromVal(wtVal)
 		if err != nil {
 			return err
 		}
@@ -327,7 +399,7 @@ func init() {
 
 	RegisterWord("~fm", func(vm *VM) error {
 		wtVal := vm.Pop()
-		wt, err := wavetableFromVal(wtVal)
+		wt, err := vm.wavetableFromVal(wtVal)
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/mjibson/go-dsp/fft"
+)
+
+// mipLevelLimit is the highest number of mip levels a wavetable can be
+// configured with.
+const mipLevelLimit = 16
+
+// minMipWaveSize is the size below which waves are not band-limited
+// any further: higher levels reuse the last level at least this size.
+const minMipWaveSize = 16
+
+// smoothRolloffWidth is the fraction of the harmonics kept by a mip
+// level which the smooth rolloff fades out.
+const smoothRolloffWidth = 0.25
+
+// mipStrategy describes how the mip levels of a wavetable are built.
+//
+// Level l keeps the harmonics of the base waves which stay below
+// Nyquist up to an octave above the lowest frequency the level is
+// played at, i.e. size/2^(l+1) of them for base waves of size samples,
+// in waves of size/2^l samples times the oversampling factor.
+type mipStrategy struct {
+	smooth     bool // fade out the highest harmonics instead of cutting them off
+	maxLevel   int  // highest mip level, played from the highest notes up
+	oversample int  // size of the waves of each level relative to the minimum
+}
+
+var defaultMipStrategy = mipStrategy{
+	maxLevel:   MaxMipLevel,
+	oversample: 1,
+}
+
+func (s mipStrategy) String() string {
+	rolloff := "brickwall"
+	if s.smooth {
+		rolloff = "smooth"
+	}
+	return fmt.Sprintf("%s rolloff, %d levels, %dx oversampled", rolloff, s.maxLevel, s.oversample)
+}
+
+// mipStrategyFromEnv returns the mip strategy selected by the :mip/*
+// env vars, and whether :mip/eager asks to build all levels up front.
+func mipStrategyFromEnv(vm *VM) (mipStrategy, bool, error) {
+	s := defaultMipStrategy
+	if v := vm.GetVal(":mip/rolloff"); v != nil {
+		switch v {
+		case Str("brickwall"):
+			s.smooth = false
+		case Str("smooth"):
+			s.smooth = true
+		default:
+			return s, false, fmt.Errorf(`:mip/rolloff must be "brickwall" or "smooth", got %v`, v)
+		}
+	}
+	if v := vm.GetVal(":mip/levels"); v != nil {
+		n, ok := v.(Num)
+		if !ok || n < 0 || n > mipLevelLimit || n != Num(int(n)) {
+			return s, false, fmt.Errorf(":mip/levels must be an integer in 0..%d, got %v", mipLevelLimit, v)
+		}
+		s.maxLevel = int(n)
+	}
+	if v := vm.GetVal(":mip/oversample"); v != nil {
+		switch v {
+		case Num(1), Num(2), Num(4), Num(8):
+			s.oversample = int(v.(Num))
+		default:
+			return s, false, fmt.Errorf(":mip/oversample must be 1, 2, 4 or 8, got %v", v)
+		}
+	}
+	eager := false
+	if v := vm.GetVal(":mip/eager"); v != nil {
+		n, ok := v.(Num)
+		if !ok {
+			return s, false, fmt.Errorf(":mip/eager must be a boolean, got %v", v)
+		}
+		eager = n != 0
+	}
+	return s, eager, nil
+}
+
+// levelSize returns the number of harmonics kept by mip level l of
+// base waves of baseSize samples and the size of its waves, or ok=false
+// if the level would be smaller than minMipWaveSize.
+func (s mipStrategy) levelSize(l, baseSize int) (harmonics, size int, ok bool) {
+	harmonics = baseSize >> (l + 1)
+	size = min(baseSize, 2*harmonics*s.oversample)
+	return harmonics, size, size >= minMipWaveSize
+}
+
+// bandlimitWave resynthesizes a single-cycle wave as size samples
+// holding its first harmonics harmonics (without DC), faded out
+// towards the top with a raised cosine if smooth is set.
+func bandlimitWave(wave *Tape, harmonics, size int, smooth bool) *Tape {
+	nf := wave.nframes
+	x := make([]complex128, nf)
+	for i, smp := range wave.samples[:nf] {
+		x[i] = complex(float64(smp), 0)
+	}
+	X := fft.FFT(x)
+	harmonics = min(harmonics, nf/2, size/2)
+	fadeStart := float64(harmonics)
+	if smooth {
+		fadeStart = float64(harmonics) * (1 - smoothRolloffWidth)
+	}
+	Y := make([]complex128, size)
+	for k := 1; k <= harmonics; k++ {
+		g := 1.0
+		if float64(k) > fadeStart {
+			g = 0.5 * (1 + math.Cos(math.Pi*(float64(k)-fadeStart)/(float64(harmonics)-fadeStart+1)))
+		}
+		if 2*k == size {
+			// the Nyquist bin of the new size holds both halves of the
+			// spectrum, which are two bins at the old size
+			re := real(X[k])
+			if 2*k != nf {
+				re *= 2
+			}
+			Y[k] = complex(re*g, 0)
+			continue
+		}
+		Y[k] = X[k] * complex(g, 0)
+		Y[size-k] = X[nf-k] * complex(g, 0)
+	}
+	y := fft.IFFT(Y)
+	out := makeTape(1, size)
+	// fft.IFFT divides by size, the samples of wave were scaled by nf
+	scale := float64(size) / float64(nf)
+	for i := range size {
+		out.samples[i] = Smp(real(y[i]) * scale)
+	}
+	return out
+}
+
+// wavetableFromVal is like the function of the same name, but builds
+// new wavetables with the mip strategy of the :mip/* env vars.
+func (vm *VM) wavetableFromVal(v Val) (*Wavetable, error) {
+	wt, err := wavetableFromVal(v)
+	if err != nil {
+		return nil, err
+	}
+	if wt == v {
+		return wt, nil
+	}
+	strategy, eager, err := mipStrategyFromEnv(vm)
+	if err != nil {
+		return nil, err
+	}
+	if strategy != wt.strategy {
+		wt = newWavetable(wt.mips[0], strategy)
+	}
+	if eager {
+		wt.prebuildLevels()
+	}
+	return wt, nil
+}
+
+// prebuildLevels builds all mip levels of wt in the background, so
+// that oscillators do not have to stop to build one when a note first
+// goes high enough to use it.
+func (wt *Wavetable) prebuildLevels() {
+	go wt.ensureLevel(wt.strategy.maxLevel)
+}
+
+func init() {
+	RegisterGoMethod[*Wavetable]("wt/mips", func(vm *VM, wt *Wavetable) (*Wavetable, error) {
+		strategy, eager, err := mipStrategyFromEnv(vm)
+		if err != nil {
+			return nil, err
+		}
+		result := newWavetable(wt.mips[0], strategy)
+		result.warps = wt.warps
+		if eager {
+			result.prebuildLevels()
+		}
+		return result, nil
+	})
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// monoSum returns t as a mono tape, the mean of its channels.
+func (t *Tape) monoSum() *Tape {
+	if t.nchannels == 1 {
+		return t
+	}
+	mono := makeTape(1, t.nframes)
+	for i := range t.nframes {
+		sum := 0.0
+		for ch := range t.nchannels {
+			sum += t.samples[i*t.nchannels+ch]
+		}
+		mono.samples[i] = sum / float64(t.nchannels)
+	}
+	return mono
+}
+
+// risingZeroCrossing returns the fractional index of the first rising
+// zero crossing of the mono tape t in [start,end), or start if there
+// is none.
+func (t *Tape) risingZeroCrossing(start, end float64) float64 {
+	lo := max(int(math.Ceil(start)), 1)
+	hi := min(int(end), t.nframes)
+	for i := lo; i < hi; i++ {
+		a, b := t.samples[i-1], t.samples[i]
+		if a < 0 && b >= 0 {
+			return float64(i-1) + a/(a-b)
+		}
+	}
+	return start
+}
+
+// ExtractCycles cuts n single cycles of the pitched sound in t, spread
+// evenly across it, and resamples each to size frames. The period of
+// each cycle is the pitch found by Pitch around it, or the median
+// pitch of t where none is found. Cycles start at a rising zero
+// crossing and are tilted to end where they start, so that they loop
+// without a click. The waves are normalized together to a peak of 1.
+func (t *Tape) ExtractCycles(n, size int, minFreq, maxFreq float64) (Waveset, error) {
+	pitches := t.Pitch(minFreq, maxFreq)
+	median := medianPitch(pitches)
+	if median == 0 {
+		return nil, fmt.Errorf("no pitch found in tape")
+	}
+	sr := float64(SampleRate())
+	mono := t.monoSum()
+	waves := make(Waveset, n)
+	frame := Frame{0}
+	peak := 0.0
+	for i := range waves {
+		center := (float64(i) + 0.5) / float64(n) * float64(t.nframes)
+		freq := median
+		if h := int(center) / trackHopSize; h < len(pitches) && pitches[h] > 0 {
+			freq = pitches[h]
+		}
+		period := sr / freq
+		if period >= float64(t.nframes) {
+			return nil, fmt.Errorf("tape is shorter than a cycle")
+		}
+		start := max(center-period/2, 0)
+		start = mono.risingZeroCrossing(start, start+period)
+		start = min(start, float64(t.nframes)-1-period)
+		mono.GetInterpolatedFrameAtIndex(start, frame)
+		first := float64(frame[0])
+		mono.GetInterpolatedFrameAtIndex(start+period, frame)
+		tilt := float64(frame[0]) - first
+		wave := makeTape(1, size)
+		for k := range size {
+			phase := float64(k) / float64(size)
+			mono.GetInterpolatedFrameAtIndex(start+phase*period, frame)
+			v := float64(frame[0]) - tilt*phase
+			wave.samples[k] = v
+			peak = max(peak, math.Abs(v))
+		}
+		waves[i] = wave
+	}
+	if peak > 0 {
+		for _, wave := range waves {
+			for k := range wave.samples {
+				wave.samples[k] /= peak
+			}
+		}
+	}
+	return waves, nil
+}
+
+func init() {
+	RegisterGoMethod[*Tape]("wt/from-sample", func(vm *VM, t *Tape, n int) (*Wavetable, error) {
+		if n < 1 {
+			return nil, fmt.Errorf("expected at least 1 wave, got %d", n)
+		}
+		minFreq, maxFreq, err := getTrackRange(vm)
+		if err != nil {
+			return nil, err
+		}
+		waves, err := t.ExtractCycles(n, DefaultWaveSize, minFreq, maxFreq)
+		if err != nil {
+			return nil, err
+		}
+		v := make(Vec, len(waves))
+		for i, wave := range waves {
+			v[i] = wave
+		}
+		return vm.wavetableFromVal(v)
+	})
+}
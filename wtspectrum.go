@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+
+	"github.com/mjibson/go-dsp/fft"
+)
+
+// waveHarmonics returns the magnitudes of the harmonics of a single
+// cycle wave, the magnitude of harmonic k at index k-1, scaled so that
+// a full scale sine has a magnitude of 1.
+func waveHarmonics(wave *Tape) []float64 {
+	nf := wave.nframes
+	if wave.nchannels != 1 || nf < 2 {
+		return nil
+	}
+	x := make([]complex128, nf)
+	for i, smp := range wave.samples[:nf] {
+		x[i] = complex(float64(smp), 0)
+	}
+	X := fft.FFT(x)
+	harmonics := make([]float64, nf/2)
+	for k := range harmonics {
+		bin := X[k+1]
+		harmonics[k] = 2 * math.Hypot(real(bin), imag(bin)) / float64(nf)
+	}
+	return harmonics
+}
+
+// harmonicPartial is a sine harmonic of a single cycle wave, its phase
+// in cycles.
+type harmonicPartial struct {
+	harmonic   int
+	amp, phase float64
+}
+
+// harmonicPartialsFromVal parses a spectrum given as a Vec of numbers,
+// the amplitude of harmonic k at index k-1, or of [ harmonic amp phase ]
+// vectors, where phase may be left out.
+func harmonicPartialsFromVal(spec Vec) ([]harmonicPartial, error) {
+	partials := make([]harmonicPartial, 0, len(spec))
+	for i, v := range spec {
+		switch v := v.(type) {
+		case Num:
+			partials = append(partials, harmonicPartial{harmonic: i + 1, amp: float64(v)})
+		case Vec:
+			if len(v) < 2 || len(v) > 3 {
+				return nil, fmt.Errorf("expected [ harmonic amp phase ], got %v", v)
+			}
+			nums, err := numsFromVal(v, len(v))
+			if err != nil {
+				return nil, err
+			}
+			k := nums[0]
+			if k < 1 || k != math.Trunc(k) {
+				return nil, fmt.Errorf("harmonic must be a positive integer, got %v", k)
+			}
+			p := harmonicPartial{harmonic: int(k), amp: nums[1]}
+			if len(nums) == 3 {
+				p.phase = nums[2]
+			}
+			partials = append(partials, p)
+		default:
+			return nil, fmt.Errorf("expected an amplitude or [ harmonic amp phase ], got %v", v)
+		}
+	}
+	return partials, nil
+}
+
+// synthesizeHarmonics builds a single cycle wave of size samples as the
+// sum of the sines of partials by inverse FFT. Harmonics which do not
+// fit below the Nyquist frequency of the wave are dropped.
+func synthesizeHarmonics(partials []harmonicPartial, size int) *Tape {
+	Y := make([]complex128, size)
+	for _, p := range partials {
+		k := p.harmonic
+		if 2*k >= size {
+			continue
+		}
+		// amp*sin(2pi(kx+phase)) has the coefficient amp/2i e^(2pi i phase)
+		// at harmonic k and its conjugate at -k; fft.IFFT divides by size
+		c := cmplx.Rect(p.amp*float64(size)/2, 2*math.Pi*p.phase-math.Pi/2)
+		Y[k] += c
+		Y[size-k] += cmplx.Conj(c)
+	}
+	y := fft.IFFT(Y)
+	out := makeTape(1, size)
+	for i := range size {
+		out.samples[i] = Smp(real(y[i]))
+	}
+	return out
+}
+
+// harmonicBandwidth returns the highest harmonic within 60 dB of the
+// strongest one, or 0 if all of them are silent.
+func harmonicBandwidth(harmonics []float64) int {
+	peak := 0.0
+	for _, m := range harmonics {
+		peak = max(peak, m)
+	}
+	if peak == 0 {
+		return 0
+	}
+	for k := len(harmonics) - 1; k >= 0; k-- {
+		if harmonics[k] >= peak*1e-3 {
+			return k + 1
+		}
+	}
+	return 0
+}
+
+// spectrumColumns reduces harmonics to ncols columns, each the
+// strongest of the harmonics it covers, in dB relative to ref mapped to
+// 0..1 over a range of 60 dB.
+func spectrumColumns(harmonics []float64, ref float64, ncols int) []float64 {
+	cols := make([]float64, ncols)
+	if len(harmonics) == 0 || ref == 0 || ncols <= 0 {
+		return cols
+	}
+	for x := range cols {
+		lo := x * len(harmonics) / ncols
+		hi := max((x+1)*len(harmonics)/ncols, lo+1)
+		m := 0.0
+		for _, h := range harmonics[lo:min(hi, len(harmonics))] {
+			m = max(m, h)
+		}
+		if m > 0 {
+			cols[x] = min(max(1+20*math.Log10(m/ref)/60, 0), 1)
+		}
+	}
+	return cols
+}
+
+// levelFreq returns the lowest frequency at which an oscillator over a
+// wavetable with waves of baseWaveSize samples plays mip level (see
+// selectMipLevel).
+func levelFreq(level, baseWaveSize int) float64 {
+	return float64(SampleRate()) / 2 * math.Exp2(float64(level)) / float64(baseWaveSize)
+}
+
+// auditionWave plays a single cycle wave at freq for nframes frames.
+func auditionWave(wave *Tape, freq float64, nframes int) *Tape {
+	out := makeTape(1, nframes)
+	frame := Frame{0}
+	phase := 0.0
+	inc := freq / float64(SampleRate())
+	for i := range nframes {
+		wave.GetInterpolatedFrameAtPhase(phase, frame)
+		out.samples[i] = frame[0]
+		phase = math.Mod(phase+inc, 1)
+	}
+	return out
+}
+
+// mipLevel returns the waves of mip level of wt, building the level if
+// needed.
+func (wt *Wavetable) mipLevel(level int) (Waveset, error) {
+	if level < 0 || level >= len(wt.mips) {
+		return nil, fmt.Errorf("wavetable: mip level %d out of range 0..%d", level, len(wt.mips)-1)
+	}
+	wt.ensureLevel(level)
+	return wt.mips[level], nil
+}
+
+func init() {
+	RegisterGoMethod[*Wavetable]("wt/level", func(wt *Wavetable, level int) (*Wavetable, error) {
+		waves, err := wt.mipLevel(level)
+		if err != nil {
+			return nil, err
+		}
+		return newWavetableFromWaveset(waves)
+	})
+
+	RegisterGoMethod[*Wavetable]("wt/spectrum", func(wt *Wavetable, level, wave int) (Vec, error) {
+		waves, err := wt.mipLevel(level)
+		if err != nil {
+			return nil, err
+		}
+		if wave < 0 || wave >= len(waves) {
+			return nil, fmt.Errorf("wavetable: wave %d out of range 0..%d", wave, len(waves)-1)
+		}
+		var result Vec
+		for _, m := range waveHarmonics(waves[wave]) {
+			result = append(result, Num(m))
+		}
+		return result, nil
+	})
+	RegisterGoMethod[Vec]("wt/harmonics", func(vm *VM, spec Vec) (*Wavetable, error) {
+		partials, err := harmonicPartialsFromVal(spec)
+		if err != nil {
+			return nil, err
+		}
+		return vm.wavetableFromVal(synthesizeHarmonics(partials, DefaultWaveSize))
+	})
+}
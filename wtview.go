@@ -0,0 +1,73 @@
+package main
+
+// maxViewWaves is the number of waves drawn by the wavetable view;
+// larger tables are shown with evenly spaced waves.
+const maxViewWaves = 64
+
+// wtView lays out the waves of a wavetable as a stack of polylines in
+// an oblique projection: the first wave in front at the bottom left,
+// the last one at the back towards the top right.
+type wtView struct {
+	width, height float32
+	depthX        float32 // horizontal offset of the last wave
+	depthY        float32 // vertical offset of the last wave
+	amp           float32 // height of a sample value of 1
+	npoints       int     // points per wave
+}
+
+func makeWtView(width, height float32, npoints int) wtView {
+	depthX := width * 0.25
+	depthY := height * 0.45
+	return wtView{
+		width:   width,
+		height:  height,
+		depthX:  depthX,
+		depthY:  depthY,
+		amp:     (height - depthY) / 2 * 0.9,
+		npoints: max(npoints, 2),
+	}
+}
+
+// project returns the position of point i of a wave with sample value
+// smp at depth z (0 for the first wave, 1 for the last one).
+func (v wtView) project(i int, smp float64, z float64) (x, y float32) {
+	smp = min(max(smp, -1), 1)
+	x = float32(z)*v.depthX + float32(i)/float32(v.npoints-1)*(v.width-v.depthX)
+	y = v.height - (v.height-v.depthY)/2 - float32(z)*v.depthY - float32(smp)*v.amp
+	return x, y
+}
+
+// shownWaves returns the indices of the waves to draw, back to front.
+func shownWaves(n int) []int {
+	step := max(1, (n+maxViewWaves-1)/maxViewWaves)
+	var indices []int
+	for i := n - 1; i >= 0; i -= step {
+		indices = append(indices, i)
+	}
+	return indices
+}
+
+// waveDepth returns the depth of wave i of n.
+func waveDepth(i, n int) float64 {
+	if n <= 1 {
+		return 0
+	}
+	return float64(i) / float64(n-1)
+}
+
+// waveAt samples a single-cycle wave at point i of npoints.
+func waveAt(wave *Tape, i, npoints int) float64 {
+	out := Frame{0}
+	wave.GetInterpolatedFrameAtPhase(float64(i)/float64(npoints), out)
+	return float64(out[0])
+}
+
+// morphAtPoint samples the waves of a level at point i of npoints,
+// crossfading between adjacent waves like the oscillator does.
+func morphAtPoint(waves Waveset, morph float64, i, npoints int) float64 {
+	pos := min(max(morph, 0), 1) * float64(len(waves)-1)
+	i0 := int(pos)
+	i1 := min(i0+1, len(waves)-1)
+	frac := pos - float64(i0)
+	return (1-frac)*waveAt(waves[i0], i, npoints) + frac*waveAt(waves[i1], i, npoints)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// wtWarpKind is a way of bending the phase at which an oscillator reads
+// the waves of a wavetable.
+type wtWarpKind int
+
+const (
+	wtWarpBend wtWarpKind = iota
+	wtWarpPWM
+	wtWarpSync
+	wtWarpFormant
+)
+
+var wtWarpNames = []string{"bend", "pwm", "sync-warp", "formant"}
+
+// maxWarpRatio is the ratio of the sync and formant warps at an amount
+// of 1.
+const maxWarpRatio = 16
+
+// wtWarp is a warp of a wavetable with an amount read per frame.
+type wtWarp struct {
+	kind   wtWarpKind
+	amount Stream
+}
+
+// withWarp returns a wavetable over the waves of wt read through the
+// warps of wt and w. The mip levels of wt built so far are shared,
+// the others are built separately.
+func (wt *Wavetable) withWarp(w wtWarp) *Wavetable {
+	result := newWavetable(wt.mips[0], wt.strategy)
+	wt.mipMu.Lock()
+	built := int(wt.built.Load())
+	copy(result.mips, wt.mips[:built])
+	wt.mipMu.Unlock()
+	result.built.Store(int32(built))
+	result.warps = append(append(result.warps, wt.warps...), w)
+	return result
+}
+
+// warpNames returns the names of the warps of wt, in the order they
+// were added.
+func (wt *Wavetable) warpNames() string {
+	names := make([]string, len(wt.warps))
+	for i, w := range wt.warps {
+		names[i] = wtWarpNames[w.kind]
+	}
+	return strings.Join(names, ",")
+}
+
+// warpReader reads the amounts of the warps of a wavetable during an
+// oscillator run.
+type warpReader struct {
+	kinds   []wtWarpKind
+	nexts   []func() (Frame, bool)
+	amounts []float64
+}
+
+func (wt *Wavetable) newWarpReader() *warpReader {
+	r := &warpReader{
+		kinds:   make([]wtWarpKind, len(wt.warps)),
+		nexts:   make([]func() (Frame, bool), len(wt.warps)),
+		amounts: make([]float64, len(wt.warps)),
+	}
+	for i, w := range wt.warps {
+		r.kinds[i] = w.kind
+		r.nexts[i] = w.amount.Mono().Next
+	}
+	return r
+}
+
+// next reads the amounts of the next frame, false when one of them
+// ends.
+func (r *warpReader) next() bool {
+	for i, next := range r.nexts {
+		frame, ok := next()
+		if !ok {
+			return false
+		}
+		r.amounts[i] = frame[0]
+	}
+	return true
+}
+
+// apply returns the phase the waves are read at for phase (wrapped
+// into [0,1) if there are warps), the gain of the result and the factor
+// by which the warps raise the frequencies of the harmonics, for
+// choosing the mip level. The last warp added to a table is applied
+// first, so that each warp bends the wave of the table it was applied
+// to.
+func (r *warpReader) apply(phase float64) (warped, gain, freqMult float64) {
+	if len(r.kinds) == 0 {
+		return phase, 1, 1
+	}
+	phase -= math.Floor(phase)
+	gain, freqMult = 1, 1
+	for i := len(r.kinds) - 1; i >= 0; i-- {
+		amount := r.amounts[i]
+		switch r.kinds[i] {
+		case wtWarpBend:
+			phase = math.Pow(phase, math.Pow(4, -min(max(amount, -1), 1)))
+		case wtWarpPWM:
+			w := min(max(0.5*(1-amount), 0.01), 0.99)
+			if phase < w {
+				phase = 0.5 * phase / w
+			} else {
+				phase = 0.5 + 0.5*(phase-w)/(1-w)
+			}
+		case wtWarpSync:
+			ratio := math.Pow(maxWarpRatio, min(max(amount, 0), 1))
+			phase = math.Mod(phase*ratio, 1)
+			freqMult *= ratio
+		case wtWarpFormant:
+			ratio := math.Pow(maxWarpRatio, min(max(amount, 0), 1))
+			phase *= ratio
+			if phase >= 1 {
+				phase, gain = 0, 0
+			}
+			freqMult *= ratio
+		}
+	}
+	return phase, gain, freqMult
+}
+
+func registerWarp(name string, kind wtWarpKind) {
+	RegisterWord(name, func(vm *VM) error {
+		amountVal := vm.Pop()
+		amount, err := streamFromVal(amountVal)
+		if err != nil {
+			return fmt.Errorf("%s: amount: %w", name, err)
+		}
+		wt, err := vm.wavetableFromVal(vm.Pop())
+		if err != nil {
+			return err
+		}
+		vm.Push(wt.withWarp(wtWarp{kind: kind, amount: amount}))
+		return nil
+	})
+}
+
+func init() {
+	registerWarp("wt/bend", wtWarpBend)
+	registerWarp("wt/pwm", wtWarpPWM)
+	registerWarp("wt/sync-warp", wtWarpSync)
+	registerWarp("wt/formant", wtWarpFormant)
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// wtWavFrameSize is the size of the waves in wavetable WAV files which
+// do not say otherwise, and of the waves of the files written by
+// wt/save: the convention of Serum, Vital and most other synths.
+const wtWavFrameSize = 2048
+
+const (
+	wavFormatPCM        = 1
+	wavFormatFloat      = 3
+	wavFormatExtensible = 0xfffe
+)
+
+// wavetableWav is the content of a wavetable WAV file.
+type wavetableWav struct {
+	samples   []float64 // mono sum of the channels
+	frameSize int       // from the clm chunk, 0 if there is none
+}
+
+// parseWavetableWav decodes a WAV file of 8, 16, 24 or 32 bit integer
+// or 32 or 64 bit float samples, and the frame size of the clm chunk
+// written by Serum ("<!>2048 ...").
+func parseWavetableWav(data []byte) (*wavetableWav, error) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return nil, fmt.Errorf("not a WAV file")
+	}
+	var (
+		format, nchannels, bits int
+		pcm                     []byte
+		haveFmt, haveData       bool
+		result                  wavetableWav
+	)
+	for pos := 12; pos+8 <= len(data); {
+		id := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		body := data[pos+8 : min(pos+8+size, len(data))]
+		switch id {
+		case "fmt ":
+			if len(body) < 16 {
+				return nil, fmt.Errorf("short fmt chunk")
+			}
+			format = int(binary.LittleEndian.Uint16(body[0:2]))
+			nchannels = int(binary.LittleEndian.Uint16(body[2:4]))
+			bits = int(binary.LittleEndian.Uint16(body[14:16]))
+			if format == wavFormatExtensible && len(body) >= 26 {
+				// the format is in the first two bytes of the sub format GUID
+				format = int(binary.LittleEndian.Uint16(body[24:26]))
+			}
+			haveFmt = true
+		case "data":
+			pcm = body
+			haveData = true
+		case "clm ":
+			text, ok := strings.CutPrefix(string(body), "<!>")
+			if !ok {
+				break
+			}
+			fields := strings.Fields(text)
+			if len(fields) > 0 {
+				if n, err := strconv.Atoi(fields[0]); err == nil && n > 0 {
+					result.frameSize = n
+				}
+			}
+		}
+		pos += 8 + size + size%2
+	}
+	if !haveFmt || !haveData {
+		return nil, fmt.Errorf("missing fmt or data chunk")
+	}
+	if nchannels < 1 {
+		return nil, fmt.Errorf("invalid number of channels: %d", nchannels)
+	}
+	decode, err := wavSampleDecoder(format, bits)
+	if err != nil {
+		return nil, err
+	}
+	bytesPerSample := bits / 8
+	nframes := len(pcm) / (bytesPerSample * nchannels)
+	result.samples = make([]float64, nframes)
+	for i := range nframes {
+		sum := 0.0
+		for ch := range nchannels {
+			offset := (i*nchannels + ch) * bytesPerSample
+			sum += decode(pcm[offset : offset+bytesPerSample])
+		}
+		result.samples[i] = sum / float64(nchannels)
+	}
+	return &result, nil
+}
+
+// wavSampleDecoder returns a function converting a sample of the given
+// format and bit depth to a float in [-1,1].
+func wavSampleDecoder(format, bits int) (func([]byte) float64, error) {
+	switch {
+	case format == wavFormatPCM && bits == 8:
+		return func(b []byte) float64 { return (float64(b[0]) - 128) / 128 }, nil
+	case format == wavFormatPCM && bits == 16:
+		return func(b []byte) float64 { return float64(int16(binary.LittleEndian.Uint16(b))) / (1 << 15) }, nil
+	case format == wavFormatPCM && bits == 24:
+		return func(b []byte) float64 {
+			v := int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24) >> 8
+			return float64(v) / (1 << 23)
+		}, nil
+	case format == wavFormatPCM && bits == 32:
+		return func(b []byte) float64 { return float64(int32(binary.LittleEndian.Uint32(b))) / (1 << 31) }, nil
+	case format == wavFormatFloat && bits == 32:
+		return func(b []byte) float64 { return float64(math.Float32frombits(binary.LittleEndian.Uint32(b))) }, nil
+	case format == wavFormatFloat && bits == 64:
+		return func(b []byte) float64 { return math.Float64frombits(binary.LittleEndian.Uint64(b)) }, nil
+	}
+	return nil, fmt.Errorf("unsupported sample format %d with %d bits", format, bits)
+}
+
+// loadWavetableWav reads the waves of a wavetable WAV file: frames of
+// the size given in its clm chunk, or of wtWavFrameSize samples.
+func loadWavetableWav(path string) (Waveset, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	w, err := parseWavetableWav(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	frameSize := w.frameSize
+	if frameSize == 0 {
+		frameSize = wtWavFrameSize
+	}
+	if len(w.samples) == 0 || len(w.samples)%frameSize != 0 {
+		return nil, fmt.Errorf("%s: %d samples are not a whole number of %d sample waves", path, len(w.samples), frameSize)
+	}
+	waves := make(Waveset, len(w.samples)/frameSize)
+	for i := range waves {
+		wave := makeTape(1, frameSize)
+		copy(wave.samples, w.samples[i*frameSize:(i+1)*frameSize])
+		waves[i] = wave
+	}
+	return waves, nil
+}
+
+// encodeWavetableWav encodes waves of the same size as a mono 32 bit
+// float WAV file with a clm chunk giving their size.
+func encodeWavetableWav(waves Waveset) []byte {
+	size := waves[0].nframes
+	clm := []byte(fmt.Sprintf("<!>%d 00000000 wavetable (mixtape)", size))
+	if len(clm)%2 == 1 {
+		clm = append(clm, 0)
+	}
+	ndata := 4 * size * len(waves)
+	var b bytes.Buffer
+	le := func(v any) { binary.Write(&b, binary.LittleEndian, v) }
+	b.WriteString("RIFF")
+	le(uint32(4 + 8 + 16 + 8 + len(clm) + 8 + ndata))
+	b.WriteString("WAVE")
+	b.WriteString("fmt ")
+	le(uint32(16))
+	le(uint16(wavFormatFloat))
+	le(uint16(1)) // channels
+	le(uint32(SampleRate()))
+	le(uint32(4 * SampleRate())) // bytes per second
+	le(uint16(4))                // bytes per frame
+	le(uint16(32))               // bits per sample
+	b.WriteString("clm ")
+	le(uint32(len(clm)))
+	b.Write(clm)
+	b.WriteString("data")
+	le(uint32(ndata))
+	for _, wave := range waves {
+		for _, smp := range wave.samples[:size] {
+			le(float32(smp))
+		}
+	}
+	return b.Bytes()
+}
+
+func init() {
+	RegisterGoMethod[Str]("wt/load", func(vm *VM, path string) (*Wavetable, error) {
+		p, err := resolveTapePath(vm, path)
+		if err != nil {
+			return nil, err
+		}
+		if strings.ToLower(filepath.Ext(p)) != ".wav" {
+			return nil, fmt.Errorf("not a WAV file: %s", p)
+		}
+		waves, err := loadWavetableWav(p)
+		if err != nil {
+			return nil, err
+		}
+		v := make(Vec, len(waves))
+		for i, wave := range waves {
+			v[i] = wave
+		}
+		return vm.wavetableFromVal(v)
+	})
+
+	RegisterGoFunc("wt/save", func(vm *VM, v Val, path string) error {
+		if err := vm.checkSandbox("writing " + path); err != nil {
+			return err
+		}
+		wt, err := vm.wavetableFromVal(v)
+		if err != nil {
+			return err
+		}
+		waves := make(Waveset, len(wt.mips[0]))
+		for i, wave := range wt.mips[0] {
+			if wave.nframes != wtWavFrameSize {
+				wave = bandlimitWave(wave, wtWavFrameSize/2-1, wtWavFrameSize, false)
+			}
+			waves[i] = wave
+		}
+		p, err := expandPath(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(p, encodeWavetableWav(waves), 0o644)
+	})
+}